@@ -0,0 +1,106 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Endpoint is one target in a weighted traffic mix. Method, headers and
+// checks default to (and merge with) the top-level settings.
+type Endpoint struct {
+	Name        string            `json:"name"`
+	URL         string            `json:"url"`
+	Method      string            `json:"method"`
+	Body        string            `json:"body"`
+	BodyFile    string            `json:"body_file"`
+	StreamBody  string            `json:"stream_body"` // size of a generated body streamed chunked
+	ContentType string            `json:"content_type"`
+	Headers     map[string]string `json:"headers"`
+	Weight      float64           `json:"weight"`
+	Checks      []Check           `json:"checks"`
+	Extract     []Extractor       `json:"extract"` // scenario steps only
+	When        string            `json:"when"`    // scenario steps only: a template; the step is skipped when it renders false
+	Before      string            `json:"before"`  // scenario steps only: script function run first, may skip the step
+	After       string            `json:"after"`   // scenario steps only: script function given the response, may fail the step
+	GraphQL     *GraphQLRequest   `json:"graphql"`
+	Multipart   *Multipart        `json:"multipart"`
+}
+
+// Multipart describes a multipart/form-data body of form fields and files,
+// as an upload form sends it. The body is built once and sent as it is.
+type Multipart struct {
+	Fields map[string]string `json:"fields"`
+	Files  []MultipartFile   `json:"files"`
+}
+
+// MultipartFile is a file part, read from Path or, without one, Size
+// random bytes, e.g. "10MB"
+type MultipartFile struct {
+	Field       string `json:"field"` // form field name
+	Path        string `json:"path"`
+	Size        string `json:"size"`
+	Name        string `json:"name"`         // file name sent, default the base of Path
+	ContentType string `json:"content_type"` // detected when empty
+}
+
+// Check validates a response body. Every condition that is set must hold;
+// a failing check turns an otherwise successful response into a failure.
+type Check struct {
+	Contains    string `json:"contains"`
+	NotContains string `json:"not_contains"`
+	Prefix      string `json:"prefix"`
+	Regex       string `json:"regex"`
+	JSONPath    string `json:"json_path"`
+	Equals      any    `json:"equals"` // expected value at JSONPath; only existence is checked when unset
+	MinBytes    int    `json:"min_bytes"`
+	MaxBytes    int    `json:"max_bytes"`
+	Digest      string `json:"digest"` // "sha256:<hex>" of the whole body; md5, sha1 and sha512 work too
+}
+
+// Extractor captures a value from a response into a variable that later
+// scenario steps can use as {{.name}}. Exactly one source must be set.
+type Extractor struct {
+	Name     string `json:"name"`
+	JSONPath string `json:"json_path"`
+	Regex    string `json:"regex"` // first capture group, or the whole match
+	Header   string `json:"header"`
+}
+
+// ParseByteSize parses a size such as "512KB", "10MB" or "1.5GiB". Units
+// are decimal (KB, MB, GB) or binary (KiB, MiB, GiB); a bare number is
+// bytes.
+func ParseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	num := strings.TrimRightFunc(s, func(r rune) bool { return r < '0' || r > '9' && r != '.' })
+	units := map[string]float64{
+		"": 1, "b": 1,
+		"kb": 1e3, "mb": 1e6, "gb": 1e9,
+		"kib": 1 << 10, "mib": 1 << 20, "gib": 1 << 30,
+	}
+	unit, ok := units[strings.ToLower(strings.TrimSpace(s[len(num):]))]
+	n, err := strconv.ParseFloat(num, 64)
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 512KB or 10MiB)", s)
+	}
+	return int64(n * unit), nil
+}
+
+// ParseJSONCheck parses the "$.path=value" form of -expect-json. The value
+// is decoded as JSON when possible and used as a plain string otherwise;
+// without "=" only the path's existence is checked.
+func ParseJSONCheck(s string) Check {
+	path, value, ok := strings.Cut(s, "=")
+	c := Check{JSONPath: strings.TrimSpace(path)}
+	if ok {
+		value = strings.TrimSpace(value)
+		var v any
+		if err := json.Unmarshal([]byte(value), &v); err == nil {
+			c.Equals = v
+		} else {
+			c.Equals = value
+		}
+	}
+	return c
+}
@@ -0,0 +1,134 @@
+package config
+
+// HTTP versions accepted by HTTP_VERSION
+const (
+	HTTPAuto = "auto" // HTTP/2 over TLS when the server offers it, HTTP/1.1 otherwise
+	HTTP1    = "1.1"  // HTTP/1.1 only
+	HTTP2    = "2"    // HTTP/2 only over TLS
+	HTTPH2C  = "h2c"  // HTTP/2 with prior knowledge over cleartext, HTTP/2 over TLS
+	HTTP3    = "3"    // HTTP/3 over QUIC, experimental
+)
+
+// HTTP clients accepted by ENGINE
+const (
+	EngineNetHTTP  = "net/http" // the standard library's client
+	EngineFastHTTP = "fasthttp" // valyala/fasthttp, for plain HTTP/1.1
+)
+
+// Failure categories accepted by RETRY_ON
+const (
+	RetryNetwork = "network" // connection, TLS, DNS, timeout and body read errors
+	Retry5xx     = "5xx"     // HTTP 5xx responses
+	Retry429     = "429"     // HTTP 429, waiting as long as Retry-After asks
+	Retry4xx     = "4xx"     // any other HTTP 4xx response
+	RetryCheck   = "check"   // failed checks, extractors, gRPC, GraphQL and DNS answers
+)
+
+// Circuit breaker actions accepted by BREAKER_ACTION
+const (
+	BreakerAbort    = "abort"    // stop the test
+	BreakerThrottle = "throttle" // hold back new requests for the cool-down, then carry on
+)
+
+// Think time distributions accepted by THINK_DISTRIBUTION
+const (
+	ThinkFixed       = "fixed"       // always ThinkTime
+	ThinkUniform     = "uniform"     // evenly spread between ThinkTime and ThinkTimeMax
+	ThinkExponential = "exponential" // ThinkTime on average, capped at ThinkTimeMax if set
+)
+
+// ProxyEnv as PROXY takes the proxy from HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY
+const ProxyEnv = "env"
+
+// Per-request report formats
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"   // one JSON object per request, with typed fields
+	FormatParquet = "parquet" // the JSONL fields as columns
+)
+
+// Resource guards: how a test that may not fit the container's CPU and
+// memory limits is handled
+const (
+	GuardWarn = "warn" // size GOMAXPROCS and the GC to the limits and warn about the concurrency
+	GuardCap  = "cap"  // as warn, but lower the concurrency to fit the memory limit
+	GuardOff  = "off"  // ignore the container's limits
+)
+
+// Log formats
+const (
+	LogText = "text" // key=value pairs, for reading in a terminal
+	LogJSON = "json" // one JSON object per line, for log aggregators
+)
+
+// Feeder strategies
+const (
+	FeedSequential = "sequential" // each row once, in order; the run ends when rows run out
+	FeedCircular   = "circular"   // in order, wrapping around
+	FeedRandom     = "random"     // a random row for every request
+)
+
+// User-Agent rotations
+const (
+	RotateRequest = "request" // a random User-Agent for every request
+	RotateUser    = "user"    // one per virtual user, taken in turn
+)
+
+// Feeder supplies a row of variables to every request or scenario
+// iteration, for use in templates as {{.column}}. The file is CSV with a
+// header row, or JSON Lines when it ends in .jsonl or .ndjson.
+type Feeder struct {
+	File     string `json:"file"`
+	Strategy string `json:"strategy"`
+}
+
+// Replay file formats
+const (
+	ReplayCapture  = "capture"  // JSON Lines written by loadtester record
+	ReplayHAR      = "har"      // HTTP Archive exported by a browser
+	ReplayCombined = "combined" // nginx or Apache access log, common or combined format
+	ReplayALB      = "alb"      // AWS Application Load Balancer access log
+)
+
+// ReplayConfig replaces the configured requests with recorded traffic,
+// sent against URL in the order and at the pace it was recorded. Speed
+// multiplies the pace; IgnoreTiming sends the requests back to back at
+// the configured concurrency instead.
+type ReplayConfig struct {
+	File         string  `json:"file"`
+	Format       string  `json:"format"`
+	Speed        float64 `json:"speed"`
+	IgnoreTiming bool    `json:"ignore_timing"`
+}
+
+// GRPCConfig switches the test to unary gRPC calls. The request message
+// is the JSON body (templates and feeders apply), encoded to protobuf
+// using the message types in Proto, or those the server describes through
+// gRPC server reflection.
+type GRPCConfig struct {
+	Proto       string   `json:"proto"`
+	ImportPaths []string `json:"import_paths"` // where Proto's imports are looked up, besides its own directory
+	Reflection  bool     `json:"reflection"`   // ask the server for the service instead of reading Proto
+	Method      string   `json:"method"`       // package.Service/Method
+}
+
+// GraphQLRequest describes a GraphQL query or mutation. It is sent as a
+// JSON POST body, and a response with a non-empty "errors" array counts
+// as a failure even when the HTTP status is 200.
+type GraphQLRequest struct {
+	Query         string         `json:"query"`
+	QueryFile     string         `json:"query_file"`
+	Variables     map[string]any `json:"variables"`
+	OperationName string         `json:"operation_name"`
+}
+
+// DNSConfig switches the test to DNS queries sent over UDP to the resolver
+// in a dns://host[:port] URL. Every name is queried for every type, in
+// rotation.
+type DNSConfig struct {
+	Names         []string `json:"names"`
+	NamesFile     string   `json:"names_file"` // one name per line
+	Types         []string `json:"types"`      // default A
+	AllowNXDomain bool     `json:"allow_nxdomain"`
+}
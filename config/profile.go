@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Load patterns selectable via PATTERN
+const (
+	PatternConstant = "constant"
+	PatternStep     = "step"
+	PatternSpike    = "spike"
+)
+
+// Workload models selectable via MODEL
+const (
+	// ModelClosed keeps Concurrency virtual users busy: each sends its next
+	// request only once the previous one completed (and it has thought)
+	ModelClosed = "closed"
+	// ModelOpen launches requests on an arrival schedule, however many are
+	// still in flight
+	ModelOpen = "open"
+	// ModelAuto picks open when an arrival rate is set, closed otherwise
+	ModelAuto = "auto"
+)
+
+// Stage is one segment of a staged load profile. The arrival rate moves
+// linearly from the previous stage's target to Target over Duration; a
+// zero Duration jumps straight to Target.
+type Stage struct {
+	Duration Duration `json:"duration"`
+	Target   float64  `json:"target"`
+}
+
+// ParseStages parses the compact "2m:500,5m:500,1m:0" stage format used by
+// the -stages flag and STAGES env var
+func ParseStages(s string) ([]Stage, error) {
+	var stages []Stage
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, target, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("stage %q must be duration:target", part)
+		}
+		dur, err := time.ParseDuration(d)
+		if err != nil {
+			return nil, fmt.Errorf("stage %q: %w", part, err)
+		}
+		rate, err := strconv.ParseFloat(target, 64)
+		if err != nil {
+			return nil, fmt.Errorf("stage %q: %w", part, err)
+		}
+		stages = append(stages, Stage{Duration: Duration(dur), Target: rate})
+	}
+	return stages, nil
+}
+
+// FormatStages renders stages in the compact flag format
+func FormatStages(stages []Stage) string {
+	parts := make([]string, len(stages))
+	for i, st := range stages {
+		parts[i] = fmt.Sprintf("%s:%g", time.Duration(st.Duration), st.Target)
+	}
+	return strings.Join(parts, ",")
+}
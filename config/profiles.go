@@ -0,0 +1,143 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DecodeProfile decodes a YAML or JSON test definition on top of cfg like
+// Decode, then applies one of the named profiles under its profiles key:
+// profile, or the file's own profile setting when that is empty. A profile
+// holds the same settings as the top level, which is its base, and may
+// extend another profile whose settings it overrides in turn. Settings are
+// merged as they are decoded: values replace those before, lists are
+// replaced whole and headers are added to.
+func DecodeProfile(data []byte, yaml bool, profile string, cfg *Config) error {
+	top, profiles, err := splitProfiles(data, yaml)
+	if err != nil {
+		return err
+	}
+	if err := decodeSettings(top, cfg); err != nil {
+		return err
+	}
+	if profile == "" {
+		if profiles == nil {
+			// A resolved config passed on, e.g. to an agent, names its
+			// profile but no longer has any
+			return nil
+		}
+		profile = cfg.Profile
+	}
+	if profile == "" {
+		return nil
+	}
+	chain, err := profileChain(profiles, profile)
+	if err != nil {
+		return err
+	}
+	for _, name := range chain {
+		settings := profiles[name]
+		delete(settings, "extends")
+		if err := decodeSettings(settings, cfg); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	cfg.Profile = profile
+	return nil
+}
+
+// ProfileNames returns the names of the profiles defined in the config
+// file at path, sorted
+func ProfileNames(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	_, profiles, err := splitProfiles(data, !strings.EqualFold(filepath.Ext(path), ".json"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(profiles) == 0 {
+		return nil, nil
+	}
+	return profileNames(profiles), nil
+}
+
+// splitProfiles decodes a test definition into its top-level settings
+// and its profiles
+func splitProfiles(data []byte, yaml bool) (top map[string]json.RawMessage, profiles map[string]map[string]json.RawMessage, err error) {
+	if yaml {
+		doc, err := parseYAML(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := json.Unmarshal(data, &top); err != nil {
+		return nil, nil, err
+	}
+	if raw, ok := top["profiles"]; ok {
+		if err := json.Unmarshal(raw, &profiles); err != nil {
+			return nil, nil, fmt.Errorf("profiles: each profile must be a map of settings")
+		}
+		delete(top, "profiles")
+	}
+	return top, profiles, nil
+}
+
+// profileChain returns name and the profiles it extends, base first
+func profileChain(profiles map[string]map[string]json.RawMessage, name string) ([]string, error) {
+	var chain []string
+	for name != "" {
+		settings, ok := profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q (defined: %s)", name, strings.Join(profileNames(profiles), ", "))
+		}
+		if slices.Contains(chain, name) {
+			return nil, fmt.Errorf("profile %s extends itself through %s", name, strings.Join(chain, " -> "))
+		}
+		chain = append(chain, name)
+		name = ""
+		if raw, ok := settings["extends"]; ok {
+			if err := json.Unmarshal(raw, &name); err != nil {
+				return nil, fmt.Errorf("profile %s: extends must be a profile name", chain[len(chain)-1])
+			}
+		}
+	}
+	slices.Reverse(chain)
+	return chain, nil
+}
+
+func profileNames(profiles map[string]map[string]json.RawMessage) []string {
+	if len(profiles) == 0 {
+		return []string{"none"}
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// decodeSettings decodes a map of settings on top of cfg, rejecting
+// unknown keys
+func decodeSettings(settings map[string]json.RawMessage, cfg *Config) error {
+	if len(settings) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(cfg)
+}
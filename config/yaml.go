@@ -0,0 +1,406 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a single significant line of a YAML document
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// yamlParser decodes the subset of YAML used by test definitions:
+// block mappings, block sequences, plain/quoted scalars, literal (|) and
+// folded (>) block scalars and simple flow collections ([a, b], {k: v}).
+type yamlParser struct {
+	lines []yamlLine
+	raw   []string
+	pos   int
+}
+
+// parseYAML decodes a YAML document into maps, slices and scalars that
+// encoding/json can marshal.
+func parseYAML(data []byte) (any, error) {
+	p := &yamlParser{raw: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")}
+	for i, l := range p.raw {
+		lead := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+		if strings.ContainsRune(lead, '\t') && strings.TrimSpace(l) != "" {
+			return nil, fmt.Errorf("yaml line %d: tabs are not allowed for indentation", i+1)
+		}
+		text := strings.TrimRight(stripYAMLComment(l), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		p.lines = append(p.lines, yamlLine{num: i, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(p.lines) == 0 {
+		return map[string]any{}, nil
+	}
+	v, err := p.parseNode(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, p.errorf("unexpected content %q", p.lines[p.pos].text)
+	}
+	return v, nil
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	line := 0
+	if p.pos < len(p.lines) {
+		line = p.lines[p.pos].num + 1
+	} else if len(p.lines) > 0 {
+		line = p.lines[len(p.lines)-1].num + 1
+	}
+	return fmt.Errorf("yaml line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// parseNode parses the node starting at the current line
+func (p *yamlParser) parseNode(indent int) (any, error) {
+	l := p.lines[p.pos]
+	if isYAMLSeqItem(l.text) {
+		return p.parseSeq(l.indent)
+	}
+	if _, _, ok := splitYAMLKey(l.text); ok {
+		return p.parseMap(l.indent)
+	}
+	p.pos++
+	return scalarAt(l.text, l.num)
+}
+
+func (p *yamlParser) parseMap(indent int) (any, error) {
+	m := map[string]any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, p.errorf("bad indentation")
+		}
+		if isYAMLSeqItem(l.text) {
+			break
+		}
+		key, rest, ok := splitYAMLKey(l.text)
+		if !ok {
+			return nil, p.errorf("expected key: value, got %q", l.text)
+		}
+		if _, dup := m[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+		v, err := p.parseValue(indent, rest, l.num)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func (p *yamlParser) parseSeq(indent int) (any, error) {
+	seq := []any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent != indent || !isYAMLSeqItem(l.text) {
+			if l.indent > indent {
+				return nil, p.errorf("bad indentation")
+			}
+			break
+		}
+		rest := strings.TrimLeft(l.text[1:], " ")
+		if rest == "" {
+			p.pos++
+			v, err := p.parseValue(indent, "", l.num)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			continue
+		}
+		// Re-read the item content as a node indented past the dash
+		childIndent := indent + len(l.text) - len(rest)
+		if _, _, ok := splitYAMLKey(rest); ok || isYAMLSeqItem(rest) {
+			p.lines[p.pos] = yamlLine{num: l.num, indent: childIndent, text: rest}
+			v, err := p.parseNode(childIndent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			continue
+		}
+		p.pos++
+		v, err := p.parseValue(indent, rest, l.num)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+	}
+	return seq, nil
+}
+
+// parseValue parses the value following "key:" or "-"
+func (p *yamlParser) parseValue(indent int, rest string, num int) (any, error) {
+	if strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">") {
+		return p.parseBlockScalar(indent, rest, num), nil
+	}
+	if rest != "" {
+		return scalarAt(rest, num)
+	}
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if next.indent > indent || (next.indent == indent && isYAMLSeqItem(next.text)) {
+		return p.parseNode(next.indent)
+	}
+	return nil, nil
+}
+
+// parseBlockScalar reads a literal or folded block from the raw lines
+func (p *yamlParser) parseBlockScalar(indent int, header string, num int) string {
+	folded := header[0] == '>'
+	chomp := strings.TrimLeft(header[1:], "0123456789")
+	var body []string
+	blockIndent := -1
+	i := num + 1
+	for ; i < len(p.raw); i++ {
+		line := p.raw[i]
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" {
+			body = append(body, "")
+			continue
+		}
+		ind := len(line) - len(trimmed)
+		if ind <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = ind
+		}
+		if ind < blockIndent {
+			break
+		}
+		body = append(body, strings.TrimRight(line[blockIndent:], " "))
+	}
+	// Skip the parsed lines that belonged to the block
+	for p.pos < len(p.lines) && p.lines[p.pos].num < i {
+		p.pos++
+	}
+	for len(body) > 0 && body[len(body)-1] == "" {
+		body = body[:len(body)-1]
+	}
+	var s string
+	if folded {
+		s = strings.Join(body, " ")
+	} else {
+		s = strings.Join(body, "\n")
+	}
+	if chomp != "-" && s != "" {
+		s += "\n"
+	}
+	return s
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits "key: value" outside of quotes and flow collections
+func splitYAMLKey(text string) (string, string, bool) {
+	if text == "" || text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	}
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case (c == '"' || c == '\'') && i == 0:
+			if i = closingQuote(text, i); i < 0 {
+				return "", "", false
+			}
+		case c == ':' && (i == len(text)-1 || text[i+1] == ' '):
+			key := strings.TrimSpace(text[:i])
+			if uq, err := unquoteYAML(key); err == nil {
+				key = uq
+			}
+			return key, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// stripYAMLComment removes a trailing "# comment" that is not inside quotes
+func stripYAMLComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case (c == '"' || c == '\'') && (i == 0 || strings.ContainsRune(" [{,", rune(line[i-1]))):
+			if i = closingQuote(line, i); i < 0 {
+				// Unterminated, so there is no comment to strip; parsing
+				// the scalar reports it
+				return line
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// closingQuote returns the index of the quote that closes the quoted
+// scalar opening at s[start], or -1 if there is none. A double-quoted
+// scalar escapes with a backslash, a single-quoted one by doubling the
+// quote.
+func closingQuote(s string, start int) int {
+	q := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case s[i] != q:
+		case q == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		default:
+			return i
+		}
+	}
+	return -1
+}
+
+// scalarAt parses the scalar s found on the zero-based line num
+func scalarAt(s string, num int) (any, error) {
+	v, err := parseYAMLScalar(s)
+	if err != nil {
+		return nil, fmt.Errorf("yaml line %d: %w", num+1, err)
+	}
+	return v, nil
+}
+
+func unquoteYAML(s string) (string, error) {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		uq, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid double-quoted string %s", s)
+		}
+		return uq, nil
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return "", fmt.Errorf("not quoted")
+}
+
+// parseYAMLScalar converts a plain, quoted or flow scalar to a Go value
+func parseYAMLScalar(s string) (any, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if s[0] == '[' || s[0] == '{' {
+		v, rest, err := parseYAMLFlow(s)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("trailing content after %q", s)
+		}
+		return v, nil
+	}
+	if s[0] == '"' || s[0] == '\'' {
+		switch end := closingQuote(s, 0); {
+		case end < 0:
+			return nil, fmt.Errorf("unterminated quoted string %s", s)
+		case end < len(s)-1:
+			return nil, fmt.Errorf("trailing content after %s", s[:end+1])
+		}
+		return unquoteYAML(s)
+	}
+	switch s {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "xXnN_") {
+		return f, nil
+	}
+	return s, nil
+}
+
+// parseYAMLFlow parses an inline [..] or {..} collection and returns the
+// remaining unparsed input
+func parseYAMLFlow(s string) (any, string, error) {
+	s = strings.TrimLeft(s, " ")
+	if s == "" {
+		return nil, s, fmt.Errorf("unexpected end of flow collection")
+	}
+	switch s[0] {
+	case '[':
+		seq := []any{}
+		s = strings.TrimLeft(s[1:], " ")
+		for {
+			if strings.HasPrefix(s, "]") {
+				return seq, s[1:], nil
+			}
+			v, rest, err := parseYAMLFlow(s)
+			if err != nil {
+				return nil, s, err
+			}
+			seq = append(seq, v)
+			s = strings.TrimLeft(rest, " ")
+			if strings.HasPrefix(s, ",") {
+				s = strings.TrimLeft(s[1:], " ")
+			} else if !strings.HasPrefix(s, "]") {
+				return nil, s, fmt.Errorf("expected , or ] in flow sequence")
+			}
+		}
+	case '{':
+		m := map[string]any{}
+		s = strings.TrimLeft(s[1:], " ")
+		for {
+			if strings.HasPrefix(s, "}") {
+				return m, s[1:], nil
+			}
+			end := strings.IndexByte(s, ':')
+			if end < 0 {
+				return nil, s, fmt.Errorf("expected key: value in flow mapping")
+			}
+			key := strings.TrimSpace(s[:end])
+			if uq, err := unquoteYAML(key); err == nil {
+				key = uq
+			}
+			v, rest, err := parseYAMLFlow(s[end+1:])
+			if err != nil {
+				return nil, s, err
+			}
+			m[key] = v
+			s = strings.TrimLeft(rest, " ")
+			if strings.HasPrefix(s, ",") {
+				s = strings.TrimLeft(s[1:], " ")
+			} else if !strings.HasPrefix(s, "}") {
+				return nil, s, fmt.Errorf("expected , or } in flow mapping")
+			}
+		}
+	}
+	// Scalar inside a flow collection ends at , ] or } outside quotes
+	end := len(s)
+	if s[0] == '"' || s[0] == '\'' {
+		if i := closingQuote(s, 0); i >= 0 {
+			end = i + 1
+		}
+	} else if i := strings.IndexAny(s, ",]}"); i >= 0 {
+		end = i
+	}
+	v, err := parseYAMLScalar(strings.TrimSpace(s[:end]))
+	return v, s[end:], err
+}
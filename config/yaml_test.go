@@ -0,0 +1,107 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want any
+	}{
+		{
+			name: "plain scalars",
+			doc:  "n: 3\nf: 1.5\nb: true\nnil: ~\ns: hello world\nhex: 0x1F\n",
+			want: map[string]any{"n": int64(3), "f": 1.5, "b": true, "nil": nil, "s": "hello world", "hex": "0x1F"},
+		},
+		{
+			name: "single quotes",
+			doc:  "q: 'it''s # not a comment'\nr: 'a: b'\n",
+			want: map[string]any{"q": "it's # not a comment", "r": "a: b"},
+		},
+		{
+			name: "double quotes",
+			doc:  `q: "say \"hi\" # x"` + "\n" + `r: "tab\there"` + "\n",
+			want: map[string]any{"q": `say "hi" # x`, "r": "tab\there"},
+		},
+		{
+			name: "quoted keys",
+			doc:  "'it''s': 1\n\"a: b\": 2\n",
+			want: map[string]any{"it's": int64(1), "a: b": int64(2)},
+		},
+		{
+			name: "comments",
+			doc:  "# leading\nurl: http://x/#frag # trailing\nn: 1 # one\n   # indented\n",
+			want: map[string]any{"url": "http://x/#frag", "n": int64(1)},
+		},
+		{
+			name: "nested",
+			doc:  "---\na:\n  b:\n    - 1\n    - c: d\n      e: f\n  g: [1, 'x, y', {h: i}]\n",
+			want: map[string]any{"a": map[string]any{
+				"b": []any{int64(1), map[string]any{"c": "d", "e": "f"}},
+				"g": []any{int64(1), "x, y", map[string]any{"h": "i"}},
+			}},
+		},
+		{
+			name: "sequence at key indentation",
+			doc:  "a:\n- 1\n- 2\nb: 3\n",
+			want: map[string]any{"a": []any{int64(1), int64(2)}, "b": int64(3)},
+		},
+		{
+			name: "literal block",
+			doc:  "body: |\n  {\"a\": 1}\n  # kept\n\n  end\nnext: 1\n",
+			want: map[string]any{"body": "{\"a\": 1}\n# kept\n\nend\n", "next": int64(1)},
+		},
+		{
+			name: "folded block stripped",
+			doc:  "q: >-\n  one\n  two\n",
+			want: map[string]any{"q": "one two"},
+		},
+		{
+			name: "empty",
+			doc:  "# nothing\n",
+			want: map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{name: "tab indentation", doc: "a:\n\tb: 1\n", want: "yaml line 2: tabs are not allowed"},
+		{name: "over-indented key", doc: "a: 1\n  b: 2\n", want: "yaml line 2: bad indentation"},
+		{name: "over-indented item", doc: "a:\n  - 1\n    - 2\n", want: "yaml line 3: bad indentation"},
+		{name: "duplicate key", doc: "a: 1\na: 2\n", want: `yaml line 2: duplicate key "a"`},
+		{name: "not a mapping", doc: "a: 1\njust text\n", want: `yaml line 2: expected key: value`},
+		{name: "unterminated quote", doc: "a: 1\nb: 'open\n", want: "yaml line 2: unterminated quoted string"},
+		{name: "trailing after quote", doc: "a: 'x' y\n", want: "yaml line 1: trailing content after 'x'"},
+		{name: "bad escape", doc: "\nq: \"\\q\"\n", want: "yaml line 2: invalid double-quoted string"},
+		{name: "unclosed flow", doc: "a: 1\nb: [1, 2\n", want: "yaml line 2: "},
+		{name: "flow trailing content", doc: "a: [1] x\n", want: "yaml line 1: trailing content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML([]byte(tt.doc))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to start with %q", err, tt.want)
+			}
+		})
+	}
+}
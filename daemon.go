@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/runner"
+)
+
+// scheduledTest is a profile of the daemon's config file with a schedule
+type scheduledTest struct {
+	name string
+	cfg  config.Config
+	cron *config.Cron
+	next time.Time
+}
+
+// runDaemon runs the scheduled profiles of a config file on their
+// schedules until the process is stopped and returns the process exit
+// code
+func runDaemon(args []string) int {
+	fs := flag.NewFlagSet("loadtester daemon", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: loadtester daemon -config file [-- test flags]")
+		fs.PrintDefaults()
+	}
+	path := fs.String("config", config.GetEnv("CONFIG", ""), "config file whose profiles with a schedule are run (env CONFIG)")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if *path == "" {
+		fs.Usage()
+		return 2
+	}
+	tests, err := loadSchedules(*path, fs.Args())
+	if err != nil {
+		slog.Error("daemon failed", "err", err)
+		return 2
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for _, t := range tests {
+		fmt.Printf("Scheduled %s (%s), next at %s\n", t.name, t.cfg.Schedule, t.next.Format(time.DateTime))
+	}
+	for {
+		// One test runs at a time; one that came due meanwhile starts
+		// as soon as the other finished
+		var due *scheduledTest
+		for _, t := range tests {
+			if !t.next.IsZero() && (due == nil || t.next.Before(due.next)) {
+				due = t
+			}
+		}
+		if due == nil {
+			fmt.Println("No scheduled test will run again")
+			return 0
+		}
+		select {
+		case <-time.After(time.Until(due.next)):
+		case <-ctx.Done():
+			fmt.Println("Daemon stopped")
+			return 0
+		}
+		runScheduled(ctx, due)
+		due.next = due.cron.Next(time.Now())
+		if !due.next.IsZero() {
+			fmt.Printf("Next run of %s at %s\n", due.name, due.next.Format(time.DateTime))
+		}
+	}
+}
+
+// loadSchedules loads every profile of the config file at path, or its
+// base settings if it has none, and keeps those with a schedule. args are
+// applied to each as on the command line.
+func loadSchedules(path string, args []string) ([]*scheduledTest, error) {
+	names, err := config.ProfileNames(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		names = []string{""}
+	}
+	var tests []*scheduledTest
+	for _, name := range names {
+		cfg, err := config.Load(append([]string{"-config", path, "-profile", name}, args...))
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Schedule == "" {
+			continue
+		}
+		cron, err := config.ParseCron(cfg.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		if _, err := runner.New(cfg); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		t := &scheduledTest{name: name, cfg: cfg, cron: cron, next: cron.Next(time.Now())}
+		if name == "" {
+			t.name = path
+		}
+		tests = append(tests, t)
+	}
+	if len(tests) == 0 {
+		return nil, fmt.Errorf("%s has no profile with a schedule", path)
+	}
+	return tests, nil
+}
+
+// runScheduled runs one scheduled test, printing its progress and outcome.
+// Its reports are written, uploaded and announced as its settings say.
+func runScheduled(ctx context.Context, t *scheduledTest) {
+	fmt.Printf("%s: starting %s\n", time.Now().Format(time.DateTime), t.name)
+	r, err := runner.New(t.cfg)
+	if err != nil {
+		slog.Error("invalid configuration", "test", t.name, "err", err)
+		return
+	}
+	r.Out = os.Stdout
+	out, err := r.Run(ctx)
+	if err != nil {
+		slog.Error("scheduled test failed", "test", t.name, "err", err)
+		return
+	}
+	outcome := "passed"
+	switch {
+	case out.Aborted != "":
+		outcome = "aborted: " + out.Aborted
+	case !out.Passed:
+		outcome = "failed its thresholds"
+	case out.Interrupted:
+		outcome = "interrupted"
+	}
+	fmt.Printf("%s: %s %s, %d requests, %d failed, p95 %d ms, report %s\n", time.Now().Format(time.DateTime),
+		t.name, outcome, out.Total.Sent, out.Total.Failed, out.Total.Percentile(0.95), out.CSVFile)
+}
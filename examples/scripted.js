@@ -0,0 +1,17 @@
+// Functions the steps of examples/scripted.yaml call. before functions get
+// the iteration's variables, after functions the response and variables.
+
+function checkLogin(res, vars) {
+  if (!res.json().token) throw new Error("no token");
+  vars.token = res.json().token;
+  vars.premium = res.headers["X-Plan"] === "premium";
+}
+
+function pickOrder(vars) {
+  vars.sku = ["A-100", "B-200", "C-300"][Math.floor(Math.random() * 3)];
+  vars.quantity = vars.premium === "true" ? 10 : 1;
+}
+
+function checkOrder(res) {
+  return res.status === 201 && res.json().total > 0;
+}
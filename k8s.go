@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/runner"
+)
+
+// k8sAgentPort is the port the worker pods' agents listen on
+const k8sAgentPort = 7070
+
+// k8sPodTemplate is the default worker pod. activeDeadlineSeconds stops
+// the pod should the coordinator die before deleting it.
+const k8sPodTemplate = `apiVersion: v1
+kind: Pod
+metadata:
+  name: {{.Name}}
+  labels:
+    app.kubernetes.io/name: loadtester-agent
+    loadtester/run: "{{.RunID}}"
+spec:
+  restartPolicy: Never
+  activeDeadlineSeconds: {{.DeadlineSeconds}}
+  containers:
+    - name: agent
+      image: {{.Image}}
+      args: ["agent", "-listen", ":{{.Port}}", "-report-dir", "/tmp/reports"]
+      env:
+        - name: AGENT_TOKEN
+          value: "{{.Token}}"
+      ports:
+        - containerPort: {{.Port}}
+      readinessProbe:
+        httpGet:
+          path: /health
+          port: {{.Port}}
+        periodSeconds: 2
+`
+
+// k8sWorker is what a pod template is rendered with
+type k8sWorker struct {
+	Name            string
+	RunID           string
+	Index           int // from 0
+	Image           string
+	Port            int
+	Token           string // the agent's token, generated for the test
+	DeadlineSeconds int
+}
+
+// k8sCluster is the set of worker pods of a test
+type k8sCluster struct {
+	kubectl   string
+	namespace string
+	pods      []string
+	addrs     []string // where the coordinator reaches each pod's agent
+	forwards  []*exec.Cmd
+}
+
+// runK8s starts worker pods running agents, runs the test distributed
+// over them and deletes them again, returning the process exit code
+func runK8s(args []string) int {
+	fs := flag.NewFlagSet("loadtester k8s", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: loadtester k8s [-workers n] [flags] [-- test options]")
+		fs.PrintDefaults()
+	}
+	workers := fs.Int("workers", 3, "number of worker pods to split the load between")
+	namespace := fs.String("namespace", config.GetEnv("K8S_NAMESPACE", ""), "namespace of the worker pods, default the current context's (env K8S_NAMESPACE)")
+	image := fs.String("image", config.GetEnv("K8S_IMAGE", "loadtester:latest"), "image of the worker pods (env K8S_IMAGE)")
+	tmplFile := fs.String("template", config.GetEnv("K8S_TEMPLATE", ""), "pod manifest template to use instead of the built-in one (env K8S_TEMPLATE)")
+	kubectl := fs.String("kubectl", config.GetEnv("KUBECTL", "kubectl"), "kubectl command to manage the pods with (env KUBECTL)")
+	readyTimeout := fs.Duration("ready-timeout", 5*time.Minute, "how long to wait for the worker pods to become ready")
+	lifetime := fs.Duration("pod-lifetime", 6*time.Hour, "longest a worker pod may run, in case it is not deleted")
+	portForward := fs.Bool("port-forward", os.Getenv("KUBERNETES_SERVICE_HOST") == "", "reach the agents through kubectl port-forward rather than the pod IPs; the default outside a cluster")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if *workers < 1 {
+		slog.Error("k8s: -workers must be at least 1")
+		return 2
+	}
+	tmplText := k8sPodTemplate
+	if *tmplFile != "" {
+		data, err := os.ReadFile(*tmplFile)
+		if err != nil {
+			slog.Error("k8s failed", "err", err)
+			return 2
+		}
+		tmplText = string(data)
+	}
+	tmpl, err := template.New("pod").Option("missingkey=error").Parse(tmplText)
+	if err != nil {
+		slog.Error("k8s: invalid pod template", "err", err)
+		return 2
+	}
+	cfg, err := config.Load(fs.Args())
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		slog.Error("invalid configuration", "err", err)
+		return 2
+	}
+	if len(cfg.Agents) > 0 {
+		slog.Error("invalid configuration: k8s starts its own agents, so agents cannot be set")
+		return 2
+	}
+	cfg.AgentToken = crand.Text()
+	// Check the test before starting any pod
+	check := cfg.Clone()
+	check.Agents = make([]string, *workers)
+	if _, err := runner.New(check); err != nil {
+		slog.Error("invalid configuration", "err", err)
+		return 2
+	}
+
+	var manifests bytes.Buffer
+	cl := &k8sCluster{kubectl: *kubectl, namespace: *namespace}
+	runID := fmt.Sprintf("%06x", rand.Uint32()&0xffffff)
+	for i := range *workers {
+		w := k8sWorker{
+			Name:            fmt.Sprintf("loadtester-%s-%d", runID, i),
+			RunID:           runID,
+			Index:           i,
+			Image:           *image,
+			Port:            k8sAgentPort,
+			Token:           cfg.AgentToken,
+			DeadlineSeconds: int(lifetime.Seconds()),
+		}
+		manifests.WriteString("---\n")
+		if err := tmpl.Execute(&manifests, w); err != nil {
+			slog.Error("k8s: invalid pod template", "err", err)
+			return 2
+		}
+		manifests.WriteString("\n")
+		cl.pods = append(cl.pods, w.Name)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cl.cleanup()
+	err = cl.start(ctx, manifests.Bytes(), *readyTimeout, *portForward)
+	// From here the test handles interrupts itself
+	stop()
+	if err != nil {
+		slog.Error("k8s failed", "err", err)
+		return 1
+	}
+	cfg.Agents = cl.addrs
+	return runConfig(cfg)
+}
+
+// start creates the pods, waits until their agents are ready and finds
+// the address of each
+func (cl *k8sCluster) start(ctx context.Context, manifests []byte, readyTimeout time.Duration, portForward bool) error {
+	fmt.Printf("Starting %d worker pods\n", len(cl.pods))
+	if _, err := cl.run(ctx, manifests, "apply", "-f", "-"); err != nil {
+		return err
+	}
+	args := []string{"wait", "--for=condition=Ready", "--timeout=" + readyTimeout.String()}
+	for _, pod := range cl.pods {
+		args = append(args, "pod/"+pod)
+	}
+	if _, err := cl.run(ctx, nil, args...); err != nil {
+		return fmt.Errorf("worker pods not ready: %w", err)
+	}
+	if portForward {
+		for _, pod := range cl.pods {
+			addr, err := cl.forward(ctx, pod)
+			if err != nil {
+				return err
+			}
+			cl.addrs = append(cl.addrs, addr)
+		}
+	} else {
+		for _, pod := range cl.pods {
+			ip, err := cl.run(ctx, nil, "get", "pod", pod, "-o", "jsonpath={.status.podIP}")
+			if err != nil {
+				return err
+			}
+			cl.addrs = append(cl.addrs, net.JoinHostPort(strings.TrimSpace(ip), fmt.Sprint(k8sAgentPort)))
+		}
+	}
+	fmt.Printf("Worker pods ready: %s\n", strings.Join(cl.pods, ", "))
+	return nil
+}
+
+// forward starts kubectl port-forward to a pod's agent and returns the
+// local address it listens on
+func (cl *k8sCluster) forward(ctx context.Context, pod string) (string, error) {
+	cmd := exec.Command(cl.kubectl, cl.args("port-forward", "pod/"+pod, fmt.Sprintf("127.0.0.1::%d", k8sAgentPort))...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	cl.forwards = append(cl.forwards, cmd)
+	// kubectl prints "Forwarding from 127.0.0.1:41235 -> 7070" once
+	// it listens
+	lines := make(chan string, 1)
+	go func() {
+		sc := bufio.NewScanner(out)
+		if sc.Scan() {
+			lines <- sc.Text()
+		}
+		close(lines)
+		for sc.Scan() {
+		}
+	}()
+	select {
+	case line, ok := <-lines:
+		_, addr, found := strings.Cut(line, "Forwarding from ")
+		addr, _, _ = strings.Cut(addr, " ->")
+		if !ok || !found {
+			return "", fmt.Errorf("port-forward to %s failed", pod)
+		}
+		return addr, nil
+	case <-time.After(30 * time.Second):
+		return "", fmt.Errorf("port-forward to %s timed out", pod)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// cleanup stops the port forwards and deletes the pods without waiting
+// for them to terminate
+func (cl *k8sCluster) cleanup() {
+	for _, cmd := range cl.forwards {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	if len(cl.pods) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	args := append([]string{"delete", "pod", "--wait=false", "--ignore-not-found"}, cl.pods...)
+	if _, err := cl.run(ctx, nil, args...); err != nil {
+		slog.Error("k8s: failed to delete the worker pods", "pods", strings.Join(cl.pods, " "), "err", err)
+		return
+	}
+	fmt.Printf("Deleted %d worker pods\n", len(cl.pods))
+}
+
+// run runs kubectl with stdin and returns its output
+func (cl *k8sCluster) run(ctx context.Context, stdin []byte, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, cl.kubectl, cl.args(args...)...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("kubectl %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("kubectl %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+func (cl *k8sCluster) args(args ...string) []string {
+	if cl.namespace != "" {
+		return append([]string{"--namespace", cl.namespace}, args...)
+	}
+	return args
+}
@@ -0,0 +1,141 @@
+package loadgen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// combinedLine matches the common and combined log formats of nginx and
+// Apache: client, user, [time], "request", status, size and optionally
+// "referer" "user-agent"
+var combinedLine = regexp.MustCompile(`^\S+ \S+ \S+ \[([^\]]+)\] "((?:[^"\\]|\\.)*)" \S+ \S+(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?`)
+
+// readCombinedLog parses an nginx or Apache access log in the common or
+// combined format
+func readCombinedLog(data []byte) ([]captureEntry, error) {
+	return readAccessLog(data, func(line string) (captureEntry, bool, error) {
+		m := combinedLine.FindStringSubmatch(line)
+		if m == nil {
+			return captureEntry{}, false, fmt.Errorf("not in the common or combined log format")
+		}
+		t, err := time.Parse("02/Jan/2006:15:04:05 -0700", m[1])
+		if err != nil {
+			return captureEntry{}, false, fmt.Errorf("invalid time %q", m[1])
+		}
+		e, ok := logRequest(t, m[2])
+		logHeader(&e, "Referer", m[3])
+		logHeader(&e, "User-Agent", m[4])
+		return e, ok, nil
+	})
+}
+
+// readALBLog parses an AWS Application Load Balancer access log
+func readALBLog(data []byte) ([]captureEntry, error) {
+	return readAccessLog(data, func(line string) (captureEntry, bool, error) {
+		fields := splitLogFields(line)
+		if len(fields) < 14 {
+			return captureEntry{}, false, fmt.Errorf("not in the ALB log format")
+		}
+		t, err := time.Parse(time.RFC3339Nano, fields[1])
+		if err != nil {
+			return captureEntry{}, false, fmt.Errorf("invalid time %q", fields[1])
+		}
+		e, ok := logRequest(t, fields[12])
+		logHeader(&e, "User-Agent", fields[13])
+		return e, ok, nil
+	})
+}
+
+// readAccessLog parses the lines of an access log with parse, which
+// reports whether the line holds a request worth replaying. Logs only
+// have whole seconds, so requests logged in the same second are spread
+// evenly across it rather than sent in a burst.
+func readAccessLog(data []byte, parse func(string) (captureEntry, bool, error)) ([]captureEntry, error) {
+	var entries []captureEntry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		e, ok, err := parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if ok {
+			entries = append(entries, e)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(entries); {
+		j := i + 1
+		for j < len(entries) && entries[j].Time.Equal(entries[i].Time) {
+			j++
+		}
+		if entries[i].Time.Truncate(time.Second).Equal(entries[i].Time) {
+			for k := i; k < j; k++ {
+				entries[k].Time = entries[k].Time.Add(time.Duration(k-i) * time.Second / time.Duration(j-i))
+			}
+		}
+		i = j
+	}
+	return entries, nil
+}
+
+// logRequest builds an entry from the request line of an access log,
+// "GET /path?query HTTP/1.1". Malformed requests, logged as "-" or with
+// raw bytes when a client sent garbage, are not replayed.
+func logRequest(t time.Time, request string) (captureEntry, bool) {
+	parts := strings.Fields(request)
+	if len(parts) < 2 {
+		return captureEntry{}, false
+	}
+	u, err := url.Parse(parts[1])
+	if err != nil || u.Path == "" && u.RawQuery == "" {
+		return captureEntry{}, false
+	}
+	// Absolute URLs, as logged by an ALB, are replayed against the new
+	// base URL too
+	return captureEntry{Time: t, Method: parts[0], URL: u.RequestURI()}, true
+}
+
+// logHeader sets a request header logged in an access log, which uses "-"
+// for missing values
+func logHeader(e *captureEntry, name, value string) {
+	if value == "" || value == "-" {
+		return
+	}
+	if e.Headers == nil {
+		e.Headers = map[string]string{}
+	}
+	e.Headers[name] = strings.ReplaceAll(value, `\"`, `"`)
+}
+
+// splitLogFields splits a log line on spaces, keeping double-quoted
+// fields together without their quotes
+func splitLogFields(line string) []string {
+	var fields []string
+	for line = strings.TrimLeft(line, " "); line != ""; line = strings.TrimLeft(line, " ") {
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return append(fields, line[1:])
+			}
+			fields = append(fields, line[1:end+1])
+			line = line[end+2:]
+			continue
+		}
+		field, rest, _ := strings.Cut(line, " ")
+		fields = append(fields, field)
+		line = rest
+	}
+	return fields
+}
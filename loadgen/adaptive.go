@@ -0,0 +1,121 @@
+package loadgen
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+// adaptiveRate is the arrival rate of an adaptive open-model run. It backs
+// off when the target throttles and climbs back towards Rate while it
+// does not.
+type adaptiveRate struct {
+	mu      sync.Mutex
+	max     float64 // Rate
+	floor   float64 // lowest rate it backs off to
+	backoff float64
+	step    float64 // req/s added each second
+	rate    float64
+	changed time.Time     // of the last back-off or step up
+	cut     time.Time     // requests sent before it were throttled at a higher rate
+	offset  time.Duration // of the next request from the start of the run
+	sent    int
+
+	backoffs  int
+	firstAt   time.Duration // active time of the first back-off
+	firstSent int           // requests sent before it
+}
+
+// resolveAdaptive validates the adaptive rate settings
+func (cfg *Plan) resolveAdaptive() error {
+	if !cfg.AdaptiveRate {
+		return nil
+	}
+	if cfg.Model != config.ModelOpen || cfg.Rate <= 0 || len(cfg.Stages) > 0 || cfg.replay != nil {
+		return fmt.Errorf("adaptive_rate needs the open model with a constant rate and cannot be combined with stages, the spike pattern or a replay")
+	}
+	if cfg.AdaptiveBackoff <= 0 || cfg.AdaptiveBackoff >= 1 {
+		return fmt.Errorf("adaptive_backoff must be between 0 and 1")
+	}
+	if cfg.AdaptiveStep <= 0 || cfg.AdaptiveStep > 1 {
+		return fmt.Errorf("adaptive_step must be more than 0 and at most 1")
+	}
+	return nil
+}
+
+// newAdaptiveRate returns the adaptive rate of a run starting at start, or
+// nil when the rate is fixed
+func newAdaptiveRate(cfg *config.Config, start time.Time) *adaptiveRate {
+	if !cfg.AdaptiveRate {
+		return nil
+	}
+	return &adaptiveRate{
+		max:     cfg.Rate,
+		floor:   min(1, cfg.Rate),
+		backoff: cfg.AdaptiveBackoff,
+		step:    cfg.AdaptiveStep * cfg.Rate,
+		rate:    cfg.Rate,
+		changed: start,
+		cut:     start,
+	}
+}
+
+// next returns the offset of the next request from the start of the run,
+// first stepping the rate up for every second since it last changed
+func (a *adaptiveRate) next(now time.Time) time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rate < a.max {
+		if up := now.Sub(a.changed) / time.Second; up > 0 {
+			a.rate = min(a.max, a.rate+a.step*float64(up))
+			a.changed = a.changed.Add(up * time.Second)
+		}
+	}
+	offset := a.offset
+	a.offset += time.Duration(float64(time.Second) / a.rate)
+	a.sent++
+	return offset
+}
+
+// observe lowers the rate when r was throttled, unless r was sent before
+// the last back-off, and reports the new rate and whether it changed
+func (a *adaptiveRate) observe(r metrics.Result, active time.Duration) (float64, bool) {
+	if !r.Throttled {
+		return 0, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if r.Timestamp.Before(a.cut) {
+		return a.rate, false
+	}
+	now := time.Now()
+	a.rate = max(a.floor, a.rate*a.backoff)
+	a.changed, a.cut = now, now
+	if a.backoffs == 0 {
+		a.firstAt, a.firstSent = active, a.sent
+	}
+	a.backoffs++
+	return a.rate, true
+}
+
+// resumed restarts the climb back up after sending was held for a
+// Retry-After
+func (a *adaptiveRate) resumed() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.changed = time.Now()
+}
+
+// sustainable returns the mean rate requests were sent at since the first
+// back-off, up to active time end, and zero if the rate never backed off
+func (a *adaptiveRate) sustainable(end time.Duration) float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.backoffs == 0 || end <= a.firstAt {
+		return 0
+	}
+	return float64(a.sent-a.firstSent) / (end - a.firstAt).Seconds()
+}
@@ -0,0 +1,56 @@
+package loadgen
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+// TestAdaptiveRetryAfterEndsWithDuration checks that a Retry-After far
+// beyond the run's duration pauses sending only until the run ends
+func TestAdaptiveRetryAfterEndsWithDuration(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name        string
+		backoffMax  time.Duration
+		minBackoffs int
+	}{
+		{name: "capped at the run's end", minBackoffs: 1},
+		// Sending resumes before the run ends and is throttled again
+		{name: "capped at backoff max", backoffMax: 200 * time.Millisecond, minBackoffs: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.URL = srv.URL
+			cfg.Model = config.ModelOpen
+			cfg.Rate = 20
+			cfg.Duration = config.Duration(time.Second)
+			cfg.AdaptiveRate = true
+			cfg.MaxRetries = 0
+			cfg.RetryBackoffMax = config.Duration(tt.backoffMax)
+			plan, err := Compile(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			stats := plan.Run(context.Background(), 1, metrics.NewLive(), nil)
+			if took := time.Since(start); took > 3*time.Second {
+				t.Errorf("run took %v with a duration of 1s", took)
+			}
+			if stats.RateBackoffs < tt.minBackoffs {
+				t.Errorf("rate backed off %d times, want at least %d", stats.RateBackoffs, tt.minBackoffs)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+
+	"LoadTester/config"
+)
+
+// defaultUserAgent is sent unless User-Agents to rotate are configured
+const defaultUserAgent = "Mozilla/5.0 (compatible; LoadTester/1.0; +https://example.com)"
+
+// User-Agents of current browser releases
+const (
+	agentChrome  = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Safari/537.36"
+	agentFirefox = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:144.0) Gecko/20100101 Firefox/144.0"
+	agentSafari  = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/26.0 Safari/605.1.15"
+	agentEdge    = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Safari/537.36 Edg/141.0.0.0"
+	agentAndroid = "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Mobile Safari/537.36"
+	agentIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 18_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/26.0 Mobile/15E148 Safari/604.1"
+)
+
+// userAgentPresets are the names that stand for one or more User-Agents
+var userAgentPresets = map[string][]string{
+	"chrome":  {agentChrome},
+	"firefox": {agentFirefox},
+	"safari":  {agentSafari},
+	"edge":    {agentEdge},
+	"android": {agentAndroid},
+	"iphone":  {agentIPhone},
+	"desktop": {agentChrome, agentFirefox, agentSafari, agentEdge},
+	"mobile":  {agentAndroid, agentIPhone},
+}
+
+// agentKey is the context key of the User-Agent of a request's virtual
+// user
+type agentKey struct{}
+
+// resolveUserAgents expands the presets among the User-Agents to rotate
+func (cfg *Plan) resolveUserAgents() error {
+	agents := cfg.UserAgents
+	if cfg.UserAgentsFile != "" {
+		lines, err := readLines(cfg.UserAgentsFile)
+		if err != nil {
+			return fmt.Errorf("reading user agents: %w", err)
+		}
+		if len(lines) == 0 {
+			return fmt.Errorf("user agents file %s is empty", cfg.UserAgentsFile)
+		}
+		agents = append(append([]string(nil), agents...), lines...)
+	}
+	switch cfg.UserAgentRotation {
+	case "", config.RotateRequest, config.RotateUser:
+	default:
+		return fmt.Errorf("unknown user_agent_rotation %q (want request or user)", cfg.UserAgentRotation)
+	}
+	if len(agents) == 0 {
+		return nil
+	}
+	if cfg.network != "" || cfg.dns != nil {
+		return fmt.Errorf("user_agents need HTTP requests and cannot be combined with socket or DNS mode")
+	}
+	for name := range cfg.Headers {
+		if http.CanonicalHeaderKey(name) == "User-Agent" {
+			return fmt.Errorf("user_agents and a User-Agent header are mutually exclusive")
+		}
+	}
+	for _, a := range agents {
+		if preset, ok := userAgentPresets[a]; ok {
+			cfg.userAgents = append(cfg.userAgents, preset...)
+		} else {
+			cfg.userAgents = append(cfg.userAgents, a)
+		}
+	}
+	return nil
+}
+
+// perUserAgent reports whether each virtual user keeps one User-Agent
+func (cfg *Plan) perUserAgent() bool {
+	return cfg.userAgents != nil && cfg.UserAgentRotation == config.RotateUser
+}
+
+// withUserAgent returns ctx carrying a virtual user's User-Agent, ctx
+// itself when the user has none
+func withUserAgent(ctx context.Context, agent string) context.Context {
+	if agent == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, agentKey{}, agent)
+}
+
+// userAgent returns the User-Agent of a request: its virtual user's, a
+// random one of those rotated, or LoadTester's own
+func (cfg *Plan) userAgent(ctx context.Context) string {
+	if agent, ok := ctx.Value(agentKey{}).(string); ok {
+		return agent
+	}
+	if len(cfg.userAgents) == 0 {
+		return defaultUserAgent
+	}
+	return cfg.userAgents[rand.IntN(len(cfg.userAgents))]
+}
@@ -0,0 +1,52 @@
+package loadgen
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// resolveAuth turns the auth settings into headers sent with every
+// request. Endpoints and scenario steps may still set their own.
+func (cfg *Plan) resolveAuth() error {
+	if cfg.AuthBasic == "" && cfg.AuthBearer == "" && cfg.AuthHeader == "" {
+		return nil
+	}
+	if cfg.network != "" || cfg.dns != nil {
+		return fmt.Errorf("auth settings need HTTP requests and cannot be combined with socket or DNS mode")
+	}
+	if cfg.AuthBasic != "" && cfg.AuthBearer != "" {
+		return fmt.Errorf("auth_basic and auth_bearer are mutually exclusive")
+	}
+	auth := map[string]string{}
+	if cfg.AuthBasic != "" {
+		if !strings.Contains(cfg.AuthBasic, ":") {
+			return fmt.Errorf("auth_basic must be in the form user:password")
+		}
+		auth["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(cfg.AuthBasic))
+	}
+	if cfg.AuthBearer != "" {
+		auth["Authorization"] = "Bearer " + cfg.AuthBearer
+	}
+	if cfg.AuthHeader != "" {
+		name := cfg.AuthHeaderName()
+		_, value, ok := strings.Cut(cfg.AuthHeader, ":")
+		if !ok || name == "" || strings.TrimSpace(value) == "" {
+			return fmt.Errorf("auth_header must be in the form \"Name: value\"")
+		}
+		if _, dup := auth[http.CanonicalHeaderKey(name)]; dup {
+			return fmt.Errorf("auth_header %s is already set by auth_basic or auth_bearer", name)
+		}
+		auth[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	}
+	for name, value := range auth {
+		for set := range cfg.Headers {
+			if strings.EqualFold(set, name) {
+				return fmt.Errorf("header %s is set both by headers and by the auth settings", set)
+			}
+		}
+		cfg.Headers[name] = value
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package loadgen
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+// breaker is the circuit breaker of a run: it tracks the error rate of the
+// requests completed in a sliding window of whole seconds
+type breaker struct {
+	rate    float64
+	min     int
+	start   time.Time
+	seconds []breakerSecond // ring buffer, one slot per second of the window
+}
+
+type breakerSecond struct {
+	sec      int // seconds since start
+	requests int
+	errors   int
+}
+
+// resolveBreaker validates the circuit breaker settings
+func (cfg *Plan) resolveBreaker() error {
+	if cfg.BreakerErrorRate < 0 || cfg.BreakerErrorRate >= 1 {
+		return fmt.Errorf("breaker_error_rate must be between 0 and 1")
+	}
+	if cfg.BreakerErrorRate == 0 {
+		return nil
+	}
+	if cfg.BreakerWindow < config.Duration(time.Second) {
+		return fmt.Errorf("breaker_window must be at least 1s")
+	}
+	if cfg.BreakerCooldown < 0 {
+		return fmt.Errorf("breaker_cooldown must not be negative")
+	}
+	if cfg.BreakerCooldown == 0 {
+		cfg.BreakerCooldown = cfg.BreakerWindow
+	}
+	switch strings.ToLower(cfg.BreakerAction) {
+	case "", config.BreakerAbort:
+		cfg.BreakerAction = config.BreakerAbort
+	case config.BreakerThrottle:
+		cfg.BreakerAction = config.BreakerThrottle
+	default:
+		return fmt.Errorf("unknown breaker_action %q (want abort or throttle)", cfg.BreakerAction)
+	}
+	return nil
+}
+
+// newBreaker returns the circuit breaker for a run starting at start, or
+// nil when it is disabled
+func newBreaker(cfg *config.Config, start time.Time) *breaker {
+	if cfg.BreakerErrorRate <= 0 {
+		return nil
+	}
+	window := int((time.Duration(cfg.BreakerWindow) + time.Second - 1) / time.Second)
+	return &breaker{
+		rate:    cfg.BreakerErrorRate,
+		min:     cfg.BreakerMinRequests,
+		start:   start,
+		seconds: make([]breakerSecond, window),
+	}
+}
+
+// observe records a finished request and returns the error rate over the
+// window and whether it trips the breaker
+func (b *breaker) observe(r metrics.Result, now time.Time) (float64, bool) {
+	sec := int(now.Sub(b.start) / time.Second)
+	slot := &b.seconds[sec%len(b.seconds)]
+	if slot.sec != sec {
+		*slot = breakerSecond{sec: sec}
+	}
+	slot.requests++
+	if r.Error != "" {
+		slot.errors++
+	}
+
+	var requests, errors int
+	for _, s := range b.seconds {
+		if s.sec > sec-len(b.seconds) {
+			requests += s.requests
+			errors += s.errors
+		}
+	}
+	if requests == 0 {
+		return 0, false
+	}
+	rate := float64(errors) / float64(requests)
+	return rate, requests >= b.min && rate > b.rate
+}
+
+// reset forgets the requests seen so far
+func (b *breaker) reset() {
+	clear(b.seconds)
+}
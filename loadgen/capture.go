@@ -0,0 +1,68 @@
+package loadgen
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"LoadTester/metrics"
+)
+
+// resolveCapture validates the capture settings
+func (cfg *Plan) resolveCapture() error {
+	if cfg.CaptureEvery < 0 || cfg.CaptureBody < 0 {
+		return fmt.Errorf("capture_every and capture_body must not be negative")
+	}
+	if cfg.capturing() && (cfg.network != "" || cfg.dns != nil) {
+		return fmt.Errorf("capture and failures need HTTP requests and cannot be combined with socket or DNS mode")
+	}
+	return nil
+}
+
+// capturing reports whether the exchanges of failed requests are kept,
+// for the capture file or the failures file
+func (cfg *Plan) capturing() bool {
+	return cfg.Capture || cfg.Failures
+}
+
+// captures reports whether request id is captured whatever its outcome
+func (cfg *Plan) captures(id int) bool {
+	return cfg.Capture && cfg.CaptureEvery > 0 && id%cfg.CaptureEvery == 0
+}
+
+// newCapture records an attempt for the capture file. resp is nil when no
+// response came back; body holds the start of its body and size the
+// length of all of it. timer is the attempt's.
+func (cfg *Plan) newCapture(req *http.Request, reqBody string, resp *http.Response, body []byte, size int64, timer *phaseTimer) *metrics.Capture {
+	c := &metrics.Capture{
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		RequestHeader: req.Header.Clone(),
+		RequestBody:   []byte(reqBody[:min(len(reqBody), cfg.CaptureBody)]),
+	}
+	c.RemoteAddr, c.LocalAddr = timer.addrs()
+	if req.Host != "" {
+		c.RequestHeader.Set("Host", req.Host)
+	}
+	if resp != nil {
+		c.Proto = resp.Proto
+		c.Status = resp.StatusCode
+		c.ResponseHeader = resp.Header.Clone()
+		c.ResponseBody = bytes.Clone(body[:min(len(body), cfg.CaptureBody)])
+		c.BodySize = size
+	}
+	return c
+}
+
+// headBuffer keeps the first n bytes written to it and drops the rest
+type headBuffer struct {
+	buf []byte
+	n   int
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if room := b.n - len(b.buf); room > 0 {
+		b.buf = append(b.buf, p[:min(len(p), room)]...)
+	}
+	return len(p), nil
+}
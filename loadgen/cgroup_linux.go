@@ -0,0 +1,87 @@
+//go:build linux
+
+package loadgen
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupNoLimit is the smallest cgroup v1 memory limit taken to mean none;
+// the kernel reports "unlimited" as the largest page-aligned int64
+const cgroupNoLimit = 1 << 62
+
+// readContainerLimits returns the CPU and memory limits of the process's
+// cgroup, v2 or v1, zero for those that are not set
+func readContainerLimits() containerLimits {
+	var l containerLimits
+	paths := cgroupPaths()
+	// cgroup v2: one hierarchy, "max" for no limit
+	if v, ok := readCgroupFile(paths[""], "cpu.max"); ok {
+		quota, period, _ := strings.Cut(v, " ")
+		q, err1 := strconv.ParseFloat(quota, 64)
+		p, err2 := strconv.ParseFloat(period, 64)
+		if err1 == nil && err2 == nil && p > 0 {
+			l.CPUs = q / p
+		}
+		if v, ok := readCgroupFile(paths[""], "memory.max"); ok {
+			l.Memory, _ = strconv.ParseInt(v, 10, 64)
+		}
+		return l
+	}
+	// cgroup v1: a hierarchy per controller, -1 for no CPU quota
+	quota, ok1 := readCgroupFile(filepath.Join("cpu", paths["cpu"]), "cpu.cfs_quota_us")
+	period, ok2 := readCgroupFile(filepath.Join("cpu", paths["cpu"]), "cpu.cfs_period_us")
+	if ok1 && ok2 {
+		q, err1 := strconv.ParseFloat(quota, 64)
+		p, err2 := strconv.ParseFloat(period, 64)
+		if err1 == nil && err2 == nil && q > 0 && p > 0 {
+			l.CPUs = q / p
+		}
+	}
+	if v, ok := readCgroupFile(filepath.Join("memory", paths["memory"]), "memory.limit_in_bytes"); ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n < cgroupNoLimit {
+			l.Memory = n
+		}
+	}
+	return l
+}
+
+// cgroupPaths maps each cgroup v1 controller of the process to its cgroup,
+// and "" to its cgroup v2 cgroup
+func cgroupPaths() map[string]string {
+	paths := map[string]string{}
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return paths
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(sc.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, c := range strings.Split(parts[1], ",") {
+			paths[c] = parts[2]
+		}
+	}
+	return paths
+}
+
+// readCgroupFile reads a file of the cgroup at path under /sys/fs/cgroup,
+// or of the hierarchy's root, which is the container's own cgroup when
+// the container has a cgroup namespace
+func readCgroupFile(path, name string) (string, bool) {
+	for _, dir := range []string{filepath.Join("/sys/fs/cgroup", path), "/sys/fs/cgroup/" + strings.SplitN(path, "/", 2)[0]} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return strings.TrimSpace(string(data)), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package loadgen
+
+// readContainerLimits finds no limits where there are no cgroups
+func readContainerLimits() containerLimits {
+	return containerLimits{}
+}
@@ -0,0 +1,148 @@
+package loadgen
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"regexp"
+	"strings"
+
+	"LoadTester/config"
+)
+
+// check is a compiled config.Check
+type check struct {
+	config.Check
+
+	regex *regexp.Regexp
+	path  jsonPath
+	algo  string
+	hash  func() hash.Hash
+	sum   []byte
+}
+
+// digests are the hash functions a check's digest may name
+var digests = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// compileCheck validates a check and prepares its regexp and JSON path
+func compileCheck(cc config.Check) (check, error) {
+	c := check{Check: cc}
+	if c.Contains == "" && c.NotContains == "" && c.Prefix == "" && c.Regex == "" && c.JSONPath == "" && c.MinBytes == 0 && c.MaxBytes == 0 && c.Digest == "" {
+		return c, fmt.Errorf("check has no conditions")
+	}
+	if c.Regex != "" {
+		re, err := regexp.Compile(c.Regex)
+		if err != nil {
+			return c, fmt.Errorf("check regex: %w", err)
+		}
+		c.regex = re
+	}
+	if c.JSONPath != "" {
+		p, err := parseJSONPath(c.JSONPath)
+		if err != nil {
+			return c, err
+		}
+		c.path = p
+	} else if c.Equals != nil {
+		return c, fmt.Errorf("check equals requires json_path")
+	}
+	if c.Digest != "" {
+		algo, sum, _ := strings.Cut(c.Digest, ":")
+		c.algo = strings.ToLower(strings.TrimSpace(algo))
+		c.hash = digests[c.algo]
+		if c.hash == nil {
+			return c, fmt.Errorf("check digest %q: want md5, sha1, sha256 or sha512 followed by \":<hex>\"", c.Digest)
+		}
+		b, err := hex.DecodeString(strings.TrimSpace(sum))
+		if err != nil || len(b) != c.hash().Size() {
+			return c, fmt.Errorf("check digest %q: want %d hex digits after %q", c.Digest, 2*c.hash().Size(), c.algo+":")
+		}
+		c.sum = b
+	}
+	if c.MaxBytes > 0 && c.MinBytes > c.MaxBytes {
+		return c, fmt.Errorf("check min_bytes exceeds max_bytes")
+	}
+	return c, nil
+}
+
+// needsBody reports whether the check inspects the body content rather
+// than just its length
+func (c *check) needsBody() bool {
+	return c.Contains != "" || c.NotContains != "" || c.Prefix != "" || c.regex != nil || c.path != nil || c.hash != nil
+}
+
+// run returns a description of the first failed condition, or "" if the
+// body passes. size is the full body length; body may be nil when no
+// check needs the content.
+func (c *check) run(body []byte, size int64) string {
+	if c.MinBytes > 0 && size < int64(c.MinBytes) {
+		return fmt.Sprintf("body is %d bytes, want at least %d", size, c.MinBytes)
+	}
+	if c.MaxBytes > 0 && size > int64(c.MaxBytes) {
+		return fmt.Sprintf("body is %d bytes, want at most %d", size, c.MaxBytes)
+	}
+	if c.Contains != "" && !bytes.Contains(body, []byte(c.Contains)) {
+		return fmt.Sprintf("body does not contain %q", c.Contains)
+	}
+	if c.NotContains != "" && bytes.Contains(body, []byte(c.NotContains)) {
+		return fmt.Sprintf("body contains %q", c.NotContains)
+	}
+	if c.Prefix != "" && !bytes.HasPrefix(body, []byte(c.Prefix)) {
+		return fmt.Sprintf("body does not start with %q", c.Prefix)
+	}
+	if c.regex != nil && !c.regex.Match(body) {
+		return fmt.Sprintf("body does not match /%s/", c.Regex)
+	}
+	if c.hash != nil {
+		h := c.hash()
+		h.Write(body)
+		if got := h.Sum(nil); !bytes.Equal(got, c.sum) {
+			return fmt.Sprintf("body %s is %x, want %x", c.algo, got, c.sum)
+		}
+	}
+	if c.path != nil {
+		var doc any
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return "body is not valid JSON"
+		}
+		v, ok := c.path.lookup(doc)
+		if !ok {
+			return fmt.Sprintf("%s not found", c.JSONPath)
+		}
+		if c.Equals != nil && !jsonEqual(v, c.Equals) {
+			return fmt.Sprintf("%s is %s, want %s", c.JSONPath, jsonString(v), jsonString(c.Equals))
+		}
+	}
+	return ""
+}
+
+// runChecks applies all checks and returns the first failure
+func runChecks(checks []check, body []byte, size int64) string {
+	for i := range checks {
+		if msg := checks[i].run(body, size); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+// checksNeedBody reports whether any check needs the body content
+func checksNeedBody(checks []check) bool {
+	for i := range checks {
+		if checks[i].needsBody() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package loadgen
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// connLimiter caps the number of connections open at once across all
+// hosts. A dial waits while the cap is reached, until another connection
+// is closed.
+type connLimiter struct {
+	slots chan struct{}
+}
+
+// newConnLimiter returns a limiter for max connections, or nil when max
+// is zero
+func newConnLimiter(max int) *connLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &connLimiter{slots: make(chan struct{}, max)}
+}
+
+// wrap returns dial limited by l; a nil l returns dial unchanged
+func (l *connLimiter) wrap(dial dialFunc) dialFunc {
+	if l == nil {
+		return dial
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			<-l.slots
+			return nil, err
+		}
+		return &limitedConn{Conn: conn, release: sync.OnceFunc(func() { <-l.slots })}, nil
+	}
+}
+
+// limitedConn frees its connection slot when closed
+type limitedConn struct {
+	net.Conn
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.release()
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package loadgen
+
+import "time"
+
+// processCPU cannot measure the CPU time used here
+func processCPU() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,164 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// dialFunc opens a connection, like net.Dialer.DialContext
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dialWith returns the function that opens the plan's connections with d,
+// applying the Unix socket, IP family, address overrides, source
+// addresses and the MaxConns cap
+func (cfg *Plan) dialWith(d *net.Dialer) dialFunc {
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if cfg.UnixSocket != "" {
+			// The URL's host only names the server in the Host header and SNI
+			return d.DialContext(ctx, "unix", cfg.UnixSocket)
+		}
+		network += cfg.IPFamily // tcp4, udp6, ...
+		if len(cfg.sources) > 0 {
+			bound := *d
+			bound.LocalAddr = cfg.nextSource(network, addr)
+			return bound.DialContext(ctx, network, addr)
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+	dial = cfg.conns.wrap(dial)
+	if len(cfg.overrides) == 0 {
+		return dial
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if to, ok := cfg.overrides[strings.ToLower(addr)]; ok {
+			addr = to
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// resolveOverrides parses the RESOLVE entries, host:port:address as in
+// curl's --resolve, into a map from host:port to the address to connect to
+func (cfg *Plan) resolveOverrides() error {
+	cfg.overrides = map[string]string{}
+	for _, entry := range cfg.Resolve {
+		host, rest, ok := cutHost(entry)
+		if !ok {
+			return fmt.Errorf("resolve %q: want host:port:address", entry)
+		}
+		port, ip, ok := strings.Cut(rest, ":")
+		if !ok {
+			return fmt.Errorf("resolve %q: want host:port:address", entry)
+		}
+		ip = strings.Trim(ip, "[]")
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return fmt.Errorf("resolve %q: invalid port %q", entry, port)
+		}
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("resolve %q: %q is not an IP address", entry, ip)
+		}
+		cfg.overrides[net.JoinHostPort(strings.ToLower(host), port)] = net.JoinHostPort(ip, port)
+	}
+	return nil
+}
+
+// cutHost splits s at the first colon, taking a bracketed IPv6 address
+// as a whole and stripping its brackets
+func cutHost(s string) (before, after string, ok bool) {
+	if len(s) > 0 && s[0] == '[' {
+		end := strings.Index(s, "]:")
+		if end < 0 {
+			return "", "", false
+		}
+		return s[1:end], s[end+2:], true
+	}
+	before, after, ok = strings.Cut(s, ":")
+	return before, after, ok && before != "" && after != ""
+}
+
+// resolveSources expands SOURCE_ADDRS, IP addresses or names of network
+// interfaces, into the addresses to bind connections to
+func (cfg *Plan) resolveSources() error {
+	cfg.sources = nil
+	for _, src := range cfg.SourceAddrs {
+		if ip := net.ParseIP(src); ip != nil {
+			cfg.sources = append(cfg.sources, ip)
+			continue
+		}
+		iface, err := net.InterfaceByName(src)
+		if err != nil {
+			return fmt.Errorf("source address %q is neither an IP address nor a network interface", src)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return fmt.Errorf("source interface %s: %w", src, err)
+		}
+		n := len(cfg.sources)
+		for _, a := range addrs {
+			// Link-local IPv6 addresses need a zone and only reach the
+			// local link, so they are left out
+			if ipNet, ok := a.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+				cfg.sources = append(cfg.sources, ipNet.IP)
+			}
+		}
+		if len(cfg.sources) == n {
+			return fmt.Errorf("source interface %s has no usable addresses", src)
+		}
+	}
+	return nil
+}
+
+// nextSource returns the local address for a connection to addr, taking
+// the source addresses in turn. When addr is an IP address or network
+// names an IP version, sources of the other IP family are skipped.
+func (cfg *Plan) nextSource(network, addr string) net.Addr {
+	host, _, _ := net.SplitHostPort(addr)
+	family := network[len(network)-1:] // "4", "6" or "p" for either
+	if to := net.ParseIP(host); to != nil {
+		family = "6"
+		if to.To4() != nil {
+			family = "4"
+		}
+	}
+	var ip net.IP
+	for range cfg.sources {
+		ip = cfg.sources[int(cfg.sourceNext.Add(1)-1)%len(cfg.sources)]
+		if family == "p" || (ip.To4() != nil) == (family == "4") {
+			break
+		}
+	}
+	if strings.HasPrefix(network, "udp") {
+		return &net.UDPAddr{IP: ip}
+	}
+	return &net.TCPAddr{IP: ip}
+}
+
+// resolveIPFamily validates IP_FAMILY
+func (cfg *Plan) resolveIPFamily() error {
+	switch strings.ToLower(cfg.IPFamily) {
+	case "":
+	case "4", "ipv4":
+		cfg.IPFamily = "4"
+	case "6", "ipv6":
+		cfg.IPFamily = "6"
+	default:
+		return fmt.Errorf("ip_family must be 4 or 6, got %q", cfg.IPFamily)
+	}
+	return nil
+}
+
+// resolveUnixSocket validates UNIX_SOCKET
+func (cfg *Plan) resolveUnixSocket() error {
+	switch {
+	case cfg.UnixSocket == "":
+		return nil
+	case cfg.network == "udp" || cfg.dns != nil:
+		return fmt.Errorf("unix_socket only works for HTTP and tcp targets")
+	case cfg.Proxy != "" || len(cfg.Resolve) > 0 || len(cfg.SourceAddrs) > 0:
+		return fmt.Errorf("unix_socket cannot be combined with proxy, resolve or source_addrs")
+	}
+	return nil
+}
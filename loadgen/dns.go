@@ -0,0 +1,235 @@
+package loadgen
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"LoadTester/metrics"
+)
+
+// dnsQueries holds the encoded questions of a DNS test
+type dnsQueries struct {
+	questions []dnsQuestion
+	next      atomic.Uint64
+	allowNX   bool
+}
+
+type dnsQuestion struct {
+	qtype string
+	wire  []byte // question section
+}
+
+// DNS record types by name
+var dnsTypes = map[string]uint16{
+	"A": 1, "NS": 2, "CNAME": 5, "SOA": 6, "PTR": 12, "MX": 15, "TXT": 16,
+	"AAAA": 28, "SRV": 33, "ANY": 255,
+}
+
+// DNS response codes by number
+var dnsRcodes = []string{"NOERROR", "FORMERR", "SERVFAIL", "NXDOMAIN", "NOTIMP", "REFUSED"}
+
+// resolveDNS prepares the queries for a dns:// target
+func (cfg *Plan) resolveDNS() error {
+	cfg.dns = nil
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Scheme != "dns" {
+		if cfg.DNS != nil {
+			return fmt.Errorf("dns names need a dns://resolver:port url")
+		}
+		return nil
+	}
+	if cfg.DNS == nil {
+		return fmt.Errorf("dns targets need names to query")
+	}
+	if len(cfg.Endpoints) > 0 || len(cfg.Scenario) > 0 || cfg.GRPC != nil || cfg.GraphQL != nil || cfg.Multipart != nil || len(cfg.Checks) > 0 {
+		return fmt.Errorf("dns targets cannot be combined with endpoints, a scenario, grpc, graphql, multipart or checks")
+	}
+	if u.Hostname() == "" || u.Path != "" && u.Path != "/" {
+		return fmt.Errorf("dns target %q must be dns://host or dns://host:port", cfg.URL)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "53")
+	}
+	cfg.URL = "dns://" + u.Host
+
+	names := cfg.DNS.Names
+	if cfg.DNS.NamesFile != "" {
+		fileNames, err := readLines(cfg.DNS.NamesFile)
+		if err != nil {
+			return fmt.Errorf("reading dns names: %w", err)
+		}
+		names = append(append([]string(nil), names...), fileNames...)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("dns targets need names to query")
+	}
+	types := cfg.DNS.Types
+	if len(types) == 0 {
+		types = []string{"A"}
+	}
+
+	q := &dnsQueries{allowNX: cfg.DNS.AllowNXDomain}
+	for _, name := range names {
+		for _, t := range types {
+			t = strings.ToUpper(strings.TrimSpace(t))
+			qtype, ok := dnsTypes[t]
+			if !ok {
+				return fmt.Errorf("unknown dns type %q", t)
+			}
+			wire, err := dnsQuestionWire(name, qtype)
+			if err != nil {
+				return err
+			}
+			q.questions = append(q.questions, dnsQuestion{qtype: t, wire: wire})
+		}
+	}
+	cfg.dns = q
+	return nil
+}
+
+// readLines reads a file of one entry per line, skipping blank lines and
+// # comments
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, sc.Err()
+}
+
+// dnsQuestionWire encodes the question section for name and qtype
+func dnsQuestionWire(name string, qtype uint16) ([]byte, error) {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+	if name == "" || len(name) > 253 {
+		return nil, fmt.Errorf("invalid dns name %q", name)
+	}
+	var b []byte
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid dns name %q", name)
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	b = append(b, 0)
+	b = binary.BigEndian.AppendUint16(b, qtype)
+	return binary.BigEndian.AppendUint16(b, 1), nil // class IN
+}
+
+// pick returns the next question in rotation
+func (q *dnsQueries) pick() *dnsQuestion {
+	n := q.next.Add(1) - 1
+	return &q.questions[n%uint64(len(q.questions))]
+}
+
+// doDNS sends one query to the resolver, retrying failures as the retry
+// settings allow. Results are grouped by record type.
+func doDNS(ctx context.Context, cfg *Plan, ep *target, id int) metrics.Result {
+	var r metrics.Result
+	r.RequestID = id
+	start := time.Now()
+	r.Timestamp = start
+	q := ep.dns.pick()
+	r.Endpoint = q.qtype
+	addr := strings.TrimPrefix(ep.URL, "dns://")
+	for attempt := 0; cfg.nextAttempt(ctx, attempt, &r, ""); attempt++ {
+		r.Retries = attempt
+		startAttempt(&r)
+		var timer phaseTimer
+		rcode, n, err := cfg.dnsExchange(ctx, addr, q.wire, &timer)
+		done := time.Now()
+		r.Duration = done.Sub(start)
+		r.Phases = timer.phases(done)
+		r.IPFamily = timer.ipFamily()
+		r.NewConn = timer.opened()
+		if err != nil {
+			r.Proto = ""
+			r.DNSRcode = ""
+			r.Error = err.Error()
+			r.ErrorType = classifyError(err)
+			continue
+		}
+		r.Proto = "UDP"
+		r.BytesSent += int64(dnsHeaderSize + len(q.wire))
+		r.BytesReceived += int64(n)
+		r.DNSRcode = rcode
+		if rcode != "NOERROR" && !(rcode == "NXDOMAIN" && ep.dns.allowNX) {
+			r.Error = "DNS " + rcode
+			r.ErrorType = metrics.ErrTypeDNSRcode
+			continue
+		}
+		r.Error = ""
+		r.ErrorType = ""
+		break
+	}
+	finishAttempt(&r)
+	return r
+}
+
+// dnsHeaderSize is the size of the fixed header of a DNS message
+const dnsHeaderSize = 12
+
+// dnsExchange sends a query with a random ID and returns the rcode and
+// size of the matching response. Datagrams with other IDs are ignored.
+func (cfg *Plan) dnsExchange(ctx context.Context, addr string, question []byte, timer *phaseTimer) (string, int, error) {
+	qid := uint16(rand.Uint32())
+	msg := make([]byte, dnsHeaderSize, dnsHeaderSize+len(question))
+	binary.BigEndian.PutUint16(msg[0:], qid)
+	binary.BigEndian.PutUint16(msg[2:], 0x0100) // recursion desired
+	binary.BigEndian.PutUint16(msg[4:], 1)      // one question
+	msg = append(msg, question...)
+
+	timer.mark(&timer.connectStart)
+	conn, err := cfg.dialSocket(ctx, "udp", addr)
+	if err != nil {
+		return "", 0, err
+	}
+	defer conn.Close()
+	timer.mark(&timer.connectDone)
+	timer.gotConn(conn, true)
+	stop := cfg.abortOnCancel(ctx, conn)
+	defer stop()
+	if _, err := conn.Write(msg); err != nil {
+		return "", 0, cancelled(ctx, err)
+	}
+	timer.mark(&timer.wroteRequest)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return "", 0, cancelled(ctx, err)
+		}
+		if n < dnsHeaderSize || binary.BigEndian.Uint16(buf) != qid {
+			continue
+		}
+		timer.mark(&timer.firstByte)
+		flags := binary.BigEndian.Uint16(buf[2:])
+		if flags&0x8000 == 0 {
+			return "", 0, fmt.Errorf("dns reply is not a response")
+		}
+		code := int(flags & 0xf)
+		if code < len(dnsRcodes) {
+			return dnsRcodes[code], n, nil
+		}
+		return fmt.Sprintf("RCODE_%d", code), n, nil
+	}
+}
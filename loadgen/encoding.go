@@ -0,0 +1,109 @@
+package loadgen
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"LoadTester/config"
+)
+
+// resolveEncoding validates ACCEPT_ENCODING and adds it to the headers.
+// With it set, Go no longer asks for gzip and decodes it behind the
+// scenes, so bodies are read as they arrive.
+func (cfg *Plan) resolveEncoding() error {
+	if cfg.AcceptEncoding == "" {
+		if cfg.Decompress {
+			return fmt.Errorf("decompress needs accept_encoding")
+		}
+		return nil
+	}
+	if cfg.network != "" || cfg.dns != nil {
+		return fmt.Errorf("accept_encoding needs HTTP requests and cannot be combined with socket or DNS mode")
+	}
+	encodings := config.SplitList(cfg.AcceptEncoding)
+	for _, e := range encodings {
+		name, _, _ := strings.Cut(e, ";") // e.g. gzip;q=0.8
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case "gzip", "deflate", "br", "zstd", "identity", "*":
+		case "compress":
+			if cfg.Decompress {
+				return fmt.Errorf("decompress supports gzip, deflate, br and zstd, not %s", name)
+			}
+		default:
+			return fmt.Errorf("unknown accept_encoding %q (want gzip, deflate, br, zstd, compress or identity)", name)
+		}
+	}
+	for name := range cfg.Headers {
+		if strings.EqualFold(name, "Accept-Encoding") {
+			return fmt.Errorf("header %s is set both by headers and by accept_encoding", name)
+		}
+	}
+	cfg.AcceptEncoding = strings.Join(encodings, ", ")
+	cfg.Headers["Accept-Encoding"] = cfg.AcceptEncoding
+	return nil
+}
+
+// responseBody returns the reader of resp's body: decoding it when
+// Decompress is set and it is gzip, deflate, br or zstd, in which case
+// wire counts the bytes read as received
+func (cfg *Plan) responseBody(resp *http.Response) (body io.Reader, wire *byteCounter, err error) {
+	if !cfg.Decompress {
+		return resp.Body, nil, nil
+	}
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip", "x-gzip":
+		wire = &byteCounter{r: resp.Body}
+		zr, err := gzip.NewReader(wire)
+		if err != nil {
+			return nil, wire, fmt.Errorf("gzip: %w", err)
+		}
+		return zr, wire, nil
+	case "deflate":
+		wire = &byteCounter{r: resp.Body}
+		return flate.NewReader(wire), wire, nil
+	case "br":
+		wire = &byteCounter{r: resp.Body}
+		return brotli.NewReader(wire), wire, nil
+	case "zstd":
+		wire = &byteCounter{r: resp.Body}
+		// One goroutine-free decoder per body, released once it is read
+		zr, err := zstd.NewReader(wire, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, wire, fmt.Errorf("zstd: %w", err)
+		}
+		return &zstdBody{zr}, wire, nil
+	}
+	return resp.Body, nil, nil
+}
+
+// zstdBody closes its decoder when the body ends or fails to decode
+type zstdBody struct {
+	*zstd.Decoder
+}
+
+func (z *zstdBody) Read(p []byte) (int, error) {
+	n, err := z.Decoder.Read(p)
+	if err != nil {
+		z.Decoder.Close()
+	}
+	return n, err
+}
+
+// byteCounter counts the bytes read through it
+type byteCounter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *byteCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,130 @@
+package loadgen
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+func TestDecompress(t *testing.T) {
+	content := strings.Repeat("compressible content ", 200)
+	encoders := map[string]func(io.Writer) io.WriteCloser{
+		"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"br":   func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+		"zstd": func(w io.Writer) io.WriteCloser {
+			zw, _ := zstd.NewWriter(w)
+			return zw
+		},
+	}
+	for name, encode := range encoders {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw := encode(&buf)
+			io.WriteString(zw, content)
+			zw.Close()
+			encoded := buf.Bytes()
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", name)
+				w.Write(encoded)
+			}))
+			defer srv.Close()
+
+			cfg := config.Default()
+			cfg.URL = srv.URL
+			cfg.AcceptEncoding = name
+			cfg.Decompress = true
+			cfg.Checks = []config.Check{{Contains: "content compressible"}}
+			cfg.Requests, cfg.Concurrency = 1, 1
+			plan, err := Compile(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var results []metrics.Result
+			plan.Run(context.Background(), 1, metrics.NewLive(), func(r metrics.Result) { results = append(results, r) })
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1", len(results))
+			}
+			r := results[0]
+			if r.Error != "" || r.Encoding != name || r.EncodedBytes != int64(len(encoded)) || r.DecodedBytes != int64(len(content)) {
+				t.Errorf("result = %s %d -> %d bytes, error %q; want %s %d -> %d",
+					r.Encoding, r.EncodedBytes, r.DecodedBytes, r.Error, name, len(encoded), len(content))
+			}
+		})
+	}
+}
+
+func TestEncodedBodies(t *testing.T) {
+	content := strings.Repeat("compressible content ", 200)
+	var buf bytes.Buffer
+	zw, _ := zstd.NewWriter(&buf)
+	io.WriteString(zw, content)
+	zw.Close()
+	encoded := buf.Bytes()
+	var accepted string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted = r.Header.Get("Accept-Encoding")
+		switch r.URL.Path {
+		case "/plain":
+			io.WriteString(w, content)
+			return
+		case "/truncated":
+			w.Header().Set("Content-Encoding", "zstd")
+			w.Write(encoded[:len(encoded)/2])
+			return
+		}
+		w.Header().Set("Content-Encoding", "zstd")
+		w.Write(encoded)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		decompress bool
+		want       metrics.Result // Encoding, EncodedBytes, DecodedBytes and ErrorType
+	}{
+		{name: "measured only", want: metrics.Result{Encoding: "zstd"}},
+		{name: "not encoded", path: "/plain", decompress: true, want: metrics.Result{}},
+		{name: "truncated", path: "/truncated", decompress: true, want: metrics.Result{Encoding: "zstd", ErrorType: metrics.ErrTypeTruncated}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.URL = srv.URL + tt.path
+			cfg.AcceptEncoding = "zstd,gzip;q=0.5"
+			cfg.Decompress = tt.decompress
+			cfg.MaxRetries = 0
+			cfg.Requests, cfg.Concurrency = 1, 1
+			plan, err := Compile(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var results []metrics.Result
+			plan.Run(context.Background(), 1, metrics.NewLive(), func(r metrics.Result) { results = append(results, r) })
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1", len(results))
+			}
+			r := results[0]
+			if accepted != "zstd, gzip;q=0.5" {
+				t.Errorf("server was sent Accept-Encoding %q", accepted)
+			}
+			if r.Encoding != tt.want.Encoding || r.ErrorType != tt.want.ErrorType ||
+				tt.want.ErrorType == "" && (r.EncodedBytes != tt.want.EncodedBytes || r.DecodedBytes != tt.want.DecodedBytes) {
+				t.Errorf("result = %q %d -> %d bytes, error type %q (%s); want %q %d -> %d, error type %q",
+					r.Encoding, r.EncodedBytes, r.DecodedBytes, r.ErrorType, r.Error,
+					tt.want.Encoding, tt.want.EncodedBytes, tt.want.DecodedBytes, tt.want.ErrorType)
+			}
+		})
+	}
+}
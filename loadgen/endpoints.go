@@ -0,0 +1,259 @@
+package loadgen
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"LoadTester/config"
+)
+
+// target is a compiled config.Endpoint, ready to send
+type target struct {
+	config.Endpoint
+
+	checks   []check // top-level checks followed by the endpoint's own
+	extract  []extractor
+	when     *template.Template // scenario steps only: the step's condition
+	needBody bool
+	tmpl     *endpointTemplates
+	grpc     *grpcCall // gRPC mode: encodes templated bodies, checks grpc-status
+	graphql  bool      // fail responses that carry GraphQL errors
+	rawBody  bool      // the body is sent as it is, not as a template
+	stream   int64     // size of a generated body streamed in its place
+	network  string    // raw socket mode: "tcp" or "udp"
+	dns      *dnsQueries
+	// header holds the request headers when they are the same for every
+	// request
+	header http.Header
+}
+
+// resolveEndpoints builds the request targets. Without an endpoints list
+// the top-level url, method, body and headers form the only target.
+func (cfg *Plan) resolveEndpoints() error {
+	cfg.targets = nil
+	cfg.cumWeights = nil
+	if len(cfg.Endpoints) == 0 {
+		ep := target{
+			Endpoint: config.Endpoint{
+				URL:         cfg.URL,
+				Method:      cfg.Method,
+				Body:        cfg.Body,
+				StreamBody:  cfg.StreamBody,
+				ContentType: cfg.ContentType,
+				Headers:     cfg.Headers,
+				Weight:      1,
+			},
+			checks: cfg.checks,
+		}
+		if cfg.GraphQL != nil {
+			if err := applyGraphQL(cfg.GraphQL, &ep); err != nil {
+				return err
+			}
+			cfg.Method, cfg.ContentType = ep.Method, ep.ContentType
+		}
+		if cfg.Multipart != nil {
+			if err := applyMultipart(cfg.Multipart, &ep); err != nil {
+				return err
+			}
+			cfg.Method, cfg.ContentType = ep.Method, ep.ContentType
+		}
+		if cfg.StreamBody != "" {
+			if cfg.grpc != nil || cfg.network != "" || cfg.dns != nil || cfg.replay != nil {
+				return fmt.Errorf("stream_body needs HTTP requests and cannot be combined with grpc, replay, socket or DNS mode")
+			}
+			if err := applyStream(&ep); err != nil {
+				return err
+			}
+			cfg.Method, cfg.ContentType = ep.Method, ep.ContentType
+		}
+		ep.Name = ep.Method + " " + ep.URL
+		if cfg.network != "" {
+			ep.network = cfg.network
+			ep.Name = ep.URL
+		}
+		if cfg.dns != nil {
+			ep.dns = cfg.dns
+			ep.Name = ep.URL
+		}
+		ep.URL = cfg.withRandomQuery(ep.URL)
+		ep.needBody = ep.graphql || checksNeedBody(ep.checks)
+		if err := ep.compileTemplates(); err != nil {
+			return err
+		}
+		if cfg.grpc != nil {
+			ep.grpc = cfg.grpc
+			if ep.tmpl == nil || ep.tmpl.body == nil {
+				// A fixed request is encoded once instead of per call
+				body, err := cfg.grpc.frame(ep.Body)
+				if err != nil {
+					return err
+				}
+				ep.Body = body
+			}
+		}
+		cfg.targets = []target{ep}
+		cfg.cumWeights = []float64{1}
+		return nil
+	}
+
+	if cfg.GraphQL != nil {
+		return fmt.Errorf("top-level graphql cannot be combined with endpoints; set graphql per endpoint")
+	}
+	if cfg.Multipart != nil {
+		return fmt.Errorf("top-level multipart cannot be combined with endpoints; set multipart per endpoint")
+	}
+	if cfg.StreamBody != "" {
+		return fmt.Errorf("top-level stream_body cannot be combined with endpoints; set stream_body per endpoint")
+	}
+	var total float64
+	names := map[string]bool{}
+	for i, ep := range cfg.Endpoints {
+		if ep.Weight < 0 {
+			return fmt.Errorf("endpoint %d: weight must not be negative", i+1)
+		}
+		if ep.Weight == 0 {
+			ep.Weight = 1
+		}
+		if len(ep.Extract) > 0 {
+			return fmt.Errorf("endpoint %d: extract is only supported in scenario steps", i+1)
+		}
+		if ep.When != "" {
+			return fmt.Errorf("endpoint %d: when is only supported in scenario steps", i+1)
+		}
+		if ep.Before != "" || ep.After != "" {
+			return fmt.Errorf("endpoint %d: before and after are only supported in scenario steps", i+1)
+		}
+		t, err := cfg.resolveEndpoint(ep, names)
+		if err != nil {
+			return fmt.Errorf("endpoint %d: %w", i+1, err)
+		}
+		total += t.Weight
+		cfg.Endpoints[i] = t.Endpoint
+		cfg.targets = append(cfg.targets, t)
+		cfg.cumWeights = append(cfg.cumWeights, total)
+	}
+	return nil
+}
+
+// resolveEndpoint fills in an endpoint's defaults from the top-level
+// settings, reads its body file and compiles its checks. names holds the
+// names already taken; ep's name is added to it.
+func (cfg *Plan) resolveEndpoint(e config.Endpoint, names map[string]bool) (target, error) {
+	ep := target{Endpoint: e}
+	if ep.URL == "" {
+		return ep, fmt.Errorf("url is required")
+	}
+	if ep.Method == "" {
+		ep.Method = cfg.Method
+	}
+	if ep.GraphQL != nil {
+		if err := applyGraphQL(ep.GraphQL, &ep); err != nil {
+			return ep, err
+		}
+	}
+	if ep.Multipart != nil {
+		if err := applyMultipart(ep.Multipart, &ep); err != nil {
+			return ep, err
+		}
+	}
+	if ep.StreamBody != "" {
+		if err := applyStream(&ep); err != nil {
+			return ep, err
+		}
+	}
+	ep.Method = strings.ToUpper(ep.Method)
+	if ep.Name == "" {
+		ep.Name = ep.Method + " " + endpointPath(ep.URL)
+	}
+	if names[ep.Name] {
+		return ep, fmt.Errorf("duplicate name %q", ep.Name)
+	}
+	names[ep.Name] = true
+	ep.URL = cfg.withRandomQuery(ep.URL)
+
+	headers := map[string]string{}
+	for k, v := range cfg.Headers {
+		headers[k] = v
+	}
+	for k, v := range ep.Headers {
+		headers[k] = v
+	}
+	ep.Headers = headers
+
+	if ep.BodyFile != "" {
+		if ep.Body != "" {
+			return ep, fmt.Errorf("body and body_file are mutually exclusive")
+		}
+		data, err := os.ReadFile(ep.BodyFile)
+		if err != nil {
+			return ep, fmt.Errorf("reading body file: %w", err)
+		}
+		ep.Body = string(data)
+	}
+	if ep.Body != "" && ep.ContentType == "" {
+		ep.ContentType = detectContentType(ep.Body)
+	}
+
+	ep.checks = append([]check(nil), cfg.checks...)
+	for j := range ep.Checks {
+		c, err := compileCheck(ep.Checks[j])
+		if err != nil {
+			return ep, fmt.Errorf("check %d: %w", j+1, err)
+		}
+		ep.checks = append(ep.checks, c)
+	}
+	ep.needBody = ep.graphql || checksNeedBody(ep.checks)
+	for j := range ep.Extract {
+		x, err := compileExtractor(ep.Extract[j])
+		if err != nil {
+			return ep, err
+		}
+		ep.extract = append(ep.extract, x)
+		ep.needBody = ep.needBody || x.needsBody()
+	}
+	if err := ep.compileTemplates(); err != nil {
+		return ep, err
+	}
+	if ep.When != "" {
+		var err error
+		if ep.when, err = compileTemplate("when", ep.When); err != nil {
+			return ep, fmt.Errorf("when: %w", err)
+		}
+		if ep.when == nil {
+			return ep, fmt.Errorf("when must be a template, e.g. {{eq .role \"admin\"}}")
+		}
+	}
+	return ep, nil
+}
+
+// pickEndpoint chooses a target at random in proportion to its weight,
+// or the next recorded request when replaying
+func (cfg *Plan) pickEndpoint() *target {
+	if cfg.replay != nil {
+		return cfg.replay.pick()
+	}
+	if len(cfg.targets) == 1 {
+		return &cfg.targets[0]
+	}
+	x := rand.Float64() * cfg.cumWeights[len(cfg.cumWeights)-1]
+	i := sort.SearchFloat64s(cfg.cumWeights, x)
+	if i == len(cfg.targets) {
+		i--
+	}
+	return &cfg.targets[i]
+}
+
+// endpointPath returns the path and query of a URL for display
+func endpointPath(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Path == "" && u.RawQuery == "" {
+		return raw
+	}
+	return u.RequestURI()
+}
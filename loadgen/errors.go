@@ -0,0 +1,57 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+
+	"LoadTester/metrics"
+)
+
+// classifyError maps a transport error to one of the ErrType categories
+func classifyError(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuth x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var certErr x509.CertificateInvalidError
+	var opErr *net.OpError
+	var limit redirectLimit
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return metrics.ErrTypeCancelled
+	case errors.As(err, &limit):
+		return metrics.ErrTypeRedirects
+	case errors.As(err, &dnsErr):
+		return metrics.ErrTypeDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return metrics.ErrTypeTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return metrics.ErrTypeConnRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return metrics.ErrTypeConnReset
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr),
+		errors.As(err, &unknownAuth), errors.As(err, &hostErr), errors.As(err, &certErr),
+		errors.As(err, &opErr) && opErr.Op == "remote error", // a TLS alert, e.g. a rejected client certificate
+		errors.Is(err, errPinMismatch):
+		return metrics.ErrTypeTLS
+	}
+	return metrics.ErrTypeOther
+}
+
+// classifyStatus returns the error category for a failing HTTP status
+func classifyStatus(code int) string {
+	if code >= 500 {
+		return metrics.ErrTypeHTTP5xx
+	}
+	return metrics.ErrTypeHTTP4xx
+}
@@ -0,0 +1,96 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"LoadTester/config"
+)
+
+// extractor is a compiled config.Extractor
+type extractor struct {
+	config.Extractor
+
+	regex *regexp.Regexp
+	path  jsonPath
+}
+
+// compileExtractor validates an extractor and prepares its regexp or JSON
+// path
+func compileExtractor(ce config.Extractor) (extractor, error) {
+	e := extractor{Extractor: ce}
+	if e.Name == "" {
+		return e, fmt.Errorf("extract: name is required")
+	}
+	sources := 0
+	for _, s := range []string{e.JSONPath, e.Regex, e.Header} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return e, fmt.Errorf("extract %s: set exactly one of json_path, regex or header", e.Name)
+	}
+	var err error
+	switch {
+	case e.JSONPath != "":
+		e.path, err = parseJSONPath(e.JSONPath)
+	case e.Regex != "":
+		e.regex, err = regexp.Compile(e.Regex)
+	}
+	if err != nil {
+		return e, fmt.Errorf("extract %s: %w", e.Name, err)
+	}
+	return e, nil
+}
+
+// needsBody reports whether the extractor reads the response body
+func (e *extractor) needsBody() bool {
+	return e.path != nil || e.regex != nil
+}
+
+// extract returns the captured value, or an error describing why the
+// response did not contain it
+func (e *extractor) extract(header http.Header, body []byte) (string, error) {
+	switch {
+	case e.Header != "":
+		if v := header.Get(e.Header); v != "" {
+			return v, nil
+		}
+		return "", fmt.Errorf("%s: header %s not found", e.Name, e.Header)
+	case e.regex != nil:
+		m := e.regex.FindSubmatch(body)
+		if m == nil {
+			return "", fmt.Errorf("%s: body does not match /%s/", e.Name, e.Regex)
+		}
+		if len(m) > 1 {
+			return string(m[1]), nil
+		}
+		return string(m[0]), nil
+	default:
+		var doc any
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return "", fmt.Errorf("%s: body is not valid JSON", e.Name)
+		}
+		v, ok := e.path.lookup(doc)
+		if !ok {
+			return "", fmt.Errorf("%s: %s not found", e.Name, e.JSONPath)
+		}
+		return jsonString(v), nil
+	}
+}
+
+// runExtractors stores every extracted value in vars, stopping at the
+// first one that fails
+func runExtractors(extractors []extractor, header http.Header, body []byte, vars map[string]string) error {
+	for i := range extractors {
+		v, err := extractors[i].extract(header, body)
+		if err != nil {
+			return err
+		}
+		vars[extractors[i].Name] = v
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// fastTransport sends requests with fasthttp, for plain HTTP/1.1 targets
+// where net/http's allocations limit the rate one generator reaches. As a
+// RoundTripper it keeps redirects, cookies and everything done with the
+// response working as with net/http. fasthttp has no httptrace hooks, so
+// requests sent with it have no phase timings or connection details.
+type fastTransport struct {
+	client    *fasthttp.Client
+	keepAlive bool
+}
+
+// newFastTransport returns a transport whose dials are abandoned once ctx
+// ends, as fasthttp cannot pass them a request's context
+func newFastTransport(ctx context.Context, cfg *Plan, dial dialFunc) *fastTransport {
+	maxConns := cfg.MaxConnsPerHost
+	if maxConns == 0 {
+		// fasthttp's default of 512 would cap the concurrency
+		maxConns = math.MaxInt32
+	}
+	return &fastTransport{
+		keepAlive: cfg.KeepAlive,
+		client: &fasthttp.Client{
+			Dial: func(addr string) (net.Conn, error) {
+				return dial(ctx, "tcp", addr)
+			},
+			TLSConfig:           cfg.tlsConfig,
+			MaxConnsPerHost:     maxConns,
+			MaxIdleConnDuration: time.Duration(cfg.IdleConnTimeout),
+			// Requests wait for a connection under MaxConnsPerHost, as
+			// with net/http, until their deadline
+			MaxConnWaitTimeout:            24 * time.Hour,
+			NoDefaultUserAgentHeader:      true,
+			DisableHeaderNamesNormalizing: true,
+			DisablePathNormalizing:        true,
+		},
+	}
+}
+
+// CloseIdleConnections closes the connections not in use
+func (t *fastTransport) CloseIdleConnections() {
+	t.client.CloseIdleConnections()
+}
+
+// RoundTrip sends req, returning when its context ends even if fasthttp,
+// which knows no contexts, is still waiting for the server. The request
+// then finishes in the background before its buffers are reused.
+func (t *fastTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if err := ctx.Err(); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	freq := fasthttp.AcquireRequest()
+	freq.Header.SetNoDefaultContentType(true)
+	freq.Header.SetMethod(req.Method)
+	freq.SetRequestURI(req.URL.String())
+	if req.Host != "" {
+		freq.Header.SetHost(req.Host)
+		freq.UseHostHeader = true
+	}
+	for name, values := range req.Header {
+		for _, v := range values {
+			freq.Header.Add(name, v)
+		}
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		freq.SetBodyStream(req.Body, int(req.ContentLength))
+	}
+	if !t.keepAlive {
+		freq.SetConnectionClose()
+	}
+
+	fresp := fasthttp.AcquireResponse()
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		if deadline, ok := ctx.Deadline(); ok {
+			err = t.client.DoDeadline(freq, fresp, deadline)
+		} else {
+			err = t.client.Do(freq, fresp)
+		}
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		fasthttp.ReleaseRequest(freq)
+		done <- err
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		go func() {
+			<-done
+			fasthttp.ReleaseResponse(fresp)
+		}()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		fasthttp.ReleaseResponse(fresp)
+		if errors.Is(err, fasthttp.ErrTimeout) {
+			// Classified as a timeout like net/http's errors
+			err = os.ErrDeadlineExceeded
+		}
+		return nil, err
+	}
+
+	code := fresp.StatusCode()
+	reason := string(fresp.Header.StatusMessage())
+	if reason == "" {
+		reason = http.StatusText(code)
+	}
+	resp := &http.Response{
+		Status:        strconv.Itoa(code) + " " + reason,
+		StatusCode:    code,
+		Proto:         string(fresp.Header.Protocol()),
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header, fresp.Header.Len()),
+		ContentLength: int64(len(fresp.Body())),
+		Request:       req,
+	}
+	if resp.Proto == "HTTP/1.0" {
+		resp.ProtoMinor = 0
+	}
+	for name, value := range fresp.Header.All() {
+		resp.Header.Add(string(name), string(value))
+	}
+	resp.Body = &fastBody{Reader: bytes.NewReader(fresp.Body()), resp: fresp}
+	return resp, nil
+}
+
+// fastBody reads a fasthttp response's body, returning the response to
+// its pool once closed
+type fastBody struct {
+	*bytes.Reader
+	resp *fasthttp.Response
+}
+
+func (b *fastBody) Close() error {
+	if b.resp != nil {
+		b.Reader.Reset(nil)
+		fasthttp.ReleaseResponse(b.resp)
+		b.resp = nil
+	}
+	return nil
+}
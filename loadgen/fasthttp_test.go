@@ -0,0 +1,131 @@
+package loadgen
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+func TestFastHTTPEngine(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, r.Method+" "+r.URL.Path+" "+r.Host+" "+r.Header.Get("X-Test")+" "+string(body))
+	}))
+	defer srv.Close()
+
+	cfg := config.Default()
+	cfg.URL = srv.URL + "/old"
+	cfg.Engine = config.EngineFastHTTP
+	cfg.Method = http.MethodPost
+	cfg.Body = "payload"
+	cfg.Headers = map[string]string{"X-Test": "yes", "Host": "example.test"}
+	cfg.Checks = []config.Check{{Contains: "GET /new example.test yes"}}
+	cfg.Requests, cfg.Concurrency = 3, 1
+	plan, err := Compile(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []metrics.Result
+	plan.Run(context.Background(), 1, metrics.NewLive(), func(r metrics.Result) { results = append(results, r) })
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	for _, r := range results {
+		// The check sees the redirected GET with the request's Host and
+		// headers
+		if r.Error != "" || r.Status != http.StatusOK || r.Proto != "HTTP/1.1" {
+			t.Errorf("result = status %d %s, error %q; want 200 over HTTP/1.1", r.Status, r.Proto, r.Error)
+		}
+	}
+}
+
+func TestFastHTTPCancel(t *testing.T) {
+	// A server that accepts the request and never answers
+	hung := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hung
+	}))
+	defer srv.Close()
+	defer close(hung)
+
+	cfg := config.Default()
+	cfg.URL = srv.URL
+	cfg.Engine = config.EngineFastHTTP
+	cfg.Timeout = 0
+	cfg.ShutdownGrace = config.Duration(50 * time.Millisecond)
+	cfg.Requests, cfg.Concurrency = 1, 1
+	plan, err := Compile(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var results []metrics.Result
+	done := make(chan struct{})
+	go func() {
+		plan.Run(ctx, 1, metrics.NewLive(), func(r metrics.Result) { results = append(results, r) })
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the run did not return after the shutdown grace")
+	}
+	if len(results) != 1 || results[0].ErrorType != metrics.ErrTypeCancelled {
+		t.Errorf("results = %+v, want the hung request cancelled", results)
+	}
+}
+
+func TestFastHTTPErrors(t *testing.T) {
+	hung := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hang":
+			<-hung
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	defer close(hung)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		want string // error type
+	}{
+		{name: "timeout", url: srv.URL + "/hang", want: metrics.ErrTypeTimeout},
+		{name: "server error", url: srv.URL + "/unavailable", want: metrics.ErrTypeHTTP5xx},
+		{name: "refused", url: closed.URL, want: metrics.ErrTypeConnRefused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.URL = tt.url
+			cfg.Engine = config.EngineFastHTTP
+			cfg.Timeout = config.Duration(100 * time.Millisecond)
+			cfg.Requests, cfg.Concurrency = 1, 1
+			plan, err := Compile(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var results []metrics.Result
+			plan.Run(context.Background(), 1, metrics.NewLive(), func(r metrics.Result) { results = append(results, r) })
+			if len(results) != 1 || results[0].ErrorType != tt.want {
+				t.Errorf("results = %+v, want one failing with %s", results, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package loadgen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"LoadTester/config"
+)
+
+// feeder hands out the rows of a config.Feeder file
+type feeder struct {
+	strategy string
+	rows     []map[string]string
+	next     atomic.Int64
+}
+
+// loadFeeder reads the feeder file: CSV with a header row, or JSON Lines
+// when the file ends in .jsonl or .ndjson
+func loadFeeder(cf *config.Feeder) (*feeder, error) {
+	f := &feeder{strategy: cf.Strategy}
+	switch f.strategy {
+	case "":
+		f.strategy = config.FeedCircular
+		cf.Strategy = f.strategy
+	case config.FeedSequential, config.FeedCircular, config.FeedRandom:
+	default:
+		return nil, fmt.Errorf("feeder strategy must be sequential, circular or random, got %q", f.strategy)
+	}
+	var err error
+	if f.rows, err = readRows(cf.File); err != nil {
+		return nil, fmt.Errorf("feeder %s: %w", cf.File, err)
+	}
+	if len(f.rows) == 0 {
+		return nil, fmt.Errorf("feeder %s: no rows", cf.File)
+	}
+	return f, nil
+}
+
+// readRows reads the rows of a feeder or credentials file: CSV with a
+// header row, or JSON Lines when the file ends in .jsonl or .ndjson
+func readRows(file string) ([]map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(file, ".jsonl") || strings.HasSuffix(file, ".ndjson") {
+		return parseJSONLines(data)
+	}
+	return parseCSVRows(data)
+}
+
+// parseCSVRows reads CSV records keyed by the header row
+func parseCSVRows(data []byte) ([]map[string]string, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	header := records[0]
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, rec := range records[1:] {
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			row[strings.TrimSpace(name)] = rec[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseJSONLines reads one JSON object per line; nested values are kept
+// as compact JSON
+func parseJSONLines(data []byte) ([]map[string]string, error) {
+	var rows []map[string]string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 16<<20)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(text), &obj); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		row := make(map[string]string, len(obj))
+		for k, v := range obj {
+			row[k] = jsonString(v)
+		}
+		rows = append(rows, row)
+	}
+	return rows, sc.Err()
+}
+
+// reset starts the sequence over for a new run
+func (f *feeder) reset() {
+	f.next.Store(0)
+}
+
+// row returns the variables for the next request. Rows are shared and
+// must not be modified.
+func (f *feeder) row() map[string]string {
+	if f.strategy == config.FeedRandom {
+		return f.rows[rand.IntN(len(f.rows))]
+	}
+	i := int(f.next.Add(1)-1) % len(f.rows)
+	return f.rows[i]
+}
+
+// limit caps the number of requests in a run: a sequential feeder sends
+// every row once
+func (f *feeder) limit(n int) int {
+	if f.strategy == config.FeedSequential {
+		return min(n, len(f.rows))
+	}
+	return n
+}
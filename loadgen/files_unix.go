@@ -0,0 +1,28 @@
+//go:build linux || darwin
+
+package loadgen
+
+import "syscall"
+
+// raiseOpenFiles raises the process's soft limit on open files to need,
+// and its hard limit too where allowed. It returns the limit now in force
+// and the one found, or zero for both if the limit cannot be read.
+func raiseOpenFiles(need uint64) (limit, was uint64) {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 0, 0
+	}
+	if rl.Cur >= need {
+		return rl.Cur, rl.Cur
+	}
+	want := syscall.Rlimit{Cur: need, Max: max(rl.Max, need)}
+	if syscall.Setrlimit(syscall.RLIMIT_NOFILE, &want) == nil {
+		return need, rl.Cur
+	}
+	// Raising the hard limit needs privileges; the soft one can go up to it
+	want = syscall.Rlimit{Cur: rl.Max, Max: rl.Max}
+	if rl.Max > rl.Cur && syscall.Setrlimit(syscall.RLIMIT_NOFILE, &want) == nil {
+		return rl.Max, rl.Cur
+	}
+	return rl.Cur, rl.Cur
+}
@@ -0,0 +1,72 @@
+//go:build linux || darwin
+
+package loadgen
+
+import (
+	"fmt"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+
+	"LoadTester/config"
+)
+
+func TestRaiseOpenFiles(t *testing.T) {
+	var orig syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &orig); err != nil {
+		t.Skip("no open file limit:", err)
+	}
+	defer syscall.Setrlimit(syscall.RLIMIT_NOFILE, &orig)
+
+	tests := []struct {
+		name  string
+		setup func(*config.Config)
+		want  uint64 // connections at once plus fileReserve
+	}{
+		{name: "closed model", setup: func(c *config.Config) { c.Concurrency = 300 }, want: 300 + fileReserve},
+		{name: "closed model capped by max conns", setup: func(c *config.Config) { c.Concurrency = 500; c.MaxConns = 300 }, want: 300 + fileReserve},
+		// 200 arrivals a second, each in flight for up to 2s
+		{name: "open model", setup: func(c *config.Config) { c.Rate = 200; c.Timeout = config.Duration(2 * time.Second) }, want: 400 + fileReserve},
+		{name: "open model peak stage", setup: func(c *config.Config) {
+			c.Rate = 10
+			c.Stages = []config.Stage{{Duration: config.Duration(time.Minute), Target: 250}, {Duration: config.Duration(time.Minute), Target: 100}}
+			c.Timeout = config.Duration(2 * time.Second)
+		}, want: 500 + fileReserve},
+		{name: "open model capped by max in flight", setup: func(c *config.Config) {
+			c.Rate = 200
+			c.Timeout = config.Duration(15 * time.Second)
+			c.MaxInFlight = 400
+		}, want: 400 + fileReserve},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if orig.Max < tt.want {
+				t.Skipf("hard open file limit %d is below %d", orig.Max, tt.want)
+			}
+			low := syscall.Rlimit{Cur: 128, Max: orig.Max}
+			if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &low); err != nil {
+				t.Skip("cannot lower the open file limit:", err)
+			}
+			cfg := config.Default()
+			cfg.URL = "http://localhost"
+			cfg.Duration = config.Duration(time.Minute)
+			tt.setup(&cfg)
+			plan, err := Compile(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := plan.RaiseOpenFiles(); err != nil {
+				t.Fatal(err)
+			}
+			var got syscall.Rlimit
+			syscall.Getrlimit(syscall.RLIMIT_NOFILE, &got)
+			if got.Cur != tt.want {
+				t.Errorf("open file limit = %d, want %d", got.Cur, tt.want)
+			}
+			if note := fmt.Sprintf("Raised the open file limit from 128 to %d", tt.want); !slices.Contains(plan.notes, note) {
+				t.Errorf("notes = %q, want %q", plan.notes, note)
+			}
+		})
+	}
+}
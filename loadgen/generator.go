@@ -0,0 +1,115 @@
+package loadgen
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"LoadTester/metrics"
+)
+
+// lagTick is the period of the timer whose lateness measures scheduling
+// lag
+const lagTick = 100 * time.Millisecond
+
+// generatorWatch samples the load generator's own health while a run is in
+// progress, passing it on to the live metrics every second
+type generatorWatch struct {
+	live  *metrics.Live
+	stop  chan struct{}
+	done  chan struct{}
+	stats metrics.GeneratorStats
+
+	start    time.Time
+	startCPU time.Duration
+	startMem runtime.MemStats
+}
+
+func watchGenerator(live *metrics.Live) *generatorWatch {
+	w := &generatorWatch{live: live, stop: make(chan struct{}), done: make(chan struct{}), start: time.Now()}
+	w.stats.CPUs = runtime.GOMAXPROCS(0)
+	w.startCPU, _ = processCPU()
+	runtime.ReadMemStats(&w.startMem)
+	go w.loop()
+	return w
+}
+
+func (w *generatorWatch) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(lagTick)
+	defer ticker.Stop()
+	last := time.Now()
+	lastCPU, lastSecond := w.startCPU, last
+	var lagSum time.Duration
+	var samples int
+	var secondLag time.Duration
+	w.stats.PeakSockets = -1
+	for {
+		select {
+		case now := <-ticker.C:
+			lag := max(0, now.Sub(last)-lagTick)
+			last = now
+			lagSum += lag
+			samples++
+			w.stats.LagMax = max(w.stats.LagMax, lag)
+			w.stats.LagMean = lagSum / time.Duration(samples)
+			secondLag = max(secondLag, lag)
+			w.stats.PeakGoroutines = max(w.stats.PeakGoroutines, runtime.NumGoroutine())
+			if now.Sub(lastSecond) < time.Second {
+				continue
+			}
+			sockets := openSockets()
+			w.stats.PeakSockets = max(w.stats.PeakSockets, sockets)
+			cpu := -1.0
+			if used, ok := processCPU(); ok {
+				cpu = float64(used-lastCPU) / float64(now.Sub(lastSecond)) / float64(w.stats.CPUs)
+				lastCPU = used
+			}
+			w.live.SetGenerator(runtime.NumGoroutine(), sockets, cpu, secondLag)
+			lastSecond, secondLag = now, 0
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// finish stops sampling and returns the stats of the run
+func (w *generatorWatch) finish() metrics.GeneratorStats {
+	close(w.stop)
+	<-w.done
+	g := w.stats
+	g.CPU = -1
+	if used, ok := processCPU(); ok {
+		g.CPU = float64(used-w.startCPU) / float64(time.Since(w.start)) / float64(g.CPUs)
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	g.GCs = int(mem.NumGC - w.startMem.NumGC)
+	g.GCPauseTotal = time.Duration(mem.PauseTotalNs - w.startMem.PauseTotalNs)
+	// Only the last 256 pauses are kept; GC k paused for PauseNs[(k-1)%256]
+	first := max(w.startMem.NumGC, mem.NumGC-min(mem.NumGC, 256)) + 1
+	for k := first; k <= mem.NumGC; k++ {
+		g.GCPauseMax = max(g.GCPauseMax, time.Duration(mem.PauseNs[(k-1)%256]))
+	}
+	if g.PeakSockets < 0 {
+		g.PeakSockets = openSockets()
+	}
+	return g
+}
+
+// openSockets counts the process's open sockets, or returns -1 where
+// /proc is not available
+func openSockets() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	n := 0
+	for _, e := range entries {
+		if link, err := os.Readlink("/proc/self/fd/" + e.Name()); err == nil && strings.HasPrefix(link, "socket:") {
+			n++
+		}
+	}
+	return n
+}
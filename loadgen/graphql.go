@@ -0,0 +1,73 @@
+package loadgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"LoadTester/config"
+)
+
+// applyGraphQL turns ep into the POST request carrying the GraphQL document.
+// String variables may use templates; they are rendered per request like
+// any other body.
+func applyGraphQL(g *config.GraphQLRequest, ep *target) error {
+	if g.QueryFile != "" {
+		if g.Query != "" {
+			return fmt.Errorf("graphql query and query_file are mutually exclusive")
+		}
+		data, err := os.ReadFile(g.QueryFile)
+		if err != nil {
+			return fmt.Errorf("reading graphql query file: %w", err)
+		}
+		g.Query = string(data)
+		g.QueryFile = ""
+	}
+	if strings.TrimSpace(g.Query) == "" {
+		return fmt.Errorf("graphql query is required")
+	}
+	if ep.Body != "" || ep.BodyFile != "" {
+		return fmt.Errorf("graphql and body are mutually exclusive")
+	}
+
+	payload := struct {
+		Query         string         `json:"query"`
+		Variables     map[string]any `json:"variables,omitempty"`
+		OperationName string         `json:"operationName,omitempty"`
+	}{g.Query, g.Variables, g.OperationName}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // keep template actions such as {{.id}} readable
+	if err := enc.Encode(payload); err != nil {
+		return fmt.Errorf("graphql variables: %w", err)
+	}
+	ep.Body = strings.TrimSpace(buf.String())
+	ep.Method = http.MethodPost
+	ep.ContentType = "application/json"
+	ep.graphql = true
+	return nil
+}
+
+// graphQLErrors reports whether a GraphQL response failed, with the first
+// message of its errors array
+func graphQLErrors(body []byte) (string, bool) {
+	var resp struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "response is not valid JSON", true
+	}
+	if len(resp.Errors) == 0 {
+		return "", false
+	}
+	msg := resp.Errors[0].Message
+	if len(resp.Errors) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(resp.Errors)-1)
+	}
+	return msg, true
+}
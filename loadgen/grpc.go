@@ -0,0 +1,184 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"LoadTester/config"
+)
+
+// grpcCall encodes request bodies for a gRPC method
+type grpcCall struct {
+	input protoreflect.MessageDescriptor
+}
+
+// gRPC status codes by number
+var grpcCodes = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND",
+	"ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION",
+	"ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+// resolveGRPC finds the method in the proto file, or asks the server for
+// it through reflection, and turns the top-level request into a gRPC
+// call: POST to /package.Service/Method over HTTP/2
+func (cfg *Plan) resolveGRPC() error {
+	if cfg.GRPC == nil || cfg.GRPC.Method == "" && cfg.GRPC.Proto == "" && !cfg.GRPC.Reflection {
+		cfg.GRPC = nil
+		return nil
+	}
+	switch {
+	case cfg.GRPC.Method == "":
+		return fmt.Errorf("grpc needs a method")
+	case cfg.GRPC.Proto == "" && !cfg.GRPC.Reflection:
+		return fmt.Errorf("grpc needs a proto file, or reflection to ask the server for the method")
+	case cfg.GRPC.Proto != "" && cfg.GRPC.Reflection:
+		return fmt.Errorf("grpc proto and reflection are mutually exclusive")
+	}
+	if len(cfg.Endpoints) > 0 || len(cfg.Scenario) > 0 || cfg.GraphQL != nil || cfg.Multipart != nil {
+		return fmt.Errorf("grpc cannot be combined with endpoints, a scenario, graphql or multipart")
+	}
+	switch cfg.HTTPVersion {
+	case config.HTTP1, config.HTTP3:
+		return fmt.Errorf("grpc requires HTTP/2")
+	case config.HTTPAuto:
+		cfg.HTTPVersion = config.HTTPH2C
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("grpc target %q must be http://host:port (h2c) or https://host:port", cfg.URL)
+	}
+
+	// Accept package.Service/Method, /package.Service/Method and
+	// package.Service.Method
+	name := strings.TrimPrefix(cfg.GRPC.Method, "/")
+	if !strings.Contains(name, "/") {
+		if i := strings.LastIndexByte(name, '.'); i > 0 {
+			name = name[:i] + "/" + name[i+1:]
+		}
+	}
+	service, methodName, _ := strings.Cut(name, "/")
+	var files descriptorFinder
+	if cfg.GRPC.Reflection {
+		files, err = cfg.reflectService(u, service)
+	} else {
+		files, err = compileProto(cfg.GRPC.Proto, cfg.GRPC.ImportPaths)
+	}
+	if err != nil {
+		return err
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return fmt.Errorf("grpc service %s not found: %w", service, err)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return fmt.Errorf("grpc %s is not a service", service)
+	}
+	method := sd.Methods().ByName(protoreflect.Name(methodName))
+	if method == nil {
+		return fmt.Errorf("grpc method %s not found in service %s", methodName, service)
+	}
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		return fmt.Errorf("grpc method %s is streaming; only unary calls are supported", name)
+	}
+	cfg.grpc = &grpcCall{input: method.Input()}
+
+	u.Path = "/" + name
+	cfg.URL = u.String()
+	cfg.Method = http.MethodPost
+	cfg.ContentType = "application/grpc"
+	cfg.Headers["TE"] = "trailers"
+
+	// Fail early on a malformed request rather than on every call
+	if !strings.Contains(cfg.Body, "{{") {
+		if _, err := cfg.grpc.frame(cfg.Body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// descriptorFinder looks up the descriptors of a proto file and its
+// imports, or of those a server described
+type descriptorFinder interface {
+	FindDescriptorByName(protoreflect.FullName) (protoreflect.Descriptor, error)
+}
+
+// compileProto compiles a .proto file with its imports, which are looked
+// up in its own directory, then in importPaths, then among the well-known
+// types such as google/protobuf/timestamp.proto
+func compileProto(path string, importPaths []string) (descriptorFinder, error) {
+	// The file is named relative to the import path it is under, so its
+	// imports resolve as protoc would resolve them
+	dir, name := filepath.Split(path)
+	paths := []string{dir}
+	for _, p := range importPaths {
+		if rel, err := filepath.Rel(p, path); err == nil && !strings.HasPrefix(rel, "..") {
+			paths, name = []string{p}, filepath.ToSlash(rel)
+			break
+		}
+	}
+	paths = append(paths, importPaths...)
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: paths}),
+	}
+	files, err := compiler.Compile(context.Background(), name)
+	if err != nil {
+		return nil, fmt.Errorf("grpc proto: %w", err)
+	}
+	return files.AsResolver(), nil
+}
+
+// frame encodes a JSON request, in the proto3 JSON mapping, as a
+// length-prefixed gRPC message
+func (g *grpcCall) frame(body string) (string, error) {
+	req := dynamicpb.NewMessage(g.input)
+	if strings.TrimSpace(body) != "" {
+		if err := protojson.Unmarshal([]byte(body), req); err != nil {
+			return "", fmt.Errorf("grpc request %s: %w", g.input.FullName(), err)
+		}
+	}
+	msg, err := proto.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("grpc request %s: %w", g.input.FullName(), err)
+	}
+	buf := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(msg))) // buf[0] = 0: not compressed
+	return string(append(buf, msg...)), nil
+}
+
+// grpcStatus returns the gRPC status name and message of a response whose
+// body has been read. Trailers-only responses carry them in the headers.
+func grpcStatus(resp *http.Response) (string, string) {
+	code := resp.Trailer.Get("Grpc-Status")
+	msg := resp.Trailer.Get("Grpc-Message")
+	if code == "" {
+		code = resp.Header.Get("Grpc-Status")
+		msg = resp.Header.Get("Grpc-Message")
+	}
+	if code == "" {
+		return "MISSING_STATUS", "response has no grpc-status"
+	}
+	if m, err := url.PathUnescape(msg); err == nil {
+		msg = m
+	}
+	n, err := strconv.Atoi(code)
+	if err != nil || n < 0 || n >= len(grpcCodes) {
+		return "CODE_" + code, msg
+	}
+	return grpcCodes[n], msg
+}
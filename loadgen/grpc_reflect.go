@@ -0,0 +1,163 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// The reflection service, by its current name and the one servers still
+// commonly register; both carry the same messages
+var reflectionMethods = []string{
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
+// reflectService asks the server at u, through gRPC server reflection, for
+// the file that defines service and the files it imports. The connection
+// is dialed as the test's own are and carries its static headers, so a
+// server that authenticates reflection sees the same credentials.
+func (cfg *Plan) reflectService(u *url.URL, service string) (descriptorFinder, error) {
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	creds := insecure.NewCredentials()
+	if u.Scheme == "https" {
+		creds = credentials.NewTLS(cfg.tlsConfig.Clone())
+	}
+	dial := cfg.dialWith(&net.Dialer{Timeout: time.Duration(cfg.DialTimeout)})
+	conn, err := grpc.NewClient("passthrough:///"+host,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dial(ctx, "tcp", addr)
+		}))
+	if err != nil {
+		return nil, fmt.Errorf("grpc reflection: %w", err)
+	}
+	defer conn.Close()
+
+	timeout := time.Duration(cfg.Timeout)
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	md := metadata.MD{}
+	for k, v := range cfg.Headers {
+		if strings.Contains(v, "{{") || strings.EqualFold(k, "Host") {
+			continue
+		}
+		md.Append(k, v)
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	var files []*descriptorpb.FileDescriptorProto
+	for _, method := range reflectionMethods {
+		files, err = reflectFiles(ctx, conn, method, service)
+		if status.Code(err) != codes.Unimplemented {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("grpc reflection of %s: %w", service, err)
+	}
+	reg, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: files})
+	if err != nil {
+		return nil, fmt.Errorf("grpc reflection of %s: %w", service, err)
+	}
+	return reg, nil
+}
+
+// reflectFiles asks for the file that defines symbol, then for each import
+// the server has not sent yet
+func reflectFiles(ctx context.Context, conn *grpc.ClientConn, method, symbol string) ([]*descriptorpb.FileDescriptorProto, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, method)
+	if err != nil {
+		return nil, err
+	}
+	ask := func(req *rpb.ServerReflectionRequest) ([][]byte, error) {
+		if err := stream.SendMsg(req); err != nil {
+			return nil, err
+		}
+		resp := new(rpb.ServerReflectionResponse)
+		if err := stream.RecvMsg(resp); err != nil {
+			return nil, err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, status.Error(codes.Code(e.ErrorCode), e.ErrorMessage)
+		}
+		return resp.GetFileDescriptorResponse().GetFileDescriptorProto(), nil
+	}
+
+	var files []*descriptorpb.FileDescriptorProto
+	seen := map[string]bool{}
+	// add decodes the files of a response and returns the imports not seen
+	add := func(raw [][]byte) ([]string, error) {
+		var missing []string
+		for _, b := range raw {
+			fd := new(descriptorpb.FileDescriptorProto)
+			if err := proto.Unmarshal(b, fd); err != nil {
+				return nil, err
+			}
+			if seen[fd.GetName()] {
+				continue
+			}
+			seen[fd.GetName()] = true
+			files = append(files, fd)
+			missing = append(missing, fd.GetDependency()...)
+		}
+		return missing, nil
+	}
+
+	raw, err := ask(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	})
+	if err != nil {
+		return nil, err
+	}
+	queue, err := add(raw)
+	if err != nil {
+		return nil, err
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if seen[name] {
+			continue
+		}
+		raw, err := ask(&rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		more, err := add(raw)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, more...)
+	}
+	stream.CloseSend()
+	return files, nil
+}
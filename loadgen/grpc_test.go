@@ -0,0 +1,254 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	rpbalpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+const ordersProto = `syntax = "proto3";
+package shop;
+
+import "google/protobuf/timestamp.proto";
+import "common/money.proto";
+
+service Orders {
+  rpc Place (Order) returns (Receipt);
+  rpc Watch (Order) returns (stream Receipt);
+}
+
+message Order {
+  string item = 1;
+  common.Money price = 2;
+  google.protobuf.Timestamp at = 3;
+}
+
+message Receipt {
+  string id = 1;
+}
+`
+
+const moneyProto = `syntax = "proto3";
+package common;
+
+message Money {
+  int64 cents = 1;
+}
+`
+
+const orderBody = `{"item": "book", "price": {"cents": 1250}, "at": "2026-10-16T12:00:00Z"}`
+
+// writeProtos writes the orders service, whose import of common/money.proto
+// is found in the returned import path
+func writeProtos(t *testing.T) (proto, importPath string) {
+	dir := t.TempDir()
+	proto = filepath.Join(dir, "shop", "orders.proto")
+	importPath = filepath.Join(dir, "lib")
+	os.MkdirAll(filepath.Dir(proto), 0755)
+	os.MkdirAll(filepath.Join(importPath, "common"), 0755)
+	os.WriteFile(proto, []byte(ordersProto), 0644)
+	os.WriteFile(filepath.Join(importPath, "common", "money.proto"), []byte(moneyProto), 0644)
+	return proto, importPath
+}
+
+// startOrders serves shop.Orders/Place, recording the orders it receives as
+// JSON, with the given reflection service; all calls must carry the token
+func startOrders(t *testing.T, proto, importPath, reflectionVersion string) (addr string, orders func() []string) {
+	files, err := compileProto(proto, []string{importPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, _ := files.FindDescriptorByName("shop.Orders")
+	method := desc.(protoreflect.ServiceDescriptor).Methods().ByName("Place")
+	var mu sync.Mutex
+	var got []string
+
+	auth := func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if v := md.Get("authorization"); len(v) != 1 || v[0] != "Bearer t-1" {
+			return status.Error(codes.Unauthenticated, "no token")
+		}
+		return nil
+	}
+	srv := grpc.NewServer(grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := auth(ss.Context()); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}))
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "shop.Orders",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Place",
+			Handler: func(_ any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				if err := auth(ctx); err != nil {
+					return nil, err
+				}
+				in := dynamicpb.NewMessage(method.Input())
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				b, _ := protojson.Marshal(in)
+				mu.Lock()
+				got = append(got, string(b))
+				mu.Unlock()
+				out := dynamicpb.NewMessage(method.Output())
+				out.Set(method.Output().Fields().ByName("id"), protoreflect.ValueOfString("r-1"))
+				return out, nil
+			},
+		}},
+	}, nil)
+	opts := reflection.ServerOptions{Services: srv, DescriptorResolver: files.(protodesc.Resolver)}
+	switch reflectionVersion {
+	case "v1":
+		rpb.RegisterServerReflectionServer(srv, reflection.NewServerV1(opts))
+	case "v1alpha":
+		rpbalpha.RegisterServerReflectionServer(srv, reflection.NewServer(opts))
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+	return ln.Addr().String(), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), got...)
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	proto, importPath := writeProtos(t)
+	tests := []struct {
+		name       string
+		reflection string // version the server offers
+		setup      func(*config.GRPCConfig)
+	}{
+		{name: "proto", setup: func(g *config.GRPCConfig) { g.Proto, g.ImportPaths = proto, []string{importPath} }},
+		{name: "reflection", reflection: "v1", setup: func(g *config.GRPCConfig) { g.Reflection = true }},
+		{name: "reflection v1alpha", reflection: "v1alpha", setup: func(g *config.GRPCConfig) { g.Reflection = true }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, orders := startOrders(t, proto, importPath, tt.reflection)
+			cfg := config.Default()
+			cfg.URL = "http://" + addr
+			cfg.Body = orderBody
+			cfg.Headers = map[string]string{"Authorization": "Bearer t-1"}
+			cfg.GRPC = &config.GRPCConfig{Method: "shop.Orders.Place"}
+			tt.setup(cfg.GRPC)
+			cfg.Requests, cfg.Concurrency = 2, 1
+			plan, err := Compile(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var results []metrics.Result
+			plan.Run(context.Background(), 1, metrics.NewLive(), func(r metrics.Result) { results = append(results, r) })
+			if len(results) != 2 {
+				t.Fatalf("got %d results, want 2", len(results))
+			}
+			for _, r := range results {
+				if r.Error != "" || r.GRPCStatus != "OK" {
+					t.Errorf("result = %s, error %q; want OK", r.GRPCStatus, r.Error)
+				}
+			}
+			want := `{"item":"book","price":{"cents":"1250"},"at":"2026-10-16T12:00:00Z"}`
+			for _, got := range orders() {
+				if strings.ReplaceAll(got, " ", "") != want {
+					t.Errorf("server got %s, want %s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGRPCStatus(t *testing.T) {
+	proto, importPath := writeProtos(t)
+	addr, orders := startOrders(t, proto, importPath, "")
+	cfg := config.Default()
+	cfg.URL = "http://" + addr
+	cfg.Body = orderBody
+	cfg.GRPC = &config.GRPCConfig{Proto: proto, ImportPaths: []string{importPath}, Method: "/shop.Orders/Place"}
+	cfg.Requests, cfg.Concurrency = 1, 1
+	plan, err := Compile(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []metrics.Result
+	plan.Run(context.Background(), 1, metrics.NewLive(), func(r metrics.Result) { results = append(results, r) })
+	// Without the token the call fails in the trailers of a 200 response
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	r := results[0]
+	if r.Status != 200 || r.GRPCStatus != "UNAUTHENTICATED" || r.ErrorType != metrics.ErrTypeGRPC || r.Error != "gRPC UNAUTHENTICATED: no token" {
+		t.Errorf("result = status %d, %s, %s %q; want 200 with UNAUTHENTICATED", r.Status, r.GRPCStatus, r.ErrorType, r.Error)
+	}
+	if got := orders(); len(got) != 0 {
+		t.Errorf("server got orders %v, want none", got)
+	}
+}
+
+func TestReflectService(t *testing.T) {
+	proto, importPath := writeProtos(t)
+	tests := []struct {
+		name       string
+		reflection string // version the server offers
+		token      string
+		want       codes.Code
+	}{
+		{name: "v1", reflection: "v1", token: "Bearer t-1"},
+		{name: "v1alpha", reflection: "v1alpha", token: "Bearer t-1"},
+		{name: "no token", reflection: "v1", want: codes.Unauthenticated},
+		{name: "no reflection service", token: "Bearer t-1", want: codes.Unimplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _ := startOrders(t, proto, importPath, tt.reflection)
+			cfg := config.Default()
+			cfg.URL = "http://" + addr
+			cfg.Headers = map[string]string{"Authorization": tt.token}
+			plan, err := Compile(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files, err := plan.reflectService(&url.URL{Scheme: "http", Host: addr}, "shop.Orders")
+			if status.Code(errors.Unwrap(err)) != tt.want {
+				t.Fatalf("err = %v, want code %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			// The server's answer covers the service and every file it imports
+			for _, name := range []protoreflect.FullName{"shop.Orders", "shop.Order", "common.Money", "google.protobuf.Timestamp"} {
+				if _, err := files.FindDescriptorByName(name); err != nil {
+					t.Errorf("%s: %v", name, err)
+				}
+			}
+		})
+	}
+}
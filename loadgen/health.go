@@ -0,0 +1,78 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Backoff between health checks, doubling from the first to the last
+const (
+	healthBackoff    = time.Second
+	healthBackoffMax = 30 * time.Second
+)
+
+// resolveHealthCheck validates the HEALTH_CHECK_URL settings
+func (cfg *Plan) resolveHealthCheck() error {
+	if cfg.HealthCheckWait < 0 {
+		return fmt.Errorf("health_check_wait must not be negative")
+	}
+	if cfg.HealthCheck == "" {
+		return nil
+	}
+	u, err := url.Parse(cfg.HealthCheck)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("health_check must be an http or https URL, got %q", cfg.HealthCheck)
+	}
+	return nil
+}
+
+// CheckHealth requests the HealthCheck URL until it answers with a 2xx or
+// 3xx status, for up to HealthCheckWait, and returns the last failure if
+// it never did. It goes through the same proxy, TLS and dial settings as
+// the test, and returns nil right away without a HealthCheck URL.
+func (cfg *Plan) CheckHealth(ctx context.Context) error {
+	if cfg.HealthCheck == "" {
+		return nil
+	}
+	client := createHTTPClient(ctx, cfg)
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	deadline := time.Now().Add(time.Duration(cfg.HealthCheckWait))
+	backoff := healthBackoff
+	for attempt := 1; ; attempt++ {
+		err := cfg.checkHealthOnce(ctx, client)
+		if err == nil {
+			return nil
+		}
+		wait := min(backoff, time.Until(deadline))
+		if wait <= 0 || ctx.Err() != nil {
+			return fmt.Errorf("health check %s failed after %d attempt(s): %w", cfg.HealthCheck, attempt, err)
+		}
+		cfg.logf("Health check failed (%v), retrying in %s\n", err, wait.Round(time.Millisecond))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+		backoff = min(2*backoff, healthBackoffMax)
+	}
+}
+
+func (cfg *Plan) checkHealthOnce(ctx context.Context, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.HealthCheck, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
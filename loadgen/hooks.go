@@ -0,0 +1,50 @@
+package loadgen
+
+import "net/http"
+
+// RequestModifier changes every HTTP request attempt just before it is
+// sent, e.g. to sign it with a scheme LoadTester does not know. An error
+// fails the attempt as request_build.
+type RequestModifier interface {
+	ModifyRequest(req *http.Request) error
+}
+
+// ResponseValidator checks every HTTP response that passed the built-in
+// checks. body is the whole response body, decompressed. It is only valid
+// during the call and must be copied to be kept. An error fails the
+// attempt as check_failed.
+type ResponseValidator interface {
+	ValidateResponse(resp *http.Response, body []byte) error
+}
+
+// RequestModifierFunc adapts a function to a RequestModifier
+type RequestModifierFunc func(req *http.Request) error
+
+func (f RequestModifierFunc) ModifyRequest(req *http.Request) error { return f(req) }
+
+// ResponseValidatorFunc adapts a function to a ResponseValidator
+type ResponseValidatorFunc func(resp *http.Response, body []byte) error
+
+func (f ResponseValidatorFunc) ValidateResponse(resp *http.Response, body []byte) error {
+	return f(resp, body)
+}
+
+// modify applies the request modifiers in order
+func (cfg *Plan) modify(req *http.Request) error {
+	for _, m := range cfg.Modifiers {
+		if err := m.ModifyRequest(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate applies the response validators in order
+func (cfg *Plan) validate(resp *http.Response, body []byte) error {
+	for _, v := range cfg.Validators {
+		if err := v.ValidateResponse(resp, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// resolveHTTP3 checks the settings HTTP/3 cannot honour. QUIC runs over
+// UDP with TLS built in, so there is no cleartext HTTP/3, no HTTP proxy
+// and no Unix socket.
+func (cfg *Plan) resolveHTTP3() error {
+	switch {
+	case cfg.Proxy != "":
+		return fmt.Errorf("http_version 3 cannot send through a proxy")
+	case cfg.UnixSocket != "":
+		return fmt.Errorf("http_version 3 cannot use a unix_socket")
+	}
+	if u, err := url.Parse(cfg.URL); err == nil && u.Scheme == "http" {
+		return fmt.Errorf("http_version 3 needs an https URL, got %q", cfg.URL)
+	}
+	return nil
+}
+
+// newHTTP3Transport returns the transport of http_version 3. Each host
+// gets one QUIC connection, over which requests are multiplexed as with
+// HTTP/2.
+func (cfg *Plan) newHTTP3Transport() *http3.Transport {
+	return &http3.Transport{
+		TLSClientConfig: cfg.tlsConfig,
+		QUICConfig: &quic.Config{
+			HandshakeIdleTimeout: time.Duration(cfg.TLSHandshakeTimeout),
+			MaxIdleTimeout:       time.Duration(cfg.IdleConnTimeout),
+		},
+		Dial:               cfg.dialQUIC,
+		DisableCompression: cfg.AcceptEncoding != "",
+	}
+}
+
+// dialQUIC opens a QUIC connection to addr, applying the IP family,
+// address overrides and source addresses as dialWith does for TCP. The
+// name lookup and the QUIC handshake, which connects and negotiates TLS
+// in one, are timed for the request that opens the connection.
+func (cfg *Plan) dialQUIC(ctx context.Context, addr string, tlsConf *tls.Config, conf *quic.Config) (*quic.Conn, error) {
+	timer, ok := ctx.Value(timerKey{}).(*phaseTimer)
+	if !ok {
+		timer = &phaseTimer{} // a health check or probe, not timed
+	}
+	if to, ok := cfg.overrides[strings.ToLower(addr)]; ok {
+		addr = to
+	}
+	network := "udp" + cfg.IPFamily
+	host, _, _ := net.SplitHostPort(addr)
+	lookup := net.ParseIP(host) == nil
+	if lookup {
+		timer.mark(&timer.dnsStart)
+	}
+	raddr, err := net.ResolveUDPAddr(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if lookup {
+		timer.mark(&timer.dnsDone)
+	}
+	var laddr *net.UDPAddr
+	if len(cfg.sources) > 0 {
+		laddr = cfg.nextSource(network, raddr.String()).(*net.UDPAddr)
+	}
+	pc, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	timer.mark(&timer.quicStart)
+	conn, err := quic.Dial(ctx, pc, raddr, tlsConf, conf)
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+	timer.mark(&timer.quicDone)
+	// quic.Dial leaves the socket open when the connection closes
+	go func() {
+		<-conn.Context().Done()
+		pc.Close()
+	}()
+	return conn, nil
+}
@@ -0,0 +1,115 @@
+package loadgen
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+func TestHTTP3(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	})
+	// The TLS server only provides a certificate for the QUIC server
+	tlsSrv := httptest.NewTLSServer(handler)
+	defer tlsSrv.Close()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("no UDP:", err)
+	}
+	srv := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(tlsSrv.TLS.Clone())}
+	go srv.Serve(pc)
+	defer srv.Close()
+
+	cfg := config.Default()
+	cfg.URL = "https://" + pc.LocalAddr().String() + "/"
+	cfg.HTTPVersion = "h3"
+	cfg.VerifyTLS = false
+	cfg.Checks = []config.Check{{Contains: "HTTP/3"}}
+	cfg.Requests, cfg.Concurrency = 4, 2
+	plan, err := Compile(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []metrics.Result
+	stats := plan.Run(context.Background(), 1, metrics.NewLive(), func(r metrics.Result) { results = append(results, r) })
+	if len(results) != 4 {
+		t.Fatalf("got %d results, want 4", len(results))
+	}
+	handshakes := 0
+	for _, r := range results {
+		if r.Error != "" || r.Proto != "HTTP/3.0" {
+			t.Errorf("result = %s, error %q; want HTTP/3.0", r.Proto, r.Error)
+		}
+		if r.Phases.QUIC > 0 {
+			handshakes++
+		}
+		if r.Phases.Connect != 0 || r.Phases.TLS != 0 {
+			t.Errorf("connect %v and TLS %v recorded, want them in the QUIC phase", r.Phases.Connect, r.Phases.TLS)
+		}
+	}
+	// The requests share the connection the first one opened
+	if handshakes != 1 {
+		t.Errorf("%d requests timed a QUIC handshake, want 1", handshakes)
+	}
+	if stats.Phases.Mean().QUIC == 0 {
+		t.Error("no mean QUIC handshake time in the run's stats")
+	}
+}
+
+func TestHTTP3Requests(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, r.Method+" "+r.Header.Get("X-Test")+" "+string(body))
+	})
+	tlsSrv := httptest.NewTLSServer(handler)
+	defer tlsSrv.Close()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("no UDP:", err)
+	}
+	srv := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(tlsSrv.TLS.Clone())}
+	go srv.Serve(pc)
+	defer srv.Close()
+
+	tests := []struct {
+		name  string
+		setup func(*config.Config)
+		want  string // error type
+	}{
+		{name: "post", setup: func(c *config.Config) {
+			c.Method, c.Body = http.MethodPost, "payload"
+			c.Headers = map[string]string{"X-Test": "yes"}
+			c.Checks = []config.Check{{Contains: "POST yes payload"}}
+		}},
+		{name: "untrusted certificate", setup: func(c *config.Config) { c.VerifyTLS = true }, want: metrics.ErrTypeTLS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.URL = "https://" + pc.LocalAddr().String() + "/"
+			cfg.HTTPVersion = config.HTTP3
+			cfg.VerifyTLS = false
+			cfg.MaxRetries = 0
+			tt.setup(&cfg)
+			cfg.Requests, cfg.Concurrency = 1, 1
+			plan, err := Compile(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var results []metrics.Result
+			plan.Run(context.Background(), 1, metrics.NewLive(), func(r metrics.Result) { results = append(results, r) })
+			if len(results) != 1 || results[0].ErrorType != tt.want {
+				t.Fatalf("results = %+v, want one with error type %q", results, tt.want)
+			}
+		})
+	}
+}
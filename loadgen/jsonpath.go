@@ -0,0 +1,109 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a compiled path in the supported JSONPath subset:
+// $.key.nested, $.list[0].key, $['key with spaces'] and $.list[-1]
+type jsonPath []any // string keys and int indexes
+
+// parseJSONPath compiles a path expression
+func parseJSONPath(expr string) (jsonPath, error) {
+	s := strings.TrimSpace(expr)
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("json path %q must start with $", expr)
+	}
+	s = s[1:]
+	var path jsonPath
+	for s != "" {
+		switch {
+		case s[0] == '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("json path %q: empty key", expr)
+			}
+			path = append(path, s[:end])
+			s = s[end:]
+		case s[0] == '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("json path %q: missing ]", expr)
+			}
+			inner := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				path = append(path, inner[1:len(inner)-1])
+				continue
+			}
+			i, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("json path %q: invalid index %q", expr, inner)
+			}
+			path = append(path, i)
+		default:
+			return nil, fmt.Errorf("json path %q: unexpected %q", expr, s)
+		}
+	}
+	return path, nil
+}
+
+// lookup walks the path through a decoded JSON document
+func (p jsonPath) lookup(doc any) (any, bool) {
+	cur := doc
+	for _, step := range p {
+		switch step := step.(type) {
+		case string:
+			m, ok := cur.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if cur, ok = m[step]; !ok {
+				return nil, false
+			}
+		case int:
+			l, ok := cur.([]any)
+			if !ok {
+				return nil, false
+			}
+			if step < 0 {
+				step += len(l)
+			}
+			if step < 0 || step >= len(l) {
+				return nil, false
+			}
+			cur = l[step]
+		}
+	}
+	return cur, true
+}
+
+// jsonEqual compares a decoded JSON value with an expected value from
+// the config, treating numbers of any Go type as equal by value
+func jsonEqual(actual, expected any) bool {
+	a, err1 := json.Marshal(actual)
+	var norm any
+	b, err2 := json.Marshal(expected)
+	if err1 != nil || err2 != nil || json.Unmarshal(b, &norm) != nil {
+		return false
+	}
+	b, _ = json.Marshal(norm)
+	return string(a) == string(b)
+}
+
+// jsonString renders a JSON value as plain text: strings without quotes,
+// everything else as compact JSON
+func jsonString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,113 @@
+package loadgen
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"LoadTester/config"
+)
+
+// applyMultipart turns ep into the request of an upload form: a POST,
+// unless another method is set, whose multipart/form-data body of m's
+// fields and files is built once here. Files are read, or generated, in
+// full, and the body is not templated, since file contents may contain
+// anything.
+func applyMultipart(m *config.Multipart, ep *target) error {
+	if ep.Body != "" || ep.BodyFile != "" {
+		return fmt.Errorf("multipart and body are mutually exclusive")
+	}
+	if ep.GraphQL != nil {
+		return fmt.Errorf("multipart and graphql are mutually exclusive")
+	}
+	if len(m.Fields) == 0 && len(m.Files) == 0 {
+		return fmt.Errorf("multipart needs fields or files")
+	}
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	names := make([]string, 0, len(m.Fields))
+	for name := range m.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := w.WriteField(name, m.Fields[name]); err != nil {
+			return err
+		}
+	}
+	for i, f := range m.Files {
+		if err := writeFilePart(w, f); err != nil {
+			return fmt.Errorf("multipart file %d: %w", i+1, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	ep.Body = buf.String()
+	ep.ContentType = w.FormDataContentType()
+	if ep.Method == "" || strings.EqualFold(ep.Method, http.MethodGet) {
+		ep.Method = http.MethodPost
+	}
+	ep.rawBody = true
+	return nil
+}
+
+// writeFilePart adds a file part to w, read from f.Path or generated
+func writeFilePart(w *multipart.Writer, f config.MultipartFile) error {
+	if f.Field == "" {
+		return fmt.Errorf("field is required")
+	}
+	var data []byte
+	switch {
+	case f.Path != "" && f.Size != "":
+		return fmt.Errorf("path and size are mutually exclusive")
+	case f.Path != "":
+		var err error
+		if data, err = os.ReadFile(f.Path); err != nil {
+			return err
+		}
+	case f.Size != "":
+		n, err := config.ParseByteSize(f.Size)
+		if err != nil {
+			return err
+		}
+		// Random, so compression along the way cannot shrink it
+		data = make([]byte, n)
+		rand.Read(data)
+	default:
+		return fmt.Errorf("path or size is required")
+	}
+	name := f.Name
+	if name == "" {
+		name = "upload.bin"
+		if f.Path != "" {
+			name = filepath.Base(f.Path)
+		}
+	}
+	contentType := f.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(name))
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	h := textproto.MIMEHeader{}
+	// Quoted as browsers and multipart.Writer.CreateFormFile do
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quote(f.Field), quote(name)))
+	h.Set("Content-Type", contentType)
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(data)
+	return err
+}
@@ -0,0 +1,94 @@
+package loadgen
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pauseGate holds back new requests while a test is paused
+type pauseGate struct {
+	mu      sync.Mutex
+	resumed chan struct{} // closed on resume; nil while not paused
+	since   time.Time     // start of the pause in progress
+	total   time.Duration // length of all earlier pauses
+}
+
+func (g *pauseGate) pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed != nil {
+		return false
+	}
+	g.resumed = make(chan struct{})
+	g.since = time.Now()
+	return true
+}
+
+func (g *pauseGate) resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed == nil {
+		return false
+	}
+	close(g.resumed)
+	g.resumed = nil
+	g.total += time.Since(g.since)
+	return true
+}
+
+func (g *pauseGate) paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resumed != nil
+}
+
+// wait blocks while paused. It returns false if cancel is closed first.
+func (g *pauseGate) wait(cancel <-chan struct{}) bool {
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-cancel:
+		return false
+	}
+}
+
+// pausedFor returns the time spent paused so far, including a pause in
+// progress
+func (g *pauseGate) pausedFor() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed != nil {
+		return g.total + time.Since(g.since)
+	}
+	return g.total
+}
+
+// Pause stops the plan from sending new requests until Resume is called.
+// Requests in flight complete and connections are kept open. It reports
+// whether the plan was running.
+func (cfg *Plan) Pause() bool {
+	return cfg.pause.pause()
+}
+
+// Resume lets a paused plan send requests again. It reports whether the
+// plan was paused.
+func (cfg *Plan) Resume() bool {
+	return cfg.pause.resume()
+}
+
+// Paused reports whether the plan is paused
+func (cfg *Plan) Paused() bool {
+	return cfg.pause.paused()
+}
+
+// WaitResumed blocks while the plan is paused or until ctx is cancelled
+func (cfg *Plan) WaitResumed(ctx context.Context) {
+	cfg.pause.wait(ctx.Done())
+}
@@ -0,0 +1,200 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"LoadTester/metrics"
+)
+
+// phaseTimer collects httptrace events for one request attempt. Dial
+// events can fire on transport goroutines, hence the mutex.
+type phaseTimer struct {
+	mu           sync.Mutex
+	hooks        *httptrace.ClientTrace // built once per pooled timer
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	quicStart    time.Time // HTTP/3 only, in place of connect and TLS
+	quicDone     time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	remote       net.Addr // address of the connection used
+	newConn      bool     // the connection was opened for this attempt
+	local        net.Addr
+	conns        int  // connections the transport handed the attempt
+	idle         bool // the last was taken from the idle pool, not dialed
+	// sent is when the current hop of a redirected request was sent, and
+	// hops are the redirects recorded before it
+	sent time.Time
+	hops []metrics.Redirect
+}
+
+// timers holds the phase timers of finished attempts with their hooks,
+// which take a dozen allocations to build
+var timers = sync.Pool{New: func() any {
+	t := new(phaseTimer)
+	t.hooks = t.trace()
+	return t
+}}
+
+// newTimer returns a timer for an attempt and ctx carrying it and its hooks
+func newTimer(ctx context.Context) (*phaseTimer, context.Context) {
+	t := timers.Get().(*phaseTimer)
+	hooks := t.hooks
+	if httptrace.ContextClientTrace(ctx) != nil {
+		// Composing with a trace already in ctx changes the hooks
+		hooks = t.trace()
+	}
+	return t, httptrace.WithClientTrace(context.WithValue(ctx, timerKey{}, t), hooks)
+}
+
+// release returns t to the pool once no hook can fire on it any more: the
+// attempt's only connection came from the idle pool, so no dial was
+// started for it, and both the request and the response went through. A
+// timer failing that is left to the garbage collector.
+func (t *phaseTimer) release() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	done := t.conns == 1 && t.idle && !t.wroteRequest.IsZero() && !t.firstByte.IsZero()
+	t.mu.Unlock()
+	if done {
+		*t = phaseTimer{hooks: t.hooks}
+		timers.Put(t)
+	}
+}
+
+func (t *phaseTimer) mark(at *time.Time) {
+	t.mu.Lock()
+	if at.IsZero() {
+		*at = time.Now()
+	}
+	t.mu.Unlock()
+}
+
+func (t *phaseTimer) gotConn(conn net.Conn, fresh bool) {
+	t.mu.Lock()
+	t.remote = conn.RemoteAddr()
+	t.local = conn.LocalAddr()
+	t.newConn = fresh
+	t.mu.Unlock()
+}
+
+// took counts a connection the transport handed the attempt, idle when
+// it came from the pool
+func (t *phaseTimer) took(idle bool) {
+	t.mu.Lock()
+	t.conns++
+	t.idle = idle
+	t.mu.Unlock()
+}
+
+// redirected starts timing the next hop after the redirect in hop,
+// first adding hop with its duration when record is set
+func (t *phaseTimer) redirected(hop metrics.Redirect, record bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if record {
+		hop.Duration = now.Sub(t.sent)
+		t.hops = append(t.hops, hop)
+	}
+	t.sent = now
+	t.dnsStart, t.dnsDone = time.Time{}, time.Time{}
+	t.connectStart, t.connectDone = time.Time{}, time.Time{}
+	t.tlsStart, t.tlsDone = time.Time{}, time.Time{}
+	t.quicStart, t.quicDone = time.Time{}, time.Time{}
+	t.wroteRequest, t.firstByte = time.Time{}, time.Time{}
+}
+
+// followed returns the redirects recorded for the attempt
+func (t *phaseTimer) followed() []metrics.Redirect {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.hops
+}
+
+// opened reports whether the attempt used a newly opened connection
+func (t *phaseTimer) opened() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.newConn
+}
+
+// addrs returns the remote and local address of the connection used, empty
+// when there was none
+func (t *phaseTimer) addrs() (remote, local string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.remote != nil {
+		remote, local = t.remote.String(), t.local.String()
+	}
+	return remote, local
+}
+
+// ipFamily returns IPv4 or IPv6 for the connection used, or "" when there
+// was none or it was not over IP
+func (t *phaseTimer) ipFamily() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var ip net.IP
+	switch a := t.remote.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		return ""
+	}
+	if ip.To4() != nil {
+		return metrics.IPv4
+	}
+	return metrics.IPv6
+}
+
+// trace returns the httptrace hooks that feed the timer
+func (t *phaseTimer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone) },
+		ConnectStart:      func(string, string) { t.mark(&t.connectStart) },
+		ConnectDone:       func(string, string, error) { t.mark(&t.connectDone) },
+		TLSHandshakeStart: func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.mark(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.gotConn(info.Conn, !info.Reused)
+			t.took(info.WasIdle)
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.wroteRequest) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte) },
+	}
+}
+
+// phases computes the phase durations once the body has been read
+func (t *phaseTimer) phases(bodyDone time.Time) metrics.Phases {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := func(start, end time.Time) time.Duration {
+		if start.IsZero() || end.IsZero() || end.Before(start) {
+			return 0
+		}
+		return end.Sub(start)
+	}
+	return metrics.Phases{
+		DNS:      span(t.dnsStart, t.dnsDone),
+		Connect:  span(t.connectStart, t.connectDone),
+		TLS:      span(t.tlsStart, t.tlsDone),
+		TTFB:     span(t.wroteRequest, t.firstByte),
+		Transfer: span(t.firstByte, bodyDone),
+		QUIC:     span(t.quicStart, t.quicDone),
+	}
+}
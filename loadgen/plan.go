@@ -0,0 +1,308 @@
+// Package loadgen generates the load of a test: it prepares the requests
+// described by a config.Config and sends them, measuring every response.
+package loadgen
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"LoadTester/config"
+)
+
+// Plan is a test prepared for running: its settings are validated, files
+// are read and templates, checks and protocol encoders are compiled. The
+// embedded Config holds the settings as resolved, with defaults and
+// derived values filled in.
+type Plan struct {
+	config.Config
+
+	// Log receives progress messages such as step pattern changes
+	Log io.Writer
+	// Modifiers and Validators are applied in order to every HTTP request
+	// attempt and response
+	Modifiers  []RequestModifier
+	Validators []ResponseValidator
+
+	targets    []target
+	cumWeights []float64 // running total of target weights
+	steps      []target  // scenario steps, in order
+	script     *script   // called by scenario steps, nil without one
+	checks     []check   // top-level checks
+	feeder     *feeder
+	replay     *replay
+	tracer     *tracer // nil without tracing
+	grpc       *grpcCall
+	network    string // "tcp" or "udp" in raw socket mode
+	dns        *dnsQueries
+	pause      pauseGate
+	retryOn    map[string]bool // RETRY_ON categories
+	budget     retryBudget
+	startOnce  sync.Once
+	deadline   time.Time    // set by Deadline
+	conns      *connLimiter // MaxConns, shared by every run
+	proxy      *url.URL
+	tlsConfig  *tls.Config
+	overrides  map[string]string // RESOLVE: host:port to the address to dial
+	sources    []net.IP          // SOURCE_ADDRS, expanded
+	sourceNext atomic.Uint64
+	limits     containerLimits // of the container, with the resource guard on
+	notes      []string        // about the resources, printed by the first run
+	notesOnce  sync.Once
+	// credentials are the rows of the credentials file, one per virtual
+	// user
+	credentials []map[string]string
+	// userAgents are the User-Agents rotated, with presets expanded
+	userAgents []string
+	// randomQuery is the templated query string of the random query
+	// parameters, added to every target's URL
+	randomQuery string
+}
+
+// Compile validates cfg and prepares it for running. cfg itself is not
+// modified.
+func Compile(cfg config.Config) (*Plan, error) {
+	p := &Plan{Config: cfg.Clone(), Log: io.Discard}
+	if err := p.resolve(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// resolve validates the settings and fills in values derived from others
+func (cfg *Plan) resolve() error {
+	cfg.Method = strings.ToUpper(cfg.Method)
+	if cfg.Headers == nil {
+		cfg.Headers = map[string]string{}
+	}
+	if cfg.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+	if err := cfg.resolveResources(); err != nil {
+		return err
+	}
+	if cfg.Duration < 0 {
+		return fmt.Errorf("duration must not be negative")
+	}
+	if cfg.Warmup < 0 || cfg.WarmupRequests < 0 {
+		return fmt.Errorf("warmup must not be negative")
+	}
+	if err := cfg.resolveRetries(); err != nil {
+		return err
+	}
+	if err := cfg.resolveBreaker(); err != nil {
+		return err
+	}
+	if err := cfg.resolveStop(); err != nil {
+		return err
+	}
+	if err := cfg.resolveHealthCheck(); err != nil {
+		return err
+	}
+	if err := cfg.resolveThinkTime(); err != nil {
+		return err
+	}
+	if cfg.Timeout < 0 || cfg.DialTimeout < 0 || cfg.TLSHandshakeTimeout < 0 || cfg.ResponseHeaderTimeout < 0 || cfg.IdleConnTimeout < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	if cfg.MaxInFlight < 0 || cfg.MaxConnsPerHost < 0 || cfg.MaxConns < 0 {
+		return fmt.Errorf("max_in_flight and connection caps must not be negative")
+	}
+	cfg.conns = newConnLimiter(cfg.MaxConns)
+	if cfg.ShutdownGrace < 0 {
+		return fmt.Errorf("shutdown_grace must not be negative")
+	}
+	if cfg.Rate < 0 {
+		return fmt.Errorf("rate must not be negative")
+	}
+	for i, st := range cfg.Stages {
+		if st.Duration < 0 {
+			return fmt.Errorf("stage %d: duration must not be negative", i+1)
+		}
+		if st.Target < 0 {
+			return fmt.Errorf("stage %d: target must not be negative", i+1)
+		}
+	}
+	for i := range cfg.Checks {
+		c, err := compileCheck(cfg.Checks[i])
+		if err != nil {
+			return fmt.Errorf("check %d: %w", i+1, err)
+		}
+		cfg.checks = append(cfg.checks, c)
+	}
+	if err := cfg.resolvePattern(); err != nil {
+		return err
+	}
+	if cfg.Duration == 0 && cfg.Requests < 1 {
+		return fmt.Errorf("requests must be at least 1 when no duration is set")
+	}
+	if len(cfg.Agents) > 0 && cfg.Duration == 0 && cfg.Requests < len(cfg.Agents) {
+		return fmt.Errorf("requests must be at least the number of agents")
+	}
+	if len(cfg.Agents) > 0 && cfg.AgentToken == "" {
+		return fmt.Errorf("agents need agent_token, the token they were started with")
+	}
+	if cfg.BodyFile != "" {
+		if cfg.Body != "" {
+			return fmt.Errorf("body and body_file are mutually exclusive")
+		}
+		data, err := os.ReadFile(cfg.BodyFile)
+		if err != nil {
+			return fmt.Errorf("reading body file: %w", err)
+		}
+		cfg.Body = string(data)
+	}
+	if err := cfg.resolveHTTPVersion(); err != nil {
+		return err
+	}
+	if err := cfg.resolveEngine(); err != nil {
+		return err
+	}
+	if err := cfg.resolveProxy(); err != nil {
+		return err
+	}
+	if err := cfg.resolveTLS(); err != nil {
+		return err
+	}
+	if err := cfg.resolveOverrides(); err != nil {
+		return err
+	}
+	if err := cfg.resolveSources(); err != nil {
+		return err
+	}
+	if err := cfg.resolveIPFamily(); err != nil {
+		return err
+	}
+	if err := cfg.resolveSocket(); err != nil {
+		return err
+	}
+	if err := cfg.resolveDNS(); err != nil {
+		return err
+	}
+	if err := cfg.resolveAuth(); err != nil {
+		return err
+	}
+	// After the auth headers, which reflection sends too
+	if err := cfg.resolveGRPC(); err != nil {
+		return err
+	}
+	if err := cfg.resolveEncoding(); err != nil {
+		return err
+	}
+	if err := cfg.resolveRedirects(); err != nil {
+		return err
+	}
+	if err := cfg.resolveUserAgents(); err != nil {
+		return err
+	}
+	if err := cfg.resolveRandom(); err != nil {
+		return err
+	}
+	if err := cfg.resolveUnixSocket(); err != nil {
+		return err
+	}
+	if err := cfg.resolveReplay(); err != nil {
+		return err
+	}
+	if err := cfg.resolveModel(); err != nil {
+		return err
+	}
+	if err := cfg.resolveAdaptive(); err != nil {
+		return err
+	}
+	if err := cfg.resolveSearch(); err != nil {
+		return err
+	}
+	if err := cfg.resolveTracing(); err != nil {
+		return err
+	}
+	if err := cfg.resolveCapture(); err != nil {
+		return err
+	}
+	if cfg.Body != "" && cfg.ContentType == "" && cfg.network == "" {
+		cfg.ContentType = detectContentType(cfg.Body)
+	}
+	if cfg.Feeder != nil {
+		f, err := loadFeeder(cfg.Feeder)
+		if err != nil {
+			return err
+		}
+		cfg.feeder = f
+	}
+	if cfg.Credentials != "" {
+		rows, err := loadCredentials(cfg.Credentials)
+		if err != nil {
+			return err
+		}
+		cfg.credentials = rows
+	}
+	if err := cfg.resolveScenario(); err != nil {
+		return err
+	}
+	if err := cfg.resolveScript(); err != nil {
+		return err
+	}
+	return cfg.resolveEndpoints()
+}
+
+// resolvePattern validates the PATTERN settings and fills in defaults.
+// The spike pattern is expressed as generated stages.
+func (cfg *Plan) resolvePattern() error {
+	switch strings.ToLower(cfg.Pattern) {
+	case "", config.PatternConstant:
+		cfg.Pattern = config.PatternConstant
+	case config.PatternStep:
+		cfg.Pattern = config.PatternStep
+		if cfg.Rate > 0 || len(cfg.Stages) > 0 {
+			return fmt.Errorf("step pattern adds workers and cannot be combined with rate or stages")
+		}
+		if cfg.StepWorkers <= 0 {
+			cfg.StepWorkers = max(1, cfg.Concurrency/10)
+		}
+		if cfg.StepInterval <= 0 {
+			return fmt.Errorf("step_interval must be positive")
+		}
+	case config.PatternSpike:
+		cfg.Pattern = config.PatternSpike
+		if len(cfg.Stages) > 0 {
+			return fmt.Errorf("spike pattern cannot be combined with stages")
+		}
+		if cfg.Duration <= 0 || cfg.Rate <= 0 || cfg.SpikeRate <= 0 {
+			return fmt.Errorf("spike pattern requires duration, rate (baseline) and spike_rate")
+		}
+		if cfg.SpikeAt == 0 {
+			cfg.SpikeAt = cfg.Duration / 3
+		}
+		if cfg.SpikeDuration == 0 {
+			cfg.SpikeDuration = cfg.Duration / 10
+		}
+		if cfg.SpikeAt+cfg.SpikeDuration > cfg.Duration {
+			return fmt.Errorf("spike_at + spike_duration exceeds duration")
+		}
+		cfg.Stages = spikeStages(&cfg.Config)
+	default:
+		return fmt.Errorf("unknown pattern %q (want constant, step or spike)", cfg.Pattern)
+	}
+	return nil
+}
+
+// detectContentType guesses the Content-Type of a request body
+func detectContentType(body string) string {
+	trimmed := strings.TrimSpace(body)
+	if json.Valid([]byte(trimmed)) && (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) {
+		return "application/json"
+	}
+	if _, err := url.ParseQuery(trimmed); err == nil && strings.Contains(trimmed, "=") && !strings.ContainsAny(trimmed, " \n") {
+		return "application/x-www-form-urlencoded"
+	}
+	return http.DetectContentType([]byte(body))
+}
@@ -0,0 +1,70 @@
+package loadgen
+
+import (
+	"context"
+	"maps"
+	"net/http/cookiejar"
+
+	"LoadTester/metrics"
+)
+
+// Probe sends a single request to every endpoint, or runs the scenario
+// steps once in order, stopping at the first failed step, and returns the
+// results. A replay probes its first recorded request. Warm-up, pacing,
+// the circuit breaker and stop conditions do not apply.
+func (cfg *Plan) Probe(ctx context.Context) []metrics.Result {
+	client := createHTTPClient(ctx, cfg)
+	vars := map[string]string{}
+	if cfg.feeder != nil {
+		cfg.feeder.reset()
+		maps.Copy(vars, cfg.feeder.row())
+	}
+	if cfg.credentials != nil {
+		// As the first virtual user
+		maps.Copy(vars, cfg.credentials[0])
+	}
+	if cfg.perUserAgent() {
+		ctx = withUserAgent(ctx, cfg.userAgents[0])
+	}
+	var results []metrics.Result
+	if len(cfg.steps) > 0 {
+		vu := *client
+		if cfg.Cookies {
+			vu.Jar, _ = cookiejar.New(nil)
+		}
+		ctx, release := cfg.withScript(ctx)
+		defer release()
+		for i := range cfg.steps {
+			run, r := cfg.steps[i].runs(ctx, i+1, vars)
+			if !run {
+				continue
+			}
+			if r.Error == "" {
+				r = doRequest(ctx, &vu, cfg, &cfg.steps[i], i+1, vars)
+			}
+			results = append(results, r)
+			if r.Error != "" {
+				break
+			}
+		}
+		return results
+	}
+	targets := cfg.targets
+	if cfg.replay != nil {
+		targets = []target{cfg.replay.entries[0].target}
+	}
+	for i := range targets {
+		ep := &targets[i]
+		var r metrics.Result
+		switch {
+		case ep.dns != nil:
+			r = doDNS(ctx, cfg, ep, i+1)
+		case ep.network != "":
+			r = doSocket(ctx, cfg, ep, i+1, vars)
+		default:
+			r = doRequest(ctx, client, cfg, ep, i+1, vars)
+		}
+		results = append(results, r)
+	}
+	return results
+}
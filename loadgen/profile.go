@@ -0,0 +1,193 @@
+package loadgen
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"LoadTester/config"
+)
+
+// arrivalSchedule returns when the k-th (0-based) request of an open-model
+// run should be launched, relative to the start of the run. ok is false
+// once the schedule is exhausted.
+type arrivalSchedule interface {
+	at(k int) (offset time.Duration, ok bool)
+}
+
+// constantSchedule launches requests at a fixed rate forever
+type constantSchedule struct {
+	period time.Duration
+}
+
+func (s constantSchedule) at(k int) (time.Duration, bool) {
+	return time.Duration(k) * s.period, true
+}
+
+// stagedSchedule ramps the arrival rate through a list of stages
+type stagedSchedule struct {
+	start  float64
+	stages []config.Stage
+}
+
+func (s stagedSchedule) at(k int) (time.Duration, bool) {
+	var elapsed time.Duration
+	from := s.start
+	remaining := float64(k)
+	for _, st := range s.stages {
+		T := time.Duration(st.Duration).Seconds()
+		to := st.Target
+		// Requests launched during this stage: the area under the rate line
+		n := (from + to) / 2 * T
+		if remaining < n {
+			// Solve from*t + (to-from)/(2T)*t^2 = remaining for t
+			var t float64
+			if a := (to - from) / (2 * T); a == 0 {
+				t = remaining / from
+			} else {
+				t = (-from + math.Sqrt(from*from+4*a*remaining)) / (2 * a)
+			}
+			return elapsed + time.Duration(t*float64(time.Second)), true
+		}
+		remaining -= n
+		elapsed += time.Duration(st.Duration)
+		from = to
+	}
+	return elapsed, false
+}
+
+// totalDuration is the combined length of all stages
+func (s stagedSchedule) totalDuration() time.Duration {
+	var d time.Duration
+	for _, st := range s.stages {
+		d += time.Duration(st.Duration)
+	}
+	return d
+}
+
+// resolveModel settles the workload model. A rate, stages, the spike
+// pattern or a timed replay set an arrival rate; so does spreading a fixed
+// number of requests over INTERVAL, which becomes a rate of
+// Requests/Interval. Auto picks the open model for any of them.
+func (cfg *Plan) resolveModel() error {
+	scheduled := cfg.Rate > 0 || len(cfg.Stages) > 0 || cfg.replay != nil && cfg.replay.timed
+	paced := !scheduled && !cfg.Burst && cfg.Interval > 0 && cfg.Duration == 0 &&
+		cfg.Pattern == config.PatternConstant && cfg.replay == nil
+	switch strings.ToLower(cfg.Model) {
+	case "", config.ModelAuto:
+		cfg.Model = config.ModelClosed
+		if scheduled || paced {
+			cfg.Model = config.ModelOpen
+		}
+	case config.ModelOpen:
+		cfg.Model = config.ModelOpen
+		if cfg.Pattern == config.PatternStep {
+			return fmt.Errorf("step pattern adds virtual users and needs the closed model")
+		}
+		if !scheduled && !paced {
+			return fmt.Errorf("open model needs an arrival rate: set rate or stages, or interval with a number of requests")
+		}
+	case config.ModelClosed:
+		cfg.Model = config.ModelClosed
+		if scheduled {
+			return fmt.Errorf("closed model cannot be combined with rate, stages, the spike pattern or a timed replay, which set an arrival rate")
+		}
+	default:
+		return fmt.Errorf("unknown model %q (want closed, open or auto)", cfg.Model)
+	}
+	if cfg.Model == config.ModelOpen && paced {
+		cfg.Rate = float64(cfg.Requests) / float64(cfg.Interval)
+	}
+	return nil
+}
+
+// resolveSearch validates the rate search settings and fills in their
+// defaults
+func (cfg *Plan) resolveSearch() error {
+	if !cfg.Search {
+		return nil
+	}
+	if cfg.Model != config.ModelOpen || cfg.Rate <= 0 || len(cfg.Stages) > 0 || cfg.replay != nil || cfg.Duration <= 0 {
+		return fmt.Errorf("search needs the open model with a constant rate and a duration, and cannot be combined with stages, the spike pattern or a replay")
+	}
+	if cfg.AdaptiveRate {
+		return fmt.Errorf("search and adaptive_rate are mutually exclusive")
+	}
+	if len(cfg.Thresholds) == 0 {
+		return fmt.Errorf("search needs thresholds to tell whether a rate is sustainable")
+	}
+	if cfg.SearchMax < cfg.Rate {
+		return fmt.Errorf("search_max must be at least rate")
+	}
+	if cfg.SearchStep < 0 || cfg.SearchPrecision < 0 {
+		return fmt.Errorf("search_step and search_precision must not be negative")
+	}
+	if cfg.SearchStep == 0 {
+		cfg.SearchStep = cfg.Rate
+	}
+	if cfg.SearchPrecision == 0 {
+		cfg.SearchPrecision = cfg.SearchStep / 10
+	}
+	return nil
+}
+
+// newSchedule returns the arrival schedule for an open-model run, or nil
+// when the run is closed-model
+func newSchedule(cfg *config.Config) arrivalSchedule {
+	if len(cfg.Stages) > 0 {
+		return stagedSchedule{start: cfg.Rate, stages: cfg.Stages}
+	}
+	if cfg.Rate > 0 {
+		return constantSchedule{period: time.Duration(float64(time.Second) / cfg.Rate)}
+	}
+	return nil
+}
+
+// spikeStages builds the stage list for the spike pattern: hold the
+// baseline rate, jump to the spike rate, hold it, then drop back to the
+// baseline for the rest of the run
+func spikeStages(cfg *config.Config) []config.Stage {
+	rest := cfg.Duration - cfg.SpikeAt - cfg.SpikeDuration
+	return []config.Stage{
+		{Duration: cfg.SpikeAt, Target: cfg.Rate},
+		{Duration: 0, Target: cfg.SpikeRate},
+		{Duration: cfg.SpikeDuration, Target: cfg.SpikeRate},
+		{Duration: 0, Target: cfg.Rate},
+		{Duration: rest, Target: cfg.Rate},
+	}
+}
+
+// stepWorkers raises the number of usable semaphore slots by
+// cfg.StepWorkers every cfg.StepInterval until Concurrency is reached. It
+// occupies every slot beyond the first step before returning and releases
+// them from a background goroutine until done is closed.
+func stepWorkers(cfg *Plan, sem chan struct{}, done <-chan struct{}) {
+	reserved := max(0, cfg.Concurrency-cfg.StepWorkers)
+	for i := 0; i < reserved; i++ {
+		sem <- struct{}{}
+	}
+	workers := cfg.Concurrency - reserved
+	cfg.logf("Step pattern: %d workers\n", workers)
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.StepInterval))
+		defer ticker.Stop()
+		for reserved > 0 {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if !cfg.pause.wait(done) {
+				return
+			}
+			n := min(cfg.StepWorkers, reserved)
+			for i := 0; i < n; i++ {
+				<-sem
+			}
+			reserved -= n
+			workers += n
+			cfg.logf("Step pattern: %d workers\n", workers)
+		}
+	}()
+}
@@ -0,0 +1,149 @@
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"LoadTester/config"
+)
+
+// resolveHTTPVersion validates HTTP_VERSION and H2_MAX_STREAMS
+func (cfg *Plan) resolveHTTPVersion() error {
+	switch cfg.HTTPVersion {
+	case "":
+		cfg.HTTPVersion = config.HTTPAuto
+	case "1", "http/1.1":
+		cfg.HTTPVersion = config.HTTP1
+	case "2.0", "h2":
+		cfg.HTTPVersion = config.HTTP2
+	case "h3", "3.0":
+		cfg.HTTPVersion = config.HTTP3
+	case config.HTTPAuto, config.HTTP1, config.HTTP2, config.HTTPH2C, config.HTTP3:
+	default:
+		return fmt.Errorf("http_version must be auto, 1.1, 2, h2c or 3, got %q", cfg.HTTPVersion)
+	}
+	if cfg.H2MaxStreams < 0 {
+		return fmt.Errorf("h2_max_streams must not be negative")
+	}
+	if cfg.H2MaxStreams > 0 && (cfg.HTTPVersion == config.HTTP1 || cfg.HTTPVersion == config.HTTP3) {
+		return fmt.Errorf("h2_max_streams requires HTTP/2")
+	}
+	if cfg.HTTPVersion == config.HTTP3 {
+		return cfg.resolveHTTP3()
+	}
+	return nil
+}
+
+// resolveEngine validates ENGINE. fasthttp only speaks HTTP/1.1, so it
+// takes auto as 1.1.
+func (cfg *Plan) resolveEngine() error {
+	switch strings.ToLower(cfg.Engine) {
+	case "", "nethttp", config.EngineNetHTTP:
+		cfg.Engine = config.EngineNetHTTP
+		return nil
+	case config.EngineFastHTTP:
+		cfg.Engine = config.EngineFastHTTP
+	default:
+		return fmt.Errorf("engine must be net/http or fasthttp, got %q", cfg.Engine)
+	}
+	switch {
+	case cfg.HTTPVersion == config.HTTPAuto:
+		cfg.HTTPVersion = config.HTTP1
+	case cfg.HTTPVersion != config.HTTP1:
+		return fmt.Errorf("engine fasthttp only speaks HTTP/1.1, got http_version %s; use the net/http engine", cfg.HTTPVersion)
+	}
+	switch {
+	case cfg.H2MaxStreams > 0:
+		return fmt.Errorf("h2_max_streams requires HTTP/2, which engine fasthttp does not speak")
+	case cfg.GRPC != nil:
+		return fmt.Errorf("grpc requires HTTP/2, which engine fasthttp does not speak")
+	case cfg.Proxy != "":
+		return fmt.Errorf("engine fasthttp cannot send through a proxy; use the net/http engine")
+	}
+	return nil
+}
+
+// protocols returns the protocols the transport may use
+func (cfg *Plan) protocols() *http.Protocols {
+	var p http.Protocols
+	switch cfg.HTTPVersion {
+	case config.HTTP1:
+		p.SetHTTP1(true)
+	case config.HTTP2:
+		p.SetHTTP2(true)
+	case config.HTTPH2C:
+		p.SetHTTP2(true)
+		p.SetUnencryptedHTTP2(true)
+	default:
+		p.SetHTTP1(true)
+		p.SetHTTP2(true)
+	}
+	return &p
+}
+
+// streamLimiter caps the number of concurrent HTTP/2 streams per
+// connection. Each transport is limited to a single connection, and a
+// request holds one of its transport's stream slots until the response
+// body is closed; requests wait while every slot is busy.
+type streamLimiter struct {
+	slots      chan http.RoundTripper
+	transports []*http.Transport
+}
+
+// newStreamLimiter spreads concurrency streams over as many connections
+// as needed to keep each at or below maxStreams, but no more than
+// maxConns when that is set
+func newStreamLimiter(newTransport func() *http.Transport, concurrency, maxStreams, maxConns int) *streamLimiter {
+	conns := (concurrency + maxStreams - 1) / maxStreams
+	if maxConns > 0 {
+		conns = min(conns, maxConns)
+	}
+	l := &streamLimiter{slots: make(chan http.RoundTripper, conns*maxStreams)}
+	for range conns {
+		t := newTransport()
+		t.MaxConnsPerHost = 1
+		l.transports = append(l.transports, t)
+		for range maxStreams {
+			l.slots <- t
+		}
+	}
+	return l
+}
+
+// CloseIdleConnections closes the idle connections of every transport
+func (l *streamLimiter) CloseIdleConnections() {
+	for _, t := range l.transports {
+		t.CloseIdleConnections()
+	}
+}
+
+func (l *streamLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	var t http.RoundTripper
+	select {
+	case t = <-l.slots:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	resp, err := t.RoundTrip(req)
+	if err != nil {
+		l.slots <- t
+		return nil, err
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: sync.OnceFunc(func() { l.slots <- t })}
+	return resp, nil
+}
+
+// releaseOnClose frees a stream slot once the response body is closed
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
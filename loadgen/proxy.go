@@ -0,0 +1,44 @@
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"LoadTester/config"
+)
+
+// resolveProxy validates the PROXY setting
+func (cfg *Plan) resolveProxy() error {
+	if cfg.Proxy == "" || cfg.Proxy == config.ProxyEnv {
+		return nil
+	}
+	u, err := url.Parse(cfg.Proxy)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL: %w", errors.Unwrap(err)) // err would show the password
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("proxy must be an http, https or socks5 URL, got %q", u.Redacted())
+	}
+	if u.Host == "" {
+		return fmt.Errorf("proxy %q has no host", u.Redacted())
+	}
+	cfg.proxy = u
+	return nil
+}
+
+// proxyFunc returns the transport's Proxy function, nil for direct
+// connections
+func (cfg *Plan) proxyFunc() func(*http.Request) (*url.URL, error) {
+	switch {
+	case cfg.Proxy == config.ProxyEnv:
+		return http.ProxyFromEnvironment
+	case cfg.proxy != nil:
+		return http.ProxyURL(cfg.proxy)
+	}
+	return nil
+}
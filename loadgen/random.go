@@ -0,0 +1,112 @@
+package loadgen
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// randomGenerators are the template functions a random header or query
+// parameter may name, with the number of integer arguments each takes
+var randomGenerators = map[string]int{
+	"uuid":        0,
+	"seq":         0,
+	"timestamp":   0,
+	"timestampMs": 0,
+	"randInt":     2,
+	"randString":  1,
+}
+
+// resolveRandom turns the random headers into templated headers, and the
+// random query parameters into the templated query that is added to every
+// target's URL
+func (cfg *Plan) resolveRandom() error {
+	if len(cfg.RandomHeaders) == 0 && len(cfg.RandomQuery) == 0 {
+		return nil
+	}
+	if cfg.network != "" || cfg.dns != nil || cfg.Replay != nil {
+		return fmt.Errorf("random_headers and random_query need templated HTTP requests and cannot be combined with replay, socket or DNS mode")
+	}
+	names := make([]string, 0, len(cfg.RandomHeaders))
+	for name := range cfg.RandomHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for set := range cfg.Headers {
+			if http.CanonicalHeaderKey(set) == http.CanonicalHeaderKey(name) {
+				return fmt.Errorf("header %s is set both by headers and by random_headers", name)
+			}
+		}
+		tmpl, err := randomTemplate(cfg.RandomHeaders[name], func(v string) string { return v })
+		if err != nil {
+			return fmt.Errorf("random header %s: %w", name, err)
+		}
+		if cfg.Headers == nil {
+			cfg.Headers = map[string]string{}
+		}
+		cfg.Headers[name] = tmpl
+	}
+
+	names = names[:0]
+	for name := range cfg.RandomQuery {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	params := make([]string, len(names))
+	for i, name := range names {
+		tmpl, err := randomTemplate(cfg.RandomQuery[name], url.QueryEscape)
+		if err != nil {
+			return fmt.Errorf("random query parameter %s: %w", name, err)
+		}
+		params[i] = url.QueryEscape(name) + "=" + tmpl
+	}
+	cfg.randomQuery = strings.Join(params, "&")
+	return nil
+}
+
+// randomTemplate returns the template that renders spec: a generator call
+// such as "randString 12", or a pick from values separated by |, each
+// passed through escape
+func randomTemplate(spec string, escape func(string) string) (string, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("needs a generator or values separated by |")
+	}
+	if n, ok := randomGenerators[fields[0]]; ok {
+		if len(fields)-1 != n {
+			return "", fmt.Errorf("%s takes %d arguments", fields[0], n)
+		}
+		for _, arg := range fields[1:] {
+			if _, err := strconv.Atoi(arg); err != nil {
+				return "", fmt.Errorf("%s: %q is not a number", fields[0], arg)
+			}
+		}
+		return "{{" + strings.Join(fields, " ") + "}}", nil
+	}
+	values := strings.Split(spec, "|")
+	for i, v := range values {
+		values[i] = strconv.Quote(escape(strings.TrimSpace(v)))
+	}
+	return "{{randChoice " + strings.Join(values, " ") + "}}", nil
+}
+
+// withRandomQuery returns u with the random query parameters added
+func (cfg *Plan) withRandomQuery(u string) string {
+	if cfg.randomQuery == "" {
+		return u
+	}
+	u, fragment, hasFragment := strings.Cut(u, "#")
+	sep := "?"
+	if strings.Contains(u, "?") {
+		sep = "&"
+	}
+	u += sep + cfg.randomQuery
+	if hasFragment {
+		u += "#" + fragment
+	}
+	return u
+}
@@ -0,0 +1,106 @@
+package loadgen
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// captureEntry is one line of a capture file written by a Recorder
+type captureEntry struct {
+	Time         time.Time         `json:"time"`
+	Method       string            `json:"method"`
+	URL          string            `json:"url"` // path and query
+	Headers      map[string]string `json:"headers,omitempty"`
+	Body         string            `json:"body,omitempty"`
+	BodyEncoding string            `json:"body_encoding,omitempty"` // "base64" when the body is not UTF-8
+}
+
+// unrecordedHeaders are request headers not worth replaying: they
+// describe the connection or are set again when the request is sent
+var unrecordedHeaders = map[string]bool{
+	"Connection":          true,
+	"Content-Length":      true,
+	"Host":                true,
+	"Keep-Alive":          true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"X-Forwarded-For":     true,
+}
+
+// Recorder is a reverse proxy that forwards every request to its target
+// and writes it to a capture file, one JSON line per request, for replay
+type Recorder struct {
+	proxy *httputil.ReverseProxy
+
+	mu sync.Mutex
+	w  io.Writer
+	n  int
+}
+
+// NewRecorder returns a Recorder forwarding to target and writing the
+// capture to w
+func NewRecorder(target *url.URL, w io.Writer) *Recorder {
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+	}
+	return &Recorder{proxy: proxy, w: w}
+}
+
+// Recorded returns the number of requests captured so far
+func (rec *Recorder) Recorded() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.n
+}
+
+func (rec *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e := captureEntry{Time: time.Now(), Method: r.Method, URL: r.URL.RequestURI()}
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			http.Error(w, "reading request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if utf8.Valid(body) {
+			e.Body = string(body)
+		} else {
+			e.Body, e.BodyEncoding = base64.StdEncoding.EncodeToString(body), "base64"
+		}
+	}
+	for name, values := range r.Header {
+		if unrecordedHeaders[name] {
+			continue
+		}
+		if e.Headers == nil {
+			e.Headers = map[string]string{}
+		}
+		e.Headers[name] = strings.Join(values, ", ")
+	}
+	line, _ := json.Marshal(e)
+	rec.mu.Lock()
+	if _, err := rec.w.Write(append(line, '\n')); err != nil {
+		slog.Error("record: failed to write the capture", "err", err)
+	}
+	rec.n++
+	rec.mu.Unlock()
+	rec.proxy.ServeHTTP(w, r)
+}
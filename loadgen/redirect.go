@@ -0,0 +1,47 @@
+package loadgen
+
+import (
+	"fmt"
+	"net/http"
+
+	"LoadTester/metrics"
+)
+
+// redirectLimit is the error of a request redirected more than
+// MaxRedirects times
+type redirectLimit int
+
+func (n redirectLimit) Error() string {
+	return fmt.Sprintf("stopped after %d redirects", int(n))
+}
+
+// timerKey is the context key of an attempt's *phaseTimer, which the
+// redirect policy restarts on every hop
+type timerKey struct{}
+
+// resolveRedirects validates the redirect policy
+func (cfg *Plan) resolveRedirects() error {
+	if cfg.MaxRedirects < 0 {
+		return fmt.Errorf("max_redirects must not be negative")
+	}
+	if cfg.RecordRedirects && cfg.MaxRedirects == 0 {
+		return fmt.Errorf("record_redirects needs max_redirects above 0")
+	}
+	return nil
+}
+
+// checkRedirect is the client's redirect policy: up to MaxRedirects
+// redirects are followed. The phases of a request are those of its final
+// response; with RecordRedirects each hop before it is kept as well.
+func (cfg *Plan) checkRedirect(req *http.Request, via []*http.Request) error {
+	if cfg.MaxRedirects == 0 {
+		return http.ErrUseLastResponse
+	}
+	if t, ok := req.Context().Value(timerKey{}).(*phaseTimer); ok {
+		t.redirected(metrics.Redirect{Status: req.Response.StatusCode, URL: via[len(via)-1].URL.String()}, cfg.RecordRedirects)
+	}
+	if len(via) > cfg.MaxRedirects {
+		return redirectLimit(cfg.MaxRedirects)
+	}
+	return nil
+}
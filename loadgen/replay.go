@@ -0,0 +1,255 @@
+package loadgen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"LoadTester/config"
+)
+
+// replay hands out recorded requests in order. Timed replays are also
+// the arrival schedule of the run.
+type replay struct {
+	entries []replayEntry
+	speed   float64
+	timed   bool
+	next    atomic.Int64
+}
+
+// replayEntry is a recorded request, offset from the first one
+type replayEntry struct {
+	offset time.Duration
+	target target
+}
+
+// resolveReplay loads the REPLAY_FILE requests, which take the place of
+// the configured ones. Recorded and logged paths are resolved against
+// URL; the absolute URLs of a HAR file are kept.
+func (cfg *Plan) resolveReplay() error {
+	rc := cfg.Replay
+	if rc == nil {
+		return nil
+	}
+	switch strings.ToLower(rc.Format) {
+	case "", config.ReplayCapture:
+		rc.Format = config.ReplayCapture
+	case config.ReplayHAR:
+		rc.Format = config.ReplayHAR
+	case config.ReplayCombined, "common", "nginx", "apache":
+		rc.Format = config.ReplayCombined
+	case config.ReplayALB:
+		rc.Format = config.ReplayALB
+	default:
+		return fmt.Errorf("unknown replay format %q (want capture, har, combined or alb)", rc.Format)
+	}
+	if rc.Speed < 0 {
+		return fmt.Errorf("replay speed must not be negative")
+	}
+	if rc.Speed == 0 {
+		rc.Speed = 1
+	}
+	switch {
+	case len(cfg.Endpoints) > 0 || len(cfg.Scenario) > 0:
+		return fmt.Errorf("replay cannot be combined with endpoints or scenario")
+	case cfg.GRPC != nil || cfg.GraphQL != nil || cfg.Multipart != nil || cfg.network != "" || cfg.dns != nil:
+		return fmt.Errorf("replay sends the recorded requests and cannot be combined with grpc, graphql, multipart, socket or DNS mode")
+	case !rc.IgnoreTiming && (cfg.Rate > 0 || len(cfg.Stages) > 0 || cfg.Pattern != config.PatternConstant):
+		return fmt.Errorf("replay follows the recorded timing and cannot be combined with rate, stages or patterns; set replay ignore_timing to use them")
+	case cfg.Warmup > 0 || cfg.WarmupRequests > 0:
+		return fmt.Errorf("replay cannot be combined with warmup")
+	}
+	base, err := url.Parse(cfg.URL)
+	if err != nil || base.Host == "" {
+		return fmt.Errorf("replay needs an absolute url to send the recorded requests to")
+	}
+	data, err := os.ReadFile(rc.File)
+	if err != nil {
+		return fmt.Errorf("reading replay file: %w", err)
+	}
+	entries, err := replayReaders[rc.Format](data)
+	if err != nil {
+		return fmt.Errorf("replay %s: %w", rc.File, err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("replay %s: no requests", rc.File)
+	}
+	// Requests are replayed in the order they were sent
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+
+	cfg.replay = &replay{speed: rc.Speed, timed: !rc.IgnoreTiming}
+	for i, e := range entries {
+		t, err := cfg.replayTarget(base, e)
+		if err != nil {
+			return fmt.Errorf("replay %s request %d: %w", rc.File, i+1, err)
+		}
+		if rc.Format == config.ReplayHAR {
+			// A HAR file is a page load, reported entry by entry
+			t.Name = fmt.Sprintf("%d %s", i+1, t.Name)
+		}
+		cfg.replay.entries = append(cfg.replay.entries, replayEntry{offset: max(0, e.Time.Sub(entries[0].Time)), target: t})
+	}
+	return nil
+}
+
+// replayReaders parse the supported replay formats
+var replayReaders = map[string]func([]byte) ([]captureEntry, error){
+	config.ReplayCapture:  readCapture,
+	config.ReplayHAR:      readHAR,
+	config.ReplayCombined: readCombinedLog,
+	config.ReplayALB:      readALBLog,
+}
+
+// readCapture parses the JSON Lines written by a Recorder
+func readCapture(data []byte) ([]captureEntry, error) {
+	var entries []captureEntry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 64<<20)
+	for line := 1; sc.Scan(); line++ {
+		text := bytes.TrimSpace(sc.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var e captureEntry
+		if err := json.Unmarshal(text, &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// harFile is the part of an HTTP Archive that is replayed
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			StartedDateTime time.Time `json:"startedDateTime"`
+			Request         struct {
+				Method  string `json:"method"`
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				PostData *struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// readHAR parses the requests of a HAR file as exported by browsers
+func readHAR(data []byte) ([]captureEntry, error) {
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("not a HAR file: %w", err)
+	}
+	entries := make([]captureEntry, 0, len(har.Log.Entries))
+	for _, he := range har.Log.Entries {
+		req := he.Request
+		e := captureEntry{Time: he.StartedDateTime, Method: req.Method, URL: req.URL, Headers: map[string]string{}}
+		for _, h := range req.Headers {
+			name := http.CanonicalHeaderKey(h.Name)
+			if strings.HasPrefix(name, ":") || unrecordedHeaders[name] {
+				continue // HTTP/2 pseudo-headers are set by the transport
+			}
+			if prev, ok := e.Headers[name]; ok {
+				sep := ", "
+				if name == "Cookie" {
+					sep = "; "
+				}
+				h.Value = prev + sep + h.Value
+			}
+			e.Headers[name] = h.Value
+		}
+		if pd := req.PostData; pd != nil {
+			e.Body, e.BodyEncoding = pd.Text, pd.Encoding
+			if pd.MimeType != "" {
+				e.Headers["Content-Type"] = pd.MimeType
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// replayTarget builds the target for a captured request. Headers set in
+// the configuration replace the recorded ones; templates are not
+// expanded, the request is sent as it was recorded.
+func (cfg *Plan) replayTarget(base *url.URL, e captureEntry) (target, error) {
+	ref, err := url.Parse(e.URL)
+	if err != nil {
+		return target{}, fmt.Errorf("invalid url %q", e.URL)
+	}
+	body := e.Body
+	switch e.BodyEncoding {
+	case "":
+	case "base64":
+		data, err := base64.StdEncoding.DecodeString(e.Body)
+		if err != nil {
+			return target{}, fmt.Errorf("decoding body: %w", err)
+		}
+		body = string(data)
+	default:
+		return target{}, fmt.Errorf("unknown body_encoding %q", e.BodyEncoding)
+	}
+	method := strings.ToUpper(e.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	headers := map[string]string{}
+	for name, value := range e.Headers {
+		headers[http.CanonicalHeaderKey(name)] = value
+	}
+	for name, value := range cfg.Headers {
+		headers[http.CanonicalHeaderKey(name)] = value
+	}
+	contentType := headers["Content-Type"]
+	delete(headers, "Content-Type")
+	t := target{
+		Endpoint: config.Endpoint{
+			Name:        method + " " + ref.Path,
+			URL:         base.ResolveReference(ref).String(),
+			Method:      method,
+			Body:        body,
+			ContentType: contentType,
+			Headers:     headers,
+			Weight:      1,
+		},
+		checks: cfg.checks,
+	}
+	t.needBody = checksNeedBody(t.checks)
+	return t, nil
+}
+
+// reset starts the replay over from the first request
+func (rp *replay) reset() {
+	rp.next.Store(0)
+}
+
+// pick returns the next recorded request, wrapping around at the end
+func (rp *replay) pick() *target {
+	i := int(rp.next.Add(1)-1) % len(rp.entries)
+	return &rp.entries[i].target
+}
+
+// at schedules the k-th request at its recorded offset divided by the
+// speed; the schedule ends with the recording
+func (rp *replay) at(k int) (time.Duration, bool) {
+	if k >= len(rp.entries) {
+		return 0, false
+	}
+	return time.Duration(float64(rp.entries[k].offset) / rp.speed), true
+}
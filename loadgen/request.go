@@ -0,0 +1,397 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+// buildFailed fails the attempt in r, which could not be sent, as
+// request_build
+func buildFailed(r *metrics.Result, start time.Time, msg string) {
+	r.Duration = time.Since(start)
+	r.Error = msg
+	r.ErrorType = metrics.ErrTypeRequestBuild
+}
+
+// bodyBuffers holds the buffers response bodies are read into when a check
+// needs their content
+var bodyBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// maxPooledBody is the largest body buffer put back in the pool, so one
+// large response does not keep its memory for the rest of the run
+const maxPooledBody = 1 << 20
+
+// createHTTPClient returns a high-performance HTTP client. Connections
+// still being dialed when ctx ends are abandoned.
+func createHTTPClient(ctx context.Context, cfg *Plan) *http.Client {
+	dialer := &net.Dialer{Timeout: time.Duration(cfg.DialTimeout), KeepAlive: 30 * time.Second}
+	dial := cfg.dialWith(dialer)
+	newTransport := func() *http.Transport {
+		return &http.Transport{
+			DialContext:           dial,
+			Proxy:                 cfg.proxyFunc(),
+			TLSClientConfig:       cfg.tlsConfig,
+			TLSHandshakeTimeout:   time.Duration(cfg.TLSHandshakeTimeout),
+			ResponseHeaderTimeout: time.Duration(cfg.ResponseHeaderTimeout),
+			IdleConnTimeout:       time.Duration(cfg.IdleConnTimeout),
+			Protocols:             cfg.protocols(),
+			MaxIdleConns:          50_000,
+			MaxIdleConnsPerHost:   50_000,
+			MaxConnsPerHost:       cfg.MaxConnsPerHost,
+			DisableKeepAlives:     !cfg.KeepAlive,
+			DisableCompression:    cfg.AcceptEncoding != "",
+		}
+	}
+	var transport http.RoundTripper
+	switch {
+	case cfg.Engine == config.EngineFastHTTP:
+		transport = newFastTransport(ctx, cfg, dial)
+	case cfg.HTTPVersion == config.HTTP3:
+		transport = cfg.newHTTP3Transport()
+	case cfg.H2MaxStreams > 0:
+		transport = newStreamLimiter(newTransport, cfg.Concurrency, cfg.H2MaxStreams, cfg.MaxConnsPerHost)
+	default:
+		transport = newTransport()
+	}
+
+	return &http.Client{
+		Timeout:       time.Duration(cfg.Timeout),
+		Transport:     transport,
+		CheckRedirect: cfg.checkRedirect,
+	}
+}
+
+// newRequest builds the HTTP request for an endpoint. The body is
+// re-wrapped on every call so retries resend the full payload.
+func newRequest(ctx context.Context, ep *target, agent string) (*http.Request, error) {
+	var body io.Reader
+	switch {
+	case ep.stream > 0:
+		body = newStreamBody(ep.stream)
+	case ep.Body != "":
+		body = strings.NewReader(ep.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, ep.Method, ep.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	if ep.header != nil {
+		req.Header = ep.header.Clone()
+		if _, ok := req.Header["User-Agent"]; !ok {
+			req.Header["User-Agent"] = []string{agent}
+		}
+		return req, nil
+	}
+	req.Header.Set("User-Agent", agent)
+	if ep.ContentType != "" {
+		req.Header.Set("Content-Type", ep.ContentType)
+	}
+	for name, value := range ep.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+// requestSize returns the size of req as written in HTTP/1.1: request
+// line, headers and body. HTTP/2 compresses the headers, so less is sent.
+// Of a streamed body, the part sent so far counts.
+func requestSize(req *http.Request) int64 {
+	n := len(req.Method) + len(req.URL.RequestURI()) + len(" HTTP/1.1\r\n") + len("Host: \r\n") + len(req.Host) + 2
+	if req.Host == "" {
+		n += len(req.URL.Host)
+	}
+	n += headerSize(req.Header)
+	if b, ok := req.Body.(*streamBody); ok {
+		return int64(n) + b.sent.Load()
+	}
+	return int64(n) + max(0, req.ContentLength)
+}
+
+// responseSize returns the size of resp's status line and headers, plus
+// the body bytes read
+func responseSize(resp *http.Response, body int64) int64 {
+	return int64(len(resp.Proto)+1+len(resp.Status)+2+headerSize(resp.Header)+2) + body
+}
+
+// headerSize returns the size of h written as "Name: value" lines
+func headerSize(h http.Header) int {
+	n := 0
+	for name, values := range h {
+		for _, v := range values {
+			n += len(name) + len(v) + 4
+		}
+	}
+	return n
+}
+
+// worker executes a single HTTP request against a weighted endpoint as
+// user, the virtual user of the goroutine sending it, or a user borrowed
+// from users when nil. Cancelling ctx aborts the request; warm marks it as
+// a warm-up request and due is its scheduled send time in the open model.
+func worker(ctx context.Context, client *http.Client, users *virtualUsers, user *virtualUser, cfg *Plan, id int, warm bool, due time.Time, results chan<- metrics.Result) {
+	client, vu, release := users.client(client, user)
+	defer release()
+	var vars map[string]string
+	if cfg.feeder != nil {
+		vars = cfg.feeder.row()
+	}
+	if vu != nil {
+		vars = withCredentials(vars, vu.creds)
+		ctx = withUserAgent(ctx, vu.agent)
+	}
+	ep := cfg.pickEndpoint()
+	var r metrics.Result
+	switch {
+	case ep.dns != nil:
+		r = doDNS(ctx, cfg, ep, id)
+	case ep.network != "":
+		r = doSocket(ctx, cfg, ep, id, vars)
+	default:
+		r = doRequest(ctx, client, cfg, ep, id, vars)
+	}
+	r.Warmup = warm
+	r.Scheduled = due
+	results <- r
+}
+
+// doRequest sends one request to ep, retrying failures as the retry
+// settings allow. Templates in ep are rendered against vars, and the
+// endpoint's extracted values, and its after function's changes, are
+// stored back into vars. An aborted
+// request is not retried.
+func doRequest(ctx context.Context, client *http.Client, cfg *Plan, ep *target, id int, vars map[string]string) metrics.Result {
+	var r metrics.Result
+	r.RequestID = id
+	start := time.Now()
+	r.Timestamp = start
+	r.Endpoint = ep.Name
+	var sp *span
+	if cfg.tracer != nil {
+		ctx, sp = cfg.tracer.start(ctx, ep.Name, spanKindClient)
+		defer func() {
+			attrs := []otlpAttr{
+				strAttr("http.request.method", ep.Method),
+				strAttr("loadtester.endpoint", r.Endpoint),
+				intAttr("loadtester.request_id", r.RequestID),
+				intAttr("loadtester.retries", r.Retries),
+			}
+			if r.Status > 0 {
+				attrs = append(attrs, intAttr("http.response.status_code", r.Status))
+			}
+			cfg.tracer.finish(sp, r.ErrorType, r.Error, attrs...)
+		}()
+	}
+	target, err := ep.expand(vars)
+	if err != nil {
+		r.Error = err.Error()
+		r.ErrorType = metrics.ErrTypeRequestBuild
+		return r
+	}
+	// Retries keep the User-Agent of the first attempt
+	agent := cfg.userAgent(ctx)
+	var retryAfter string
+	// The last attempt's exchange, kept for the capture file
+	var capReq *http.Request
+	var capResp *http.Response
+	var capBody []byte
+	var capSize int64
+	var capTimer *phaseTimer
+	// Reused by every attempt and returned to the pool once the capture
+	// holds its own copy of the body
+	var bodyBuf *bytes.Buffer
+	defer func() {
+		if bodyBuf != nil && bodyBuf.Cap() <= maxPooledBody {
+			bodyBuffers.Put(bodyBuf)
+		}
+	}()
+	// Requests and results are not pooled: a request's context can only
+	// be set by building a new one, and results are passed by value. The
+	// attempt's timer, with its trace hooks, is.
+	var timer *phaseTimer
+	defer func() { timer.release() }()
+	for attempt := 0; cfg.nextAttempt(ctx, attempt, &r, retryAfter); attempt++ {
+		retryAfter = ""
+		r.Retries = attempt
+		startAttempt(&r)
+		capReq, capResp, capBody, capTimer = nil, nil, nil, nil
+		timer.release()
+		var traced context.Context
+		timer, traced = newTimer(ctx)
+		req, err := newRequest(traced, target, agent)
+		if err != nil {
+			buildFailed(&r, start, err.Error())
+			break
+		}
+
+		if sp != nil {
+			// The server's spans of every attempt are children of the
+			// request's span
+			req.Header.Set("Traceparent", sp.traceparent())
+		}
+		if err := cfg.modify(req); err != nil {
+			buildFailed(&r, start, "modifying request: "+err.Error())
+			break
+		}
+
+		timer.sent = time.Now()
+		resp, err := client.Do(req)
+		r.Redirects = timer.followed()
+		if cfg.capturing() {
+			capReq, capResp, capBody, capTimer = req, resp, nil, timer
+		}
+		r.IPFamily = timer.ipFamily()
+		r.NewConn = timer.opened()
+		r.TLSHandshake = false
+
+		if err != nil {
+			r.Duration = time.Since(start)
+			r.Phases = timer.phases(time.Now())
+			r.Status = 0
+			if resp != nil {
+				// The last redirect of a request that reached MaxRedirects
+				r.Status = resp.StatusCode
+			}
+			r.Encoding, r.EncodedBytes, r.DecodedBytes = "", 0, 0
+			r.Error = err.Error()
+			r.ErrorType = classifyError(err)
+			continue
+		}
+
+		// Only buffer the body when a check needs its content
+		var body []byte
+		var size int64
+		src, wire, readErr := cfg.responseBody(resp)
+		switch {
+		case readErr != nil:
+		case ep.needBody || len(cfg.Validators) > 0:
+			if bodyBuf == nil {
+				bodyBuf = bodyBuffers.Get().(*bytes.Buffer)
+			}
+			bodyBuf.Reset()
+			size, readErr = bodyBuf.ReadFrom(src)
+			body = bodyBuf.Bytes()
+			capBody = body
+		case cfg.capturing():
+			head := headBuffer{n: cfg.CaptureBody}
+			size, readErr = io.Copy(&head, src)
+			capBody = head.buf
+		default:
+			size, readErr = io.Copy(io.Discard, src)
+		}
+		capSize = size
+		resp.Body.Close()
+		bodyDone := time.Now()
+		r.Duration = bodyDone.Sub(start)
+		r.Phases = timer.phases(bodyDone)
+
+		received := size
+		r.Encoding = resp.Header.Get("Content-Encoding")
+		r.EncodedBytes, r.DecodedBytes = 0, 0
+		if wire != nil {
+			received = wire.n
+			r.EncodedBytes, r.DecodedBytes = wire.n, size
+		}
+		r.BytesSent += requestSize(req)
+		r.BytesReceived += responseSize(resp, received)
+		r.Status = resp.StatusCode
+		r.Proto = resp.Proto
+		if resp.TLS != nil {
+			// A new connection's handshake may have been traced on the
+			// request that dialed it, so it is inferred here
+			r.TLSHandshake = r.NewConn
+			r.TLSVersion = tls.VersionName(resp.TLS.Version)
+			r.TLSCipher = tls.CipherSuiteName(resp.TLS.CipherSuite)
+		}
+		if resp.StatusCode >= 400 {
+			r.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+			r.ErrorType = classifyStatus(resp.StatusCode)
+			retryAfter = resp.Header.Get("Retry-After")
+			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+				r.Throttled = true
+				r.RetryAfter, _ = parseRetryAfter(retryAfter)
+			}
+			continue
+		}
+		if readErr != nil {
+			r.Error = "reading body: " + readErr.Error()
+			r.ErrorType = metrics.ErrTypeBodyRead
+			switch {
+			case errors.Is(readErr, io.ErrUnexpectedEOF):
+				// The connection ended before Content-Length bytes, the
+				// last chunk or the end of the compressed stream
+				r.Error = "body truncated"
+				if resp.ContentLength >= 0 {
+					r.Error = fmt.Sprintf("body truncated: %d of %d bytes", received, resp.ContentLength)
+				}
+				r.ErrorType = metrics.ErrTypeTruncated
+			case classifyError(readErr) == metrics.ErrTypeTimeout:
+				r.ErrorType = metrics.ErrTypeTimeout
+			}
+			continue
+		}
+		if ep.grpc != nil {
+			var msg string
+			r.GRPCStatus, msg = grpcStatus(resp)
+			if r.GRPCStatus != "OK" {
+				r.Error = "gRPC " + r.GRPCStatus + ": " + msg
+				r.ErrorType = metrics.ErrTypeGRPC
+				continue
+			}
+		}
+		if ep.graphql {
+			if msg, failed := graphQLErrors(body); failed {
+				r.Error = "GraphQL: " + msg
+				r.ErrorType = metrics.ErrTypeGraphQL
+				continue
+			}
+		}
+		if msg := runChecks(ep.checks, body, size); msg != "" {
+			r.Error = "check failed: " + msg
+			r.ErrorType = metrics.ErrTypeCheck
+			continue
+		}
+		if err := cfg.validate(resp, body); err != nil {
+			r.Error = "check failed: " + err.Error()
+			r.ErrorType = metrics.ErrTypeCheck
+			continue
+		}
+		if vars != nil {
+			if err := runExtractors(ep.extract, resp.Header, body, vars); err != nil {
+				r.Error = "extract failed: " + err.Error()
+				r.ErrorType = metrics.ErrTypeExtract
+				continue
+			}
+		}
+		if ep.After != "" {
+			if err := scriptFrom(ctx).after(ep.After, resp, body, vars); err != nil {
+				r.Error = "check failed: after: " + err.Error()
+				r.ErrorType = metrics.ErrTypeCheck
+				continue
+			}
+		}
+		r.Error = ""
+		r.ErrorType = ""
+		break
+	}
+	finishAttempt(&r)
+	if capReq != nil && (r.Error != "" || cfg.captures(id)) {
+		r.Capture = cfg.newCapture(capReq, target.Body, capResp, capBody, capSize, capTimer)
+	}
+	return r
+}
@@ -0,0 +1,50 @@
+package loadgen
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"LoadTester/config"
+)
+
+// BenchmarkDoRequest measures the allocations of one request on the hot
+// path, against a local server over a kept-alive connection
+func BenchmarkDoRequest(b *testing.B) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	for _, bc := range []struct {
+		name  string
+		setup func(*config.Config)
+	}{
+		{name: "get", setup: func(c *config.Config) {}},
+		{name: "post", setup: func(c *config.Config) {
+			c.Method, c.Body, c.ContentType = http.MethodPost, `{"item": "book"}`, "application/json"
+		}},
+		{name: "checked", setup: func(c *config.Config) { c.Checks = []config.Check{{Contains: "ok"}} }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			cfg := config.Default()
+			cfg.URL = srv.URL + "/items?page=1"
+			cfg.Headers = map[string]string{"Accept": "application/json"}
+			bc.setup(&cfg)
+			plan, err := Compile(cfg)
+			if err != nil {
+				b.Fatal(err)
+			}
+			ctx := context.Background()
+			client := createHTTPClient(ctx, plan)
+			defer client.CloseIdleConnections()
+			b.ReportAllocs()
+			for i := 0; b.Loop(); i++ {
+				if r := doRequest(ctx, client, plan, &plan.targets[0], i, nil); r.Error != "" {
+					b.Fatal(r.Error)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package loadgen
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"LoadTester/config"
+)
+
+// requestMemory is roughly what a request in flight costs the generator:
+// its goroutine, connection buffers and TLS state
+const requestMemory = 64 << 10
+
+// containerLimits are the CPU and memory limits of the generator's
+// container, zero when not limited
+type containerLimits struct {
+	CPUs   float64
+	Memory int64 // bytes
+}
+
+// resolveResources validates the resource guard settings, caps the
+// concurrency and prepares the notes Run prints about them
+func (cfg *Plan) resolveResources() error {
+	switch strings.ToLower(cfg.ResourceGuard) {
+	case "", config.GuardWarn:
+		cfg.ResourceGuard = config.GuardWarn
+	case config.GuardCap, config.GuardOff:
+		cfg.ResourceGuard = strings.ToLower(cfg.ResourceGuard)
+	default:
+		return fmt.Errorf("unknown resource_guard %q (want warn, cap or off)", cfg.ResourceGuard)
+	}
+	if cfg.MaxProcs < 0 || cfg.MaxConcurrency < 0 {
+		return fmt.Errorf("max_procs and max_concurrency must not be negative")
+	}
+	if cfg.MaxConcurrency > 0 && cfg.Concurrency > cfg.MaxConcurrency {
+		cfg.notes = append(cfg.notes, fmt.Sprintf("Concurrency lowered from %d to max_concurrency %d", cfg.Concurrency, cfg.MaxConcurrency))
+		cfg.Concurrency = cfg.MaxConcurrency
+	}
+	if cfg.ResourceGuard == config.GuardOff || len(cfg.Agents) > 0 {
+		// Agents check their own containers
+		return nil
+	}
+	cfg.limits = readContainerLimits()
+	if cfg.limits.Memory <= 0 {
+		return nil
+	}
+	// Half the memory is left for responses, results and the runtime
+	fit := max(1, int(cfg.limits.Memory/2/requestMemory))
+	if cfg.Concurrency <= fit {
+		return nil
+	}
+	if cfg.ResourceGuard == config.GuardCap {
+		cfg.notes = append(cfg.notes, fmt.Sprintf("Concurrency lowered from %d to %d to fit the container's %s memory limit",
+			cfg.Concurrency, fit, formatMemory(cfg.limits.Memory)))
+		cfg.Concurrency = fit
+		return nil
+	}
+	cfg.notes = append(cfg.notes, fmt.Sprintf("Warning: %d concurrent requests may not fit the container's %s memory limit, about %d do; lower -c or set -resource-guard cap",
+		cfg.Concurrency, formatMemory(cfg.limits.Memory), fit))
+	return nil
+}
+
+// applyResources sizes the Go runtime to the container's limits: its CPU
+// limit bounds GOMAXPROCS, which otherwise counts every CPU of the host,
+// unless GOMAXPROCS is set, and the GC works harder as memory nears the
+// limit rather than let the container be killed. It runs once, before the
+// first run.
+func (cfg *Plan) applyResources() {
+	procs := cfg.MaxProcs
+	if procs == 0 && cfg.limits.CPUs > 0 && os.Getenv("GOMAXPROCS") == "" {
+		procs = min(runtime.NumCPU(), int(math.Ceil(cfg.limits.CPUs)))
+		if procs != runtime.GOMAXPROCS(0) {
+			cfg.notes = append(cfg.notes, fmt.Sprintf("Using %d CPUs for the container's CPU limit of %.2f", procs, cfg.limits.CPUs))
+		}
+	}
+	if procs > 0 {
+		runtime.GOMAXPROCS(procs)
+	}
+	// A GOMEMLIMIT set by the user is kept
+	if cfg.limits.Memory > 0 && debug.SetMemoryLimit(-1) == math.MaxInt64 {
+		debug.SetMemoryLimit(cfg.limits.Memory / 10 * 9)
+	}
+	for _, note := range cfg.notes {
+		cfg.logf("%s\n", note)
+	}
+}
+
+// formatMemory renders a byte count in binary units, e.g. "512 MiB"
+func formatMemory(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%d MiB", n>>20)
+	}
+	return fmt.Sprintf("%d KiB", n>>10)
+}
+
+// fileReserve is how many files the generator keeps open besides its
+// connections: reports, logs, listeners and the runtime's own
+const fileReserve = 64
+
+// connsAtOnce estimates how many connections the test can have open at
+// once. In the closed model every virtual user has one. In the open model
+// arrivals do not wait for earlier requests, so as many can be in flight
+// as arrive at the peak rate within the timeout; without a timeout or a
+// known rate, Concurrency is the estimate. MaxInFlight and MaxConns cap it.
+func (cfg *Plan) connsAtOnce() int {
+	conns := cfg.Concurrency
+	if cfg.Model == config.ModelOpen {
+		peak := cfg.Rate
+		for _, st := range cfg.Stages {
+			peak = max(peak, st.Target)
+		}
+		if peak > 0 && cfg.Timeout > 0 {
+			conns = int(math.Ceil(peak * time.Duration(cfg.Timeout).Seconds()))
+		}
+	}
+	if cfg.MaxInFlight > 0 {
+		conns = min(conns, cfg.MaxInFlight)
+	}
+	if cfg.MaxConns > 0 {
+		conns = min(conns, cfg.MaxConns)
+	}
+	return conns
+}
+
+// RaiseOpenFiles checks that the process may open a file for every
+// connection the test can open at once, raising its limit if needed, so
+// the test fails before it starts rather than with "too many open files"
+// errors. It is called once, before the first run.
+func (cfg *Plan) RaiseOpenFiles() error {
+	if len(cfg.Agents) > 0 {
+		// Agents check their own limits
+		return nil
+	}
+	conns := cfg.connsAtOnce()
+	need := uint64(conns + fileReserve)
+	limit, was := raiseOpenFiles(need)
+	switch {
+	case limit == 0:
+		return nil
+	case limit < need && cfg.Model == config.ModelOpen:
+		return fmt.Errorf("%d requests in flight at once need about %d open files, but the limit is %d and cannot be raised: run ulimit -n %d first, or lower the rate or timeout, or set max_in_flight",
+			conns, need, limit, need)
+	case limit < need:
+		return fmt.Errorf("%d concurrent connections need about %d open files, but the limit is %d and cannot be raised: run ulimit -n %d first, or lower concurrency or max_conns",
+			conns, need, limit, need)
+	case limit > was:
+		cfg.notes = append(cfg.notes, fmt.Sprintf("Raised the open file limit from %d to %d", was, limit))
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+// retryBudgetFloor is how many retries a run may make before the retry
+// budget applies, so the first failures of a run can still be retried
+const retryBudgetFloor = 10
+
+// retryBudget counts the requests and retries of a run
+type retryBudget struct {
+	requests atomic.Int64
+	retries  atomic.Int64
+}
+
+func (b *retryBudget) reset() {
+	b.requests.Store(0)
+	b.retries.Store(0)
+}
+
+// take reserves a retry if fewer than ratio times the requests so far
+// have been used, ratio 0 meaning no limit
+func (b *retryBudget) take(ratio float64) bool {
+	n := b.retries.Add(1)
+	if ratio <= 0 || n <= retryBudgetFloor || float64(n) <= ratio*float64(b.requests.Load()) {
+		return true
+	}
+	b.retries.Add(-1)
+	return false
+}
+
+// resolveRetries validates the retry settings
+func (cfg *Plan) resolveRetries() error {
+	if cfg.MaxRetries < 0 {
+		return fmt.Errorf("retries must not be negative")
+	}
+	if cfg.RetryBackoff < 0 || cfg.RetryBackoffMax < 0 {
+		return fmt.Errorf("retry backoff must not be negative")
+	}
+	if cfg.RetryJitter < 0 || cfg.RetryJitter > 1 {
+		return fmt.Errorf("retry_jitter must be between 0 and 1")
+	}
+	if cfg.RetryBudget < 0 {
+		return fmt.Errorf("retry_budget must not be negative")
+	}
+	cfg.retryOn = map[string]bool{}
+	for _, c := range cfg.RetryOn {
+		c = strings.ToLower(strings.TrimSpace(c))
+		switch c {
+		case config.RetryNetwork, config.Retry5xx, config.Retry429, config.Retry4xx, config.RetryCheck:
+			cfg.retryOn[c] = true
+		default:
+			return fmt.Errorf("unknown retry_on %q (want network, 5xx, 429, 4xx or check)", c)
+		}
+	}
+	return nil
+}
+
+// retryCategory returns the RETRY_ON category of a failed attempt, or ""
+// for failures that are never retried
+func retryCategory(r *metrics.Result) string {
+	switch r.ErrorType {
+	case metrics.ErrTypeHTTP5xx:
+		return config.Retry5xx
+	case metrics.ErrTypeHTTP4xx:
+		if r.Status == http.StatusTooManyRequests {
+			return config.Retry429
+		}
+		return config.Retry4xx
+	case metrics.ErrTypeCheck, metrics.ErrTypeExtract, metrics.ErrTypeGRPC, metrics.ErrTypeGraphQL, metrics.ErrTypeDNSRcode:
+		return config.RetryCheck
+	case metrics.ErrTypeRequestBuild, metrics.ErrTypeCancelled, metrics.ErrTypeRedirects:
+		return ""
+	}
+	return config.RetryNetwork
+}
+
+// nextAttempt reports whether attempt number attempt of the request in r
+// should be made. The first attempt always is; later ones only when the
+// last one failed in a way RETRY_ON covers, MaxRetries is not reached and
+// the retry budget allows it. It then waits for the backoff, or for
+// retryAfter (a Retry-After header value) when given, records the failed
+// attempt in r.Attempts and starts the record of the next one, which
+// finishAttempt completes.
+func (cfg *Plan) nextAttempt(ctx context.Context, attempt int, r *metrics.Result, retryAfter string) bool {
+	if attempt == 0 {
+		cfg.budget.requests.Add(1)
+		return true
+	}
+	if attempt > cfg.MaxRetries || ctx.Err() != nil || !cfg.retryOn[retryCategory(r)] {
+		return false
+	}
+	if !cfg.budget.take(cfg.RetryBudget) {
+		r.RetryDenied = true
+		return false
+	}
+	delay := cfg.backoff(attempt, retryAfter, cfg.Deadline())
+	if delay > 0 {
+		wait := time.NewTimer(delay)
+		defer wait.Stop()
+		select {
+		case <-wait.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	if len(r.Attempts) == 0 {
+		// The first attempt is only recorded once there is a second
+		r.Attempts = append(r.Attempts, metrics.Attempt{Number: 1})
+	}
+	finishAttempt(r)
+	r.Attempts[len(r.Attempts)-1].Backoff = delay
+	r.Attempts = append(r.Attempts, metrics.Attempt{
+		Number: attempt + 1,
+		Start:  time.Since(r.Timestamp),
+	})
+	return true
+}
+
+// startAttempt clears what the previous attempt of r got back, so that
+// none of it is taken for the outcome of the next one. The counters of
+// every attempt and whether any was throttled are kept.
+func startAttempt(r *metrics.Result) {
+	r.Status, r.Proto, r.Error, r.ErrorType = 0, "", "", ""
+	r.TLSVersion, r.TLSCipher, r.IPFamily = "", "", ""
+	r.NewConn, r.TLSHandshake = false, false
+	r.GRPCStatus, r.DNSRcode = "", ""
+	r.Encoding, r.EncodedBytes, r.DecodedBytes = "", 0, 0
+	r.Phases, r.Redirects = metrics.Phases{}, nil
+}
+
+// finishAttempt records the outcome of the attempt in progress, as it
+// stands in r, in the last of r.Attempts and sets r.AttemptDuration.
+// r.Duration must end with the attempt.
+func finishAttempt(r *metrics.Result) {
+	r.AttemptDuration = r.Duration
+	if len(r.Attempts) == 0 {
+		return
+	}
+	a := &r.Attempts[len(r.Attempts)-1]
+	a.Status, a.ErrorType = r.Status, r.ErrorType
+	a.Duration = r.Duration - a.Start
+	r.AttemptDuration = a.Duration
+}
+
+// backoff returns the wait before retry number attempt: RetryBackoff
+// doubled for each earlier retry, capped at RetryBackoffMax and shortened
+// by up to RetryJitter. A Retry-After value takes precedence, capped at
+// RetryBackoffMax and at the time left before end, the end of the run or
+// zero for none, so that a server cannot park the request for longer than
+// the test runs.
+func (cfg *Plan) backoff(attempt int, retryAfter string, end time.Time) time.Duration {
+	if d, ok := parseRetryAfter(retryAfter); ok {
+		if cfg.RetryBackoffMax > 0 {
+			d = min(d, time.Duration(cfg.RetryBackoffMax))
+		}
+		if !end.IsZero() {
+			d = min(d, max(0, time.Until(end)))
+		}
+		return d
+	}
+	d := time.Duration(cfg.RetryBackoff)
+	capped := cfg.RetryBackoffMax > 0
+	// Uncapped, the doubling stops before it overflows
+	for i := 1; i < attempt && (!capped || d < time.Duration(cfg.RetryBackoffMax)) && d <= math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if capped {
+		d = min(d, time.Duration(cfg.RetryBackoffMax))
+	}
+	return d - time.Duration(rand.Float64()*cfg.RetryJitter*float64(d))
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an
+// HTTP date
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(0, time.Until(t)), true
+	}
+	return 0, false
+}
@@ -0,0 +1,102 @@
+package loadgen
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+func TestBackoffCapsRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		backoffMax time.Duration
+		end        time.Duration // from now, zero for none
+		retryAfter string
+		want       time.Duration // upper bound
+		wantMin    time.Duration
+	}{
+		{name: "honoured", backoffMax: 5 * time.Second, retryAfter: "2", want: 2 * time.Second, wantMin: 2 * time.Second},
+		{name: "capped at backoff max", backoffMax: 5 * time.Second, retryAfter: "86400", want: 5 * time.Second, wantMin: 5 * time.Second},
+		{name: "no backoff max", retryAfter: "86400", want: 24 * time.Hour, wantMin: 24 * time.Hour},
+		{name: "capped at end", end: 2 * time.Second, retryAfter: "86400", want: 2 * time.Second, wantMin: time.Second},
+		{name: "end passed", end: -time.Second, backoffMax: 5 * time.Second, retryAfter: "10", want: 0},
+		{name: "http date", backoffMax: 5 * time.Second, retryAfter: time.Now().Add(48 * time.Hour).UTC().Format(http.TimeFormat), want: 5 * time.Second, wantMin: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Plan{Config: config.Config{RetryBackoffMax: config.Duration(tt.backoffMax)}}
+			var end time.Time
+			if tt.end != 0 {
+				end = time.Now().Add(tt.end)
+			}
+			got := cfg.backoff(1, tt.retryAfter, end)
+			if got > tt.want || got < tt.wantMin {
+				t.Errorf("backoff = %v, want between %v and %v", got, tt.wantMin, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffDoubles(t *testing.T) {
+	tests := []struct {
+		name       string
+		backoffMax time.Duration
+		attempt    int
+		want       time.Duration
+	}{
+		{name: "first retry", backoffMax: 10 * time.Second, attempt: 1, want: 100 * time.Millisecond},
+		{name: "third retry", backoffMax: 10 * time.Second, attempt: 3, want: 400 * time.Millisecond},
+		{name: "capped", backoffMax: 300 * time.Millisecond, attempt: 3, want: 300 * time.Millisecond},
+		{name: "no cap", attempt: 5, want: 1600 * time.Millisecond},
+		{name: "no cap, many retries", attempt: 80, want: 100 * time.Millisecond << 36},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Plan{Config: config.Config{
+				RetryBackoff:    config.Duration(100 * time.Millisecond),
+				RetryBackoffMax: config.Duration(tt.backoffMax),
+			}}
+			if got := cfg.backoff(tt.attempt, "", time.Time{}); got != tt.want {
+				t.Errorf("backoff = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRetryAfterEndsWithMaxDuration checks that a Retry-After far beyond
+// MaxDuration does not hold a run up past it
+func TestRetryAfterEndsWithMaxDuration(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	cfg := config.Default()
+	cfg.URL = srv.URL
+	cfg.Requests, cfg.Concurrency = 1, 1
+	cfg.MaxRetries = 1
+	cfg.RetryBackoffMax = 0
+	cfg.MaxDuration = config.Duration(time.Second)
+	plan, err := Compile(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	var results []metrics.Result
+	plan.Run(context.Background(), 1, metrics.NewLive(), func(r metrics.Result) { results = append(results, r) })
+	if took := time.Since(start); took > 3*time.Second {
+		t.Errorf("run took %v with a max duration of 1s", took)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	if r := results[0]; r.Status != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", r.Status)
+	}
+}
@@ -0,0 +1,438 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+// Run executes a single run of the plan. Every result is passed to
+// observe, from one goroutine, before it is added to the returned stats;
+// observe may be nil. Cancelling ctx stops sending new requests; those in
+// flight get ShutdownGrace to complete and are counted, and any still
+// running after that are aborted and recorded as cancelled. Time spent
+// paused does not count towards the run's duration or arrival schedule.
+// Warm-up requests come first, on the same schedule, and are flagged in
+// their results rather than counted. A tripped circuit breaker either
+// stops sending, setting the stats' Aborted reason, or holds back new
+// requests for the cool-down. Stop conditions and MaxDuration stop
+// sending too, and set the Aborted reason.
+func (cfg *Plan) Run(ctx context.Context, run int, live *metrics.Live, observe func(metrics.Result)) *metrics.RunStats {
+	live.StartRun(run)
+	cfg.notesOnce.Do(cfg.applyResources)
+	// Reaching MaxDuration is handled like an interrupt: requests in
+	// flight get ShutdownGrace to complete
+	if deadline := cfg.Deadline(); !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadlineCause(ctx, deadline, errMaxDuration)
+		defer cancel()
+	}
+	cfg.budget.reset()
+	if cfg.tracer != nil {
+		cfg.tracer.begin(run)
+		defer cfg.tracer.end()
+	}
+	reqCtx, abort := context.WithCancel(context.WithoutCancel(ctx))
+	defer abort()
+	stopGrace := context.AfterFunc(ctx, func() {
+		grace := time.NewTimer(time.Duration(cfg.ShutdownGrace))
+		defer grace.Stop()
+		select {
+		case <-grace.C:
+			abort()
+		case <-reqCtx.Done():
+		}
+	})
+	defer stopGrace()
+	client := createHTTPClient(reqCtx, cfg)
+	watch := watchGenerator(live)
+	results := make(chan metrics.Result, cfg.Concurrency)
+	var wg sync.WaitGroup
+	startRun := time.Now()
+	pausedBefore := cfg.pause.pausedFor()
+	paused := func() time.Duration { return cfg.pause.pausedFor() - pausedBefore }
+	active := func() time.Duration { return time.Since(startRun) - paused() }
+
+	// Requests held back by the circuit breaker, or by the adaptive rate
+	// for a Retry-After, shift the arrival schedule like a pause but count
+	// towards the run's duration
+	sendCtx, stopSending := context.WithCancel(ctx)
+	defer stopSending()
+	brk := newBreaker(&cfg.Config, startRun)
+	stop := newStopConditions(&cfg.Config)
+	var throttle pauseGate
+	var closeBreaker *time.Timer
+	adapt := newAdaptiveRate(&cfg.Config, startRun)
+	var retryAfter pauseGate
+	var endRetryAfter *time.Timer
+	held := func() time.Duration { return paused() + throttle.pausedFor() + retryAfter.pausedFor() }
+
+	// A slot for each virtual user of the closed model, some of which the
+	// step pattern holds back at first
+	sem := make(chan struct{}, cfg.Concurrency)
+	// MaxInFlight caps requests in flight in every model, holding back
+	// arrivals in rate mode
+	var inFlight chan struct{}
+	if cfg.MaxInFlight > 0 {
+		inFlight = make(chan struct{}, cfg.MaxInFlight)
+	}
+
+	// In the open model requests are launched on a fixed schedule
+	// regardless of how many are still in flight, so a slow server cannot
+	// hold back arrivals and hide its latency. In the closed model
+	// Concurrency virtual users each send their next request only once
+	// the previous one completed.
+	openModel := cfg.Model == config.ModelOpen
+	schedule := newSchedule(&cfg.Config)
+	limit := cfg.Requests
+	if cfg.Duration > 0 || len(cfg.Stages) > 0 {
+		limit = math.MaxInt
+	}
+	if cfg.replay != nil {
+		// A replay sends the recording once, looping over it only to
+		// fill a set duration when the timing is ignored
+		cfg.replay.reset()
+		if cfg.replay.timed {
+			schedule = cfg.replay
+		}
+		if cfg.replay.timed || cfg.Duration == 0 {
+			limit = len(cfg.replay.entries)
+		}
+	}
+	if cfg.feeder != nil {
+		cfg.feeder.reset()
+		limit = cfg.feeder.limit(limit)
+	}
+
+	// Collect results while requests are still being sent
+	stats := metrics.NewRunStats(run, startRun)
+	var measureStart atomic.Int64 // UnixNano at the end of the warm-up
+	var measureAfter atomic.Int64 // active time at the end of the warm-up
+	warmup := cfg.Warmup > 0 || cfg.WarmupRequests > 0
+
+	// runLeft returns the time left before MaxDuration or Duration ends
+	// the run, and false when only its request count does. Duration is
+	// counted once the warm-up is over.
+	runLeft := func() (time.Duration, bool) {
+		left, ok := time.Duration(math.MaxInt64), false
+		if deadline := cfg.Deadline(); !deadline.IsZero() {
+			left, ok = time.Until(deadline), true
+		}
+		if cfg.Duration > 0 && (!warmup || measureStart.Load() != 0) {
+			measured := active() - time.Duration(measureAfter.Load())
+			left, ok = min(left, time.Duration(cfg.Duration)-measured), true
+		}
+		return max(0, left), ok
+	}
+
+	// checkBreaker feeds a result to the circuit breaker and reacts if it
+	// trips; it runs on the collector goroutine
+	checkBreaker := func(r metrics.Result) {
+		if brk == nil || throttle.paused() {
+			return
+		}
+		if rate, tripped := brk.observe(r, time.Now()); tripped {
+			stats.BreakerTrips++
+			reason := fmt.Sprintf("%.1f%% of requests failed in the last %s", rate*100, time.Duration(cfg.BreakerWindow))
+			if cfg.BreakerAction == config.BreakerThrottle {
+				cfg.logf("Circuit breaker tripped: %s, holding back requests for %s\n", reason, time.Duration(cfg.BreakerCooldown))
+				throttle.pause()
+				brk.reset()
+				closeBreaker = time.AfterFunc(time.Duration(cfg.BreakerCooldown), func() {
+					throttle.resume()
+					cfg.logf("Circuit breaker closed, sending again\n")
+				})
+			} else {
+				cfg.logf("Circuit breaker tripped: %s, aborting the test\n", reason)
+				stats.Aborted = "circuit breaker tripped: " + reason
+				stopSending()
+				brk = nil
+			}
+		}
+	}
+
+	// checkAdaptive backs the adaptive rate off when a result was
+	// throttled, on the collector goroutine
+	checkAdaptive := func(r metrics.Result) {
+		if adapt == nil {
+			return
+		}
+		rate, slowed := adapt.observe(r, active())
+		if !slowed {
+			return
+		}
+		stats.RateBackoffs++
+		// Like a retry, the wait is capped so that a server cannot hold
+		// the run up beyond its end
+		wait := r.RetryAfter
+		if cfg.RetryBackoffMax > 0 {
+			wait = min(wait, time.Duration(cfg.RetryBackoffMax))
+		}
+		if left, ok := runLeft(); ok {
+			wait = min(wait, left)
+		}
+		if wait > 0 && retryAfter.pause() {
+			cfg.logf("Throttled: rate lowered to %.1f req/s, waiting %s as asked by Retry-After\n", rate, wait)
+			endRetryAfter = time.AfterFunc(wait, func() {
+				adapt.resumed()
+				retryAfter.resume()
+			})
+		} else {
+			cfg.logf("Throttled: rate lowered to %.1f req/s\n", rate)
+		}
+	}
+
+	// checkStop feeds a result to the stop conditions, on the collector
+	// goroutine
+	checkStop := func(r metrics.Result) {
+		if stop == nil || stats.Aborted != "" {
+			return
+		}
+		if reason := stop.observe(r); reason != "" {
+			cfg.logf("Stop condition met: %s, stopping the test\n", reason)
+			stats.Aborted = reason
+			stopSending()
+			stop = nil
+		}
+	}
+
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		measuring := false
+		for r := range results {
+			if !r.Warmup && !measuring {
+				// The timeline starts when measuring does
+				measuring = true
+				if t := measureStart.Load(); t != 0 {
+					stats.Start = time.Unix(0, t)
+				}
+			}
+			checkBreaker(r)
+			checkAdaptive(r)
+			checkStop(r)
+			stats.Add(r)
+			live.Observe(r)
+			if observe != nil {
+				observe(r)
+			}
+		}
+	}()
+
+	if cfg.Pattern == config.PatternStep {
+		stepDone := make(chan struct{})
+		defer close(stepDone)
+		stepWorkers(cfg, sem, stepDone)
+	}
+
+	users := newVirtualUsers(cfg)
+	// Once the run has sent all it should, virtual users still thinking,
+	// waiting for a slot or held back stop rather than delay its end
+	usersCtx, stopUsers := context.WithCancel(sendCtx)
+	defer stopUsers()
+	var failedIterations atomic.Int64
+	// send makes one request, or runs the scenario once, as user, or as a
+	// user borrowed for it when nil
+	send := func(id int, warm bool, due time.Time, user *virtualUser) {
+		if len(cfg.steps) > 0 {
+			if !runScenario(reqCtx, client, users, user, cfg, id, warm, due, results, live) && !warm {
+				failedIterations.Add(1)
+			}
+			return
+		}
+		live.Launched()
+		worker(reqCtx, client, users, user, cfg, id, warm, due, results)
+	}
+
+	// The warm-up lasts until both its duration has passed and its
+	// requests were sent. Measuring, and the arrival schedule, start over
+	// when it ends.
+	warming := warmup
+	if warming {
+		cfg.logf("Warming up\n")
+	}
+	warmed := 0
+	var measureFrom time.Duration // active time when the warm-up ended
+	sent := 0
+	endWarmup := func() {
+		if warming && warmed >= cfg.WarmupRequests && active() >= time.Duration(cfg.Warmup) {
+			warming = false
+			measureFrom = active()
+			measureAfter.Store(int64(measureFrom))
+			measureStart.Store(time.Now().UnixNano())
+			cfg.logf("Warm-up finished after %d requests\n", warmed)
+		}
+	}
+	// done reports whether the run has sent all it should
+	done := func() bool {
+		return sent >= limit || sendCtx.Err() != nil ||
+			!warming && cfg.Duration > 0 && active()-measureFrom >= time.Duration(cfg.Duration)
+	}
+	count := func() {
+		if warming {
+			warmed++
+		} else {
+			sent++
+		}
+	}
+
+	if openModel {
+		// Every arrival gets a goroutine of its own, so requests still in
+		// flight never hold back the next one. One timer is reset for
+		// every arrival rather than allocating a new one each time.
+		arrival := time.NewTimer(0)
+		arrival.Stop()
+		defer arrival.Stop()
+	loop:
+		for i := 1; sent < limit; i++ {
+			endWarmup()
+			// A Retry-After is waited out before the next arrival is
+			// scheduled, so it does not count as the generator falling
+			// behind
+			retryAfter.wait(sendCtx.Done())
+			// Sleep until this request's scheduled arrival; if the loop
+			// fell behind, launch immediately to catch up
+			offset, ok := schedule.at(sent)
+			if warming {
+				offset, ok = schedule.at(warmed)
+			} else {
+				offset += measureFrom
+			}
+			if adapt != nil {
+				// The adaptive rate carries on across the end of the
+				// warm-up
+				offset, ok = adapt.next(time.Now()), true
+			}
+			if !ok {
+				break
+			}
+			due := startRun.Add(offset + held())
+			if wait := time.Until(due); wait > 0 {
+				arrival.Reset(wait)
+				select {
+				case <-arrival.C:
+				case <-sendCtx.Done():
+					break loop
+				}
+			}
+			cfg.pause.wait(sendCtx.Done())
+			throttle.wait(sendCtx.Done())
+			if inFlight != nil {
+				select {
+				case inFlight <- struct{}{}:
+				case <-sendCtx.Done():
+					break loop
+				}
+			}
+			if done() {
+				if inFlight != nil {
+					<-inFlight
+				}
+				break
+			}
+			wg.Add(1)
+			go func(id int, warm bool) {
+				defer wg.Done()
+				send(id, warm, due, nil)
+				if inFlight != nil {
+					<-inFlight
+				}
+			}(i, warming)
+			count()
+		}
+	} else {
+		// Each virtual user is a goroutine that sends its requests one
+		// after another, thinking in between, until the users together
+		// have sent the run's requests. A user starts once it gets a
+		// slot, which the step pattern hands out over time.
+		var mu sync.Mutex // guards the counters while the users run
+		next := 0
+		claim := func() (id int, warm bool, ok bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			endWarmup()
+			if done() {
+				stopUsers()
+				return 0, false, false
+			}
+			next++
+			id, warm = next, warming
+			count()
+			return id, warm, true
+		}
+		for range cfg.Concurrency {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				select {
+				case sem <- struct{}{}:
+				case <-usersCtx.Done():
+					return
+				}
+				user := users.bind()
+				for {
+					cfg.pause.wait(usersCtx.Done())
+					throttle.wait(usersCtx.Done())
+					if inFlight != nil {
+						select {
+						case inFlight <- struct{}{}:
+						case <-usersCtx.Done():
+							return
+						}
+					}
+					id, warm, ok := claim()
+					if ok {
+						send(id, warm, time.Time{}, user)
+					}
+					if inFlight != nil {
+						<-inFlight
+					}
+					if !ok || !cfg.think(usersCtx) {
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	stopUsers()
+	wg.Wait()
+	close(results)
+	<-collected
+	// Free the connection slots held by idle keep-alive connections for
+	// the next run
+	client.CloseIdleConnections()
+	if closeBreaker != nil {
+		closeBreaker.Stop()
+	}
+	if endRetryAfter != nil {
+		endRetryAfter.Stop()
+	}
+	// Nothing is held back by a Retry-After beyond the end of the run
+	retryAfter.resume()
+	if stats.Aborted == "" && context.Cause(ctx) == errMaxDuration {
+		stats.Aborted = fmt.Sprintf("max_duration of %s reached", time.Duration(cfg.MaxDuration))
+	}
+	stats.Finish(active() - measureFrom)
+	if adapt != nil {
+		stats.SustainableRate = adapt.sustainable(active())
+	}
+	stats.Generator = watch.finish()
+	if len(cfg.steps) > 0 {
+		stats.Iterations = sent
+		stats.FailedIterations = int(failedIterations.Load())
+	}
+	return stats
+}
+
+// logf writes a progress message to the plan's log
+func (cfg *Plan) logf(format string, args ...any) {
+	fmt.Fprintf(cfg.Log, format, args...)
+}
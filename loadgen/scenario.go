@@ -0,0 +1,155 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"time"
+
+	"LoadTester/metrics"
+)
+
+// resolveScenario validates the scenario steps. Steps are endpoints run
+// in order, so weights do not apply.
+func (cfg *Plan) resolveScenario() error {
+	if len(cfg.Scenario) == 0 {
+		return nil
+	}
+	if len(cfg.Endpoints) > 0 {
+		return fmt.Errorf("endpoints and scenario are mutually exclusive")
+	}
+	if cfg.GraphQL != nil {
+		return fmt.Errorf("top-level graphql cannot be combined with a scenario; set graphql per step")
+	}
+	if cfg.Multipart != nil {
+		return fmt.Errorf("top-level multipart cannot be combined with a scenario; set multipart per step")
+	}
+	if cfg.StreamBody != "" {
+		return fmt.Errorf("top-level stream_body cannot be combined with a scenario; set stream_body per step")
+	}
+	names := map[string]bool{}
+	for i, step := range cfg.Scenario {
+		if step.Weight != 0 {
+			return fmt.Errorf("scenario step %d: weight is not supported in scenarios", i+1)
+		}
+		t, err := cfg.resolveEndpoint(step, names)
+		if err != nil {
+			return fmt.Errorf("scenario step %d: %w", i+1, err)
+		}
+		cfg.Scenario[i] = t.Endpoint
+		cfg.steps = append(cfg.steps, t)
+	}
+	return nil
+}
+
+// runScenario executes every scenario step in order as one virtual user
+// iteration. Each iteration starts with its own cookie jar (unless cookies
+// are disabled) and variables, so a session cookie or token from a login
+// step is sent by the steps after it. With a credentials file, the
+// iteration holds a virtual user's credentials throughout, so the login
+// step logs in as that user. The iteration stops at the first
+// failed step and reports whether all steps succeeded. The user thinks
+// between steps. Steps call the script's functions in a runtime of the
+// iteration's own. Results of a warm-up iteration are flagged as such, and
+// due is the scheduled start of the iteration in the open model.
+func runScenario(ctx context.Context, client *http.Client, users *virtualUsers, user *virtualUser, cfg *Plan, id int, warm bool, due time.Time, results chan<- metrics.Result, live *metrics.Live) bool {
+	vu := *client
+	if cfg.Cookies {
+		vu.Jar, _ = cookiejar.New(nil)
+	}
+	vars := map[string]string{}
+	if cfg.feeder != nil {
+		for k, v := range cfg.feeder.row() {
+			vars[k] = v
+		}
+	}
+	if cfg.credentials != nil || cfg.perUserAgent() {
+		if user == nil {
+			user = users.get()
+			defer users.put(user)
+		}
+		for k, v := range user.creds {
+			vars[k] = v
+		}
+		ctx = withUserAgent(ctx, user.agent)
+	}
+	ctx, release := cfg.withScript(ctx)
+	defer release()
+	var failed metrics.Result // the step that ended the iteration
+	if cfg.tracer != nil {
+		// The steps of an iteration share a trace
+		var it *span
+		ctx, it = cfg.tracer.start(ctx, "scenario iteration", spanKindInternal)
+		defer func() {
+			cfg.tracer.finish(it, failed.ErrorType, failed.Error, intAttr("loadtester.iteration", id))
+		}()
+	}
+	sent := false
+	for i := range cfg.steps {
+		step := &cfg.steps[i]
+		run, r := step.runs(ctx, id, vars)
+		if !run {
+			continue
+		}
+		if sent && r.Error == "" && !cfg.think(ctx) {
+			return false
+		}
+		live.Launched()
+		if r.Error == "" {
+			r = doRequest(ctx, &vu, cfg, step, id, vars)
+		}
+		r.Warmup = warm
+		if !sent {
+			// Only the first step sent was scheduled
+			r.Scheduled = due
+		}
+		sent = true
+		results <- r
+		if r.Error != "" {
+			failed = r
+			return false
+		}
+	}
+	return true
+}
+
+// runs reports whether a scenario step is to be sent in an iteration with
+// vars. Its before function runs first and may skip it; then it is sent
+// always without a when condition, otherwise when that renders to
+// anything but "", "false" or "0". A before function that throws or a
+// condition that fails to render returns the step's failed result to
+// report in its place.
+func (ep *target) runs(ctx context.Context, id int, vars map[string]string) (bool, metrics.Result) {
+	failed := func(err string) (bool, metrics.Result) {
+		return true, metrics.Result{
+			RequestID: id,
+			Timestamp: time.Now(),
+			Endpoint:  ep.Name,
+			Error:     err,
+			ErrorType: metrics.ErrTypeRequestBuild,
+		}
+	}
+	if ep.Before != "" {
+		run, err := scriptFrom(ctx).before(ep.Before, vars)
+		if err != nil {
+			return failed("before: " + err.Error())
+		}
+		if !run {
+			return false, metrics.Result{}
+		}
+	}
+	if ep.when == nil {
+		return true, metrics.Result{}
+	}
+	var b strings.Builder
+	if err := ep.when.Execute(&b, vars); err != nil {
+		return failed("when: " + err.Error())
+	}
+	switch strings.TrimSpace(b.String()) {
+	case "", "false", "0":
+		return false, metrics.Result{}
+	}
+	return true, metrics.Result{}
+}
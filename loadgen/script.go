@@ -0,0 +1,229 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// script is the JavaScript file of a scenario, whose functions its steps
+// call before they are sent and after their response. A goja runtime is
+// not safe for concurrent use, so every virtual user iteration takes one
+// of its own from a pool; globals are therefore not shared between users
+// and may or may not survive from one iteration to the next.
+type script struct {
+	program *goja.Program
+	vms     sync.Pool // of *scriptVM
+}
+
+// scriptVM is a runtime that has run the script
+type scriptVM struct {
+	rt        *goja.Runtime
+	parse     goja.Callable // JSON.parse
+	stringify goja.Callable // JSON.stringify
+}
+
+type scriptKey struct{}
+
+// resolveScript loads the script and checks that the functions the steps
+// name as before and after exist. Only scenario steps call them, since
+// only an iteration has variables for them to read and set.
+func (cfg *Plan) resolveScript() error {
+	if cfg.Script == "" {
+		for i, step := range cfg.Scenario {
+			if step.Before != "" || step.After != "" {
+				return fmt.Errorf("scenario step %d: before and after call functions of a script, but none is set", i+1)
+			}
+		}
+		return nil
+	}
+	if len(cfg.steps) == 0 {
+		return fmt.Errorf("script needs a scenario, whose steps call its functions")
+	}
+	src, err := os.ReadFile(cfg.Script)
+	if err != nil {
+		return fmt.Errorf("reading script: %w", err)
+	}
+	program, err := goja.Compile(cfg.Script, string(src), true)
+	if err != nil {
+		return fmt.Errorf("script: %w", err)
+	}
+	s := &script{program: program}
+	vm, err := s.newVM()
+	if err != nil {
+		return fmt.Errorf("script: %w", err)
+	}
+	for i, step := range cfg.steps {
+		for _, fn := range []string{step.Before, step.After} {
+			if _, ok := goja.AssertFunction(vm.rt.Get(fn)); fn != "" && !ok {
+				return fmt.Errorf("scenario step %d: %s has no function %s", i+1, cfg.Script, fn)
+			}
+		}
+		// after sees the response body
+		cfg.steps[i].needBody = step.needBody || step.After != ""
+	}
+	s.vms.Put(vm)
+	cfg.script = s
+	return nil
+}
+
+// newVM returns a runtime that has run the script, with console.log
+// writing to the log
+func (s *script) newVM() (*scriptVM, error) {
+	rt := goja.New()
+	console := rt.NewObject()
+	console.Set("log", func(call goja.FunctionCall) goja.Value {
+		args := make([]any, len(call.Arguments))
+		for i, a := range call.Arguments {
+			args[i] = a.String()
+		}
+		slog.Info("script: " + fmt.Sprint(args...))
+		return goja.Undefined()
+	})
+	rt.Set("console", console)
+	if _, err := rt.RunProgram(s.program); err != nil {
+		return nil, err
+	}
+	json := rt.Get("JSON").ToObject(rt)
+	parse, _ := goja.AssertFunction(json.Get("parse"))
+	stringify, _ := goja.AssertFunction(json.Get("stringify"))
+	return &scriptVM{rt: rt, parse: parse, stringify: stringify}, nil
+}
+
+// withScript returns ctx carrying a runtime of the script for the
+// requests of one iteration, and the function that gives it back. A
+// script still running when ctx ends is interrupted.
+func (cfg *Plan) withScript(ctx context.Context) (context.Context, func()) {
+	if cfg.script == nil {
+		return ctx, func() {}
+	}
+	vm, _ := cfg.script.vms.Get().(*scriptVM)
+	if vm == nil {
+		var err error
+		if vm, err = cfg.script.newVM(); err != nil {
+			// It ran when the test was compiled, so this is down to the
+			// script itself, e.g. a random failure; the steps calling it
+			// fail
+			slog.Error("script failed", "err", err)
+			return ctx, func() {}
+		}
+	}
+	stop := context.AfterFunc(ctx, func() { vm.rt.Interrupt(ctx.Err()) })
+	return context.WithValue(ctx, scriptKey{}, vm), func() {
+		// An interrupted runtime is not reused
+		if stop() {
+			cfg.script.vms.Put(vm)
+		}
+	}
+}
+
+// scriptFrom returns the runtime of the iteration ctx belongs to
+func scriptFrom(ctx context.Context) *scriptVM {
+	vm, _ := ctx.Value(scriptKey{}).(*scriptVM)
+	return vm
+}
+
+// before calls the named function with the iteration's variables, which
+// it may change, and reports whether the step is to be sent: unless the
+// function returns false, null or another falsy value other than
+// undefined.
+func (vm *scriptVM) before(name string, vars map[string]string) (bool, error) {
+	ret, err := vm.call(name, vars)
+	if err != nil {
+		return false, err
+	}
+	return goja.IsUndefined(ret) || ret.ToBoolean(), nil
+}
+
+// after calls the named function with the response and the iteration's
+// variables, which it may change. The step fails if the function returns
+// false or throws, as a check would fail it.
+func (vm *scriptVM) after(name string, resp *http.Response, body []byte, vars map[string]string) error {
+	if vm == nil {
+		return fmt.Errorf("%s: the script failed to run", name)
+	}
+	rt := vm.rt
+	res := rt.NewObject()
+	res.Set("status", resp.StatusCode)
+	res.Set("proto", resp.Proto)
+	headers := rt.NewObject()
+	for k := range resp.Header {
+		headers.Set(k, resp.Header.Get(k))
+	}
+	res.Set("headers", headers)
+	text := string(body)
+	res.Set("body", text)
+	res.Set("json", func(goja.FunctionCall) goja.Value {
+		v, err := vm.parse(goja.Undefined(), rt.ToValue(text))
+		if err != nil {
+			panic(err)
+		}
+		return v
+	})
+	ret, err := vm.call(name, vars, res)
+	if err != nil {
+		return err
+	}
+	if !goja.IsUndefined(ret) && !ret.ToBoolean() {
+		return fmt.Errorf("%s returned %s", name, ret)
+	}
+	return nil
+}
+
+// call calls the named function with a vars object followed by args, and
+// copies the object back into vars. Values that are not strings are
+// stored as their string or, for objects, their JSON; null and undefined
+// remove the variable.
+func (vm *scriptVM) call(name string, vars map[string]string, args ...goja.Value) (goja.Value, error) {
+	if vm == nil {
+		return nil, fmt.Errorf("%s: the script failed to run", name)
+	}
+	rt := vm.rt
+	fn, ok := goja.AssertFunction(rt.Get(name))
+	if !ok {
+		return nil, fmt.Errorf("%s is not a function", name)
+	}
+	obj := rt.NewObject()
+	for k, v := range vars {
+		obj.Set(k, v)
+	}
+	if len(args) > 0 {
+		// after(res, vars)
+		args = append(args, obj)
+	} else {
+		args = []goja.Value{obj}
+	}
+	ret, err := fn(goja.Undefined(), args...)
+	if err != nil {
+		if ex, ok := err.(*goja.Exception); ok {
+			return nil, fmt.Errorf("%s: %s", name, ex.Value())
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	clear(vars)
+	for _, k := range obj.Keys() {
+		v := obj.Get(k)
+		switch {
+		case goja.IsUndefined(v) || goja.IsNull(v):
+		case isObject(v):
+			s, err := vm.stringify(goja.Undefined(), v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: variable %s: %w", name, k, err)
+			}
+			vars[k] = s.String()
+		default:
+			vars[k] = v.String()
+		}
+	}
+	return ret, nil
+}
+
+func isObject(v goja.Value) bool {
+	_, ok := v.(*goja.Object)
+	return ok
+}
@@ -0,0 +1,179 @@
+package loadgen
+
+import (
+	"context"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+const testScript = `
+function login(vars) {
+	vars.amount = String(40 + 2);
+	vars.tags = ["a", "b"];
+}
+function checkLogin(res, vars) {
+	if (res.status !== 200) throw new Error("status " + res.status);
+	vars.token = res.json().token;
+	vars.admin = res.headers["X-Role"] === "admin";
+}
+function onlyAdmin(vars) {
+	return vars.admin === "true";
+}
+function checkOrder(res) {
+	return res.body.includes("42");
+}
+`
+
+func TestScript(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("X-Role", "user")
+			io.WriteString(w, `{"token": "t-1"}`)
+		case "/order":
+			// The token from login and the variables before set
+			if r.Header.Get("Authorization") != "Bearer t-1" || string(body) != `42 ["a","b"]` {
+				http.Error(w, "bad order: "+string(body), http.StatusBadRequest)
+				return
+			}
+			io.WriteString(w, "order 42 placed")
+		}
+	}))
+	defer srv.Close()
+	file := t.TempDir() + "/test.js"
+	os.WriteFile(file, []byte(testScript), 0644)
+
+	cfg := config.Default()
+	cfg.Script = file
+	cfg.Scenario = []config.Endpoint{
+		{Name: "login", URL: srv.URL + "/login", Before: "login", After: "checkLogin"},
+		{Name: "admin", URL: srv.URL + "/admin", Before: "onlyAdmin"},
+		{Name: "order", Method: "POST", URL: srv.URL + "/order", Body: `{{.amount}} {{.tags}}`,
+			Headers: map[string]string{"Authorization": "Bearer {{.token}}"}, After: "checkOrder"},
+	}
+	cfg.Requests, cfg.Concurrency = 2, 1
+	plan, err := Compile(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []metrics.Result
+	plan.Run(context.Background(), 1, metrics.NewLive(), func(r metrics.Result) { results = append(results, r) })
+	if len(results) != 4 {
+		t.Fatalf("got %d results, want login and order twice", len(results))
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			t.Errorf("%s: %s", r.Endpoint, r.Error)
+		}
+	}
+	if got := strings.Join(paths, " "); got != "/login /order /login /order" {
+		t.Errorf("requests = %s, want the admin step skipped", got)
+	}
+}
+
+func TestScriptFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "no amount")
+	}))
+	defer srv.Close()
+	file := t.TempDir() + "/test.js"
+	os.WriteFile(file, []byte(testScript+"function broken() { null.x; }\n"), 0644)
+
+	tests := []struct {
+		name      string
+		step      config.Endpoint
+		wantError string
+		wantType  string
+	}{
+		{name: "after returns false", step: config.Endpoint{After: "checkOrder"}, wantError: "check failed: after: checkOrder returned false", wantType: metrics.ErrTypeCheck},
+		{name: "after throws", step: config.Endpoint{After: "checkLogin"}, wantError: "check failed: after: checkLogin: SyntaxError", wantType: metrics.ErrTypeCheck},
+		{name: "before throws", step: config.Endpoint{Before: "broken"}, wantError: "before: broken: TypeError", wantType: metrics.ErrTypeRequestBuild},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Script = file
+			tt.step.URL = srv.URL
+			cfg.Scenario = []config.Endpoint{tt.step}
+			cfg.Requests, cfg.Concurrency = 1, 1
+			plan, err := Compile(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var results []metrics.Result
+			plan.Run(context.Background(), 1, metrics.NewLive(), func(r metrics.Result) { results = append(results, r) })
+			if len(results) != 1 || !strings.HasPrefix(results[0].Error, tt.wantError) || results[0].ErrorType != tt.wantType {
+				t.Errorf("results = %+v, want one %s error starting %q", results, tt.wantType, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestScriptVariables(t *testing.T) {
+	program := goja.MustCompile("vars.js", `
+function set(vars) {
+	vars.count = 3;
+	vars.user = {id: 7, name: "ann"};
+	vars.admin = true;
+	vars.token = null;
+	delete vars.stale;
+}
+function skip(vars) { return 0; }
+function keep(vars) {}
+function readOrder(res, vars) {
+	vars.order = res.json().id;
+	vars.status = res.status;
+	vars.region = res.headers["X-Region"];
+}
+`, true)
+	vm, err := (&script{program: program}).newVM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &http.Response{StatusCode: 201, Proto: "HTTP/1.1", Header: http.Header{"X-Region": {"eu"}}}
+	tests := []struct {
+		name     string
+		call     func(vars map[string]string) (bool, error)
+		wantSend bool
+		want     map[string]string
+	}{
+		{name: "before sets variables", call: func(vars map[string]string) (bool, error) { return vm.before("set", vars) }, wantSend: true,
+			want: map[string]string{"count": "3", "user": `{"id":7,"name":"ann"}`, "admin": "true", "kept": "yes"}},
+		{name: "before skips the step", call: func(vars map[string]string) (bool, error) { return vm.before("skip", vars) },
+			want: map[string]string{"token": "t-1", "stale": "old", "kept": "yes"}},
+		{name: "before returns nothing", call: func(vars map[string]string) (bool, error) { return vm.before("keep", vars) }, wantSend: true,
+			want: map[string]string{"token": "t-1", "stale": "old", "kept": "yes"}},
+		{name: "after reads the response", call: func(vars map[string]string) (bool, error) {
+			return true, vm.after("readOrder", resp, []byte(`{"id": "o-9"}`), vars)
+		}, wantSend: true,
+			want: map[string]string{"token": "t-1", "stale": "old", "kept": "yes", "order": "o-9", "status": "201", "region": "eu"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := map[string]string{"token": "t-1", "stale": "old", "kept": "yes"}
+			send, err := tt.call(vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if send != tt.wantSend {
+				t.Errorf("send = %v, want %v", send, tt.wantSend)
+			}
+			if !maps.Equal(vars, tt.want) {
+				t.Errorf("vars = %v, want %v", vars, tt.want)
+			}
+		})
+	}
+}
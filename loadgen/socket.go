@@ -0,0 +1,156 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"LoadTester/metrics"
+)
+
+// Raw socket mode: a tcp:// or udp:// target sends the body as-is over a
+// fresh connection (TCP) or as a single datagram (UDP) per request
+
+const socketReadSize = 64 << 10 // largest response read for checks
+
+// resolveSocket switches to raw socket mode for tcp:// and udp:// targets
+func (cfg *Plan) resolveSocket() error {
+	cfg.network = ""
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Scheme != "tcp" && u.Scheme != "udp" {
+		return nil
+	}
+	if len(cfg.Endpoints) > 0 || len(cfg.Scenario) > 0 || cfg.GRPC != nil || cfg.GraphQL != nil || cfg.Multipart != nil {
+		return fmt.Errorf("%s targets cannot be combined with endpoints, a scenario, grpc, graphql or multipart", u.Scheme)
+	}
+	if u.Port() == "" || u.Path != "" && u.Path != "/" {
+		return fmt.Errorf("%s target %q must be %s://host:port", u.Scheme, cfg.URL, u.Scheme)
+	}
+	if u.Scheme == "udp" && cfg.Body == "" {
+		return fmt.Errorf("udp targets need a body to send")
+	}
+	cfg.network = u.Scheme
+	return nil
+}
+
+// doSocket sends one payload to a raw TCP or UDP target, retrying failures
+// as the retry settings allow. A response is only awaited when checks are set; it is
+// whatever the server sends in its first packet, up to 64 KiB.
+func doSocket(ctx context.Context, cfg *Plan, ep *target, id int, vars map[string]string) metrics.Result {
+	var r metrics.Result
+	r.RequestID = id
+	start := time.Now()
+	r.Timestamp = start
+	r.Endpoint = ep.Name
+	target, err := ep.expand(vars)
+	if err != nil {
+		r.Error = err.Error()
+		r.ErrorType = metrics.ErrTypeRequestBuild
+		return r
+	}
+	u, err := url.Parse(target.URL)
+	if err != nil {
+		r.Error = err.Error()
+		r.ErrorType = metrics.ErrTypeRequestBuild
+		return r
+	}
+	for attempt := 0; cfg.nextAttempt(ctx, attempt, &r, ""); attempt++ {
+		r.Retries = attempt
+		startAttempt(&r)
+		var timer phaseTimer
+		body, err := cfg.exchange(ctx, ep.network, u.Host, target.Body, len(ep.checks) > 0, &timer)
+		done := time.Now()
+		r.Duration = done.Sub(start)
+		r.Phases = timer.phases(done)
+		r.IPFamily = timer.ipFamily()
+		r.NewConn = timer.opened()
+		if err != nil {
+			r.Proto = ""
+			r.Error = err.Error()
+			r.ErrorType = classifyError(err)
+			continue
+		}
+		r.Proto = strings.ToUpper(ep.network)
+		r.BytesSent += int64(len(target.Body))
+		r.BytesReceived += int64(len(body))
+		if msg := runChecks(ep.checks, body, int64(len(body))); msg != "" {
+			r.Error = "check failed: " + msg
+			r.ErrorType = metrics.ErrTypeCheck
+			continue
+		}
+		r.Error = ""
+		r.ErrorType = ""
+		break
+	}
+	finishAttempt(&r)
+	return r
+}
+
+// exchange dials addr, writes payload and, if wait is set, reads the first
+// chunk of the reply. Phases are recorded on timer as for HTTP requests.
+// Cancelling ctx aborts the exchange.
+func (cfg *Plan) exchange(ctx context.Context, network, addr, payload string, wait bool, timer *phaseTimer) ([]byte, error) {
+	timer.mark(&timer.connectStart)
+	conn, err := cfg.dialSocket(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	timer.mark(&timer.connectDone)
+	timer.gotConn(conn, true)
+	stop := cfg.abortOnCancel(ctx, conn)
+	defer stop()
+
+	if payload != "" {
+		if _, err := conn.Write([]byte(payload)); err != nil {
+			return nil, cancelled(ctx, err)
+		}
+	}
+	timer.mark(&timer.wroteRequest)
+	if !wait {
+		return nil, nil
+	}
+	buf := make([]byte, socketReadSize)
+	n, err := conn.Read(buf)
+	if n == 0 && err != nil {
+		return nil, fmt.Errorf("reading response: %w", cancelled(ctx, err))
+	}
+	timer.mark(&timer.firstByte)
+	return buf[:n], nil
+}
+
+// dialSocket connects to addr, giving up after the dial timeout or the
+// request timeout, whichever is shorter, or when ctx is cancelled. It
+// waits for a free slot while MaxConns connections are open, and
+// honours RESOLVE overrides and SOURCE_ADDRS.
+func (cfg *Plan) dialSocket(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := net.Dialer{Timeout: time.Duration(cfg.DialTimeout)}
+	if cfg.Timeout > 0 {
+		d.Deadline = time.Now().Add(time.Duration(cfg.Timeout))
+	}
+	return cfg.dialWith(&d)(ctx, network, addr)
+}
+
+// abortOnCancel sets conn's deadline to the request timeout from now and
+// moves it to the past when ctx is cancelled, so blocked reads and writes
+// return. The returned function stops watching ctx.
+func (cfg *Plan) abortOnCancel(ctx context.Context, conn net.Conn) func() bool {
+	if cfg.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(time.Duration(cfg.Timeout)))
+	}
+	return context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+}
+
+// cancelled returns ctx's error in place of err once ctx is cancelled,
+// since err is then only the expired deadline set by abortOnCancel
+func cancelled(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+// stopMinRequests is how many requests a run needs before its error rate
+// can stop it
+const stopMinRequests = 100
+
+// errMaxDuration is the cause of a run's context ending at MaxDuration
+var errMaxDuration = errors.New("max_duration reached")
+
+// stopConditions end a run once too many of its measured requests failed:
+// in all, in a row or as a share of them
+type stopConditions struct {
+	maxErrors int
+	maxInRow  int
+	maxRate   float64
+
+	requests, errors, inRow int
+}
+
+// resolveStop validates the stop conditions
+func (cfg *Plan) resolveStop() error {
+	if cfg.StopErrors < 0 || cfg.StopFailuresInRow < 0 {
+		return fmt.Errorf("stop_errors and stop_failures_in_row must not be negative")
+	}
+	if cfg.StopErrorRate < 0 || cfg.StopErrorRate >= 1 {
+		return fmt.Errorf("stop_error_rate must be between 0 and 1")
+	}
+	if cfg.MaxDuration < 0 {
+		return fmt.Errorf("max_duration must not be negative")
+	}
+	return nil
+}
+
+// newStopConditions returns the stop conditions of a run, or nil when none
+// are set
+func newStopConditions(cfg *config.Config) *stopConditions {
+	if cfg.StopErrors == 0 && cfg.StopFailuresInRow == 0 && cfg.StopErrorRate == 0 {
+		return nil
+	}
+	return &stopConditions{maxErrors: cfg.StopErrors, maxInRow: cfg.StopFailuresInRow, maxRate: cfg.StopErrorRate}
+}
+
+// observe records a finished request and returns why the run should stop,
+// or "" to carry on. Warm-up requests do not count.
+func (s *stopConditions) observe(r metrics.Result) string {
+	if r.Warmup {
+		return ""
+	}
+	s.requests++
+	if r.Error == "" {
+		s.inRow = 0
+		return ""
+	}
+	s.errors++
+	s.inRow++
+	rate := float64(s.errors) / float64(s.requests)
+	switch {
+	case s.maxErrors > 0 && s.errors >= s.maxErrors:
+		return fmt.Sprintf("%d requests failed (stop_errors)", s.errors)
+	case s.maxInRow > 0 && s.inRow >= s.maxInRow:
+		return fmt.Sprintf("%d requests in a row failed (stop_failures_in_row)", s.inRow)
+	case s.maxRate > 0 && s.requests >= stopMinRequests && rate > s.maxRate:
+		return fmt.Sprintf("%.1f%% of %d requests failed (stop_error_rate)", rate*100, s.requests)
+	}
+	return ""
+}
+
+// Deadline returns when MaxDuration ends the test, counting from the first
+// call, or the zero time when there is no limit
+func (cfg *Plan) Deadline() time.Time {
+	if cfg.MaxDuration <= 0 {
+		return time.Time{}
+	}
+	cfg.startOnce.Do(func() {
+		cfg.deadline = time.Now().Add(time.Duration(cfg.MaxDuration))
+	})
+	return cfg.deadline
+}
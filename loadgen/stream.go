@@ -0,0 +1,75 @@
+package loadgen
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"LoadTester/config"
+)
+
+// streamBlock is the random data streamed bodies repeat. It is random so
+// that compression along the way cannot shrink the upload, and larger
+// than a compressor's window so that repeating it does not let one.
+var streamBlock = func() []byte {
+	b := make([]byte, 256<<10)
+	rand.Read(b)
+	return b
+}()
+
+// applyStream makes ep send a generated body of ep.StreamBody bytes,
+// streamed with chunked transfer encoding rather than held in memory.
+// Like an upload it is a POST unless another method than GET is set.
+func applyStream(ep *target) error {
+	if ep.Body != "" || ep.BodyFile != "" || ep.GraphQL != nil || ep.Multipart != nil {
+		return fmt.Errorf("stream_body cannot be combined with body, body_file, graphql or multipart")
+	}
+	n, err := config.ParseByteSize(ep.StreamBody)
+	if err != nil {
+		return fmt.Errorf("stream_body: %w", err)
+	}
+	if n <= 0 {
+		return fmt.Errorf("stream_body must be positive")
+	}
+	ep.stream = n
+	if ep.ContentType == "" {
+		ep.ContentType = "application/octet-stream"
+	}
+	if ep.Method == "" || strings.EqualFold(ep.Method, http.MethodGet) {
+		ep.Method = http.MethodPost
+	}
+	return nil
+}
+
+// streamBody generates a streamed request body. Its type is unknown to
+// net/http, so the length is not announced and HTTP/1.1 sends it chunked.
+type streamBody struct {
+	remaining int64
+	off       int
+	sent      atomic.Int64 // bytes handed to the transport so far
+}
+
+func newStreamBody(n int64) *streamBody {
+	return &streamBody{remaining: n}
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.EOF
+	}
+	p = p[:min(int64(len(p)), b.remaining)]
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], streamBlock[b.off:])
+		n += c
+		b.off = (b.off + c) % len(streamBlock)
+	}
+	b.remaining -= int64(n)
+	b.sent.Add(int64(n))
+	return n, nil
+}
+
+func (b *streamBody) Close() error { return nil }
@@ -0,0 +1,180 @@
+package loadgen
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// endpointTemplates holds the compiled form of an endpoint's templated
+// fields. Only fields containing "{{" are compiled; the rest are sent as
+// they are.
+type endpointTemplates struct {
+	url     *template.Template
+	body    *template.Template
+	headers map[string]*template.Template
+}
+
+// compileTemplate parses s as a template, or returns nil when s contains
+// no template actions
+func compileTemplate(name, s string) (*template.Template, error) {
+	if !strings.Contains(s, "{{") {
+		return nil, nil
+	}
+	return template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(s)
+}
+
+// templateSeq backs the seq template function
+var templateSeq atomic.Int64
+
+// templateFuncs generate data inside templates, so requests can vary
+// without a feeder file
+var templateFuncs = template.FuncMap{
+	// uuid returns a random version 4 UUID
+	"uuid": func() string {
+		hi, lo := rand.Uint64(), rand.Uint64()
+		hi = hi&^0xf000 | 0x4000     // version 4
+		lo = lo&^(0xc<<60) | 0x8<<60 // RFC 4122 variant
+		return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
+			hi>>32, hi>>16&0xffff, hi&0xffff, lo>>48, lo&0xffffffffffff)
+	},
+	// randInt returns a random integer in [min, max]
+	"randInt": func(min, max int) (int, error) {
+		if max < min {
+			return 0, fmt.Errorf("randInt: max %d is less than min %d", max, min)
+		}
+		return min + rand.IntN(max-min+1), nil
+	},
+	// randString returns n random alphanumeric characters
+	"randString": func(n int) string {
+		const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = chars[rand.IntN(len(chars))]
+		}
+		return string(b)
+	},
+	// randChoice returns one of its arguments at random
+	"randChoice": func(first string, rest ...string) string {
+		i := rand.IntN(len(rest) + 1)
+		if i == 0 {
+			return first
+		}
+		return rest[i-1]
+	},
+	// timestamp returns the current Unix time in seconds
+	"timestamp": func() string { return strconv.FormatInt(time.Now().Unix(), 10) },
+	// timestampMs returns the current Unix time in milliseconds
+	"timestampMs": func() string { return strconv.FormatInt(time.Now().UnixMilli(), 10) },
+	// now formats the current time, RFC 3339 unless a Go layout is given
+	"now": func(layout ...string) string {
+		if len(layout) > 0 {
+			return time.Now().Format(layout[0])
+		}
+		return time.Now().Format(time.RFC3339)
+	},
+	// seq returns 1, 2, 3, ... across all requests of the test
+	"seq": func() int64 { return templateSeq.Add(1) },
+}
+
+// compileTemplates prepares the templated fields of ep, leaving ep.tmpl
+// nil when nothing is templated
+func (ep *target) compileTemplates() error {
+	var tmpl endpointTemplates
+	var err error
+	if tmpl.url, err = compileTemplate("url", ep.URL); err != nil {
+		return err
+	}
+	if !ep.rawBody {
+		if tmpl.body, err = compileTemplate("body", ep.Body); err != nil {
+			return err
+		}
+	}
+	templated := tmpl.url != nil || tmpl.body != nil
+	for name, value := range ep.Headers {
+		t, err := compileTemplate(name, value)
+		if err != nil {
+			return err
+		}
+		if t != nil {
+			if tmpl.headers == nil {
+				tmpl.headers = map[string]*template.Template{}
+			}
+			tmpl.headers[name] = t
+			templated = true
+		}
+	}
+	if templated {
+		ep.tmpl = &tmpl
+	}
+	if tmpl.headers == nil {
+		ep.header = ep.staticHeader()
+	}
+	return nil
+}
+
+// staticHeader returns the request headers of ep, built once so that
+// each request copies them in one go, or nil when a Host header sets the
+// request's host instead
+func (ep *target) staticHeader() http.Header {
+	h := make(http.Header, len(ep.Headers)+1)
+	if ep.ContentType != "" {
+		h.Set("Content-Type", ep.ContentType)
+	}
+	for name, value := range ep.Headers {
+		if strings.EqualFold(name, "Host") {
+			return nil
+		}
+		h.Set(name, value)
+	}
+	return h
+}
+
+// expand returns ep with its templates rendered against vars. Endpoints
+// without templates are returned unchanged.
+func (ep *target) expand(vars map[string]string) (*target, error) {
+	if ep.tmpl == nil {
+		return ep, nil
+	}
+	out := *ep
+	render := func(t *template.Template) (string, error) {
+		var b strings.Builder
+		if err := t.Execute(&b, vars); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}
+	var err error
+	if ep.tmpl.url != nil {
+		if out.URL, err = render(ep.tmpl.url); err != nil {
+			return nil, err
+		}
+	}
+	if ep.tmpl.body != nil {
+		if out.Body, err = render(ep.tmpl.body); err != nil {
+			return nil, err
+		}
+		if ep.grpc != nil {
+			if out.Body, err = ep.grpc.frame(out.Body); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if ep.tmpl.headers != nil {
+		out.Headers = make(map[string]string, len(ep.Headers))
+		for name, value := range ep.Headers {
+			if t := ep.tmpl.headers[name]; t != nil {
+				if value, err = render(t); err != nil {
+					return nil, err
+				}
+			}
+			out.Headers[name] = value
+		}
+	}
+	return &out, nil
+}
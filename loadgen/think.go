@@ -0,0 +1,68 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"LoadTester/config"
+)
+
+// resolveThinkTime validates the think time settings
+func (cfg *Plan) resolveThinkTime() error {
+	if cfg.ThinkTime < 0 || cfg.ThinkTimeMax < 0 {
+		return fmt.Errorf("think_time must not be negative")
+	}
+	switch strings.ToLower(cfg.ThinkDistribution) {
+	case "", config.ThinkFixed:
+		cfg.ThinkDistribution = config.ThinkFixed
+	case config.ThinkUniform:
+		cfg.ThinkDistribution = config.ThinkUniform
+		if cfg.ThinkTimeMax < cfg.ThinkTime {
+			return fmt.Errorf("uniform think time needs think_time_max of at least think_time")
+		}
+	case config.ThinkExponential:
+		cfg.ThinkDistribution = config.ThinkExponential
+	default:
+		return fmt.Errorf("unknown think_distribution %q (want fixed, uniform or exponential)", cfg.ThinkDistribution)
+	}
+	return nil
+}
+
+// thinkTime draws the pause before a virtual user's next request
+func (cfg *Plan) thinkTime() time.Duration {
+	lo := time.Duration(cfg.ThinkTime)
+	switch cfg.ThinkDistribution {
+	case config.ThinkUniform:
+		return lo + rand.N(time.Duration(cfg.ThinkTimeMax)-lo+1)
+	case config.ThinkExponential:
+		d := time.Duration(rand.ExpFloat64() * float64(lo))
+		if cfg.ThinkTimeMax > 0 {
+			d = min(d, time.Duration(cfg.ThinkTimeMax))
+		}
+		return d
+	}
+	return lo
+}
+
+// think pauses a virtual user between requests. It returns false if ctx
+// is cancelled first.
+func (cfg *Plan) think(ctx context.Context) bool {
+	if cfg.ThinkTime == 0 && cfg.ThinkTimeMax == 0 {
+		return ctx.Err() == nil
+	}
+	d := cfg.thinkTime()
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	wait := time.NewTimer(d)
+	defer wait.Stop()
+	select {
+	case <-wait.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,116 @@
+package loadgen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// tlsVersions maps TLS_MIN_VERSION and TLS_MAX_VERSION values to versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// errPinMismatch is returned when no certificate of a server's chain
+// matches TLS_PINS
+var errPinMismatch = errors.New("tls: no certificate matches the pinned fingerprints")
+
+// resolveTLS loads the client certificate and CA bundle and builds the
+// TLS settings shared by every connection of the plan
+func (cfg *Plan) resolveTLS() error {
+	cfg.tlsConfig = &tls.Config{
+		InsecureSkipVerify: !cfg.VerifyTLS, // skip verification if VERIFY_TLS=false
+		ServerName:         cfg.TLSServerName,
+	}
+	for _, v := range []struct {
+		name    string
+		setting string
+		version *uint16
+	}{
+		{"tls_min_version", cfg.TLSMinVersion, &cfg.tlsConfig.MinVersion},
+		{"tls_max_version", cfg.TLSMaxVersion, &cfg.tlsConfig.MaxVersion},
+	} {
+		if v.setting == "" {
+			continue
+		}
+		version, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(v.setting), "tls")]
+		if !ok {
+			return fmt.Errorf("%s must be 1.0, 1.1, 1.2 or 1.3, got %q", v.name, v.setting)
+		}
+		*v.version = version
+	}
+	if hi := cfg.tlsConfig.MaxVersion; hi != 0 && hi < cfg.tlsConfig.MinVersion {
+		return fmt.Errorf("tls_max_version is lower than tls_min_version")
+	}
+	if len(cfg.TLSPins) > 0 {
+		pins, err := parsePins(cfg.TLSPins)
+		if err != nil {
+			return err
+		}
+		cfg.tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			return checkPins(pins, cs)
+		}
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return fmt.Errorf("tls_cert and tls_key must be set together")
+	}
+	if cfg.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return fmt.Errorf("loading client certificate: %w", err)
+		}
+		cfg.tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.TLSCA != "" {
+		pem, err := os.ReadFile(cfg.TLSCA)
+		if err != nil {
+			return fmt.Errorf("reading CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no PEM certificates found in %s", cfg.TLSCA)
+		}
+		cfg.tlsConfig.RootCAs = pool
+	}
+	return nil
+}
+
+// parsePins decodes SHA-256 fingerprints given in hex, with or without
+// colons as printed by openssl x509 -fingerprint -sha256
+func parsePins(pins []string) ([][]byte, error) {
+	var out [][]byte
+	for _, p := range pins {
+		sum, err := hex.DecodeString(strings.ReplaceAll(strings.TrimPrefix(strings.ToLower(p), "sha256:"), ":", ""))
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("tls pin %q is not a SHA-256 fingerprint in hex", p)
+		}
+		out = append(out, sum)
+	}
+	return out, nil
+}
+
+// checkPins returns errPinMismatch unless a certificate the server sent,
+// or a root it was verified against, has one of the pinned fingerprints
+func checkPins(pins [][]byte, cs tls.ConnectionState) error {
+	chains := append([][]*x509.Certificate{cs.PeerCertificates}, cs.VerifiedChains...)
+	for _, chain := range chains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.Raw)
+			for _, pin := range pins {
+				if bytes.Equal(sum[:], pin) {
+					return nil
+				}
+			}
+		}
+	}
+	return errPinMismatch
+}
@@ -0,0 +1,357 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spans are exported in batches of up to spanBatch, at least once per
+// second. At most spanQueue spans wait for export; more are dropped.
+const (
+	spanBatch = 512
+	spanQueue = 8192
+)
+
+// OTLP span kinds and status codes
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+	spanStatusError  = 2
+)
+
+// tracer gives every request a W3C trace context, sent in its traceparent
+// header, and exports the sampled requests as spans to an OTLP/HTTP
+// collector when one is set
+type tracer struct {
+	endpoint string // OTLP traces URL, empty to only propagate
+	headers  map[string]string
+	sample   float64
+	resource []otlpAttr // attributes of the exported spans' resource
+
+	mu      sync.Mutex
+	run     int
+	queue   []otlpSpan
+	dropped int
+	lastErr string
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// span is a request or scenario iteration being traced
+type span struct {
+	traceID [16]byte
+	spanID  [8]byte
+	parent  [8]byte // zero for a root span
+	sampled bool
+	name    string
+	kind    int
+	start   time.Time
+}
+
+type spanKey struct{}
+
+// resolveTracing sets up trace propagation and export. A collector
+// endpoint implies propagation.
+func (cfg *Plan) resolveTracing() error {
+	if !cfg.TraceParent && cfg.OTLPEndpoint == "" {
+		return nil
+	}
+	if cfg.TraceSample < 0 || cfg.TraceSample > 1 {
+		return fmt.Errorf("trace_sample must be between 0 and 1")
+	}
+	if cfg.network != "" || cfg.dns != nil {
+		return fmt.Errorf("tracing needs HTTP requests and cannot be combined with socket or DNS mode")
+	}
+	t := &tracer{sample: cfg.TraceSample}
+	if cfg.OTLPEndpoint != "" {
+		u, err := url.Parse(cfg.OTLPEndpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("otlp_endpoint must be an http or https URL, got %q", cfg.OTLPEndpoint)
+		}
+		// Like the OpenTelemetry SDKs, a base URL gets the traces path
+		if !strings.HasSuffix(u.Path, "/v1/traces") {
+			u.Path = strings.TrimRight(u.Path, "/") + "/v1/traces"
+		}
+		t.endpoint = u.String()
+		t.headers = otlpHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+		// The test's tags go with the service name, sorted for stable
+		// output
+		t.resource = []otlpAttr{strAttr("service.name", serviceName())}
+		keys := make([]string, 0, len(cfg.Tags))
+		for k := range cfg.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			t.resource = append(t.resource, strAttr("loadtester.tag."+k, cfg.Tags[k]))
+		}
+	}
+	cfg.tracer = t
+	return nil
+}
+
+// otlpHeaders parses OTEL_EXPORTER_OTLP_HEADERS, "key=value,..." with
+// URL-encoded values
+func otlpHeaders(s string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if dec, err := url.QueryUnescape(strings.TrimSpace(v)); err == nil {
+			v = dec
+		}
+		headers[strings.TrimSpace(k)] = v
+	}
+	return headers
+}
+
+// begin starts exporting the spans of a run
+func (t *tracer) begin(run int) {
+	t.mu.Lock()
+	t.run = run
+	t.dropped = 0
+	t.mu.Unlock()
+	if t.endpoint == "" {
+		return
+	}
+	t.stop, t.done = make(chan struct{}), make(chan struct{})
+	go t.loop()
+}
+
+// end exports what is left of the run
+func (t *tracer) end() {
+	if t.endpoint == "" {
+		return
+	}
+	close(t.stop)
+	<-t.done
+	if t.dropped > 0 {
+		slog.Warn("otlp: spans were dropped because export fell behind", "dropped", t.dropped)
+	}
+}
+
+func (t *tracer) loop() {
+	defer close(t.done)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.flush()
+		case <-t.stop:
+			t.flush()
+			return
+		}
+	}
+}
+
+// start begins a span, a child of the one in ctx if there is one, and
+// returns a context carrying it. The sampling decision is taken at the
+// root and inherited.
+func (t *tracer) start(ctx context.Context, name string, kind int) (context.Context, *span) {
+	s := &span{name: name, kind: kind, start: time.Now()}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.traceID, s.parent, s.sampled = parent.traceID, parent.spanID, parent.sampled
+	} else {
+		binary.LittleEndian.PutUint64(s.traceID[:8], rand.Uint64())
+		binary.LittleEndian.PutUint64(s.traceID[8:], rand.Uint64())
+		s.sampled = t.sample >= 1 || rand.Float64() < t.sample
+	}
+	binary.LittleEndian.PutUint64(s.spanID[:], rand.Uint64())
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// traceparent returns the W3C traceparent header naming s as the parent
+// of the server's span
+func (s *span) traceparent() string {
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-" + flags
+}
+
+// finish ends s and queues it for export. errType and msg mark a failed
+// request or iteration.
+func (t *tracer) finish(s *span, errType, msg string, attrs ...otlpAttr) {
+	if t.endpoint == "" || !s.sampled {
+		return
+	}
+	o := otlpSpan{
+		TraceID:    hex.EncodeToString(s.traceID[:]),
+		SpanID:     hex.EncodeToString(s.spanID[:]),
+		Name:       s.name,
+		Kind:       s.kind,
+		Start:      strconv.FormatInt(s.start.UnixNano(), 10),
+		End:        strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes: attrs,
+	}
+	if s.parent != [8]byte{} {
+		o.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	if msg != "" {
+		o.Attributes = append(o.Attributes, strAttr("error.type", errType))
+		o.Status = &otlpStatus{Code: spanStatusError, Message: msg}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	o.Attributes = append(o.Attributes, intAttr("loadtester.run", t.run))
+	if len(t.queue) >= spanQueue {
+		t.dropped++
+		return
+	}
+	t.queue = append(t.queue, o)
+}
+
+// flush exports the queued spans
+func (t *tracer) flush() {
+	for {
+		if t.export() < spanBatch {
+			return
+		}
+	}
+}
+
+// export sends up to spanBatch queued spans and returns how many it took.
+// Failures are logged when they change, like those of the metric sinks.
+func (t *tracer) export() int {
+	t.mu.Lock()
+	n := min(len(t.queue), spanBatch)
+	batch := t.queue[:n:n]
+	t.queue = t.queue[n:]
+	t.mu.Unlock()
+	if n == 0 {
+		return 0
+	}
+	err := t.post(batch)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		if err.Error() != t.lastErr {
+			slog.Warn("otlp: export failed", "err", err)
+		}
+		t.lastErr = err.Error()
+		return n
+	}
+	t.lastErr = ""
+	return n
+}
+
+func (t *tracer) post(spans []otlpSpan) error {
+	var req otlpRequest
+	req.ResourceSpans = []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: t.resource},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "loadtester"},
+			Spans: spans,
+		}},
+	}}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		httpReq.Header.Set(k, v)
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// serviceName is the service.name of the exported spans, OTEL_SERVICE_NAME
+// if set
+func serviceName() string {
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		return name
+	}
+	return "loadtester"
+}
+
+// The OTLP/HTTP JSON encoding of an export request, as far as it is used
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID      string      `json:"traceId"`
+	SpanID       string      `json:"spanId"`
+	ParentSpanID string      `json:"parentSpanId,omitempty"`
+	Name         string      `json:"name"`
+	Kind         int         `json:"kind"`
+	Start        string      `json:"startTimeUnixNano"`
+	End          string      `json:"endTimeUnixNano"`
+	Attributes   []otlpAttr  `json:"attributes,omitempty"`
+	Status       *otlpStatus `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	String *string `json:"stringValue,omitempty"`
+	Int    *string `json:"intValue,omitempty"` // 64-bit integers are strings in OTLP JSON
+}
+
+func strAttr(key, value string) otlpAttr {
+	return otlpAttr{Key: key, Value: otlpValue{String: &value}}
+}
+
+func intAttr(key string, value int) otlpAttr {
+	s := strconv.Itoa(value)
+	return otlpAttr{Key: key, Value: otlpValue{Int: &s}}
+}
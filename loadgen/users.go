@@ -0,0 +1,136 @@
+package loadgen
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"sync/atomic"
+)
+
+// virtualUser is what a virtual user keeps from one request to the next:
+// its cookie jar, its credentials and its User-Agent
+type virtualUser struct {
+	jar   http.CookieJar    // nil when cookies are disabled
+	creds map[string]string // a row of the credentials file, nil without one
+	agent string            // empty unless User-Agents rotate per user
+}
+
+// virtualUsers hands out virtual users. In the closed model each virtual
+// user goroutine takes one for its lifetime, so its session, credentials
+// and User-Agent stay the same from one request to the next. In the open
+// model a request holds a user until it completes, so concurrent requests
+// never share one, and a later request picks it up again with the session
+// cookies the server set. Nil when neither cookies, credentials nor
+// per-user User-Agents are enabled.
+type virtualUsers struct {
+	idle    chan *virtualUser
+	cookies bool
+	creds   []map[string]string
+	agents  []string
+	started atomic.Int64
+}
+
+func newVirtualUsers(cfg *Plan) *virtualUsers {
+	if !cfg.Cookies && cfg.credentials == nil && !cfg.perUserAgent() {
+		return nil
+	}
+	u := &virtualUsers{
+		idle:    make(chan *virtualUser, cfg.Concurrency),
+		cookies: cfg.Cookies,
+		creds:   cfg.credentials,
+	}
+	if cfg.perUserAgent() {
+		u.agents = cfg.userAgents
+	}
+	return u
+}
+
+// get returns an idle user, or a new one when all are busy. New users
+// take the credentials rows and User-Agents in turn, starting over once
+// every one has a user.
+func (u *virtualUsers) get() *virtualUser {
+	select {
+	case vu := <-u.idle:
+		return vu
+	default:
+		// More requests in flight than users so far (open model): start
+		// a new user
+	}
+	vu := &virtualUser{}
+	if u.cookies {
+		vu.jar, _ = cookiejar.New(nil)
+	}
+	n := int(u.started.Add(1) - 1)
+	if u.creds != nil {
+		vu.creds = u.creds[n%len(u.creds)]
+	}
+	if u.agents != nil {
+		vu.agent = u.agents[n%len(u.agents)]
+	}
+	return vu
+}
+
+// bind returns a user for a virtual user goroutine to keep, nil without
+// virtual users. It is never handed back.
+func (u *virtualUsers) bind() *virtualUser {
+	if u == nil {
+		return nil
+	}
+	return u.get()
+}
+
+// put hands a user back once its request is done
+func (u *virtualUsers) put(vu *virtualUser) {
+	select {
+	case u.idle <- vu:
+	default:
+	}
+}
+
+// client returns a copy of base that uses the jar of vu, or of a user it
+// borrows when vu is nil, the user, nil without virtual users, and a func
+// that hands a borrowed user back once the request is done
+func (u *virtualUsers) client(base *http.Client, vu *virtualUser) (*http.Client, *virtualUser, func()) {
+	if u == nil {
+		return base, nil, func() {}
+	}
+	release := func() {}
+	if vu == nil {
+		vu = u.get()
+		release = func() { u.put(vu) }
+	}
+	c := *base
+	if vu.jar != nil {
+		c.Jar = vu.jar
+	}
+	return &c, vu, release
+}
+
+// loadCredentials reads the credentials file, a row per virtual user in
+// the format of a feeder file
+func loadCredentials(file string) ([]map[string]string, error) {
+	rows, err := readRows(file)
+	if err != nil {
+		return nil, fmt.Errorf("credentials %s: %w", file, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("credentials %s: no rows", file)
+	}
+	return rows, nil
+}
+
+// withCredentials returns vars with the columns of creds added, creds
+// taking precedence. Neither is modified.
+func withCredentials(vars, creds map[string]string) map[string]string {
+	if creds == nil {
+		return vars
+	}
+	out := make(map[string]string, len(vars)+len(creds))
+	for k, v := range vars {
+		out[k] = v
+	}
+	for k, v := range creds {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"LoadTester/config"
+)
+
+// setupLogging makes the default slog logger write entries of level and
+// above to w in format, config.LogText or config.LogJSON. The packages of
+// the tool and the standard log package all log through it.
+func setupLogging(w io.Writer, level, format string) error {
+	var min slog.Level // info when empty
+	if level != "" {
+		if err := min.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("unknown log_level %q (want debug, info, warn or error)", level)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: min}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "", config.LogText:
+		h = slog.NewTextHandler(w, opts)
+	case config.LogJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("unknown log_format %q (want text or json)", format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
@@ -1,263 +1,482 @@
+// Command loadtester runs HTTP, gRPC, GraphQL, raw socket and DNS load
+// tests. The work is done by the runner package; this command reads the
+// configuration, shows live progress and prints the results.
 package main
 
 import (
-	"compress/gzip"
-	"crypto/tls"
-	"encoding/csv"
+	"context"
+	"crypto/rand"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
-	"sort"
-	"strconv"
-	"sync"
-	"sync/atomic"
+	"os/signal"
+	"syscall"
 	"time"
-)
 
-// Config holds the load test configuration
-type Config struct {
-	URL         string
-	Requests    int
-	Concurrency int
-	Interval    int
-	RepeatCount int
-	RepeatDelay int
-	Burst       bool
-	Compress    bool
-	LogRequests bool
-	MaxRetries  int
-}
+	"LoadTester/config"
+	"LoadTester/loadgen"
+	"LoadTester/metrics"
+	"LoadTester/report"
+	"LoadTester/runner"
+	"LoadTester/server"
+)
 
-// Result stores metrics for each request
-type Result struct {
-	RequestID int
-	Status    int
-	Error     string
-	Duration  time.Duration
-	Retries   int
+func main() {
+	// Subcommands log as LOG_LEVEL and LOG_FORMAT say; a test applies its
+	// own settings once loaded
+	if err := setupLogging(os.Stderr, config.GetEnv("LOG_LEVEL", ""), config.GetEnv("LOG_FORMAT", "")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "agent":
+			os.Exit(runAgent(os.Args[2:]))
+		case "serve":
+			os.Exit(runServe(os.Args[2:]))
+		case "record":
+			os.Exit(runRecord(os.Args[2:]))
+		case "compare":
+			os.Exit(runCompare(os.Args[2:]))
+		case "history":
+			os.Exit(runHistory(os.Args[2:]))
+		case "daemon":
+			os.Exit(runDaemon(os.Args[2:]))
+		case "k8s":
+			os.Exit(runK8s(os.Args[2:]))
+		}
+	}
+	os.Exit(runTest(os.Args[1:]))
 }
 
-// getEnv reads env variable or returns default
-func getEnv(key, def string) string {
-	if val, ok := os.LookupEnv(key); ok {
-		return val
+// runTest runs the load test configured by args and returns the process
+// exit code. It returns rather than exiting so deferred report writers are
+// flushed.
+func runTest(args []string) int {
+	cfg, err := config.Load(args)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		slog.Error("invalid configuration", "err", err)
+		return 2
+	}
+	if len(cfg.Targets) > 0 {
+		return runTargets(args, cfg)
 	}
-	return def
+	return runConfig(cfg)
 }
 
-// loadConfig reads environment variables into Config
-func loadConfig() Config {
-	reqs, _ := strconv.Atoi(getEnv("REQUESTS", "1000"))
-	concurrency, _ := strconv.Atoi(getEnv("CONCURRENCY", "100"))
-	interval, _ := strconv.Atoi(getEnv("INTERVAL", "5"))
-	repeatCount, _ := strconv.Atoi(getEnv("REPEAT_COUNT", "1"))
-	repeatDelay, _ := strconv.Atoi(getEnv("REPEAT_DELAY", "5"))
-	maxRetries, _ := strconv.Atoi(getEnv("MAX_RETRIES", "2"))
-	burst := getEnv("BURST", "false") == "true"
-	compress := getEnv("COMPRESS", "false") == "true"
-	logReq := getEnv("LOG_REQUESTS", "false") == "true"
-	url := getEnv("URL", "https://www.google.com/generate_204")
+// runConfig runs a load test from its loaded settings and returns the
+// process exit code
+func runConfig(cfg config.Config) int {
+	r, err := runner.New(cfg)
+	if err != nil {
+		slog.Error("invalid configuration", "err", err)
+		return 2
+	}
+	var logTo io.Writer = os.Stderr
+	level := cfg.LogLevel
+	if cfg.LogRequests {
+		os.MkdirAll(cfg.LogDir, 0755)
+		logFile, err := os.Create(fmt.Sprintf("%s/results_%d.log", cfg.LogDir, time.Now().Unix()))
+		if err != nil {
+			slog.Error("failed to create the log file", "err", err)
+		} else {
+			defer logFile.Close()
+			logTo = logFile
+		}
+		if level == "" {
+			level = "debug"
+		}
+	}
+	if err := setupLogging(logTo, level, cfg.LogFormat); err != nil {
+		slog.Error("invalid configuration", "err", err)
+		return 2
+	}
+	if cfg.DryRun {
+		return dryRun(r)
+	}
 
-	return Config{
-		URL:         url,
-		Requests:    reqs,
-		Concurrency: concurrency,
-		Interval:    interval,
-		RepeatCount: repeatCount,
-		RepeatDelay: repeatDelay,
-		Burst:       burst,
-		Compress:    compress,
-		LogRequests: logReq,
-		MaxRetries:  maxRetries,
+	live := metrics.NewLive()
+	if cfg.MetricsAddr != "" {
+		srv := metrics.Serve(cfg.MetricsAddr, live)
+		defer srv.Close()
+		fmt.Printf("Serving Prometheus metrics on %s/metrics\n", cfg.MetricsAddr)
+	}
+	if cfg.PprofAddr != "" {
+		srv := servePprof(cfg.PprofAddr)
+		defer srv.Close()
+		fmt.Printf("Serving pprof on %s/debug/pprof/\n", cfg.PprofAddr)
+	}
+	resolved := r.Config()
+	stopDisplay := func() {}
+	if cfg.TUI {
+		if !isTerminal(os.Stdout) {
+			fmt.Println("Dashboard disabled: stdout is not a terminal")
+		} else if stop, err := startDashboard(&resolved, live); err != nil {
+			slog.Warn("failed to start the dashboard", "err", err)
+		} else {
+			stopDisplay = stop
+		}
+	} else if cfg.Progress {
+		stopDisplay = startProgress(live)
+	}
+	// The dashboard captures stdout, so it is only looked up once the
+	// display has started
+	r.Out = os.Stdout
+	r.Live = live
+	ctx, stop := interruptContext(time.Duration(resolved.ShutdownGrace))
+	stopPause := handlePauseSignals(r)
+	out, err := r.Run(ctx)
+	stopPause()
+	stop()
+	stopDisplay()
+	if err != nil {
+		slog.Error("test failed", "err", err)
+		return 1
 	}
+	return printResults(out)
 }
 
-// createHTTPClient returns a high-performance HTTP client
-func createHTTPClient() *http.Client {
-	// Read VERIFY_TLS env var (default true)
-	verifyTLS, _ := strconv.ParseBool(getEnv("VERIFY_TLS", "true"))
+// printResults prints the outcome of all runs of a test and returns the
+// process exit code
+func printResults(out *runner.Report) int {
+	switch {
+	case out.Aborted != "":
+		fmt.Printf("Test aborted after %d run(s). Total failed requests: %d\n", len(out.Runs), out.Total.Failed)
+	case out.Interrupted:
+		fmt.Printf("Test interrupted after %d run(s). Total failed requests: %d\n", len(out.Runs), out.Total.Failed)
+	default:
+		fmt.Printf("All test runs completed. Total failed requests: %d\n", out.Total.Failed)
+	}
+	report.PrintStatusTable(os.Stdout, out.Total)
+	report.PrintErrorTable(os.Stdout, out.Total)
+	report.PrintEndpointTable(os.Stdout, &out.Config, out.Total)
+	fmt.Printf("Total wall-clock time for all runs: %.2fs\n", out.Duration.Seconds())
+	if len(out.Config.Tags) > 0 {
+		fmt.Printf("Tags: %s\n", report.FormatTags(out.Config.Tags, ", "))
+	}
+	if out.CSVFile != "" {
+		fmt.Printf("Report saved to: %s\n", out.CSVFile)
+	} else {
+		fmt.Println("Per-request reports are saved on the agents")
+	}
+	if out.HTMLFile != "" {
+		fmt.Printf("HTML report saved to: %s\n", out.HTMLFile)
+	}
+	if out.CaptureFile != "" {
+		fmt.Printf("Captured requests saved to: %s\n", out.CaptureFile)
+	}
+	if out.FailuresFile != "" {
+		fmt.Printf("Failed requests saved to: %s\n", out.FailuresFile)
+	}
+	for _, location := range out.Uploaded {
+		fmt.Printf("Report uploaded to: %s\n", location)
+	}
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: !verifyTLS, // skip verification if VERIFY_TLS=false
+	if out.Config.Search {
+		switch {
+		case out.MaxRate == 0:
+			fmt.Printf("Search: the thresholds failed at every rate down to %.2f req/s\n", out.FailRate)
+		case out.FailRate == 0:
+			fmt.Printf("Maximum sustainable rate: at least %.2f req/s, the highest tried\n", out.MaxRate)
+		default:
+			fmt.Printf("Maximum sustainable rate: %.2f req/s (thresholds failed at %.2f req/s)\n", out.MaxRate, out.FailRate)
+		}
+	}
+	report.PrintThresholds(os.Stdout, out.Thresholds)
+	if out.Aborted != "" {
+		fmt.Printf("Test aborted: %s\n", out.Aborted)
+		return 1
+	}
+	if !out.Passed {
+		fmt.Println("One or more thresholds failed")
+		return 1
+	}
+	if out.Interrupted {
+		return 130
 	}
+	return 0
+}
 
-	return &http.Client{
-		Timeout: 15 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig:     tlsConfig,
-			MaxIdleConns:        50_000,
-			MaxIdleConnsPerHost: 50_000,
-			DisableKeepAlives:   false,
-		},
+// dryRun prints the resolved test and the results of a single request to
+// each endpoint, returning 1 if any of them failed
+func dryRun(r *runner.Runner) int {
+	resolved := r.Config()
+	report.PrintPlan(os.Stdout, &resolved)
+	ctx, stop := interruptContext(0)
+	defer stop()
+	if !report.PrintProbes(os.Stdout, r.Probe(ctx)) {
+		fmt.Println("Dry run failed: fix the requests above before running the test")
+		return 1
 	}
+	fmt.Println("Dry run passed; run again without -dry-run to start the test")
+	return 0
 }
 
-// worker executes a single HTTP GET request with retries
-func worker(client *http.Client, url string, id int, results chan<- Result, logReq bool, maxRetries int) {
-	var r Result
-	r.RequestID = id
-	start := time.Now()
-	var attempt int
-	for attempt = 0; attempt <= maxRetries; attempt++ {
-		req, err := http.NewRequest("GET", url, nil)
-		req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; LoadTester/1.0; +https://example.com)")
-		if err != nil {
-			r.Error = err.Error()
-			break
+// interruptContext returns a context that is cancelled on the first
+// SIGINT or SIGTERM until stop is called. A second signal kills the
+// process as usual.
+func interruptContext(grace time.Duration) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			signal.Stop(sigs)
+			fmt.Printf("\nReceived %v: stopping the test, requests in flight have %s to finish (repeat to quit now)\n", sig, grace)
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
 
-		resp, err := client.Do(req)
-		duration := time.Since(start)
-		r.Duration = duration
-		r.Retries = attempt
-
-		if err != nil {
-			r.Error = err.Error()
-			continue
+// handlePauseSignals pauses or resumes r on each SIGUSR1 until the
+// returned function is called
+func handlePauseSignals(r *runner.Runner) (stop func()) {
+	if len(pauseSignals) == 0 {
+		return func() {}
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, pauseSignals...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				if r.Pause() {
+					fmt.Println("Paused: no new requests are sent until the next SIGUSR1")
+				} else if r.Resume() {
+					fmt.Println("Resumed")
+				}
+			case <-done:
+				return
+			}
 		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
 
-		io.Copy(io.Discard, resp.Body)
-		resp.Body.Close()
-
-		r.Status = resp.StatusCode
-		if resp.StatusCode >= 400 {
-			r.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
-			continue
+// runAgent serves coordinator requests until the process is stopped and
+// returns the process exit code
+func runAgent(args []string) int {
+	fs := flag.NewFlagSet("loadtester agent", flag.ContinueOnError)
+	listen := fs.String("listen", config.GetEnv("AGENT_LISTEN", "127.0.0.1:7070"), "address to accept coordinator requests on (env AGENT_LISTEN)")
+	token := fs.String("token", config.GetEnv("AGENT_TOKEN", ""), "token coordinators must send, set on them with -agent-token (env AGENT_TOKEN)")
+	reportDir := fs.String("report-dir", config.GetEnv("REPORT_DIR", "reports"), "directory for the per-request report of each run (env REPORT_DIR)")
+	pprofAddr := fs.String("pprof-addr", config.GetEnv("PPROF_ADDR", ""), "serve the Go profiler on this address, e.g. localhost:6060 (env PPROF_ADDR)")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
 		}
-		r.Error = ""
-		break
+		return 2
 	}
-
-	results <- r
+	if *token == "" {
+		slog.Error("agent: -token is required, so that only your coordinators can start load")
+		return 2
+	}
+	if *pprofAddr != "" {
+		defer servePprof(*pprofAddr).Close()
+	}
+	fmt.Printf("Agent listening on %s\n", *listen)
+	if err := http.ListenAndServe(*listen, runner.NewAgent(*token, *reportDir, os.Stdout)); err != nil {
+		slog.Error("agent stopped", "err", err)
+		return 1
+	}
+	return 0
 }
 
-// runLoad executes a single run of requests
-func runLoad(cfg Config, run int, writer *csv.Writer, totalFailed *int64) time.Duration {
-	fmt.Printf("Starting test run #%d\n", run)
-	client := createHTTPClient()
-	results := make(chan Result, cfg.Requests)
-	var wg sync.WaitGroup
-	startRun := time.Now()
-
-	// Semaphore for concurrency control
-	sem := make(chan struct{}, cfg.Concurrency)
-
-	// Interval ticker for pacing requests if not burst
-	var ticker *time.Ticker
-	if !cfg.Burst && cfg.Interval > 0 {
-		intervalPerReq := time.Duration(float64(cfg.Interval) / float64(cfg.Requests) * float64(time.Second))
-		ticker = time.NewTicker(intervalPerReq)
-		defer ticker.Stop()
+// runServe serves the control API until the process is stopped and
+// returns the process exit code
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("loadtester serve", flag.ContinueOnError)
+	listen := fs.String("listen", config.GetEnv("SERVE_LISTEN", "127.0.0.1:8080"), "address to serve the API on (env SERVE_LISTEN)")
+	token := fs.String("token", config.GetEnv("SERVE_TOKEN", ""), "bearer token API clients must send, generated when empty (env SERVE_TOKEN)")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
 	}
-
-	send := func(id int) {
-		defer wg.Done()
-		worker(client, cfg.URL, id, results, cfg.LogRequests, cfg.MaxRetries)
-		<-sem
+	if *token == "" {
+		*token = rand.Text()
+		fmt.Printf("API token: %s\n", *token)
+	}
+	fmt.Printf("Serving the control API on %s\n", *listen)
+	if err := http.ListenAndServe(*listen, server.New(*token)); err != nil {
+		slog.Error("serve stopped", "err", err)
+		return 1
 	}
+	return 0
+}
 
-	for i := 1; i <= cfg.Requests; i++ {
-		wg.Add(1)
-		sem <- struct{}{}
-		go send(i)
-		if !cfg.Burst && ticker != nil {
-			<-ticker.C
+// runRecord proxies requests to the target, capturing them for replay,
+// until the process is interrupted and returns the process exit code
+func runRecord(args []string) int {
+	fs := flag.NewFlagSet("loadtester record", flag.ContinueOnError)
+	listen := fs.String("listen", config.GetEnv("RECORD_LISTEN", ":8081"), "address to accept the traffic to record on (env RECORD_LISTEN)")
+	targetURL := fs.String("target", config.GetEnv("RECORD_TARGET", ""), "URL of the service to forward the traffic to (env RECORD_TARGET)")
+	out := fs.String("out", config.GetEnv("RECORD_FILE", "capture.jsonl"), "file to write the captured requests to (env RECORD_FILE)")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
 		}
+		return 2
+	}
+	target, err := url.Parse(*targetURL)
+	if err != nil || target.Host == "" {
+		slog.Error("record: -target must be an absolute URL", "target", *targetURL)
+		return 2
+	}
+	file, err := os.Create(*out)
+	if err != nil {
+		slog.Error("record failed", "err", err)
+		return 1
 	}
+	defer file.Close()
 
+	rec := loadgen.NewRecorder(target, file)
+	srv := &http.Server{Addr: *listen, Handler: rec}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	go func() {
-		wg.Wait()
-		close(results)
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
 	}()
+	fmt.Printf("Recording requests to %s on %s into %s (Ctrl+C to stop)\n", target.Redacted(), *listen, *out)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		slog.Error("record failed", "err", err)
+		return 1
+	}
+	fmt.Printf("Recorded %d request(s) to %s\n", rec.Recorded(), *out)
+	return 0
+}
 
-	// Collect results
-	var success, fail int32
-	var latencies []int64
-	batch := make([][]string, 0, cfg.Requests)
-	for r := range results {
-		if r.Error != "" {
-			fail++
-		} else {
-			success++
+// runCompare compares the per-request report of a test with that of a
+// baseline and returns 1 if any metric regressed beyond its tolerance
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("loadtester compare", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: loadtester compare [flags] <baseline report> <current report>")
+		fs.PrintDefaults()
+	}
+	var tol metrics.Tolerances
+	fs.Float64Var(&tol.Latency, "latency-tolerance", 0.1, "largest relative increase of p50, p95 and p99, e.g. 0.1 for 10%")
+	fs.Float64Var(&tol.ErrorRate, "error-rate-tolerance", 0.01, "largest increase of the error rate, e.g. 0.01 for one percentage point")
+	fs.Float64Var(&tol.Throughput, "rps-tolerance", 0.1, "largest relative decrease of the throughput, e.g. 0.1 for 10%")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
 		}
-		latencies = append(latencies, r.Duration.Milliseconds())
-		batch = append(batch, []string{
-			strconv.Itoa(run),
-			strconv.Itoa(r.RequestID),
-			strconv.Itoa(r.Status),
-			r.Error,
-			strconv.Itoa(int(r.Duration.Milliseconds())),
-			strconv.Itoa(r.Retries),
-		})
-	}
-	writer.WriteAll(batch)
-	atomic.AddInt64(totalFailed, int64(fail))
-
-	// Compute latency percentiles
-	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
-	p50, p90, p99 := int64(0), int64(0), int64(0)
-	if len(latencies) > 0 {
-		p50 = latencies[len(latencies)/2]
-		p90 = latencies[int(float64(len(latencies))*0.9)]
-		p99 = latencies[int(float64(len(latencies))*0.99)]
+		return 2
 	}
-
-	durationRun := time.Since(startRun)
-	fmt.Printf("Run %d completed: Requests=%d, Success=%d, Failed=%d, Time=%.2fs\n",
-		run, cfg.Requests, success, fail, durationRun.Seconds())
-	fmt.Printf("Latency(ms): p50=%d, p90=%d, p99=%d\n", p50, p90, p99)
-
-	return durationRun
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	if tol.Latency < 0 || tol.ErrorRate < 0 || tol.Throughput < 0 {
+		slog.Error("compare: tolerances must not be negative")
+		return 2
+	}
+	base, err := report.ReadRuns(fs.Arg(0))
+	if err != nil {
+		slog.Error("compare failed", "err", err)
+		return 2
+	}
+	cur, err := report.ReadRuns(fs.Arg(1))
+	if err != nil {
+		slog.Error("compare failed", "err", err)
+		return 2
+	}
+	deltas := metrics.Compare(metrics.Merge(base), metrics.Merge(cur), tol)
+	fmt.Printf("Comparing %s (current) with %s (baseline)\n", fs.Arg(1), fs.Arg(0))
+	report.PrintComparison(os.Stdout, deltas)
+	report.PrintRunComparison(os.Stdout, base, cur)
+	if metrics.Regressed(deltas) {
+		fmt.Println("Performance regressed beyond the tolerances")
+		return 1
+	}
+	return 0
 }
 
-func main() {
-	cfg := loadConfig()
-	reportDir := getEnv("REPORT_DIR", "reports")
-	logDir := getEnv("LOG_DIR", "logs")
-
-	os.MkdirAll(reportDir, 0755)
-	if cfg.LogRequests {
-		os.MkdirAll(logDir, 0755)
-		logFile, _ := os.Create(fmt.Sprintf("%s/results_%d.log", logDir, time.Now().Unix()))
-		defer logFile.Close()
-		log.SetOutput(logFile)
+// runHistory prints or exports the results recorded in a history database
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("loadtester history", flag.ContinueOnError)
+	file := fs.String("file", config.GetEnv("HISTORY_FILE", "history.db"), "SQLite history database written by -history (env HISTORY_FILE)")
+	test := fs.String("test", config.GetEnv("TEST_NAME", ""), "show only this test (env TEST_NAME)")
+	commit := fs.String("commit", "", "show only the tests of commits starting with this")
+	imp := fs.String("import", "", "add the entries of a JSON Lines history file from an earlier version to the database first")
+	last := fs.Int("last", 20, "show only the last n entries of each test, 0 for all")
+	format := fs.String("format", "text", "text, or csv to export the entries")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
 	}
-
-	timestamp := time.Now().Format("20060102_150405")
-	fileName := fmt.Sprintf("%s/results_%s.csv", reportDir, timestamp)
-	var file *os.File
-	var writer *csv.Writer
-
-	if cfg.Compress {
-		file, _ = os.Create(fileName + ".gz")
-		defer file.Close()
-		gzipWriter := gzip.NewWriter(file)
-		defer gzipWriter.Close()
-		writer = csv.NewWriter(gzipWriter)
-		defer writer.Flush()
-	} else {
-		file, _ = os.Create(fileName)
-		defer file.Close()
-		writer = csv.NewWriter(file)
-		defer writer.Flush()
+	if *imp != "" {
+		n, err := report.ImportHistory(*file, *imp)
+		if err != nil {
+			slog.Error("history import failed", "err", err)
+			return 2
+		}
+		fmt.Fprintf(os.Stderr, "Imported %d test(s) from %s into %s\n", n, *imp, *file)
 	}
-
-	writer.Write([]string{"RunID", "RequestID", "Status", "Error", "Duration(ms)", "Retries"})
-
-	var totalFailed int64
-	var totalDuration time.Duration
-	for run := 1; run <= cfg.RepeatCount; run++ {
-		duration := runLoad(cfg, run, writer, &totalFailed)
-		totalDuration += duration
-		if run < cfg.RepeatCount {
-			fmt.Printf("Waiting %d seconds before next run...\n", cfg.RepeatDelay)
-			time.Sleep(time.Duration(cfg.RepeatDelay) * time.Second)
+	entries, err := report.ReadHistory(*file, *test, *commit)
+	if err != nil {
+		slog.Error("history failed", "err", err)
+		return 2
+	}
+	if *last > 0 {
+		entries = lastPerTest(entries, *last)
+	}
+	switch *format {
+	case "text":
+		if len(entries) == 0 {
+			fmt.Println("No tests recorded")
+			return 0
+		}
+		report.PrintHistory(os.Stdout, entries)
+	case "csv":
+		if err := report.WriteHistoryCSV(os.Stdout, entries); err != nil {
+			slog.Error("history failed", "err", err)
+			return 1
 		}
+	default:
+		slog.Error("history: unknown format, want text or csv", "format", *format)
+		return 2
 	}
+	return 0
+}
 
-	fmt.Printf("All test runs completed. Total failed requests: %d\n", totalFailed)
-	fmt.Printf("Total wall-clock time for all runs: %.2fs\n", totalDuration.Seconds())
-	fmt.Printf("Report saved to: %s\n", fileName)
+// lastPerTest keeps the last n entries of each test, in their order
+func lastPerTest(entries []report.HistoryEntry, n int) []report.HistoryEntry {
+	seen := map[string]int{}
+	keep := make([]bool, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		if seen[entries[i].Test] < n {
+			seen[entries[i].Test]++
+			keep[i] = true
+		}
+	}
+	var kept []report.HistoryEntry
+	for i, e := range entries {
+		if keep[i] {
+			kept = append(kept, e)
+		}
+	}
+	return kept
 }
@@ -0,0 +1,79 @@
+package metrics
+
+import "time"
+
+// Tolerances are the largest changes from a baseline that are not
+// regressions: relative increases of the latency percentiles and decrease
+// of the throughput, e.g. 0.1 for 10%, and an absolute increase of the
+// error rate, e.g. 0.01 for one percentage point
+type Tolerances struct {
+	Latency    float64
+	ErrorRate  float64
+	Throughput float64
+}
+
+// MinLatencyRegression is the smallest latency increase counted as a
+// regression, below which percentiles only differ by histogram resolution
+// and noise
+const MinLatencyRegression = time.Millisecond
+
+// Delta is one metric of a test compared with its baseline
+type Delta struct {
+	Metric   string  // p50, p95, p99, error_rate or rps
+	Baseline float64 // milliseconds for latencies, a fraction for error_rate
+	Current  float64
+	// Change is relative to the baseline, except for error_rate where it
+	// is the difference
+	Change    float64
+	Tolerance float64
+	Regressed bool
+	// Unknown is set when either side lacks the metric, such as the
+	// throughput of a report without timestamps
+	Unknown bool
+}
+
+// Compare compares the combined results of a test with those of a
+// baseline
+func Compare(base, cur *RunStats, tol Tolerances) []Delta {
+	var deltas []Delta
+	for _, p := range []struct {
+		name string
+		q    float64
+	}{{"p50", 0.50}, {"p95", 0.95}, {"p99", 0.99}} {
+		b, c := base.Latency.Quantile(p.q), cur.Latency.Quantile(p.q)
+		d := Delta{Metric: p.name, Baseline: millis(b), Current: millis(c), Tolerance: tol.Latency}
+		if b > 0 {
+			d.Change = float64(c-b) / float64(b)
+		}
+		d.Regressed = c-b >= MinLatencyRegression && (b == 0 || d.Change > tol.Latency)
+		deltas = append(deltas, d)
+	}
+
+	d := Delta{Metric: "error_rate", Baseline: base.ErrorRate(), Current: cur.ErrorRate(), Tolerance: tol.ErrorRate}
+	d.Change = d.Current - d.Baseline
+	d.Regressed = d.Change > tol.ErrorRate
+	deltas = append(deltas, d)
+
+	d = Delta{Metric: "rps", Baseline: base.Throughput(), Current: cur.Throughput(), Tolerance: tol.Throughput}
+	if d.Baseline == 0 || d.Current == 0 {
+		d.Unknown = true
+	} else {
+		d.Change = (d.Current - d.Baseline) / d.Baseline
+		d.Regressed = d.Change < -tol.Throughput
+	}
+	return append(deltas, d)
+}
+
+// Regressed reports whether any of deltas is a regression
+func Regressed(deltas []Delta) bool {
+	for _, d := range deltas {
+		if d.Regressed {
+			return true
+		}
+	}
+	return false
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
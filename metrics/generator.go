@@ -0,0 +1,60 @@
+package metrics
+
+import "time"
+
+// Limits above which the load generator, not the target, is likely to be
+// what holds the test back
+const (
+	BusyCPU = 0.8                   // share of the available CPU
+	BusyLag = 50 * time.Millisecond // scheduling lag
+)
+
+// GeneratorStats describe the load generator's own health during a run.
+// Merged stats keep the worst of their parts, except for the GC figures
+// which add up.
+type GeneratorStats struct {
+	CPUs int // GOMAXPROCS
+	// CPU is the share of the available CPU the process used, 0 to 1, or
+	// -1 where it cannot be measured
+	CPU            float64
+	PeakGoroutines int
+	// PeakSockets is the most sockets open at once, -1 where they cannot
+	// be counted
+	PeakSockets  int
+	GCs          int
+	GCPauseTotal time.Duration
+	GCPauseMax   time.Duration
+	// Lag is how late a timer that should fire every 100ms fired, at most
+	// and on average: a loaded scheduler delays sends and timings alike
+	LagMax  time.Duration
+	LagMean time.Duration
+}
+
+// Busy reports why the generator may have limited the test, or "" if it
+// kept up
+func (g GeneratorStats) Busy() string {
+	switch {
+	case g.CPU >= BusyCPU:
+		return "it used most of its CPU"
+	case g.LagMax >= BusyLag:
+		return "its scheduler fell behind by up to " + g.LagMax.Round(time.Millisecond).String()
+	}
+	return ""
+}
+
+func (g *GeneratorStats) merge(o GeneratorStats) {
+	if g.CPUs == 0 {
+		// Nothing merged yet
+		*g = o
+		return
+	}
+	g.CPUs = max(g.CPUs, o.CPUs)
+	g.CPU = max(g.CPU, o.CPU)
+	g.PeakGoroutines = max(g.PeakGoroutines, o.PeakGoroutines)
+	g.PeakSockets = max(g.PeakSockets, o.PeakSockets)
+	g.GCs += o.GCs
+	g.GCPauseTotal += o.GCPauseTotal
+	g.GCPauseMax = max(g.GCPauseMax, o.GCPauseMax)
+	g.LagMax = max(g.LagMax, o.LagMax)
+	g.LagMean = max(g.LagMean, o.LagMean)
+}
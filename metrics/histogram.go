@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"encoding/json"
+	"math/bits"
+	"time"
+)
+
+// Histogram layout: values below histSubBuckets microseconds get one
+// bucket each; above that every power of two is split into
+// histSubBuckets/2 linear sub-buckets, giving under 1% relative error
+// with a few KB of counters regardless of how many values are recorded.
+const (
+	histSubBits    = 7
+	histSubBuckets = 1 << histSubBits
+	histHalf       = histSubBuckets / 2
+)
+
+// Histogram records latencies in HDR-style log-linear buckets
+type Histogram struct {
+	counts []uint64
+	total  uint64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+// NewHistogram returns an empty histogram
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+func histBucket(us uint64) int {
+	if us < histSubBuckets {
+		return int(us)
+	}
+	shift := bits.Len64(us) - histSubBits
+	return shift*histHalf + int(us>>shift)
+}
+
+// histBucketValue returns the midpoint of a bucket in microseconds
+func histBucketValue(i int) uint64 {
+	if i < histSubBuckets {
+		return uint64(i)
+	}
+	shift := i/histHalf - 1
+	sub := uint64(i - shift*histHalf)
+	return sub<<shift + (uint64(1)<<shift)/2
+}
+
+// Record adds one latency
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	i := histBucket(uint64(d / time.Microsecond))
+	if i >= len(h.counts) {
+		grown := make([]uint64, i+1)
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	h.counts[i]++
+	if h.total == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.total++
+	h.sum += d
+}
+
+// Merge adds all values recorded in o
+func (h *Histogram) Merge(o *Histogram) {
+	if o == nil || o.total == 0 {
+		return
+	}
+	if len(o.counts) > len(h.counts) {
+		grown := make([]uint64, len(o.counts))
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	if h.total == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	h.max = max(h.max, o.max)
+	h.total += o.total
+	h.sum += o.sum
+}
+
+// Count returns the number of recorded values
+func (h *Histogram) Count() uint64 { return h.total }
+
+// Min returns the smallest recorded value
+func (h *Histogram) Min() time.Duration { return h.min }
+
+// Max returns the largest recorded value
+func (h *Histogram) Max() time.Duration { return h.max }
+
+// Mean returns the average of the recorded values
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// Quantile returns the value at quantile q (0 <= q <= 1). The extremes are
+// exact; everything in between is accurate to the bucket resolution.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return h.min
+	}
+	if q >= 1 {
+		return h.max
+	}
+	rank := uint64(q*float64(h.total)) + 1
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			v := time.Duration(histBucketValue(i)) * time.Microsecond
+			return min(max(v, h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+// histogramJSON is the wire form of a Histogram, used to send agent
+// results to the coordinator
+type histogramJSON struct {
+	Counts []uint64      `json:"counts"`
+	Total  uint64        `json:"total"`
+	Sum    time.Duration `json:"sum"`
+	Min    time.Duration `json:"min"`
+	Max    time.Duration `json:"max"`
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	return json.Marshal(histogramJSON{h.counts, h.total, h.sum, h.min, h.max})
+}
+
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var v histogramJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*h = Histogram{counts: v.Counts, total: v.Total, sum: v.Sum, min: v.Min, max: v.Max}
+	return nil
+}
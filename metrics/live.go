@@ -0,0 +1,301 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the Prometheus Histogram upper bounds in seconds
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Live tracks counters across all runs while the test is in
+// progress so they can be scraped from the /metrics endpoint
+type Live struct {
+	mu           sync.Mutex
+	run          int
+	tags         map[string]string
+	paused       bool
+	inFlight     int
+	requests     map[int]int    // by status code, 0 for transport errors
+	errors       map[string]int // by ErrType category
+	errorTotal   int
+	retries      int
+	bucketCounts []int
+	latencySum   float64
+	latencyCount int
+
+	// The load generator's own health, sampled every second
+	goroutines int
+	sockets    int // -1 if unknown
+	cpu        float64
+	lag        time.Duration
+
+	// Per-second window used by the live displays
+	started time.Time
+	current liveSecond
+	history []liveSecond
+}
+
+// liveSecond holds the requests completed during one display tick
+type liveSecond struct {
+	requests int
+	errors   int
+	latency  *Histogram
+}
+
+// Snapshot is the view of the test passed to live displays each tick
+type Snapshot struct {
+	Run       int
+	Paused    bool
+	Elapsed   time.Duration
+	InFlight  int
+	Requests  int // completed, all runs
+	Errors    int
+	RPS       float64 // completed during the last second
+	ErrorRate float64 // of requests completed during the last second
+	P50       int64   // rolling percentiles over the last RollingWindow seconds
+	P95       int64
+	P99       int64
+	History   []int64 // p95 of each recent second, oldest first
+}
+
+const (
+	RollingWindow  = 10 // seconds used for rolling percentiles
+	historySeconds = 60 // seconds of history kept for sparklines
+)
+
+// NewLive returns live metrics for a test starting now
+func NewLive() *Live {
+	return &Live{
+		requests:     map[int]int{},
+		errors:       map[string]int{},
+		bucketCounts: make([]int, len(latencyBuckets)),
+		started:      time.Now(),
+	}
+}
+
+// StartRun records the number of the run in progress
+func (m *Live) StartRun(run int) {
+	m.mu.Lock()
+	m.run = run
+	m.mu.Unlock()
+}
+
+// SetTags sets the test's tags, exported as the labels of loadtester_info
+func (m *Live) SetTags(tags map[string]string) {
+	m.mu.Lock()
+	m.tags = tags
+	m.mu.Unlock()
+}
+
+// SetPaused records whether the test is paused
+func (m *Live) SetPaused(paused bool) {
+	m.mu.Lock()
+	m.paused = paused
+	m.mu.Unlock()
+}
+
+// SetGenerator records the load generator's goroutines, open sockets,
+// share of CPU used and worst scheduling lag over the last second; -1 marks
+// a figure that cannot be measured
+func (m *Live) SetGenerator(goroutines, sockets int, cpu float64, lag time.Duration) {
+	m.mu.Lock()
+	m.goroutines, m.sockets, m.cpu, m.lag = goroutines, sockets, cpu, lag
+	m.mu.Unlock()
+}
+
+// Launched records a request being sent
+func (m *Live) Launched() {
+	m.mu.Lock()
+	m.inFlight++
+	m.mu.Unlock()
+}
+
+// Observe records a finished request
+func (m *Live) Observe(r Result) {
+	secs := r.Duration.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight--
+	m.requests[r.Status]++
+	if r.Error != "" {
+		m.errors[r.ErrorType]++
+		m.errorTotal++
+	}
+	m.retries += r.Retries
+	for i, le := range latencyBuckets {
+		if secs <= le {
+			m.bucketCounts[i]++
+		}
+	}
+	m.latencySum += secs
+	m.latencyCount++
+
+	m.current.requests++
+	if r.Error != "" {
+		m.current.errors++
+	}
+	if m.current.latency == nil {
+		m.current.latency = NewHistogram()
+	}
+	m.current.latency.Record(r.Duration)
+}
+
+// Tick closes the current second and returns a snapshot for display. It
+// is called once per second by whichever live display is active.
+func (m *Live) Tick() Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	last := m.current
+	if last.latency == nil {
+		last.latency = NewHistogram()
+	}
+	m.current = liveSecond{}
+	m.history = append(m.history, last)
+	if len(m.history) > historySeconds {
+		m.history = m.history[len(m.history)-historySeconds:]
+	}
+
+	snap := Snapshot{
+		Run:      m.run,
+		Paused:   m.paused,
+		Elapsed:  time.Since(m.started),
+		InFlight: m.inFlight,
+		Requests: m.latencyCount,
+		Errors:   m.errorTotal,
+		RPS:      float64(last.requests),
+	}
+	if last.requests > 0 {
+		snap.ErrorRate = float64(last.errors) / float64(last.requests)
+	}
+
+	window := NewHistogram()
+	for i, sec := range m.history {
+		snap.History = append(snap.History, sec.latency.Quantile(0.95).Milliseconds())
+		if i >= len(m.history)-RollingWindow {
+			window.Merge(sec.latency)
+		}
+	}
+	snap.P50 = window.Quantile(0.50).Milliseconds()
+	snap.P95 = window.Quantile(0.95).Milliseconds()
+	snap.P99 = window.Quantile(0.99).Milliseconds()
+	return snap
+}
+
+// WritePrometheus writes the metrics in the Prometheus text format
+func (m *Live) WritePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP loadtester_requests_total Requests completed, by response status (0 means no response).")
+	fmt.Fprintln(w, "# TYPE loadtester_requests_total counter")
+	codes := make([]int, 0, len(m.requests))
+	for code := range m.requests {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "loadtester_requests_total{status=\"%d\"} %d\n", code, m.requests[code])
+	}
+
+	fmt.Fprintln(w, "# HELP loadtester_errors_total Requests that failed after all retries, by error type.")
+	fmt.Fprintln(w, "# TYPE loadtester_errors_total counter")
+	types := make([]string, 0, len(m.errors))
+	for typ := range m.errors {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	for _, typ := range types {
+		fmt.Fprintf(w, "loadtester_errors_total{type=\"%s\"} %d\n", typ, m.errors[typ])
+	}
+
+	fmt.Fprintln(w, "# HELP loadtester_retries_total Retry attempts made.")
+	fmt.Fprintln(w, "# TYPE loadtester_retries_total counter")
+	fmt.Fprintf(w, "loadtester_retries_total %d\n", m.retries)
+
+	fmt.Fprintln(w, "# HELP loadtester_request_duration_seconds Request latency including retries.")
+	fmt.Fprintln(w, "# TYPE loadtester_request_duration_seconds histogram")
+	for i, le := range latencyBuckets {
+		fmt.Fprintf(w, "loadtester_request_duration_seconds_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(le, 'g', -1, 64), m.bucketCounts[i])
+	}
+	fmt.Fprintf(w, "loadtester_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.latencyCount)
+	fmt.Fprintf(w, "loadtester_request_duration_seconds_sum %g\n", m.latencySum)
+	fmt.Fprintf(w, "loadtester_request_duration_seconds_count %d\n", m.latencyCount)
+
+	fmt.Fprintln(w, "# HELP loadtester_in_flight_requests Requests sent but not yet completed.")
+	fmt.Fprintln(w, "# TYPE loadtester_in_flight_requests gauge")
+	fmt.Fprintf(w, "loadtester_in_flight_requests %d\n", m.inFlight)
+
+	fmt.Fprintln(w, "# HELP loadtester_paused Whether sending new requests is paused (1) or not (0).")
+	fmt.Fprintln(w, "# TYPE loadtester_paused gauge")
+	fmt.Fprintf(w, "loadtester_paused %d\n", boolGauge(m.paused))
+
+	fmt.Fprintln(w, "# HELP loadtester_run Number of the test run in progress.")
+	fmt.Fprintln(w, "# TYPE loadtester_run gauge")
+	fmt.Fprintf(w, "loadtester_run %d\n", m.run)
+
+	if len(m.tags) > 0 {
+		keys := make([]string, 0, len(m.tags))
+		for k := range m.tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		labels := make([]string, len(keys))
+		for i, k := range keys {
+			labels[i] = k + "=" + strconv.Quote(m.tags[k])
+		}
+		fmt.Fprintln(w, "# HELP loadtester_info The test's tags as labels; always 1.")
+		fmt.Fprintln(w, "# TYPE loadtester_info gauge")
+		fmt.Fprintf(w, "loadtester_info{%s} 1\n", strings.Join(labels, ","))
+	}
+
+	if m.goroutines == 0 {
+		return // no run has started
+	}
+	fmt.Fprintln(w, "# HELP loadtester_goroutines Goroutines of the load generator.")
+	fmt.Fprintln(w, "# TYPE loadtester_goroutines gauge")
+	fmt.Fprintf(w, "loadtester_goroutines %d\n", m.goroutines)
+	if m.sockets >= 0 {
+		fmt.Fprintln(w, "# HELP loadtester_open_sockets Sockets open in the load generator.")
+		fmt.Fprintln(w, "# TYPE loadtester_open_sockets gauge")
+		fmt.Fprintf(w, "loadtester_open_sockets %d\n", m.sockets)
+	}
+	if m.cpu >= 0 {
+		fmt.Fprintln(w, "# HELP loadtester_cpu_utilization Share of the available CPU the load generator used in the last second.")
+		fmt.Fprintln(w, "# TYPE loadtester_cpu_utilization gauge")
+		fmt.Fprintf(w, "loadtester_cpu_utilization %g\n", m.cpu)
+	}
+	fmt.Fprintln(w, "# HELP loadtester_scheduling_lag_seconds Worst lateness of a 100ms timer in the last second.")
+	fmt.Fprintln(w, "# TYPE loadtester_scheduling_lag_seconds gauge")
+	fmt.Fprintf(w, "loadtester_scheduling_lag_seconds %g\n", m.lag.Seconds())
+}
+
+// Serve exposes /metrics on addr until the returned server is shut down
+func Serve(addr string, m *Live) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WritePrometheus(w)
+	})
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("Metrics endpoint failed: %v\n", err)
+		}
+	}()
+	return srv
+}
+
+func boolGauge(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	m := NewLive()
+	m.StartRun(2)
+	for _, r := range []Result{
+		{Status: 200, Duration: 30 * time.Millisecond},
+		{Status: 200, Duration: 2 * time.Second, Retries: 1},
+		{Status: 503, Duration: 250 * time.Millisecond, Error: "HTTP 503", ErrorType: ErrTypeHTTP5xx},
+	} {
+		m.Launched()
+		m.Observe(r)
+	}
+	m.Launched()
+
+	var b strings.Builder
+	m.WritePrometheus(&b)
+	want := []string{
+		`# HELP loadtester_requests_total Requests completed, by response status (0 means no response).`,
+		`# TYPE loadtester_requests_total counter`,
+		`loadtester_requests_total{status="200"} 2`,
+		`loadtester_requests_total{status="503"} 1`,
+		`# HELP loadtester_errors_total Requests that failed after all retries, by error type.`,
+		`# TYPE loadtester_errors_total counter`,
+		`loadtester_errors_total{type="http_5xx"} 1`,
+		`# HELP loadtester_retries_total Retry attempts made.`,
+		`# TYPE loadtester_retries_total counter`,
+		`loadtester_retries_total 1`,
+		`# HELP loadtester_request_duration_seconds Request latency including retries.`,
+		`# TYPE loadtester_request_duration_seconds histogram`,
+		`loadtester_request_duration_seconds_bucket{le="0.005"} 0`,
+		`loadtester_request_duration_seconds_bucket{le="0.01"} 0`,
+		`loadtester_request_duration_seconds_bucket{le="0.025"} 0`,
+		`loadtester_request_duration_seconds_bucket{le="0.05"} 1`,
+		`loadtester_request_duration_seconds_bucket{le="0.1"} 1`,
+		`loadtester_request_duration_seconds_bucket{le="0.25"} 2`,
+		`loadtester_request_duration_seconds_bucket{le="0.5"} 2`,
+		`loadtester_request_duration_seconds_bucket{le="1"} 2`,
+		`loadtester_request_duration_seconds_bucket{le="2.5"} 3`,
+		`loadtester_request_duration_seconds_bucket{le="5"} 3`,
+		`loadtester_request_duration_seconds_bucket{le="10"} 3`,
+		`loadtester_request_duration_seconds_bucket{le="+Inf"} 3`,
+		`loadtester_request_duration_seconds_sum 2.28`,
+		`loadtester_request_duration_seconds_count 3`,
+		`# HELP loadtester_in_flight_requests Requests sent but not yet completed.`,
+		`# TYPE loadtester_in_flight_requests gauge`,
+		`loadtester_in_flight_requests 1`,
+		`# HELP loadtester_paused Whether sending new requests is paused (1) or not (0).`,
+		`# TYPE loadtester_paused gauge`,
+		`loadtester_paused 0`,
+		`# HELP loadtester_run Number of the test run in progress.`,
+		`# TYPE loadtester_run gauge`,
+		`loadtester_run 2`,
+	}
+	got := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	for i := range max(len(got), len(want)) {
+		var g, w string
+		if i < len(got) {
+			g = got[i]
+		}
+		if i < len(want) {
+			w = want[i]
+		}
+		if g != w {
+			t.Errorf("line %d:\n got %q\nwant %q", i+1, g, w)
+		}
+	}
+}
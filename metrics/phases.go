@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PhaseStats accumulates mean phase durations over a run. Each phase is
+// averaged only over the attempts where it happened.
+type PhaseStats struct {
+	sums   [6]time.Duration
+	counts [6]int
+}
+
+// Add records the phases of one request
+func (p *PhaseStats) Add(ph Phases) {
+	for i, d := range []time.Duration{ph.DNS, ph.Connect, ph.TLS, ph.TTFB, ph.Transfer, ph.QUIC} {
+		if d > 0 {
+			p.sums[i] += d
+			p.counts[i]++
+		}
+	}
+}
+
+// Merge adds the phases recorded in o
+func (p *PhaseStats) Merge(o PhaseStats) {
+	for i := range p.sums {
+		p.sums[i] += o.sums[i]
+		p.counts[i] += o.counts[i]
+	}
+}
+
+// phaseStatsJSON is the wire form of PhaseStats. Agents without the QUIC
+// phase send five of each.
+type phaseStatsJSON struct {
+	Sums   [6]time.Duration `json:"sums"`
+	Counts [6]int           `json:"counts"`
+}
+
+func (p PhaseStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(phaseStatsJSON{p.sums, p.counts})
+}
+
+func (p *PhaseStats) UnmarshalJSON(data []byte) error {
+	var v phaseStatsJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	p.sums, p.counts = v.Sums, v.Counts
+	return nil
+}
+
+// Mean returns the average duration of each phase
+func (p *PhaseStats) Mean() Phases {
+	avg := func(i int) time.Duration {
+		if p.counts[i] == 0 {
+			return 0
+		}
+		return p.sums[i] / time.Duration(p.counts[i])
+	}
+	return Phases{DNS: avg(0), Connect: avg(1), TLS: avg(2), TTFB: avg(3), Transfer: avg(4), QUIC: avg(5)}
+}
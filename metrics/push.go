@@ -0,0 +1,267 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink receives every result of a test as it completes and forwards it
+// to a monitoring system. Close flushes what is pending.
+type Sink interface {
+	Observe(run int, r Result)
+	Close() error
+}
+
+// Sinks fans results out to several sinks
+type Sinks []Sink
+
+func (s Sinks) Observe(run int, r Result) {
+	for _, sink := range s {
+		sink.Observe(run, r)
+	}
+}
+
+func (s Sinks) Close() error {
+	var first error
+	for _, sink := range s {
+		if err := sink.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Aggregate is the summary of the requests completed in one second that
+// is pushed to InfluxDB and Graphite
+type Aggregate struct {
+	Time          time.Time // start of the second
+	Run           int
+	Requests      int
+	Errors        int
+	BytesSent     int64
+	BytesReceived int64
+	Latency       *Histogram
+}
+
+// fields returns the values pushed for a second, latencies in ms
+func (a *Aggregate) fields() [][2]string {
+	ms := func(d time.Duration) string { return fmt.Sprintf("%.3f", float64(d)/float64(time.Millisecond)) }
+	errorRate := 0.0
+	if a.Requests > 0 {
+		errorRate = float64(a.Errors) / float64(a.Requests)
+	}
+	return [][2]string{
+		{"requests", fmt.Sprint(a.Requests)},
+		{"errors", fmt.Sprint(a.Errors)},
+		{"error_rate", fmt.Sprintf("%.4f", errorRate)},
+		{"bytes_sent", fmt.Sprint(a.BytesSent)},
+		{"bytes_received", fmt.Sprint(a.BytesReceived)},
+		{"latency_mean", ms(a.Latency.Mean())},
+		{"latency_p50", ms(a.Latency.Quantile(0.50))},
+		{"latency_p90", ms(a.Latency.Quantile(0.90))},
+		{"latency_p95", ms(a.Latency.Quantile(0.95))},
+		{"latency_p99", ms(a.Latency.Quantile(0.99))},
+		{"latency_max", ms(a.Latency.Max())},
+	}
+}
+
+// secondly aggregates results per wall-clock second and hands each
+// completed second to push from its own goroutine. Seconds without
+// requests are not pushed.
+type secondly struct {
+	name    string
+	push    func(*Aggregate) error
+	closeFn func() // run after the last push, may be nil
+
+	mu      sync.Mutex
+	cur     *Aggregate
+	lastErr string
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newSecondly(name string, push func(*Aggregate) error, closeFn func()) *secondly {
+	s := &secondly{name: name, push: push, closeFn: closeFn, stop: make(chan struct{}), done: make(chan struct{})}
+	go s.loop()
+	return s
+}
+
+func (s *secondly) Observe(run int, r Result) {
+	if r.Warmup {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur == nil {
+		s.cur = &Aggregate{Time: time.Now().Truncate(time.Second), Latency: NewHistogram()}
+	}
+	s.cur.Run = run
+	s.cur.Requests++
+	if r.Error != "" {
+		s.cur.Errors++
+	}
+	s.cur.BytesSent += r.BytesSent
+	s.cur.BytesReceived += r.BytesReceived
+	s.cur.Latency.Record(r.Duration)
+}
+
+func (s *secondly) loop() {
+	defer close(s.done)
+	next := time.Now().Truncate(time.Second).Add(time.Second)
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			s.flush()
+			next = next.Add(time.Second)
+			timer.Reset(time.Until(next))
+		case <-s.stop:
+			s.flush()
+			return
+		}
+	}
+}
+
+// flush pushes the current second. Failures are logged when they change,
+// so an unreachable backend does not flood the log.
+func (s *secondly) flush() {
+	s.mu.Lock()
+	a := s.cur
+	s.cur = nil
+	s.mu.Unlock()
+	if a == nil {
+		return
+	}
+	if err := s.push(a); err != nil {
+		if err.Error() != s.lastErr {
+			slog.Warn("push failed", "sink", s.name, "err", err)
+		}
+		s.lastErr = err.Error()
+		return
+	}
+	s.lastErr = ""
+}
+
+func (s *secondly) Close() error {
+	close(s.stop)
+	<-s.done
+	if s.closeFn != nil {
+		s.closeFn()
+	}
+	return nil
+}
+
+// NewInfluxSink returns a sink that writes per-second aggregates in
+// InfluxDB line protocol to writeURL, the /write endpoint of InfluxDB 1.x
+// or /api/v2/write of 2.x. A token, if set, is sent as an
+// Authorization: Token header. tags are added to every point.
+func NewInfluxSink(writeURL, token string, tags map[string]string) Sink {
+	client := &http.Client{Timeout: 5 * time.Second}
+	tagSet := influxTags(tags)
+	return newSecondly("influx", func(a *Aggregate) error {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "loadtester,run=%d%s ", a.Run, tagSet)
+		for i, f := range a.fields() {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(f[0] + "=" + f[1])
+		}
+		fmt.Fprintf(&b, " %d\n", a.Time.UnixNano())
+		req, err := http.NewRequest(http.MethodPost, writeURL, &b)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		}
+		return nil
+	}, client.CloseIdleConnections)
+}
+
+// influxTags renders tags as ",k=v" pairs sorted by key, escaping what
+// line protocol requires
+func influxTags(tags map[string]string) string {
+	esc := strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		if tags[k] != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString("," + esc.Replace(k) + "=" + esc.Replace(tags[k]))
+	}
+	return b.String()
+}
+
+// NewGraphiteSink returns a sink that sends per-second aggregates to a
+// Graphite (Carbon) plaintext listener at addr, as
+// <prefix>.<field> <value> <unix time>. tags, if any, are appended in the
+// tagged series format of Graphite 1.1, <prefix>.<field>;k=v.
+func NewGraphiteSink(addr, prefix string, tags map[string]string) Sink {
+	tagSet := graphiteTags(tags)
+	var conn net.Conn
+	return newSecondly("graphite", func(a *Aggregate) error {
+		if conn == nil {
+			c, err := net.DialTimeout("tcp", addr, 5*time.Second)
+			if err != nil {
+				return err
+			}
+			conn = c
+		}
+		var b bytes.Buffer
+		for _, f := range a.fields() {
+			fmt.Fprintf(&b, "%s.%s%s %s %d\n", prefix, f[0], tagSet, f[1], a.Time.Unix())
+		}
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write(b.Bytes()); err != nil {
+			// Reconnect on the next second
+			conn.Close()
+			conn = nil
+			return err
+		}
+		return nil
+	}, func() {
+		if conn != nil {
+			conn.Close()
+		}
+	})
+}
+
+// graphiteTags renders tags as ";k=v" pairs sorted by key. Graphite does
+// not allow spaces, semicolons or tildes in them.
+func graphiteTags(tags map[string]string) string {
+	clean := strings.NewReplacer(" ", "_", ";", "_", "~", "_")
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(";" + clean.Replace(k) + "=" + clean.Replace(tags[k]))
+	}
+	return b.String()
+}
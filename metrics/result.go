@@ -0,0 +1,143 @@
+// Package metrics aggregates the results of a load test: per-run
+// statistics, latency histograms, thresholds and the live counters behind
+// the dashboard and the Prometheus endpoint.
+package metrics
+
+import (
+	"net/http"
+	"time"
+)
+
+// Result stores metrics for each request
+type Result struct {
+	RequestID int
+	Timestamp time.Time
+	// Scheduled is when an open-model request was due to be sent; the
+	// time until Timestamp is the generator's own delay. Zero in the
+	// closed model.
+	Scheduled  time.Time
+	Status     int
+	Error      string
+	Endpoint   string // name of the targeted endpoint
+	Proto      string // negotiated protocol, e.g. HTTP/2.0
+	TLSVersion string // e.g. TLS 1.3, empty without TLS
+	TLSCipher  string // negotiated cipher suite name
+	IPFamily   string // IPv4 or IPv6 of the connection used, empty for none
+	// NewConn is set when the last attempt opened a connection rather than
+	// reusing one, and TLSHandshake when it made a TLS handshake
+	NewConn      bool
+	TLSHandshake bool
+	GRPCStatus   string // gRPC mode: status code name, e.g. UNAVAILABLE
+	DNSRcode     string // DNS mode: response code name, e.g. NXDOMAIN
+	ErrorType    string // one of the ErrType categories, empty on success
+	Duration     time.Duration
+	// BytesSent and BytesReceived are the size of the request and response
+	// of every attempt: status line, headers and body as read, or the
+	// payloads in socket and DNS mode
+	BytesSent     int64
+	BytesReceived int64
+	Retries       int
+	// Attempts are all attempts of a retried request in order, the last
+	// one included, and empty for a request made in one attempt. The
+	// outcome of the last one is the request's own.
+	Attempts []Attempt
+	// Duration is the whole request's, from sending its first attempt to
+	// the end of its last, retries and backoffs included. AttemptDuration
+	// is the last attempt's alone, what the server took to answer it.
+	AttemptDuration time.Duration
+	// Throttled is set when an attempt was answered 429 or 503, and
+	// RetryAfter to the wait the last of them asked for, if any
+	Throttled  bool
+	RetryAfter time.Duration
+	// Redirects are the hops the last attempt followed before its final
+	// response, recorded with RecordRedirects
+	Redirects []Redirect
+	// Encoding is the response's Content-Encoding, empty for none. When
+	// the body was decompressed, EncodedBytes and DecodedBytes are its
+	// size before and after.
+	Encoding     string
+	EncodedBytes int64
+	DecodedBytes int64
+	// RetryDenied is set when a failure was not retried because the run's
+	// retry budget was used up
+	RetryDenied bool
+	Phases      Phases // of the last attempt
+	Warmup      bool   // sent during the warm-up and excluded from the stats
+	// Capture is the last attempt's request and response when the request
+	// was picked for the capture or failures file, nil otherwise
+	Capture *Capture
+}
+
+// Capture is a request and its response as sent and received, with the
+// bodies cut short. The response fields are empty when none came back.
+type Capture struct {
+	Method         string
+	URL            string
+	RequestHeader  http.Header
+	RequestBody    []byte
+	Proto          string
+	Status         int
+	ResponseHeader http.Header
+	ResponseBody   []byte
+	BodySize       int64 // of the whole response body as read
+	// RemoteAddr and LocalAddr are the ends of the connection used, empty
+	// when none was
+	RemoteAddr string
+	LocalAddr  string
+}
+
+// Attempt is one attempt of a request that was retried
+type Attempt struct {
+	Number    int // 1 for the first attempt
+	Status    int
+	ErrorType string        // empty when the attempt succeeded
+	Start     time.Duration // from the request's Timestamp
+	Duration  time.Duration // of the attempt itself
+	Backoff   time.Duration // wait before the next attempt, zero for the last
+}
+
+// Redirect is one redirect a request followed
+type Redirect struct {
+	Status   int
+	URL      string        // of the request that was redirected
+	Duration time.Duration // from sending it to the redirect's headers
+}
+
+// Phases breaks a request attempt down into its network and server steps.
+// A phase that did not happen (e.g. DNS on a reused connection) is zero.
+type Phases struct {
+	DNS      time.Duration // name resolution
+	Connect  time.Duration // TCP connect
+	TLS      time.Duration // TLS handshake
+	TTFB     time.Duration // request fully written to first response byte
+	Transfer time.Duration // first response byte to end of body
+	QUIC     time.Duration // HTTP/3: QUIC handshake, connecting and TLS in one
+}
+
+// IP families recorded in Result.IPFamily
+const (
+	IPv4 = "IPv4"
+	IPv6 = "IPv6"
+)
+
+// Error categories recorded in Result.ErrorType
+const (
+	ErrTypeDNS          = "dns"
+	ErrTypeConnRefused  = "connection_refused"
+	ErrTypeConnReset    = "connection_reset"
+	ErrTypeTimeout      = "timeout"
+	ErrTypeTLS          = "tls"
+	ErrTypeHTTP4xx      = "http_4xx"
+	ErrTypeHTTP5xx      = "http_5xx"
+	ErrTypeBodyRead     = "body_read"
+	ErrTypeTruncated    = "body_truncated"
+	ErrTypeRedirects    = "too_many_redirects"
+	ErrTypeCheck        = "check_failed"
+	ErrTypeExtract      = "extract_failed"
+	ErrTypeGRPC         = "grpc_status"
+	ErrTypeGraphQL      = "graphql_errors"
+	ErrTypeDNSRcode     = "dns_rcode"
+	ErrTypeRequestBuild = "request_build"
+	ErrTypeCancelled    = "cancelled"
+	ErrTypeOther        = "other"
+)
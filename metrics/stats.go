@@ -0,0 +1,452 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// timelineLag is how many seconds a timeline bucket stays open for results
+// that are collected slightly out of order before its percentiles are
+// computed and its Histogram released
+const timelineLag = 2
+
+// maxErrorMessages caps the distinct messages kept in RunStats.Errors.
+// Messages can embed addresses or IDs, so their number would otherwise
+// grow with the run; the rest are counted under OtherErrors.
+const maxErrorMessages = 1000
+
+// OtherErrors is the RunStats.Errors key counting the failures whose
+// message did not fit in the first maxErrorMessages
+const OtherErrors = "(other messages)"
+
+// LateSend is how long after its scheduled time a request may be sent
+// before it counts as late: the generator could not keep up
+const LateSend = 10 * time.Millisecond
+
+// RunStats summarises a single test run
+type RunStats struct {
+	Run              int
+	Start            time.Time
+	Duration         time.Duration
+	Sent             int
+	Warmup           int // warm-up requests, left out of every other figure
+	Success          int
+	Failed           int
+	Iterations       int // scenario iterations started, zero without a scenario
+	Retries          int
+	RetryReasons     map[string]int // retried attempts by ErrType category
+	RetriesDenied    int            // failures not retried for lack of retry budget
+	BreakerTrips     int            // times the circuit breaker tripped
+	RateBackoffs     int            // times the adaptive rate backed off
+	SustainableRate  float64        // adaptive rate: mean req/s sent since the first back-off
+	Aborted          string         // why the run was stopped early, if it was
+	FailedIterations int
+	Latency          *Histogram // of whole requests, retries and backoffs included
+	LastAttempt      *Histogram // latency of each request's last attempt alone
+	// Open model only: latency measured from each request's scheduled
+	// send time, correcting for coordinated omission, and how late the
+	// requests were sent
+	Corrected     *Histogram
+	SendDelay     *Histogram
+	LateSends     int // sent more than LateSend after their scheduled time
+	Phases        PhaseStats
+	StatusCodes   map[int]int
+	NoResponse    int            // requests that never received a response
+	Redirects     map[string]int // redirects followed, by status, with RecordRedirects
+	RedirectTime  time.Duration  // spent on them
+	Errors        map[string]int // by message
+	ErrorTypes    map[string]int // by ErrType category
+	Endpoints     map[string]*EndpointStats
+	Protocols     map[string]int // negotiated protocol of each response; TCP or UDP in socket mode
+	TLS           map[string]int // TLS version and cipher suite of each response over TLS
+	IPFamilies    map[string]int // IP family of the connection of each request
+	BytesSent     int64          // total request and response sizes
+	BytesReceived int64
+	Encodings     map[string]int // Content-Encoding of each response that had one
+	EncodedBytes  int64          // size of the decompressed bodies as received
+	DecodedBytes  int64          // and once decompressed
+	NewConns      int            // requests that opened a connection
+	TLSHandshakes int            // requests that made a TLS handshake
+	GRPCStatus    map[string]int // gRPC mode: responses by status name
+	DNSRcodes     map[string]int // DNS mode: responses by rcode name
+	Generator     GeneratorStats // the load generator's own health
+	Timeline      []TimeBucket
+
+	closed int // timeline buckets before this index are finalised
+}
+
+// TimeBucket aggregates the requests that completed in one second of a run
+type TimeBucket struct {
+	Second   int
+	Requests int
+	Errors   int
+	P50      int64
+	P95      int64
+	P99      int64
+	Max      int64
+
+	hist *Histogram
+}
+
+// NewRunStats returns empty stats for a run starting at start
+func NewRunStats(run int, start time.Time) *RunStats {
+	return &RunStats{
+		Run:          run,
+		Start:        start,
+		Latency:      NewHistogram(),
+		LastAttempt:  NewHistogram(),
+		Corrected:    NewHistogram(),
+		SendDelay:    NewHistogram(),
+		StatusCodes:  map[int]int{},
+		Errors:       map[string]int{},
+		ErrorTypes:   map[string]int{},
+		RetryReasons: map[string]int{},
+		Endpoints:    map[string]*EndpointStats{},
+		Protocols:    map[string]int{},
+		TLS:          map[string]int{},
+		IPFamilies:   map[string]int{},
+		Redirects:    map[string]int{},
+		Encodings:    map[string]int{},
+		GRPCStatus:   map[string]int{},
+		DNSRcodes:    map[string]int{},
+	}
+}
+
+// Add records a finished request. Warm-up requests are only counted.
+func (s *RunStats) Add(r Result) {
+	if r.Warmup {
+		s.Warmup++
+		return
+	}
+	if r.Error != "" {
+		s.Failed++
+		s.countError(r.Error, 1)
+		s.ErrorTypes[r.ErrorType]++
+	} else {
+		s.Success++
+	}
+	s.Retries += r.Retries
+	// Every attempt but the last was retried
+	for i := 0; i < len(r.Attempts)-1; i++ {
+		s.RetryReasons[r.Attempts[i].ErrorType]++
+	}
+	if r.RetryDenied {
+		s.RetriesDenied++
+	}
+	if r.Status != 0 {
+		s.StatusCodes[r.Status]++
+		if r.GRPCStatus != "" {
+			s.GRPCStatus[r.GRPCStatus]++
+		}
+	} else if r.Proto == "" {
+		s.NoResponse++
+	}
+	for _, h := range r.Redirects {
+		s.Redirects[strconv.Itoa(h.Status)]++
+		s.RedirectTime += h.Duration
+	}
+	if r.Proto != "" {
+		s.Protocols[r.Proto]++
+	}
+	if r.TLSVersion != "" {
+		s.TLS[r.TLSVersion+" "+r.TLSCipher]++
+	}
+	if r.IPFamily != "" {
+		s.IPFamilies[r.IPFamily]++
+	}
+	s.BytesSent += r.BytesSent
+	s.BytesReceived += r.BytesReceived
+	if r.Encoding != "" {
+		s.Encodings[r.Encoding]++
+	}
+	s.EncodedBytes += r.EncodedBytes
+	s.DecodedBytes += r.DecodedBytes
+	if r.NewConn {
+		s.NewConns++
+	}
+	if r.TLSHandshake {
+		s.TLSHandshakes++
+	}
+	if r.DNSRcode != "" {
+		s.DNSRcodes[r.DNSRcode]++
+	}
+	s.Latency.Record(r.Duration)
+	s.LastAttempt.Record(r.AttemptDuration)
+	if !r.Scheduled.IsZero() {
+		delay := max(0, r.Timestamp.Sub(r.Scheduled))
+		s.Corrected.Record(delay + r.Duration)
+		s.SendDelay.Record(delay)
+		if delay > LateSend {
+			s.LateSends++
+		}
+	}
+	s.Phases.Add(r.Phases)
+	s.endpoint(r.Endpoint).add(r)
+
+	sec := max(0, int(r.Timestamp.Add(r.Duration).Sub(s.Start)/time.Second))
+	for len(s.Timeline) <= sec {
+		s.Timeline = append(s.Timeline, TimeBucket{Second: len(s.Timeline), hist: NewHistogram()})
+		s.closeBuckets(len(s.Timeline) - 1 - timelineLag)
+	}
+	b := &s.Timeline[sec]
+	b.Requests++
+	if r.Error != "" {
+		b.Errors++
+	}
+	if b.hist != nil {
+		b.hist.Record(r.Duration)
+	} else {
+		b.Max = max(b.Max, r.Duration.Milliseconds())
+	}
+}
+
+// countError adds n failures with message msg
+func (s *RunStats) countError(msg string, n int) {
+	if _, ok := s.Errors[msg]; !ok && len(s.Errors) >= maxErrorMessages {
+		msg = OtherErrors
+	}
+	s.Errors[msg] += n
+}
+
+// endpoint returns the stats for the named endpoint, creating them on
+// first use
+func (s *RunStats) endpoint(name string) *EndpointStats {
+	e, ok := s.Endpoints[name]
+	if !ok {
+		e = &EndpointStats{Latency: NewHistogram()}
+		s.Endpoints[name] = e
+	}
+	return e
+}
+
+// closeBuckets computes percentiles for timeline buckets up to and
+// including second last and releases their histograms
+func (s *RunStats) closeBuckets(last int) {
+	for ; s.closed <= last && s.closed < len(s.Timeline); s.closed++ {
+		b := &s.Timeline[s.closed]
+		b.P50 = b.hist.Quantile(0.50).Milliseconds()
+		b.P95 = b.hist.Quantile(0.95).Milliseconds()
+		b.P99 = b.hist.Quantile(0.99).Milliseconds()
+		b.Max = b.hist.Max().Milliseconds()
+		b.hist = nil
+	}
+}
+
+// Finish sets the run duration and closes the remaining timeline buckets
+func (s *RunStats) Finish(duration time.Duration) {
+	s.Sent = s.Success + s.Failed
+	s.Duration = duration
+	s.closeBuckets(len(s.Timeline) - 1)
+}
+
+// Throughput returns the achieved requests per second
+func (s *RunStats) Throughput() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Sent) / s.Duration.Seconds()
+}
+
+// ErrorRate returns the share of requests that failed
+func (s *RunStats) ErrorRate() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Failed) / float64(s.Sent)
+}
+
+// Bandwidth returns the bytes per second sent and received
+func (s *RunStats) Bandwidth() (sent, received float64) {
+	if s.Duration <= 0 {
+		return 0, 0
+	}
+	return float64(s.BytesSent) / s.Duration.Seconds(), float64(s.BytesReceived) / s.Duration.Seconds()
+}
+
+// RedirectCount returns the number of redirects followed
+func (s *RunStats) RedirectCount() int {
+	n := 0
+	for _, c := range s.Redirects {
+		n += c
+	}
+	return n
+}
+
+// CompressionRatio returns how many times larger the decompressed bodies
+// are than as received, zero when none was decompressed
+func (s *RunStats) CompressionRatio() float64 {
+	if s.EncodedBytes <= 0 {
+		return 0
+	}
+	return float64(s.DecodedBytes) / float64(s.EncodedBytes)
+}
+
+// Percentile returns the p-th latency percentile (0 <= p <= 1) in ms
+func (s *RunStats) Percentile(p float64) int64 {
+	return s.Latency.Quantile(p).Milliseconds()
+}
+
+// FellBehind reports whether the generator sent more than 1% of the
+// scheduled requests late, in which case it, not the target, limited the
+// achieved rate
+func (s *RunStats) FellBehind() bool {
+	n := s.SendDelay.Count()
+	return n > 0 && uint64(s.LateSends)*100 > n
+}
+
+// Merge combines several runs into one aggregate summary
+func Merge(runs []*RunStats) *RunStats {
+	total := NewRunStats(0, time.Time{})
+	for _, s := range runs {
+		total.mergeCounts(s)
+		total.Duration += s.Duration
+		// Runs are sequential, so their timelines are laid end to end
+		offset := len(total.Timeline)
+		for _, b := range s.Timeline {
+			b.Second += offset
+			total.Timeline = append(total.Timeline, b)
+		}
+	}
+	return total
+}
+
+// Combine merges the results of parts of one run that ran side by side,
+// such as the agents of a distributed run. Their timelines overlap second
+// by second.
+func Combine(run int, parts []*RunStats) *RunStats {
+	total := NewRunStats(run, time.Time{})
+	for _, s := range parts {
+		total.mergeCounts(s)
+		total.Duration = max(total.Duration, s.Duration)
+		for _, b := range s.Timeline {
+			for len(total.Timeline) <= b.Second {
+				total.Timeline = append(total.Timeline, TimeBucket{Second: len(total.Timeline)})
+			}
+			t := &total.Timeline[b.Second]
+			// The parts' histograms are gone by now, so per-second
+			// percentiles are approximated by weighting with request counts
+			if n := int64(t.Requests + b.Requests); n > 0 {
+				t.P50 = (t.P50*int64(t.Requests) + b.P50*int64(b.Requests)) / n
+				t.P95 = (t.P95*int64(t.Requests) + b.P95*int64(b.Requests)) / n
+				t.P99 = (t.P99*int64(t.Requests) + b.P99*int64(b.Requests)) / n
+			}
+			t.Requests += b.Requests
+			t.Errors += b.Errors
+			t.Max = max(t.Max, b.Max)
+		}
+	}
+	total.closed = len(total.Timeline)
+	return total
+}
+
+// mergeCounts adds the counters and histograms of o to s
+func (s *RunStats) mergeCounts(o *RunStats) {
+	if s.Start.IsZero() || o.Start.Before(s.Start) {
+		s.Start = o.Start
+	}
+	s.Sent += o.Sent
+	s.Warmup += o.Warmup
+	s.Success += o.Success
+	s.Failed += o.Failed
+	s.Iterations += o.Iterations
+	s.FailedIterations += o.FailedIterations
+	s.Retries += o.Retries
+	for typ, n := range o.RetryReasons {
+		s.RetryReasons[typ] += n
+	}
+	s.RetriesDenied += o.RetriesDenied
+	s.BreakerTrips += o.BreakerTrips
+	s.RateBackoffs += o.RateBackoffs
+	if o.SustainableRate > 0 && (s.SustainableRate == 0 || o.SustainableRate < s.SustainableRate) {
+		// The lowest of the runs, the rate each of them could sustain
+		s.SustainableRate = o.SustainableRate
+	}
+	if s.Aborted == "" {
+		s.Aborted = o.Aborted
+	}
+	s.Latency.Merge(o.Latency)
+	s.LastAttempt.Merge(o.LastAttempt)
+	s.Corrected.Merge(o.Corrected)
+	s.SendDelay.Merge(o.SendDelay)
+	s.LateSends += o.LateSends
+	s.Phases.Merge(o.Phases)
+	for code, n := range o.StatusCodes {
+		s.StatusCodes[code] += n
+	}
+	s.NoResponse += o.NoResponse
+	for code, n := range o.Redirects {
+		s.Redirects[code] += n
+	}
+	s.RedirectTime += o.RedirectTime
+	for msg, n := range o.Errors {
+		s.countError(msg, n)
+	}
+	for typ, n := range o.ErrorTypes {
+		s.ErrorTypes[typ] += n
+	}
+	for proto, n := range o.Protocols {
+		s.Protocols[proto] += n
+	}
+	for suite, n := range o.TLS {
+		s.TLS[suite] += n
+	}
+	for family, n := range o.IPFamilies {
+		s.IPFamilies[family] += n
+	}
+	s.BytesSent += o.BytesSent
+	s.BytesReceived += o.BytesReceived
+	for enc, n := range o.Encodings {
+		s.Encodings[enc] += n
+	}
+	s.EncodedBytes += o.EncodedBytes
+	s.DecodedBytes += o.DecodedBytes
+	s.Generator.merge(o.Generator)
+	s.NewConns += o.NewConns
+	s.TLSHandshakes += o.TLSHandshakes
+	for code, n := range o.GRPCStatus {
+		s.GRPCStatus[code] += n
+	}
+	for code, n := range o.DNSRcodes {
+		s.DNSRcodes[code] += n
+	}
+	for name, e := range o.Endpoints {
+		s.endpoint(name).merge(e)
+	}
+}
+
+// EndpointStats summarises the requests sent to one endpoint
+type EndpointStats struct {
+	Requests int
+	Failed   int
+	Latency  *Histogram
+}
+
+func (e *EndpointStats) add(r Result) {
+	e.Requests++
+	if r.Error != "" {
+		e.Failed++
+	}
+	e.Latency.Record(r.Duration)
+}
+
+func (e *EndpointStats) merge(o *EndpointStats) {
+	e.Requests += o.Requests
+	e.Failed += o.Failed
+	e.Latency.Merge(o.Latency)
+}
+
+// ErrorRate returns the share of the endpoint's requests that failed
+func (e *EndpointStats) ErrorRate() float64 {
+	if e.Requests == 0 {
+		return 0
+	}
+	return float64(e.Failed) / float64(e.Requests)
+}
+
+// Throughput returns the requests per second sent to the endpoint over d
+func (e *EndpointStats) Throughput(d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(e.Requests) / d.Seconds()
+}
@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsdPacket is the largest datagram sent to StatsD, small enough not to
+// be fragmented on a standard Ethernet MTU
+const statsdPacket = 1432
+
+// statsd sends every result to a StatsD server over UDP. Lines are
+// batched into datagrams, sent when full and at least every 100ms.
+type statsd struct {
+	addr   string
+	prefix string
+	dog    bool
+	tags   string // fixed DogStatsD tags, "k:v,..."
+
+	mu      sync.Mutex
+	conn    net.Conn
+	buf     []byte
+	lastErr string
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewStatsDSink returns a sink that sends each request to the StatsD
+// server at addr as the counters <prefix>.requests, .errors, .bytes_sent
+// and .bytes_received and the timer <prefix>.latency. With dogstatsd
+// set, tags are added to every metric, along with a status_class tag of
+// 2xx to 5xx, or error for requests that got no response.
+func NewStatsDSink(addr, prefix string, dogstatsd bool, tags map[string]string) Sink {
+	s := &statsd{addr: addr, prefix: prefix, dog: dogstatsd, tags: dogTags(tags), stop: make(chan struct{}), done: make(chan struct{})}
+	go s.loop()
+	return s
+}
+
+// dogTags renders tags as k:v pairs sorted by key. DogStatsD does not
+// allow the separators in tag values, so they are replaced.
+func dogTags(tags map[string]string) string {
+	clean := strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		if tags[k] != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = clean.Replace(k) + ":" + clean.Replace(tags[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// statusClass groups a status code for tagging
+func statusClass(status int) string {
+	if status < 100 {
+		return "error"
+	}
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+func (s *statsd) Observe(run int, r Result) {
+	if r.Warmup {
+		return
+	}
+	tags := ""
+	if s.dog {
+		tags = fmt.Sprintf("|#run:%d,status_class:%s", run, statusClass(r.Status))
+		if s.tags != "" {
+			tags += "," + s.tags
+		}
+	}
+	lines := []string{
+		fmt.Sprintf("%s.requests:1|c%s", s.prefix, tags),
+		fmt.Sprintf("%s.latency:%.3f|ms%s", s.prefix, float64(r.Duration)/float64(time.Millisecond), tags),
+		fmt.Sprintf("%s.bytes_sent:%d|c%s", s.prefix, r.BytesSent, tags),
+		fmt.Sprintf("%s.bytes_received:%d|c%s", s.prefix, r.BytesReceived, tags),
+	}
+	if r.Error != "" {
+		lines = append(lines, fmt.Sprintf("%s.errors:1|c%s", s.prefix, tags))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, line := range lines {
+		if len(s.buf) > 0 && len(s.buf)+1+len(line) > statsdPacket {
+			s.send()
+		}
+		if len(s.buf) > 0 {
+			s.buf = append(s.buf, '\n')
+		}
+		s.buf = append(s.buf, line...)
+	}
+}
+
+func (s *statsd) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			s.send()
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// send writes the pending datagram; s.mu must be held. Failures are
+// logged when they change, like those of the other sinks, and the
+// datagram is dropped.
+func (s *statsd) send() {
+	if len(s.buf) == 0 {
+		return
+	}
+	err := func() error {
+		if s.conn == nil {
+			c, err := net.Dial("udp", s.addr)
+			if err != nil {
+				return err
+			}
+			s.conn = c
+		}
+		_, err := s.conn.Write(s.buf)
+		return err
+	}()
+	s.buf = s.buf[:0]
+	if err != nil {
+		if err.Error() != s.lastErr {
+			slog.Warn("statsd: send failed", "err", err)
+		}
+		s.lastErr = err.Error()
+		return
+	}
+	s.lastErr = ""
+}
+
+func (s *statsd) Close() error {
+	close(s.stop)
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.send()
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Threshold is a pass/fail condition evaluated against the aggregate
+// results of all runs, e.g. "p95 < 300ms", "error_rate < 1%", "rps > 500"
+type Threshold struct {
+	Raw    string
+	Metric string
+	Op     string
+	Value  float64 // milliseconds for latencies, a fraction for error_rate
+}
+
+// thresholdMetrics lists the supported metrics and whether they are latencies
+var thresholdMetrics = map[string]bool{
+	"p50": true, "p90": true, "p95": true, "p99": true, "p99.9": true,
+	"min": true, "max": true, "mean": true,
+	"corrected_p50": true, "corrected_p95": true, "corrected_p99": true, "corrected_max": true,
+	"attempt_p50": true, "attempt_p95": true, "attempt_p99": true, "attempt_max": true,
+	"error_rate": false, "rps": false, "requests": false, "failed": false,
+	"received_mb_per_sec": false, "sent_mb_per_sec": false,
+}
+
+// ParseThreshold parses "<metric> <op> <value>"
+func ParseThreshold(s string) (Threshold, error) {
+	t := Threshold{Raw: strings.TrimSpace(s)}
+	var value string
+	for _, op := range []string{"<=", ">=", "==", "!=", "<", ">"} {
+		if i := strings.Index(t.Raw, op); i > 0 {
+			t.Metric = strings.ToLower(strings.TrimSpace(t.Raw[:i]))
+			t.Op = op
+			value = strings.TrimSpace(t.Raw[i+len(op):])
+			break
+		}
+	}
+	if t.Op == "" {
+		return t, fmt.Errorf("threshold %q: expected <metric> <op> <value>", s)
+	}
+	isLatency, ok := thresholdMetrics[t.Metric]
+	if !ok {
+		return t, fmt.Errorf("threshold %q: unknown metric %q", s, t.Metric)
+	}
+
+	var err error
+	switch {
+	case isLatency:
+		// Bare numbers are milliseconds
+		if n, perr := strconv.ParseFloat(value, 64); perr == nil {
+			t.Value = n
+		} else if d, perr := time.ParseDuration(value); perr == nil {
+			t.Value = float64(d) / float64(time.Millisecond)
+		} else {
+			err = perr
+		}
+	case t.Metric == "error_rate" && strings.HasSuffix(value, "%"):
+		t.Value, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		t.Value /= 100
+	default:
+		t.Value, err = strconv.ParseFloat(value, 64)
+	}
+	if err != nil {
+		return t, fmt.Errorf("threshold %q: invalid value %q", s, value)
+	}
+	return t, nil
+}
+
+// ParseThresholds parses a list of thresholds
+func ParseThresholds(list []string) ([]Threshold, error) {
+	var thresholds []Threshold
+	for _, s := range list {
+		t, err := ParseThreshold(s)
+		if err != nil {
+			return nil, err
+		}
+		thresholds = append(thresholds, t)
+	}
+	return thresholds, nil
+}
+
+// actual returns the measured value of the threshold's metric
+func (t Threshold) actual(s *RunStats) float64 {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	switch t.Metric {
+	case "p50":
+		return ms(s.Latency.Quantile(0.50))
+	case "p90":
+		return ms(s.Latency.Quantile(0.90))
+	case "p95":
+		return ms(s.Latency.Quantile(0.95))
+	case "p99":
+		return ms(s.Latency.Quantile(0.99))
+	case "p99.9":
+		return ms(s.Latency.Quantile(0.999))
+	case "min":
+		return ms(s.Latency.Min())
+	case "max":
+		return ms(s.Latency.Max())
+	case "mean":
+		return ms(s.Latency.Mean())
+	case "corrected_p50":
+		return ms(s.corrected().Quantile(0.50))
+	case "corrected_p95":
+		return ms(s.corrected().Quantile(0.95))
+	case "corrected_p99":
+		return ms(s.corrected().Quantile(0.99))
+	case "corrected_max":
+		return ms(s.corrected().Max())
+	case "attempt_p50":
+		return ms(s.LastAttempt.Quantile(0.50))
+	case "attempt_p95":
+		return ms(s.LastAttempt.Quantile(0.95))
+	case "attempt_p99":
+		return ms(s.LastAttempt.Quantile(0.99))
+	case "attempt_max":
+		return ms(s.LastAttempt.Max())
+	case "error_rate":
+		if s.Sent == 0 {
+			return 0
+		}
+		return float64(s.Failed) / float64(s.Sent)
+	case "rps":
+		return s.Throughput()
+	case "received_mb_per_sec", "sent_mb_per_sec":
+		sent, received := s.Bandwidth()
+		if t.Metric == "sent_mb_per_sec" {
+			return sent / 1e6
+		}
+		return received / 1e6
+	case "requests":
+		return float64(s.Sent)
+	case "failed":
+		return float64(s.Failed)
+	}
+	return 0
+}
+
+// corrected returns the latencies corrected for coordinated omission,
+// which in the closed model are the measured ones
+func (s *RunStats) corrected() *Histogram {
+	if s.Corrected.Count() == 0 {
+		return s.Latency
+	}
+	return s.Corrected
+}
+
+// Check reports whether the threshold holds for s
+func (t Threshold) Check(s *RunStats) (float64, bool) {
+	v := t.actual(s)
+	switch t.Op {
+	case "<":
+		return v, v < t.Value
+	case "<=":
+		return v, v <= t.Value
+	case ">":
+		return v, v > t.Value
+	case ">=":
+		return v, v >= t.Value
+	case "==":
+		return v, v == t.Value
+	case "!=":
+		return v, v != t.Value
+	}
+	return v, false
+}
+
+// FormatActual renders a measured value in the metric's natural unit
+func (t Threshold) FormatActual(v float64) string {
+	switch {
+	case thresholdMetrics[t.Metric]:
+		return strconv.FormatFloat(v, 'f', 2, 64) + "ms"
+	case t.Metric == "error_rate":
+		return strconv.FormatFloat(v*100, 'f', 2, 64) + "%"
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// ThresholdResult is the outcome of one threshold
+type ThresholdResult struct {
+	Threshold string // as written
+	Actual    string // measured value in the metric's unit
+	Passed    bool
+}
+
+// EvaluateThresholds checks every threshold against s and reports whether
+// all of them passed
+func EvaluateThresholds(thresholds []Threshold, s *RunStats) ([]ThresholdResult, bool) {
+	passed := true
+	var results []ThresholdResult
+	for _, t := range thresholds {
+		v, ok := t.Check(s)
+		results = append(results, ThresholdResult{Threshold: t.Raw, Actual: t.FormatActual(v), Passed: ok})
+		passed = passed && ok
+	}
+	return results, passed
+}
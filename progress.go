@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"LoadTester/metrics"
+)
+
+// startProgress prints one line of live stats per second until the
+// returned function is called
+func startProgress(live *metrics.Live) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				printProgress(live.Tick())
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+func printProgress(s metrics.Snapshot) {
+	state := ""
+	if s.Paused {
+		state = " PAUSED |"
+	}
+	fmt.Printf("[%5.0fs]%s run %d | %7.1f req/s | errors %5.1f%% | in-flight %d | p50=%dms p95=%dms p99=%dms\n",
+		s.Elapsed.Seconds(), state, s.Run, s.RPS, s.ErrorRate*100, s.InFlight, s.P50, s.P95, s.P99)
+}
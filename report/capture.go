@@ -0,0 +1,191 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"LoadTester/metrics"
+)
+
+// captureRecord is a line of the capture file: a result with the request
+// and response of its last attempt. Secrets are masked as in the plan.
+// Lines of the failures file add the attempts, phases and connection.
+type captureRecord struct {
+	Run        int               `json:"run"`
+	RequestID  int               `json:"request_id"`
+	Timestamp  time.Time         `json:"timestamp"`
+	Endpoint   string            `json:"endpoint"`
+	Status     int               `json:"status"`
+	ErrorType  string            `json:"error_type,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	DurationMs float64           `json:"duration_ms"`
+	Retries    int               `json:"retries"`
+	Attempts   []failedAttempt   `json:"attempts,omitempty"`
+	Redirects  []jsonRedirect    `json:"redirects,omitempty"`
+	Phases     *failedPhases     `json:"phases,omitempty"`
+	Connection *failedConn       `json:"connection,omitempty"`
+	Request    capturedRequest   `json:"request"`
+	Response   *capturedResponse `json:"response,omitempty"`
+}
+
+type capturedRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body,omitempty"`
+}
+
+type capturedResponse struct {
+	Protocol  string            `json:"protocol"`
+	Status    int               `json:"status"`
+	Headers   map[string]string `json:"headers"`
+	Body      string            `json:"body,omitempty"`
+	BodySize  int64             `json:"body_size"`
+	Truncated bool              `json:"truncated,omitempty"` // Body is the start of it
+}
+
+// failedAttempt is one attempt of a failed request that was retried
+type failedAttempt struct {
+	Attempt    int     `json:"attempt"`
+	Status     int     `json:"status"`
+	ErrorType  string  `json:"error_type"`
+	DurationMs float64 `json:"duration_ms"`
+	BackoffMs  float64 `json:"backoff_ms"`
+}
+
+// failedPhases are the phases of the last attempt
+type failedPhases struct {
+	DNSMs      float64 `json:"dns_ms"`
+	ConnectMs  float64 `json:"connect_ms"`
+	TLSMs      float64 `json:"tls_ms"`
+	TTFBMs     float64 `json:"ttfb_ms"`
+	TransferMs float64 `json:"transfer_ms"`
+	QUICMs     float64 `json:"quic_ms,omitempty"`
+}
+
+// failedConn is the connection of the last attempt
+type failedConn struct {
+	Remote     string `json:"remote,omitempty"`
+	Local      string `json:"local,omitempty"`
+	IPFamily   string `json:"ip_family,omitempty"`
+	New        bool   `json:"new"` // opened for the attempt rather than reused
+	TLSVersion string `json:"tls_version,omitempty"`
+	TLSCipher  string `json:"tls_cipher,omitempty"`
+}
+
+// NewCaptureWriter returns a RecordWriter writing the captured exchange of
+// every result that has one to w as JSON Lines, skipping the others. The
+// auth header is masked with the credentials.
+func NewCaptureWriter(w io.Writer, auth string) RecordWriter {
+	return newCaptureRecords(w, auth, false)
+}
+
+// NewFailureWriter returns a RecordWriter writing every failed result that
+// has a captured exchange to w as JSON Lines, with its attempts, phases
+// and connection
+func NewFailureWriter(w io.Writer, auth string) RecordWriter {
+	return newCaptureRecords(w, auth, true)
+}
+
+func newCaptureRecords(w io.Writer, auth string, failures bool) captureRecords {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	return captureRecords{bw, enc, auth, failures}
+}
+
+type captureRecords struct {
+	w        *bufio.Writer
+	enc      *json.Encoder
+	auth     string // name of the AUTH_HEADER header
+	failures bool   // only failed results, in detail
+}
+
+func (c captureRecords) Write(run int, r metrics.Result) error {
+	if r.Capture == nil || c.failures && r.Error == "" {
+		return nil
+	}
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	x := r.Capture
+	rec := captureRecord{
+		Run:        run,
+		RequestID:  r.RequestID,
+		Timestamp:  r.Timestamp,
+		Endpoint:   r.Endpoint,
+		Status:     r.Status,
+		ErrorType:  r.ErrorType,
+		Error:      r.Error,
+		DurationMs: ms(r.Duration),
+		Retries:    r.Retries,
+		Request: capturedRequest{
+			Method:  x.Method,
+			URL:     maskURL(x.URL),
+			Headers: maskHeaders(x.RequestHeader, c.auth),
+			Body:    string(x.RequestBody),
+		},
+	}
+	for _, h := range r.Redirects {
+		rec.Redirects = append(rec.Redirects, jsonRedirect{h.Status, maskURL(h.URL), ms(h.Duration)})
+	}
+	if x.Status != 0 {
+		rec.Response = &capturedResponse{
+			Protocol:  x.Proto,
+			Status:    x.Status,
+			Headers:   maskHeaders(x.ResponseHeader, c.auth),
+			Body:      string(x.ResponseBody),
+			BodySize:  x.BodySize,
+			Truncated: int64(len(x.ResponseBody)) < x.BodySize,
+		}
+	}
+	if c.failures {
+		for _, a := range r.Attempts {
+			rec.Attempts = append(rec.Attempts, failedAttempt{
+				Attempt:    a.Number,
+				Status:     a.Status,
+				ErrorType:  a.ErrorType,
+				DurationMs: ms(a.Duration),
+				BackoffMs:  ms(a.Backoff),
+			})
+		}
+		rec.Phases = &failedPhases{
+			DNSMs:      ms(r.Phases.DNS),
+			ConnectMs:  ms(r.Phases.Connect),
+			TLSMs:      ms(r.Phases.TLS),
+			TTFBMs:     ms(r.Phases.TTFB),
+			TransferMs: ms(r.Phases.Transfer),
+			QUICMs:     ms(r.Phases.QUIC),
+		}
+		if x.RemoteAddr != "" {
+			rec.Connection = &failedConn{
+				Remote:     x.RemoteAddr,
+				Local:      x.LocalAddr,
+				IPFamily:   r.IPFamily,
+				New:        r.NewConn,
+				TLSVersion: r.TLSVersion,
+				TLSCipher:  r.TLSCipher,
+			}
+		}
+	}
+	return c.enc.Encode(rec)
+}
+
+func (c captureRecords) Flush() error {
+	return c.w.Flush()
+}
+
+func (c captureRecords) Close() error {
+	return c.Flush()
+}
+
+// maskHeaders flattens h to one value per name, masking credentials
+func maskHeaders(h http.Header, auth string) map[string]string {
+	m := make(map[string]string, len(h))
+	for name, values := range h {
+		m[name] = maskHeader(name, strings.Join(values, ", "), auth)
+	}
+	return m
+}
@@ -0,0 +1,80 @@
+package report
+
+import (
+	"fmt"
+	"io"
+
+	"LoadTester/metrics"
+)
+
+// PrintComparison prints the deltas of a test against its baseline, one
+// metric per line, marking regressions
+func PrintComparison(w io.Writer, deltas []metrics.Delta) {
+	fmt.Fprintf(w, "%-12s %12s %12s %10s %10s  %s\n", "Metric", "Baseline", "Current", "Change", "Tolerance", "Result")
+	for _, d := range deltas {
+		result := "ok"
+		switch {
+		case d.Unknown:
+			result = "unknown"
+		case d.Regressed:
+			result = "REGRESSION"
+		}
+		var base, cur, change, tol string
+		switch d.Metric {
+		case "error_rate":
+			base, cur = formatPercent(d.Baseline), formatPercent(d.Current)
+			change = fmt.Sprintf("%+.2fpp", d.Change*100)
+			tol = fmt.Sprintf("+%.2fpp", d.Tolerance*100)
+		case "rps":
+			base, cur = fmt.Sprintf("%.1f/s", d.Baseline), fmt.Sprintf("%.1f/s", d.Current)
+			change = formatChange(d)
+			tol = fmt.Sprintf("-%.0f%%", d.Tolerance*100)
+		default:
+			base, cur = fmt.Sprintf("%.1f ms", d.Baseline), fmt.Sprintf("%.1f ms", d.Current)
+			change = formatChange(d)
+			tol = fmt.Sprintf("+%.0f%%", d.Tolerance*100)
+		}
+		fmt.Fprintf(w, "%-12s %12s %12s %10s %10s  %s\n", d.Metric, base, cur, change, tol, result)
+	}
+}
+
+// PrintRunComparison prints the p95, error rate and throughput of each run
+// found in both reports, for tests of more than one run
+func PrintRunComparison(w io.Writer, base, cur []*metrics.RunStats) {
+	if len(base) < 2 && len(cur) < 2 {
+		return
+	}
+	current := map[int]*metrics.RunStats{}
+	for _, s := range cur {
+		current[s.Run] = s
+	}
+	fmt.Fprintln(w, "Per run (baseline -> current):")
+	for _, b := range base {
+		c, ok := current[b.Run]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "  Run %d: p95 %d -> %d ms, error rate %s -> %s, rps %.1f -> %.1f\n", b.Run,
+			b.Percentile(0.95), c.Percentile(0.95), formatPercent(b.ErrorRate()), formatPercent(c.ErrorRate()),
+			b.Throughput(), c.Throughput())
+	}
+	if len(base) != len(cur) {
+		fmt.Fprintf(w, "  The baseline has %d runs and the current test %d\n", len(base), len(cur))
+	}
+}
+
+// formatChange renders a relative change, or "new" when the baseline was
+// zero
+func formatChange(d metrics.Delta) string {
+	if d.Unknown {
+		return "-"
+	}
+	if d.Baseline == 0 && d.Current != 0 {
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", d.Change*100)
+}
+
+func formatPercent(f float64) string {
+	return fmt.Sprintf("%.2f%%", f*100)
+}
@@ -0,0 +1,88 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"LoadTester/metrics"
+)
+
+// CSVHeader names the columns of the per-request CSV report. Columns are
+// only ever added at the end, so older reports keep their positions.
+var CSVHeader = []string{"RunID", "RequestID", "Status", "Error", "Duration(ms)", "Retries",
+	"DNS(ms)", "Connect(ms)", "TLS(ms)", "TTFB(ms)", "Transfer(ms)", "ErrorType", "Endpoint", "Protocol",
+	"Warmup", "Attempts", "TLSVersion", "TLSCipher", "IPFamily", "NewConn", "TLSHandshake", "SendDelay(ms)",
+	"BytesSent", "BytesReceived", "Timestamp", "Tags", "Redirects", "AttemptDuration(ms)", "QUIC(ms)"}
+
+// CSVRecord returns the CSV row for one request of a run. tags are the
+// test's tags as rendered by FormatTags.
+func CSVRecord(run int, r metrics.Result, tags string) []string {
+	return appendCSVRecord(nil, run, r, tags)
+}
+
+// appendCSVRecord appends the fields of CSVRecord to dst
+func appendCSVRecord(dst []string, run int, r metrics.Result, tags string) []string {
+	return append(dst,
+		strconv.Itoa(run),
+		strconv.Itoa(r.RequestID),
+		strconv.Itoa(r.Status),
+		r.Error,
+		strconv.Itoa(int(r.Duration.Milliseconds())),
+		strconv.Itoa(r.Retries),
+		fmtMillis(r.Phases.DNS),
+		fmtMillis(r.Phases.Connect),
+		fmtMillis(r.Phases.TLS),
+		fmtMillis(r.Phases.TTFB),
+		fmtMillis(r.Phases.Transfer),
+		r.ErrorType,
+		r.Endpoint,
+		r.Proto,
+		strconv.FormatBool(r.Warmup),
+		formatAttempts(r.Attempts),
+		r.TLSVersion,
+		r.TLSCipher,
+		r.IPFamily,
+		strconv.FormatBool(r.NewConn),
+		strconv.FormatBool(r.TLSHandshake),
+		formatSendDelay(r),
+		strconv.FormatInt(r.BytesSent, 10),
+		strconv.FormatInt(r.BytesReceived, 10),
+		r.Timestamp.Format(time.RFC3339Nano),
+		tags,
+		formatRedirects(r.Redirects),
+		strconv.Itoa(int(r.AttemptDuration.Milliseconds())),
+		fmtMillis(r.Phases.QUIC),
+	)
+}
+
+// formatSendDelay renders how late an open-model request was sent, empty
+// for requests that were not scheduled
+func formatSendDelay(r metrics.Result) string {
+	if r.Scheduled.IsZero() {
+		return ""
+	}
+	return fmtMillis(max(0, r.Timestamp.Sub(r.Scheduled)))
+}
+
+// formatAttempts renders the attempts of a retried request as
+// attempt/status/error type/duration ms/backoff ms, separated by
+// semicolons. The error type of an attempt that succeeded is empty.
+func formatAttempts(attempts []metrics.Attempt) string {
+	parts := make([]string, len(attempts))
+	for i, a := range attempts {
+		parts[i] = fmt.Sprintf("%d/%d/%s/%s/%s", a.Number, a.Status, a.ErrorType, fmtMillis(a.Duration), fmtMillis(a.Backoff))
+	}
+	return strings.Join(parts, ";")
+}
+
+// formatRedirects renders the redirects a request followed as
+// status/duration ms/URL, separated by semicolons
+func formatRedirects(hops []metrics.Redirect) string {
+	parts := make([]string, len(hops))
+	for i, h := range hops {
+		parts[i] = fmt.Sprintf("%d/%s/%s", h.Status, fmtMillis(h.Duration), maskURL(h.URL))
+	}
+	return strings.Join(parts, ";")
+}
@@ -0,0 +1,220 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"LoadTester/metrics"
+)
+
+// Bulk requests are sent when they hold elasticBatch documents or
+// elasticBatchBytes, and at least once per second
+const (
+	elasticBatch      = 1000
+	elasticBatchBytes = 5 << 20
+)
+
+// elasticDoc is the document indexed for a result: the JSONL record with
+// the time Kibana filters on and the machine that sent the request
+type elasticDoc struct {
+	Time time.Time `json:"@timestamp"`
+	jsonRecord
+	Host   string `json:"host,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// elastic bulk-indexes results. Batches are handed to a sender goroutine
+// so a slow cluster does not hold up the test; when it falls behind by
+// more than a few batches, results are dropped and counted.
+type elastic struct {
+	bulkURL string
+	apiKey  string
+	index   string
+	host    string
+	target  string
+	tags    map[string]string
+	client  *http.Client
+
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	docs    int
+	dropped int
+	batches chan []byte
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewElasticSink returns a sink that indexes every result in
+// Elasticsearch or OpenSearch at baseURL through the _bulk API. index
+// names the target index; {date} in it is replaced by the day of the
+// request (2006.01.02) and {run} by the run number. apiKey, if set, is
+// sent as an ApiKey authorization; credentials in baseURL are used for
+// basic auth. Every document carries the test's tags.
+func NewElasticSink(baseURL, index, apiKey, host, target string, tags map[string]string) metrics.Sink {
+	e := &elastic{
+		bulkURL: strings.TrimRight(baseURL, "/") + "/_bulk",
+		apiKey:  apiKey,
+		index:   index,
+		host:    host,
+		target:  target,
+		tags:    tags,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		batches: make(chan []byte, 4),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go e.loop()
+	return e
+}
+
+// ElasticIndex expands the {date} and {run} placeholders of an index name
+func ElasticIndex(pattern string, run int, t time.Time) string {
+	return strings.NewReplacer("{date}", t.UTC().Format("2006.01.02"), "{run}", strconv.Itoa(run)).Replace(pattern)
+}
+
+func (e *elastic) Observe(run int, r metrics.Result) {
+	action, _ := json.Marshal(map[string]map[string]string{"index": {"_index": ElasticIndex(e.index, run, r.Timestamp)}})
+	doc, err := json.Marshal(elasticDoc{Time: r.Timestamp, jsonRecord: newJSONRecord(run, r, e.tags), Host: e.host, Target: e.target})
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.buf.Write(action)
+	e.buf.WriteByte('\n')
+	e.buf.Write(doc)
+	e.buf.WriteByte('\n')
+	e.docs++
+	if e.docs >= elasticBatch || e.buf.Len() >= elasticBatchBytes {
+		e.handOff()
+	}
+}
+
+// handOff queues the pending documents for sending; e.mu must be held
+func (e *elastic) handOff() {
+	if e.docs == 0 {
+		return
+	}
+	batch := bytes.Clone(e.buf.Bytes())
+	select {
+	case e.batches <- batch:
+	default:
+		e.dropped += e.docs
+	}
+	e.buf.Reset()
+	e.docs = 0
+}
+
+func (e *elastic) loop() {
+	defer close(e.done)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var lastErr string
+	send := func(batch []byte) {
+		if err := e.bulk(batch); err != nil {
+			// Logged when it changes, so an unreachable cluster does not
+			// flood the log
+			if err.Error() != lastErr {
+				slog.Warn("elasticsearch: indexing failed", "err", err)
+			}
+			lastErr = err.Error()
+			return
+		}
+		lastErr = ""
+	}
+	for {
+		select {
+		case batch := <-e.batches:
+			send(batch)
+		case <-ticker.C:
+			e.mu.Lock()
+			e.handOff()
+			e.mu.Unlock()
+		case <-e.stop:
+			for {
+				select {
+				case batch := <-e.batches:
+					send(batch)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// bulk sends one _bulk request and reports the first document that was
+// rejected
+func (e *elastic) bulk(batch []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.bulkURL, bytes.NewReader(batch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+e.apiKey)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Error json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("reading bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	failed := 0
+	var first json.RawMessage
+	for _, item := range result.Items {
+		for _, op := range item {
+			if len(op.Error) > 0 {
+				if failed == 0 {
+					first = op.Error
+				}
+				failed++
+			}
+		}
+	}
+	return fmt.Errorf("%d of %d documents rejected, first: %s", failed, len(result.Items), first)
+}
+
+func (e *elastic) Close() error {
+	close(e.stop)
+	<-e.done
+	// The sender is done with the queue; the rest is sent from here
+	// rather than risk dropping it
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var err error
+	if e.docs > 0 {
+		err = e.bulk(e.buf.Bytes())
+	}
+	e.client.CloseIdleConnections()
+	if e.dropped > 0 {
+		slog.Warn("elasticsearch: results were dropped because indexing fell behind", "dropped", e.dropped)
+	}
+	if err != nil {
+		return fmt.Errorf("elasticsearch: %w", err)
+	}
+	return nil
+}
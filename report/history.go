@@ -0,0 +1,287 @@
+package report
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// HistoryEntry is one row of a history database: the combined results of
+// a test. Latencies are milliseconds.
+type HistoryEntry struct {
+	Time        time.Time         `json:"time"`
+	Test        string            `json:"test"`
+	Commit      string            `json:"commit,omitempty"`
+	Target      string            `json:"target"`
+	Runs        int               `json:"runs"`
+	Requests    int               `json:"requests"`
+	Failed      int               `json:"failed"`
+	ErrorRate   float64           `json:"error_rate"`
+	Throughput  float64           `json:"rps"`
+	P50Ms       int64             `json:"p50_ms"`
+	P90Ms       int64             `json:"p90_ms"`
+	P95Ms       int64             `json:"p95_ms"`
+	P99Ms       int64             `json:"p99_ms"`
+	MaxMs       int64             `json:"max_ms"`
+	DurationS   float64           `json:"duration_s"`
+	Passed      bool              `json:"passed"`
+	Interrupted bool              `json:"interrupted,omitempty"`
+	Aborted     string            `json:"aborted,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+// historySchema is the table of a history database, one row per test,
+// looked up by test name and commit. Times are UTC in RFC 3339, so they
+// sort as text, and tags are a JSON object.
+const historySchema = `
+CREATE TABLE IF NOT EXISTS history (
+	id          INTEGER PRIMARY KEY,
+	time        TEXT NOT NULL,
+	test        TEXT NOT NULL,
+	git_commit  TEXT NOT NULL DEFAULT '',
+	target      TEXT NOT NULL DEFAULT '',
+	runs        INTEGER NOT NULL,
+	requests    INTEGER NOT NULL,
+	failed      INTEGER NOT NULL,
+	error_rate  REAL NOT NULL,
+	rps         REAL NOT NULL,
+	p50_ms      INTEGER NOT NULL,
+	p90_ms      INTEGER NOT NULL,
+	p95_ms      INTEGER NOT NULL,
+	p99_ms      INTEGER NOT NULL,
+	max_ms      INTEGER NOT NULL,
+	duration_s  REAL NOT NULL,
+	passed      INTEGER NOT NULL,
+	interrupted INTEGER NOT NULL DEFAULT 0,
+	aborted     TEXT NOT NULL DEFAULT '',
+	tags        TEXT NOT NULL DEFAULT '{}'
+);
+CREATE INDEX IF NOT EXISTS history_test_commit ON history (test, git_commit, time);
+`
+
+const historyColumns = `time, test, git_commit, target, runs, requests, failed, error_rate, rps,
+	p50_ms, p90_ms, p95_ms, p99_ms, max_ms, duration_s, passed, interrupted, aborted, tags`
+
+// openHistory opens the history database at path, creating it and its
+// table if needed. Tests sharing the database wait for each other's
+// writes rather than failing.
+func openHistory(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=10000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// AppendHistory adds e to the history database at path, creating it if
+// needed
+func AppendHistory(path string, e HistoryEntry) error {
+	db, err := openHistory(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return insertHistory(db, e)
+}
+
+// execer is a database or a transaction
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insertHistory(db execer, e HistoryEntry) error {
+	tags, err := json.Marshal(e.Tags)
+	if err != nil {
+		return err
+	}
+	if e.Tags == nil {
+		tags = []byte("{}")
+	}
+	_, err = db.Exec(`INSERT INTO history (`+historyColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.UTC().Format(time.RFC3339Nano), e.Test, e.Commit, e.Target, e.Runs, e.Requests, e.Failed,
+		e.ErrorRate, e.Throughput, e.P50Ms, e.P90Ms, e.P95Ms, e.P99Ms, e.MaxMs, e.DurationS,
+		e.Passed, e.Interrupted, e.Aborted, string(tags))
+	return err
+}
+
+// ReadHistory returns the entries of the history database at path, oldest
+// first, keeping those of the named test only unless test is empty and
+// those of commits starting with commit unless it is empty
+func ReadHistory(path, test, commit string) ([]HistoryEntry, error) {
+	if _, err := os.Stat(path); err != nil {
+		// Reading must not leave an empty database behind a mistyped path
+		return nil, err
+	}
+	db, err := openHistory(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT `+historyColumns+` FROM history
+		WHERE (? = '' OR test = ?) AND (? = '' OR substr(git_commit, 1, length(?)) = ?)
+		ORDER BY time, id`, test, test, commit, commit, commit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	defer rows.Close()
+	var entries []HistoryEntry
+	for rows.Next() {
+		var e HistoryEntry
+		var at, tags string
+		if err := rows.Scan(&at, &e.Test, &e.Commit, &e.Target, &e.Runs, &e.Requests, &e.Failed,
+			&e.ErrorRate, &e.Throughput, &e.P50Ms, &e.P90Ms, &e.P95Ms, &e.P99Ms, &e.MaxMs, &e.DurationS,
+			&e.Passed, &e.Interrupted, &e.Aborted, &tags); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if e.Time, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := json.Unmarshal([]byte(tags), &e.Tags); err != nil {
+			return nil, fmt.Errorf("%s: tags: %w", path, err)
+		}
+		if len(e.Tags) == 0 {
+			e.Tags = nil
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// ImportHistory adds the entries of a JSON Lines history file, as written
+// by earlier versions, to the history database at path and returns how
+// many it added
+func ImportHistory(path, jsonl string) (int, error) {
+	f, err := os.Open(jsonl)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var entries []HistoryEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e HistoryEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return 0, fmt.Errorf("%s:%d: %w", jsonl, line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+	db, err := openHistory(path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	// All or nothing, so a failed import can simply be run again
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		if err := insertHistory(tx, e); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	return len(entries), tx.Commit()
+}
+
+// PrintHistory prints the entries of each test as a table, oldest first,
+// with the change in p95 since the first one shown to make a gradual
+// creep stand out
+func PrintHistory(w io.Writer, entries []HistoryEntry) {
+	var tests []string
+	byTest := map[string][]HistoryEntry{}
+	for _, e := range entries {
+		if _, ok := byTest[e.Test]; !ok {
+			tests = append(tests, e.Test)
+		}
+		byTest[e.Test] = append(byTest[e.Test], e)
+	}
+	for i, test := range tests {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		list := byTest[test]
+		fmt.Fprintf(w, "History of %s (%d test(s))\n", test, len(list))
+		fmt.Fprintf(w, "%-16s  %-12s %9s %8s %9s %7s %7s %7s %9s  %s\n",
+			"Time", "Commit", "Requests", "Errors", "RPS", "p50", "p95", "p99", "p95 trend", "Outcome")
+		first := list[0].P95Ms
+		for _, e := range list {
+			trend := "-"
+			if first > 0 {
+				trend = fmt.Sprintf("%+.1f%%", float64(e.P95Ms-first)/float64(first)*100)
+			}
+			fmt.Fprintf(w, "%-16s  %-12s %9d %8s %9.1f %7d %7d %7d %9s  %s\n",
+				e.Time.Local().Format("2006-01-02 15:04"), shortCommit(e.Commit), e.Requests, formatPercent(e.ErrorRate),
+				e.Throughput, e.P50Ms, e.P95Ms, e.P99Ms, trend, historyOutcome(e))
+		}
+	}
+}
+
+// WriteHistoryCSV exports the entries as CSV, for a spreadsheet or chart
+func WriteHistoryCSV(w io.Writer, entries []HistoryEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Time", "Test", "Commit", "Target", "Runs", "Requests", "Failed", "ErrorRate", "RPS",
+		"P50(ms)", "P90(ms)", "P95(ms)", "P99(ms)", "Max(ms)", "Duration(s)", "Outcome", "Tags"})
+	for _, e := range entries {
+		cw.Write([]string{
+			e.Time.Format(time.RFC3339),
+			e.Test,
+			e.Commit,
+			e.Target,
+			strconv.Itoa(e.Runs),
+			strconv.Itoa(e.Requests),
+			strconv.Itoa(e.Failed),
+			strconv.FormatFloat(e.ErrorRate, 'f', 4, 64),
+			strconv.FormatFloat(e.Throughput, 'f', 2, 64),
+			strconv.FormatInt(e.P50Ms, 10),
+			strconv.FormatInt(e.P90Ms, 10),
+			strconv.FormatInt(e.P95Ms, 10),
+			strconv.FormatInt(e.P99Ms, 10),
+			strconv.FormatInt(e.MaxMs, 10),
+			strconv.FormatFloat(e.DurationS, 'f', 1, 64),
+			historyOutcome(e),
+			FormatTags(e.Tags, ";"),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func historyOutcome(e HistoryEntry) string {
+	switch {
+	case e.Aborted != "":
+		return "aborted"
+	case !e.Passed:
+		return "failed"
+	case e.Interrupted:
+		return "interrupted"
+	}
+	return "passed"
+}
+
+func shortCommit(c string) string {
+	if len(c) > 12 {
+		return c[:12]
+	}
+	return c
+}
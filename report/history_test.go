@@ -0,0 +1,88 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "history.db")
+	start := time.Date(2026, 10, 14, 2, 0, 0, 0, time.UTC)
+	entries := []HistoryEntry{
+		{Time: start, Test: "checkout", Commit: "9f2c41d07a1e", Runs: 1, Requests: 100, P95Ms: 30, Passed: true, Tags: map[string]string{"env": "staging"}},
+		{Time: start.Add(time.Hour), Test: "search", Commit: "9f2c41d07a1e", Runs: 1, Requests: 50, P95Ms: 12, Passed: true},
+		{Time: start.Add(24 * time.Hour), Test: "checkout", Commit: "b71e0c3d55f2", Runs: 2, Requests: 100, Failed: 3, ErrorRate: 0.03, P95Ms: 35, Aborted: "error rate"},
+	}
+	// Written out of order, read back oldest first
+	for _, i := range []int{2, 0, 1} {
+		if err := AppendHistory(db, entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		test, commit string
+		want         []HistoryEntry
+	}{
+		{name: "all", want: entries},
+		{name: "test", test: "checkout", want: []HistoryEntry{entries[0], entries[2]}},
+		{name: "commit prefix", commit: "9f2c", want: []HistoryEntry{entries[0], entries[1]}},
+		{name: "test and commit", test: "checkout", commit: "b71e0c3d55f2", want: []HistoryEntry{entries[2]}},
+		{name: "no match", test: "login"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadHistory(db, tt.test, tt.commit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadHistory = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadHistoryMissing(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "history.db")
+	if _, err := ReadHistory(db, "", ""); !os.IsNotExist(err) {
+		t.Errorf("err = %v, want one for a missing file", err)
+	}
+	if _, err := os.Stat(db); err == nil {
+		t.Error("reading a missing history created the database")
+	}
+}
+
+func TestImportHistory(t *testing.T) {
+	dir := t.TempDir()
+	jsonl := filepath.Join(dir, "history.jsonl")
+	os.WriteFile(jsonl, []byte(`{"time":"2026-10-14T02:00:00Z","test":"checkout","commit":"9f2c41d07a1e","runs":1,"requests":100,"p95_ms":30,"passed":true}
+
+{"time":"2026-10-15T02:00:00Z","test":"checkout","commit":"b71e0c3d55f2","runs":1,"requests":100,"p95_ms":31,"passed":true,"tags":{"env":"staging"}}
+`), 0644)
+	db := filepath.Join(dir, "history.db")
+	n, err := ImportHistory(db, jsonl)
+	if err != nil || n != 2 {
+		t.Fatalf("ImportHistory = %d, %v; want 2 entries", n, err)
+	}
+	got, err := ReadHistory(db, "checkout", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1].P95Ms != 31 || got[1].Tags["env"] != "staging" {
+		t.Errorf("ReadHistory after import = %+v", got)
+	}
+
+	// A bad line imports nothing
+	os.WriteFile(jsonl, []byte("{\"test\":\"login\"}\nnot json\n"), 0644)
+	if _, err := ImportHistory(db, jsonl); err == nil {
+		t.Fatal("ImportHistory of a bad file succeeded")
+	}
+	if got, _ := ReadHistory(db, "login", ""); len(got) != 0 {
+		t.Errorf("a failed import added %d entries", len(got))
+	}
+}
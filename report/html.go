@@ -0,0 +1,205 @@
+package report
+
+import (
+	_ "embed"
+	"html/template"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+//go:embed report.html
+var htmlReportTemplate string
+
+// htmlReport is the data rendered into report.html
+type htmlReport struct {
+	Title     string
+	Generated string
+	Config    config.Config
+	Total     htmlRunSummary
+	Runs      []htmlRunSummary
+}
+
+// htmlRunSummary is the chart and table data for one run (or the total)
+type htmlRunSummary struct {
+	ID               string
+	Name             string
+	Requests         int
+	Success          int
+	Failed           int
+	Iterations       int
+	FailedIterations int
+	Duration         string
+	Throughput       string
+	P50              int64
+	P90              int64
+	P99              int64
+	P999             int64
+	Max              int64
+	DataSent         string // totals and rates, formatted
+	DataReceived     string
+	SentRate         string
+	ReceivedRate     string
+	NewConns         int
+	TLSHandshakes    int
+	Scheduled        bool // open model: corrected latency and send delay are set
+	CorrectedP99     int64
+	SendDelayP99     string
+	LateSends        int
+	FellBehind       bool
+	GeneratorCPU     string // empty when unknown
+	GeneratorLag     string // worst scheduling lag, ms
+	GeneratorBusy    string // why the generator may have been the bottleneck
+	StatusCodes      []htmlCount
+	Errors           []htmlCount
+	ErrorTypes       []htmlCount
+	Protocols        []htmlCount
+	TLS              []htmlCount
+	IPFamilies       []htmlCount
+	GRPCStatus       []htmlCount
+	DNSRcodes        []htmlCount
+	Timeline         []metrics.TimeBucket
+	Percentiles      [][2]float64   // [percentile, latency ms]
+	Endpoints        []htmlEndpoint // only set when several endpoints were targeted
+}
+
+type htmlEndpoint struct {
+	Name       string
+	Requests   int
+	Failed     int
+	ErrorRate  string
+	Throughput string
+	P50        int64
+	P95        int64
+	P99        int64
+}
+
+type htmlCount struct {
+	Label string
+	Count int
+}
+
+// WriteHTML renders a self-contained HTML report for all runs. cfg is the
+// configuration as resolved for the test.
+func WriteHTML(path string, cfg config.Config, runs []*metrics.RunStats) error {
+	tmpl, err := template.New("report").Parse(htmlReportTemplate)
+	if err != nil {
+		return err
+	}
+	data := htmlReport{
+		Title:     "Load test report: " + cfg.TargetLabel(),
+		Generated: time.Now().Format(time.RFC1123),
+		Config:    cfg,
+		Total:     newHTMLRunSummary(&cfg, "total", "All runs", metrics.Merge(runs)),
+	}
+	for _, s := range runs {
+		id := strconv.Itoa(s.Run)
+		data.Runs = append(data.Runs, newHTMLRunSummary(&cfg, "run"+id, "Run "+id, s))
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(f, data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func newHTMLRunSummary(cfg *config.Config, id, name string, s *metrics.RunStats) htmlRunSummary {
+	h := htmlRunSummary{
+		ID:               id,
+		Name:             name,
+		Requests:         s.Sent,
+		Success:          s.Success,
+		Failed:           s.Failed,
+		Iterations:       s.Iterations,
+		FailedIterations: s.FailedIterations,
+		Duration:         s.Duration.Round(time.Millisecond).String(),
+		Throughput:       strconv.FormatFloat(s.Throughput(), 'f', 2, 64),
+		P50:              s.Percentile(0.50),
+		P90:              s.Percentile(0.90),
+		P99:              s.Percentile(0.99),
+		P999:             s.Percentile(0.999),
+		Max:              s.Latency.Max().Milliseconds(),
+		NewConns:         s.NewConns,
+		TLSHandshakes:    s.TLSHandshakes,
+		Timeline:         s.Timeline,
+	}
+	if s.BytesSent > 0 || s.BytesReceived > 0 {
+		sent, received := s.Bandwidth()
+		h.DataSent, h.SentRate = formatBytes(float64(s.BytesSent)), formatBytes(sent)+"/s"
+		h.DataReceived, h.ReceivedRate = formatBytes(float64(s.BytesReceived)), formatBytes(received)+"/s"
+	}
+	if s.SendDelay.Count() > 0 {
+		h.Scheduled = true
+		h.CorrectedP99 = s.Corrected.Quantile(0.99).Milliseconds()
+		h.SendDelayP99 = fmtMillis(s.SendDelay.Quantile(0.99))
+		h.LateSends = s.LateSends
+		h.FellBehind = s.FellBehind()
+	}
+	if g := s.Generator; g.CPUs > 0 {
+		if g.CPU >= 0 {
+			h.GeneratorCPU = strconv.Itoa(int(g.CPU*100+0.5)) + "%"
+		}
+		h.GeneratorLag = fmtMillis(g.LagMax)
+		h.GeneratorBusy = g.Busy()
+	}
+	for code, n := range s.StatusCodes {
+		h.StatusCodes = append(h.StatusCodes, htmlCount{strconv.Itoa(code), n})
+	}
+	sort.Slice(h.StatusCodes, func(i, j int) bool { return h.StatusCodes[i].Label < h.StatusCodes[j].Label })
+	if s.NoResponse > 0 {
+		h.StatusCodes = append(h.StatusCodes, htmlCount{"no response", s.NoResponse})
+	}
+	for msg, n := range s.Errors {
+		h.Errors = append(h.Errors, htmlCount{msg, n})
+	}
+	sort.Slice(h.Errors, func(i, j int) bool { return h.Errors[i].Count > h.Errors[j].Count })
+	for _, proto := range sortedByCount(s.Protocols) {
+		h.Protocols = append(h.Protocols, htmlCount{proto, s.Protocols[proto]})
+	}
+	for _, family := range sortedByCount(s.IPFamilies) {
+		h.IPFamilies = append(h.IPFamilies, htmlCount{family, s.IPFamilies[family]})
+	}
+	for _, suite := range sortedByCount(s.TLS) {
+		h.TLS = append(h.TLS, htmlCount{suite, s.TLS[suite]})
+	}
+	for _, code := range sortedByCount(s.GRPCStatus) {
+		h.GRPCStatus = append(h.GRPCStatus, htmlCount{code, s.GRPCStatus[code]})
+	}
+	for _, code := range sortedByCount(s.DNSRcodes) {
+		h.DNSRcodes = append(h.DNSRcodes, htmlCount{code, s.DNSRcodes[code]})
+	}
+	for _, typ := range sortedByCount(s.ErrorTypes) {
+		h.ErrorTypes = append(h.ErrorTypes, htmlCount{typ, s.ErrorTypes[typ]})
+	}
+
+	if len(s.Endpoints) > 1 {
+		for _, name := range sortedEndpoints(cfg, s) {
+			e := s.Endpoints[name]
+			h.Endpoints = append(h.Endpoints, htmlEndpoint{
+				Name:       name,
+				Requests:   e.Requests,
+				Failed:     e.Failed,
+				ErrorRate:  formatPercent(e.ErrorRate()),
+				Throughput: strconv.FormatFloat(e.Throughput(s.Duration), 'f', 2, 64),
+				P50:        e.Latency.Quantile(0.50).Milliseconds(),
+				P95:        e.Latency.Quantile(0.95).Milliseconds(),
+				P99:        e.Latency.Quantile(0.99).Milliseconds(),
+			})
+		}
+	}
+
+	// Latency distribution: finer steps towards the tail
+	for _, p := range []float64{0, 10, 20, 30, 40, 50, 60, 70, 75, 80, 85, 90, 92.5, 95, 97.5, 99, 99.5, 99.9, 99.99, 100} {
+		h.Percentiles = append(h.Percentiles, [2]float64{p, float64(s.Percentile(p / 100))})
+	}
+	return h
+}
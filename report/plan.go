@@ -0,0 +1,247 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+// masked replaces the value of a secret in the printed plan, as in a
+// redacted URL
+const masked = "xxxxx"
+
+// PrintPlan prints what a test would do, as resolved: its targets, load,
+// headers and pass/fail conditions. Secrets in headers and URLs are
+// masked, so the output can be shared.
+func PrintPlan(w io.Writer, cfg *config.Config) {
+	fmt.Fprintln(w, "Test plan:")
+	switch {
+	case len(cfg.Scenario) > 0:
+		fmt.Fprintf(w, "  Scenario of %d steps:\n", len(cfg.Scenario))
+		for i, step := range cfg.Scenario {
+			fmt.Fprintf(w, "    %d. %s %s", i+1, step.Method, maskURL(step.URL))
+			if step.When != "" {
+				fmt.Fprintf(w, " when %s", step.When)
+			}
+			if step.Before != "" {
+				fmt.Fprintf(w, " before %s()", step.Before)
+			}
+			if step.After != "" {
+				fmt.Fprintf(w, " after %s()", step.After)
+			}
+			fmt.Fprintln(w)
+			printHeaders(w, "       ", step.Headers, cfg.Headers, cfg.AuthHeaderName())
+		}
+		if cfg.Script != "" {
+			fmt.Fprintf(w, "  Script: %s\n", cfg.Script)
+		}
+	case len(cfg.Endpoints) > 0:
+		var total float64
+		for _, ep := range cfg.Endpoints {
+			total += ep.Weight
+		}
+		fmt.Fprintf(w, "  Endpoints:\n")
+		for _, ep := range cfg.Endpoints {
+			fmt.Fprintf(w, "    %5.1f%%  %s %s\n", 100*ep.Weight/total, ep.Method, maskURL(ep.URL))
+			printHeaders(w, "           ", ep.Headers, cfg.Headers, cfg.AuthHeaderName())
+		}
+	case cfg.Replay != nil:
+		fmt.Fprintf(w, "  Replay of %s against %s\n", cfg.Replay.File, maskURL(cfg.URL))
+	default:
+		fmt.Fprintf(w, "  Target: %s %s\n", cfg.Method, maskURL(cfg.URL))
+	}
+	if cfg.StreamBody != "" {
+		fmt.Fprintf(w, "  Body: %s generated, streamed chunked\n", cfg.StreamBody)
+	}
+	if m := cfg.Multipart; m != nil {
+		fmt.Fprintf(w, "  Multipart form: %d fields", len(m.Fields))
+		for _, f := range m.Files {
+			source := f.Path
+			if source == "" {
+				source = f.Size + " generated"
+			}
+			fmt.Fprintf(w, ", file %s from %s", f.Field, source)
+		}
+		fmt.Fprintln(w)
+	}
+	if len(cfg.RandomQuery) > 0 {
+		names := make([]string, 0, len(cfg.RandomQuery))
+		for name := range cfg.RandomQuery {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			names[i] = name + "=" + cfg.RandomQuery[name]
+		}
+		fmt.Fprintf(w, "  Random query: %s\n", strings.Join(names, ", "))
+	}
+	if len(cfg.Headers) > 0 {
+		fmt.Fprintln(w, "  Headers:")
+		printHeaders(w, "    ", cfg.Headers, nil, cfg.AuthHeaderName())
+	}
+
+	if cfg.Model == config.ModelClosed {
+		fmt.Fprintf(w, "  Load: closed model, %d virtual users", cfg.Concurrency)
+	} else {
+		fmt.Fprintf(w, "  Load: open model, up to %d requests in flight", cfg.Concurrency)
+	}
+	switch {
+	case cfg.Pattern == config.PatternSpike:
+		fmt.Fprintf(w, ", %.2f req/s spiking to %.2f req/s at %s for %s", cfg.Rate, cfg.SpikeRate,
+			time.Duration(cfg.SpikeAt), time.Duration(cfg.SpikeDuration))
+	case len(cfg.Stages) > 0:
+		fmt.Fprintf(w, ", stages %s", config.FormatStages(cfg.Stages))
+	case cfg.Rate > 0 && cfg.AdaptiveRate:
+		fmt.Fprintf(w, ", up to %.2f req/s, backing off when throttled", cfg.Rate)
+	case cfg.Rate > 0:
+		fmt.Fprintf(w, ", %.2f req/s", cfg.Rate)
+	case cfg.Pattern == config.PatternStep:
+		fmt.Fprintf(w, ", adding %d every %s", cfg.StepWorkers, time.Duration(cfg.StepInterval))
+	}
+	if cfg.Search {
+		fmt.Fprintf(w, ", searching up to %.2f req/s in steps of %.2f req/s to within %.2f req/s",
+			cfg.SearchMax, cfg.SearchStep, cfg.SearchPrecision)
+	}
+	fmt.Fprintln(w)
+	switch {
+	case len(cfg.Stages) > 0:
+		var length time.Duration
+		for _, st := range cfg.Stages {
+			length += time.Duration(st.Duration)
+		}
+		fmt.Fprintf(w, "  Length: %s per run", length)
+	case cfg.Duration > 0:
+		fmt.Fprintf(w, "  Length: %s per run", time.Duration(cfg.Duration))
+	default:
+		fmt.Fprintf(w, "  Length: %d requests per run", cfg.Requests)
+	}
+	if cfg.RepeatCount > 1 {
+		fmt.Fprintf(w, ", %d runs %ds apart", cfg.RepeatCount, cfg.RepeatDelay)
+	}
+	if cfg.MaxDuration > 0 {
+		fmt.Fprintf(w, ", stopped after %s", time.Duration(cfg.MaxDuration))
+	}
+	fmt.Fprintln(w)
+	if cfg.Warmup > 0 || cfg.WarmupRequests > 0 {
+		fmt.Fprintf(w, "  Warm-up: %s, %d requests\n", time.Duration(cfg.Warmup), cfg.WarmupRequests)
+	}
+	if cfg.HealthCheck != "" {
+		fmt.Fprintf(w, "  Health check: %s, waiting up to %s\n", maskURL(cfg.HealthCheck), time.Duration(cfg.HealthCheckWait))
+	}
+	if len(cfg.Agents) > 0 {
+		fmt.Fprintf(w, "  Agents: %s\n", strings.Join(cfg.Agents, ", "))
+	}
+	if len(cfg.Thresholds) > 0 {
+		fmt.Fprintf(w, "  Thresholds: %s\n", strings.Join(cfg.Thresholds, "; "))
+	}
+	if len(cfg.Tags) > 0 {
+		fmt.Fprintf(w, "  Tags: %s\n", FormatTags(cfg.Tags, ", "))
+	}
+	fmt.Fprintf(w, "  Reports: %s/results_*%s\n", cfg.ReportDir, RecordExtension(cfg.Format))
+	if cfg.Capture {
+		fmt.Fprintf(w, "  Capture: %s/capture_*.jsonl, failed requests", cfg.ReportDir)
+		if cfg.CaptureEvery > 0 {
+			fmt.Fprintf(w, " and one in %d others", cfg.CaptureEvery)
+		}
+		fmt.Fprintf(w, ", bodies up to %d bytes\n", cfg.CaptureBody)
+	}
+	if cfg.Failures {
+		fmt.Fprintf(w, "  Failures: %s/failures_*.jsonl, bodies up to %d bytes\n", cfg.ReportDir, cfg.CaptureBody)
+	}
+}
+
+// printHeaders prints headers, masking secrets and the auth header,
+// skipping those that equal the inherited ones
+func printHeaders(w io.Writer, indent string, headers, inherited map[string]string, auth string) {
+	names := make([]string, 0, len(headers))
+	for name, value := range headers {
+		if v, ok := inherited[name]; !ok || v != value {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s%s: %s\n", indent, name, maskHeader(name, headers[name], auth))
+	}
+}
+
+// PrintProbes prints the result of each request of a dry run and reports
+// whether they all succeeded
+func PrintProbes(w io.Writer, results []metrics.Result) bool {
+	ok := true
+	fmt.Fprintln(w, "Probe requests:")
+	for _, r := range results {
+		outcome := "ok"
+		if r.Error != "" {
+			outcome = "FAILED: " + r.Error
+			ok = false
+		}
+		status := "-"
+		if r.Status > 0 {
+			status = fmt.Sprint(r.Status)
+		}
+		name := r.Endpoint
+		if method, u, ok := strings.Cut(name, " "); ok {
+			name = method + " " + maskURL(u)
+		} else {
+			name = maskURL(name)
+		}
+		fmt.Fprintf(w, "  %-40s %5s %8d ms  %s\n", name, status, r.Duration.Milliseconds(), outcome)
+	}
+	return ok
+}
+
+// maskHeader returns value, or a mask in its place when the header
+// carries a credential or is auth, the header set by AUTH_HEADER. The
+// scheme of an Authorization header is kept.
+func maskHeader(name, value, auth string) string {
+	if !isSecret(name) && !strings.EqualFold(name, auth) {
+		return value
+	}
+	if scheme, _, ok := strings.Cut(value, " "); ok && strings.Contains(strings.ToLower(name), "authorization") {
+		return scheme + " " + masked
+	}
+	return masked
+}
+
+// maskURL returns raw with its password and the values of secret-looking
+// query parameters masked
+func maskURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	q := u.Query()
+	hidden := false
+	for name := range q {
+		if isSecret(name) {
+			q.Set(name, masked)
+			hidden = true
+		}
+	}
+	if hidden {
+		u.RawQuery = q.Encode()
+	}
+	if _, ok := u.User.Password(); !ok && !hidden {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// isSecret reports whether a header or parameter name suggests its value
+// is a credential
+func isSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"auth", "token", "secret", "key", "password", "passwd", "cookie", "session", "signature"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,341 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"LoadTester/metrics"
+)
+
+// ReadRuns rebuilds the per-run stats of a test from its per-request
+// report, CSV, JSON Lines or Parquet and gzipped or not, as told by the
+// file name. A run's duration spans its requests from the first sent to
+// the last completed; it is zero for CSV reports written before they had
+// a Timestamp column, whose throughput is therefore unknown.
+func ReadRuns(path string) ([]*metrics.RunStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = bufio.NewReader(f)
+	name := path
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+		name = strings.TrimSuffix(name, ".gz")
+	}
+	runs := map[int]*runReader{}
+	add := func(run int, res metrics.Result) {
+		rr, ok := runs[run]
+		if !ok {
+			rr = &runReader{stats: metrics.NewRunStats(run, res.Timestamp)}
+			runs[run] = rr
+		}
+		rr.add(res)
+	}
+	switch {
+	case strings.HasSuffix(name, ".jsonl") || strings.HasSuffix(name, ".ndjson"):
+		err = readJSONRecords(r, add)
+	case strings.HasSuffix(name, ".parquet"):
+		err = readParquetRecords(r, add)
+	default:
+		err = readCSVRecords(r, add)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("%s: no requests", path)
+	}
+	ids := make([]int, 0, len(runs))
+	for id := range runs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	stats := make([]*metrics.RunStats, len(ids))
+	for i, id := range ids {
+		stats[i] = runs[id].finish()
+	}
+	return stats, nil
+}
+
+// runReader collects the results of one run and the time they span.
+// Results are written as they complete, not in the order they were sent,
+// so the timeline of the stats is only approximate.
+type runReader struct {
+	stats      *metrics.RunStats
+	start, end time.Time
+}
+
+func (rr *runReader) add(r metrics.Result) {
+	rr.stats.Add(r)
+	if r.Timestamp.IsZero() || r.Warmup {
+		return
+	}
+	if rr.start.IsZero() || r.Timestamp.Before(rr.start) {
+		rr.start = r.Timestamp
+	}
+	if end := r.Timestamp.Add(r.Duration); end.After(rr.end) {
+		rr.end = end
+	}
+}
+
+func (rr *runReader) finish() *metrics.RunStats {
+	rr.stats.Finish(rr.end.Sub(rr.start))
+	return rr.stats
+}
+
+func readJSONRecords(r io.Reader, add func(int, metrics.Result)) error {
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var rec jsonRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("record %d: %w", line, err)
+		}
+		add(rec.Run, rec.result())
+	}
+}
+
+// readParquetRecords reads a whole Parquet report, whose footer comes last
+func readParquetRecords(r io.Reader, add func(int, metrics.Result)) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	recs, err := parquet.Read[jsonRecord](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for i := range recs {
+		add(recs[i].Run, recs[i].result())
+	}
+	return nil
+}
+
+// result is the request a JSONL or Parquet record describes
+func (rec *jsonRecord) result() metrics.Result {
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	res := metrics.Result{
+		RequestID:     rec.RequestID,
+		Timestamp:     rec.Timestamp,
+		Endpoint:      rec.Endpoint,
+		Status:        rec.Status,
+		Proto:         rec.Protocol,
+		ErrorType:     rec.ErrorType,
+		Error:         rec.Error,
+		Duration:      ms(rec.DurationMs),
+		Retries:       rec.Retries,
+		Warmup:        rec.Warmup,
+		TLSVersion:    rec.TLSVersion,
+		TLSCipher:     rec.TLSCipher,
+		IPFamily:      rec.IPFamily,
+		NewConn:       rec.NewConn,
+		TLSHandshake:  rec.TLSHandshake,
+		BytesSent:     rec.BytesSent,
+		BytesReceived: rec.BytesReceived,
+		GRPCStatus:    rec.GRPCStatus,
+		DNSRcode:      rec.DNSRcode,
+		Phases: metrics.Phases{
+			DNS:      ms(rec.DNSMs),
+			Connect:  ms(rec.ConnectMs),
+			TLS:      ms(rec.TLSMs),
+			TTFB:     ms(rec.TTFBMs),
+			Transfer: ms(rec.TransferMs),
+			QUIC:     ms(rec.QUICMs),
+		},
+	}
+	// Reports from before it have only the whole request's duration
+	res.AttemptDuration = res.Duration
+	if rec.AttemptMs != nil {
+		res.AttemptDuration = ms(*rec.AttemptMs)
+	}
+	if len(rec.Attempts) > 0 {
+		attempts := make([]metrics.Attempt, len(rec.Attempts))
+		for i, a := range rec.Attempts {
+			attempts[i] = metrics.Attempt{Number: a.Attempt, Status: a.Status, ErrorType: a.ErrorType,
+				Duration: ms(a.DurationMs), Backoff: ms(a.BackoffMs)}
+		}
+		res.Attempts = completeAttempts(attempts, res)
+	}
+	if rec.SendDelayMs != nil {
+		res.Scheduled = rec.Timestamp.Add(-ms(*rec.SendDelayMs))
+	}
+	return res
+}
+
+// readCSVRecords reads the columns it needs by name, so reports from
+// versions with fewer columns can still be compared
+func readCSVRecords(r io.Reader, add func(int, metrics.Result)) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("reading the header: %w", err)
+	}
+	col := map[string]int{}
+	for i, name := range header {
+		col[name] = i
+	}
+	for _, name := range []string{"RunID", "Status", "Error", "Duration(ms)"} {
+		if _, ok := col[name]; !ok {
+			return fmt.Errorf("not a per-request report: no %s column", name)
+		}
+	}
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		field := func(name string) string {
+			if i, ok := col[name]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+		num := func(name string) int64 {
+			n, _ := strconv.ParseInt(field(name), 10, 64)
+			return n
+		}
+		millis := func(name string) time.Duration {
+			v, _ := strconv.ParseFloat(field(name), 64)
+			return time.Duration(v * float64(time.Millisecond))
+		}
+		run, err := strconv.Atoi(field("RunID"))
+		if err != nil {
+			return fmt.Errorf("line %d: invalid RunID %q", line, field("RunID"))
+		}
+		res := metrics.Result{
+			RequestID:     int(num("RequestID")),
+			Endpoint:      field("Endpoint"),
+			Status:        int(num("Status")),
+			Proto:         field("Protocol"),
+			ErrorType:     field("ErrorType"),
+			Error:         field("Error"),
+			Duration:      millis("Duration(ms)"),
+			Retries:       int(num("Retries")),
+			Warmup:        field("Warmup") == "true",
+			TLSVersion:    field("TLSVersion"),
+			TLSCipher:     field("TLSCipher"),
+			IPFamily:      field("IPFamily"),
+			NewConn:       field("NewConn") == "true",
+			TLSHandshake:  field("TLSHandshake") == "true",
+			BytesSent:     num("BytesSent"),
+			BytesReceived: num("BytesReceived"),
+			Phases: metrics.Phases{
+				DNS:      millis("DNS(ms)"),
+				Connect:  millis("Connect(ms)"),
+				TLS:      millis("TLS(ms)"),
+				TTFB:     millis("TTFB(ms)"),
+				Transfer: millis("Transfer(ms)"),
+				QUIC:     millis("QUIC(ms)"),
+			},
+		}
+		// Reports from before the column have only the whole request's
+		res.AttemptDuration = res.Duration
+		if _, ok := col["AttemptDuration(ms)"]; ok {
+			res.AttemptDuration = millis("AttemptDuration(ms)")
+		}
+		if res.Attempts, err = parseAttempts(field("Attempts"), res); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if ts := field("Timestamp"); ts != "" {
+			if res.Timestamp, err = time.Parse(time.RFC3339Nano, ts); err != nil {
+				return fmt.Errorf("line %d: invalid Timestamp %q", line, ts)
+			}
+			if delay := field("SendDelay(ms)"); delay != "" {
+				res.Scheduled = res.Timestamp.Add(-millis("SendDelay(ms)"))
+			}
+		}
+		add(run, res)
+	}
+}
+
+// parseAttempts reads the Attempts column of r's CSV record, written as
+// attempt/status/error type/duration ms/backoff ms or, by reports from
+// before the last attempt was included, status/error type/duration
+// ms/backoff ms
+func parseAttempts(s string, r metrics.Result) ([]metrics.Attempt, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ";")
+	attempts := make([]metrics.Attempt, len(parts))
+	for i, part := range parts {
+		f := strings.Split(part, "/")
+		var a metrics.Attempt
+		var err error
+		switch len(f) {
+		case 5:
+			a.Number, err = strconv.Atoi(f[0])
+			f = f[1:]
+		case 4:
+		default:
+			return nil, fmt.Errorf("invalid attempt %q", part)
+		}
+		if err == nil {
+			a.Status, err = strconv.Atoi(f[0])
+		}
+		a.ErrorType = f[1]
+		if err == nil {
+			a.Duration, err = parseMillis(f[2])
+		}
+		if err == nil {
+			a.Backoff, err = parseMillis(f[3])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid attempt %q", part)
+		}
+		attempts[i] = a
+	}
+	return completeAttempts(attempts, r), nil
+}
+
+// completeAttempts returns the attempts read for r with their start times.
+// Reports from before the last attempt was included list only the retried
+// ones, without numbers; they are numbered and the last is added from r's
+// own outcome, taking what the others and their backoffs leave of its
+// duration.
+func completeAttempts(attempts []metrics.Attempt, r metrics.Result) []metrics.Attempt {
+	if attempts[0].Number == 0 {
+		for i := range attempts {
+			attempts[i].Number = i + 1
+		}
+		attempts = append(attempts, metrics.Attempt{Number: len(attempts) + 1, Status: r.Status, ErrorType: r.ErrorType})
+	}
+	var start time.Duration
+	for i := range attempts {
+		attempts[i].Start = start
+		start += attempts[i].Duration + attempts[i].Backoff
+	}
+	if last := &attempts[len(attempts)-1]; last.Duration == 0 {
+		last.Duration = max(0, r.Duration-last.Start)
+	}
+	return attempts
+}
+
+func parseMillis(s string) (time.Duration, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	return time.Duration(v * float64(time.Millisecond)), err
+}
@@ -0,0 +1,148 @@
+package report
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"LoadTester/metrics"
+)
+
+func TestReadAttemptDuration(t *testing.T) {
+	tests := []struct {
+		name   string
+		jsonl  bool
+		report string
+		want   time.Duration
+	}{
+		{
+			name:   "csv column",
+			report: "RunID,Status,Error,Duration(ms),AttemptDuration(ms)\n1,200,,1030,16\n",
+			want:   16 * time.Millisecond,
+		},
+		{
+			name:   "csv zero column",
+			report: "RunID,Status,Error,Duration(ms),AttemptDuration(ms)\n1,200,,1030,0\n",
+			want:   0,
+		},
+		{
+			name:   "csv without column",
+			report: "RunID,Status,Error,Duration(ms)\n1,200,,1030\n",
+			want:   1030 * time.Millisecond,
+		},
+		{
+			name:   "jsonl field",
+			jsonl:  true,
+			report: `{"run":1,"status":200,"duration_ms":1030,"attempt_duration_ms":16}` + "\n",
+			want:   16 * time.Millisecond,
+		},
+		{
+			name:   "jsonl zero field",
+			jsonl:  true,
+			report: `{"run":1,"status":200,"duration_ms":1030,"attempt_duration_ms":0}` + "\n",
+			want:   0,
+		},
+		{
+			name:   "jsonl without field",
+			jsonl:  true,
+			report: `{"run":1,"status":200,"duration_ms":1030}` + "\n",
+			want:   1030 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []metrics.Result
+			add := func(_ int, r metrics.Result) { got = append(got, r) }
+			var err error
+			if tt.jsonl {
+				err = readJSONRecords(strings.NewReader(tt.report), add)
+			} else {
+				err = readCSVRecords(strings.NewReader(tt.report), add)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("got %d results, want 1", len(got))
+			}
+			if got[0].AttemptDuration != tt.want {
+				t.Errorf("AttemptDuration = %v, want %v", got[0].AttemptDuration, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVRecordAppendsAttemptDuration(t *testing.T) {
+	r := metrics.Result{Duration: 1030 * time.Millisecond, AttemptDuration: 16 * time.Millisecond}
+	rec := CSVRecord(1, r, "")
+	if len(rec) != len(CSVHeader) {
+		t.Fatalf("record has %d fields, header %d", len(rec), len(CSVHeader))
+	}
+	// Appended after the columns of older reports, which stay in place
+	baseline := []string{"RunID", "RequestID", "Status", "Error", "Duration(ms)", "Retries"}
+	if !slices.Equal(CSVHeader[:len(baseline)], baseline) {
+		t.Fatalf("header starts %v, want %v", CSVHeader[:len(baseline)], baseline)
+	}
+	i := slices.Index(CSVHeader, "AttemptDuration(ms)")
+	if i != slices.Index(CSVHeader, "Redirects")+1 {
+		t.Fatalf("AttemptDuration(ms) is column %d, want it right after Redirects", i)
+	}
+	if rec[i] != "16" {
+		t.Errorf("AttemptDuration(ms) = %s, want 16", rec[i])
+	}
+}
+
+func TestReadAttempts(t *testing.T) {
+	want := []metrics.Attempt{
+		{Number: 1, Status: 503, ErrorType: metrics.ErrTypeHTTP5xx, Duration: 10 * time.Millisecond, Backoff: 100 * time.Millisecond},
+		{Number: 2, Status: 200, Start: 110 * time.Millisecond, Duration: 20 * time.Millisecond},
+	}
+	tests := []struct {
+		name   string
+		jsonl  bool
+		report string
+	}{
+		{
+			name:   "csv",
+			report: "RunID,Status,Error,Duration(ms),Attempts\n1,200,,130,1/503/" + metrics.ErrTypeHTTP5xx + "/10/100;2/200//20/0\n",
+		},
+		{
+			name:   "csv without last attempt",
+			report: "RunID,Status,Error,Duration(ms),Attempts\n1,200,,130,503/" + metrics.ErrTypeHTTP5xx + "/10/100\n",
+		},
+		{
+			name:  "jsonl",
+			jsonl: true,
+			report: `{"run":1,"status":200,"duration_ms":130,"attempts":[` +
+				`{"attempt":1,"status":503,"error_type":"` + metrics.ErrTypeHTTP5xx + `","duration_ms":10,"backoff_ms":100},` +
+				`{"attempt":2,"status":200,"duration_ms":20,"backoff_ms":0}]}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []metrics.Result
+			add := func(_ int, r metrics.Result) { got = append(got, r) }
+			var err error
+			if tt.jsonl {
+				err = readJSONRecords(strings.NewReader(tt.report), add)
+			} else {
+				err = readCSVRecords(strings.NewReader(tt.report), add)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("got %d results, want 1", len(got))
+			}
+			if len(got[0].Attempts) != len(want) {
+				t.Fatalf("got %d attempts, want %d", len(got[0].Attempts), len(want))
+			}
+			for i, a := range got[0].Attempts {
+				if a != want[i] {
+					t.Errorf("attempt %d = %+v, want %+v", i+1, a, want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package report
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+// RecordWriter writes the per-request results of a test, one record per
+// request, in one of the config.Format* formats
+type RecordWriter interface {
+	Write(run int, r metrics.Result) error
+	Flush() error
+	// Close flushes the records and ends the report, which formats with a
+	// footer such as Parquet need; the writer is not used after
+	Close() error
+}
+
+// NewRecordWriter returns a RecordWriter for format writing to w, adding
+// the test's tags to every record. The CSV header is written first. An
+// empty format means CSV.
+func NewRecordWriter(w io.Writer, format string, tags map[string]string) (RecordWriter, error) {
+	switch strings.ToLower(format) {
+	case "", config.FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(CSVHeader)
+		return &csvRecords{w: cw, tags: FormatTags(tags, ";")}, nil
+	case config.FormatJSONL:
+		bw := bufio.NewWriter(w)
+		return jsonlRecords{bw, json.NewEncoder(bw), tags}, nil
+	case config.FormatParquet:
+		return &parquetRecords{w: parquet.NewGenericWriter[jsonRecord](w, parquet.Compression(&parquet.Zstd)), tags: tags}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q (want csv, jsonl or parquet)", format)
+}
+
+// RecordExtension returns the file extension for records in format
+func RecordExtension(format string) string {
+	switch strings.ToLower(format) {
+	case config.FormatJSONL:
+		return ".jsonl"
+	case config.FormatParquet:
+		return ".parquet"
+	}
+	return ".csv"
+}
+
+type csvRecords struct {
+	w      *csv.Writer
+	tags   string
+	record []string // reused by every Write, which the csv.Writer copies out of
+}
+
+func (c *csvRecords) Write(run int, r metrics.Result) error {
+	c.record = appendCSVRecord(c.record[:0], run, r, c.tags)
+	return c.w.Write(c.record)
+}
+
+func (c *csvRecords) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvRecords) Close() error {
+	return c.Flush()
+}
+
+type jsonlRecords struct {
+	w    *bufio.Writer
+	enc  *json.Encoder
+	tags map[string]string
+}
+
+func (j jsonlRecords) Write(run int, r metrics.Result) error {
+	return j.enc.Encode(newJSONRecord(run, r, j.tags))
+}
+
+func (j jsonlRecords) Flush() error {
+	return j.w.Flush()
+}
+
+func (j jsonlRecords) Close() error {
+	return j.Flush()
+}
+
+// parquetRecords writes the columns of jsonRecord, compressed with zstd.
+// Every Flush ends a row group, so each run of a test is one.
+type parquetRecords struct {
+	w    *parquet.GenericWriter[jsonRecord]
+	tags map[string]string
+	rows [1]jsonRecord
+}
+
+func (p *parquetRecords) Write(run int, r metrics.Result) error {
+	p.rows[0] = newJSONRecord(run, r, p.tags)
+	_, err := p.w.Write(p.rows[:])
+	return err
+}
+
+func (p *parquetRecords) Flush() error {
+	return p.w.Flush()
+}
+
+func (p *parquetRecords) Close() error {
+	return p.w.Close()
+}
+
+// jsonRecord is the JSONL and Parquet form of a result. Durations are
+// milliseconds with microsecond precision; fields that do not apply are
+// left out of JSONL, and null or empty in Parquet.
+type jsonRecord struct {
+	Run           int               `json:"run" parquet:"run"`
+	RequestID     int               `json:"request_id" parquet:"request_id"`
+	Timestamp     time.Time         `json:"timestamp" parquet:"timestamp,timestamp(nanosecond)"`
+	Endpoint      string            `json:"endpoint" parquet:"endpoint,dict"`
+	Status        int               `json:"status" parquet:"status"`
+	Protocol      string            `json:"protocol,omitempty" parquet:"protocol,dict"`
+	ErrorType     string            `json:"error_type,omitempty" parquet:"error_type,dict"`
+	Error         string            `json:"error,omitempty" parquet:"error,dict"`
+	DurationMs    float64           `json:"duration_ms" parquet:"duration_ms"`
+	AttemptMs     *float64          `json:"attempt_duration_ms" parquet:"attempt_duration_ms,optional"` // of the last attempt alone, nil in older reports
+	Retries       int               `json:"retries" parquet:"retries"`
+	DNSMs         float64           `json:"dns_ms" parquet:"dns_ms"`
+	ConnectMs     float64           `json:"connect_ms" parquet:"connect_ms"`
+	TLSMs         float64           `json:"tls_ms" parquet:"tls_ms"`
+	TTFBMs        float64           `json:"ttfb_ms" parquet:"ttfb_ms"`
+	TransferMs    float64           `json:"transfer_ms" parquet:"transfer_ms"`
+	QUICMs        float64           `json:"quic_ms,omitempty" parquet:"quic_ms"`
+	Warmup        bool              `json:"warmup" parquet:"warmup"`
+	Attempts      []jsonAttempt     `json:"attempts,omitempty" parquet:"attempts,list"`
+	TLSVersion    string            `json:"tls_version,omitempty" parquet:"tls_version,dict"`
+	TLSCipher     string            `json:"tls_cipher,omitempty" parquet:"tls_cipher,dict"`
+	IPFamily      string            `json:"ip_family,omitempty" parquet:"ip_family,dict"`
+	NewConn       bool              `json:"new_conn" parquet:"new_conn"`
+	TLSHandshake  bool              `json:"tls_handshake" parquet:"tls_handshake"`
+	SendDelayMs   *float64          `json:"send_delay_ms,omitempty" parquet:"send_delay_ms,optional"`
+	BytesSent     int64             `json:"bytes_sent" parquet:"bytes_sent"`
+	BytesReceived int64             `json:"bytes_received" parquet:"bytes_received"`
+	GRPCStatus    string            `json:"grpc_status,omitempty" parquet:"grpc_status,dict"`
+	DNSRcode      string            `json:"dns_rcode,omitempty" parquet:"dns_rcode,dict"`
+	Redirects     []jsonRedirect    `json:"redirects,omitempty" parquet:"redirects,list"`
+	Tags          map[string]string `json:"tags,omitempty" parquet:"tags"`
+}
+
+type jsonRedirect struct {
+	Status     int     `json:"status" parquet:"status"`
+	URL        string  `json:"url" parquet:"url"`
+	DurationMs float64 `json:"duration_ms" parquet:"duration_ms"`
+}
+
+type jsonAttempt struct {
+	Attempt    int     `json:"attempt" parquet:"attempt"`
+	Status     int     `json:"status" parquet:"status"`
+	ErrorType  string  `json:"error_type,omitempty" parquet:"error_type,dict"` // empty when the attempt succeeded
+	DurationMs float64 `json:"duration_ms" parquet:"duration_ms"`
+	BackoffMs  float64 `json:"backoff_ms" parquet:"backoff_ms"`
+}
+
+func newJSONRecord(run int, r metrics.Result, tags map[string]string) jsonRecord {
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	rec := jsonRecord{
+		Run:           run,
+		RequestID:     r.RequestID,
+		Timestamp:     r.Timestamp,
+		Endpoint:      r.Endpoint,
+		Status:        r.Status,
+		Protocol:      r.Proto,
+		ErrorType:     r.ErrorType,
+		Error:         r.Error,
+		DurationMs:    ms(r.Duration),
+		Retries:       r.Retries,
+		DNSMs:         ms(r.Phases.DNS),
+		ConnectMs:     ms(r.Phases.Connect),
+		TLSMs:         ms(r.Phases.TLS),
+		TTFBMs:        ms(r.Phases.TTFB),
+		TransferMs:    ms(r.Phases.Transfer),
+		QUICMs:        ms(r.Phases.QUIC),
+		Warmup:        r.Warmup,
+		TLSVersion:    r.TLSVersion,
+		TLSCipher:     r.TLSCipher,
+		IPFamily:      r.IPFamily,
+		NewConn:       r.NewConn,
+		TLSHandshake:  r.TLSHandshake,
+		BytesSent:     r.BytesSent,
+		BytesReceived: r.BytesReceived,
+		GRPCStatus:    r.GRPCStatus,
+		DNSRcode:      r.DNSRcode,
+		Tags:          tags,
+	}
+	for _, a := range r.Attempts {
+		rec.Attempts = append(rec.Attempts, jsonAttempt{a.Number, a.Status, a.ErrorType, ms(a.Duration), ms(a.Backoff)})
+	}
+	for _, h := range r.Redirects {
+		rec.Redirects = append(rec.Redirects, jsonRedirect{h.Status, maskURL(h.URL), ms(h.Duration)})
+	}
+	attempt := ms(r.AttemptDuration)
+	rec.AttemptMs = &attempt
+	if !r.Scheduled.IsZero() {
+		delay := ms(max(0, r.Timestamp.Sub(r.Scheduled)))
+		rec.SendDelayMs = &delay
+	}
+	return rec
+}
@@ -0,0 +1,83 @@
+package report
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"LoadTester/metrics"
+)
+
+func TestParquetRecords(t *testing.T) {
+	start := time.Date(2026, 10, 16, 1, 30, 44, 373512363, time.UTC)
+	runs := [][]metrics.Result{
+		{
+			{RequestID: 1, Timestamp: start, Scheduled: start.Add(-time.Millisecond), Endpoint: "GET /", Status: 200, Proto: "HTTP/2.0",
+				Duration: 14 * time.Millisecond, AttemptDuration: 14 * time.Millisecond, NewConn: true, BytesSent: 125, BytesReceived: 213,
+				Phases: metrics.Phases{Connect: 200 * time.Microsecond, TTFB: 13 * time.Millisecond}},
+			{RequestID: 2, Timestamp: start.Add(time.Second), Endpoint: "GET /", Status: 200, Retries: 1,
+				Duration: 130 * time.Millisecond, AttemptDuration: 20 * time.Millisecond,
+				Attempts: []metrics.Attempt{
+					{Number: 1, Status: 503, ErrorType: metrics.ErrTypeHTTP5xx, Duration: 10 * time.Millisecond, Backoff: 100 * time.Millisecond},
+					{Number: 2, Status: 200, Duration: 20 * time.Millisecond},
+				},
+				Redirects: []metrics.Redirect{{Status: 302, URL: "http://localhost/old", Duration: time.Millisecond}}},
+		},
+		{
+			{RequestID: 1, Timestamp: start.Add(time.Minute), Endpoint: "POST /orders", ErrorType: metrics.ErrTypeTimeout, Error: "timeout",
+				Duration: time.Second, AttemptDuration: time.Second},
+		},
+	}
+	tags := map[string]string{"env": "staging"}
+	path := filepath.Join(t.TempDir(), "results"+RecordExtension("parquet"))
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := NewRecordWriter(f, "parquet", tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []jsonRecord
+	for i, results := range runs {
+		for _, r := range results {
+			if err := records.Write(i+1, r); err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, newJSONRecord(i+1, r, tags))
+		}
+		if err := records.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := records.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// The rows read back are the JSONL records
+	f, _ = os.Open(path)
+	defer f.Close()
+	info, _ := f.Stat()
+	got, err := parquet.Read[jsonRecord](f, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("records read back =\n%s\nwant\n%s", gotJSON, wantJSON)
+	}
+
+	stats, err := ReadRuns(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[0].Success != 2 || stats[1].Failed != 1 {
+		t.Fatalf("ReadRuns = %d runs, want 2 successes then 1 failure", len(stats))
+	}
+}
@@ -0,0 +1,324 @@
+// Package report renders the results of a load test: the text summaries
+// printed after each run, the per-request CSV and the HTML report, and reads
+// per-request reports back to compare tests.
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+// PrintRunSummary prints the end-of-run report for one run
+func PrintRunSummary(w io.Writer, cfg *config.Config, stats *metrics.RunStats) {
+	fmt.Fprintf(w, "Run %d completed: Requests=%d, Success=%d, Failed=%d, Time=%.2fs\n",
+		stats.Run, stats.Sent, stats.Success, stats.Failed, stats.Duration.Seconds())
+	if stats.Warmup > 0 {
+		fmt.Fprintf(w, "Warm-up: %d requests sent before measuring, not included below\n", stats.Warmup)
+	}
+	if stats.Iterations > 0 {
+		fmt.Fprintf(w, "Scenario iterations: %d, completed=%d, aborted=%d\n",
+			stats.Iterations, stats.Iterations-stats.FailedIterations, stats.FailedIterations)
+	}
+	switch {
+	case cfg.Pattern == config.PatternSpike:
+		fmt.Fprintf(w, "Throughput: %.2f req/s (baseline %.2f req/s, spike %.2f req/s)\n", stats.Throughput(), cfg.Rate, cfg.SpikeRate)
+	case len(cfg.Stages) > 0:
+		fmt.Fprintf(w, "Throughput: %.2f req/s (staged profile %s)\n", stats.Throughput(), config.FormatStages(cfg.Stages))
+	case cfg.Rate > 0:
+		fmt.Fprintf(w, "Throughput: %.2f req/s (target %.2f req/s)\n", stats.Throughput(), cfg.Rate)
+	default:
+		fmt.Fprintf(w, "Throughput: %.2f req/s\n", stats.Throughput())
+	}
+	fmt.Fprintf(w, "Latency(ms): p50=%d, p90=%d, p99=%d, p99.9=%d, max=%d\n", stats.Percentile(0.50), stats.Percentile(0.90),
+		stats.Percentile(0.99), stats.Percentile(0.999), stats.Latency.Max().Milliseconds())
+	if stats.Retries > 0 {
+		// Retried requests take longer than any one of their attempts
+		a := stats.LastAttempt
+		fmt.Fprintf(w, "Last attempt latency(ms), without retries and backoffs: p50=%d, p90=%d, p99=%d, p99.9=%d, max=%d\n",
+			a.Quantile(0.50).Milliseconds(), a.Quantile(0.90).Milliseconds(), a.Quantile(0.99).Milliseconds(),
+			a.Quantile(0.999).Milliseconds(), a.Max().Milliseconds())
+	}
+	if n := stats.SendDelay.Count(); n > 0 {
+		c := stats.Corrected
+		fmt.Fprintf(w, "Corrected latency(ms), from scheduled send: p50=%d, p90=%d, p99=%d, p99.9=%d, max=%d\n",
+			c.Quantile(0.50).Milliseconds(), c.Quantile(0.90).Milliseconds(), c.Quantile(0.99).Milliseconds(),
+			c.Quantile(0.999).Milliseconds(), c.Max().Milliseconds())
+		fmt.Fprintf(w, "Send delay(ms): p50=%s, p99=%s, max=%s, late (>%s)=%d\n", fmtMillis(stats.SendDelay.Quantile(0.50)),
+			fmtMillis(stats.SendDelay.Quantile(0.99)), fmtMillis(stats.SendDelay.Max()), metrics.LateSend, stats.LateSends)
+		if stats.FellBehind() {
+			fmt.Fprintf(w, "Warning: the load generator fell behind its schedule: %d of %d requests were sent more than %s late, so it limited the rate; the corrected latency includes the delay\n",
+				stats.LateSends, n, metrics.LateSend)
+		}
+	}
+	ph := stats.Phases.Mean()
+	var quic string
+	if ph.QUIC > 0 {
+		quic = ", quic=" + fmtMillis(ph.QUIC)
+	}
+	fmt.Fprintf(w, "Phases(ms, mean): dns=%s, connect=%s, tls=%s, ttfb=%s, transfer=%s%s\n",
+		fmtMillis(ph.DNS), fmtMillis(ph.Connect), fmtMillis(ph.TLS), fmtMillis(ph.TTFB), fmtMillis(ph.Transfer), quic)
+	if stats.BytesSent > 0 || stats.BytesReceived > 0 {
+		sent, received := stats.Bandwidth()
+		fmt.Fprintf(w, "Data: sent %s (%s/s), received %s (%s/s)\n", formatBytes(float64(stats.BytesSent)), formatBytes(sent),
+			formatBytes(float64(stats.BytesReceived)), formatBytes(received))
+	}
+	if stats.NewConns > 0 {
+		fmt.Fprintf(w, "Connections opened: %d, TLS handshakes: %d\n", stats.NewConns, stats.TLSHandshakes)
+	}
+	if g := stats.Generator; g.CPUs > 0 {
+		fmt.Fprintf(w, "Generator: %s, goroutines peak %d, sockets peak %s, GC %d pauses (total %sms, max %sms), scheduling lag max %sms (mean %sms)\n",
+			formatCPU(g), g.PeakGoroutines, formatKnown(g.PeakSockets), g.GCs, fmtMillis(g.GCPauseTotal), fmtMillis(g.GCPauseMax),
+			fmtMillis(g.LagMax), fmtMillis(g.LagMean))
+		if reason := g.Busy(); reason != "" {
+			fmt.Fprintf(w, "Warning: the load generator may have been the bottleneck, not the target: %s\n", reason)
+		}
+	}
+	fmt.Fprintf(w, "Status codes: %s\n", formatStatusCodes(stats))
+	if len(stats.GRPCStatus) > 0 {
+		fmt.Fprintf(w, "gRPC status: %s\n", formatCounts(stats.GRPCStatus))
+	}
+	if len(stats.DNSRcodes) > 0 {
+		fmt.Fprintf(w, "DNS rcodes: %s\n", formatCounts(stats.DNSRcodes))
+	}
+	if n := stats.RedirectCount(); n > 0 {
+		fmt.Fprintf(w, "Redirects: %d followed (%s), mean %sms per hop\n", n, formatCounts(stats.Redirects),
+			fmtMillis(stats.RedirectTime/time.Duration(n)))
+	}
+	if len(stats.Protocols) > 0 {
+		fmt.Fprintf(w, "Protocols: %s\n", formatCounts(stats.Protocols))
+	}
+	if len(stats.IPFamilies) > 0 {
+		fmt.Fprintf(w, "IP families: %s\n", formatCounts(stats.IPFamilies))
+	}
+	if len(stats.Encodings) > 0 {
+		fmt.Fprintf(w, "Content encodings: %s\n", formatCounts(stats.Encodings))
+	}
+	if ratio := stats.CompressionRatio(); ratio > 0 {
+		fmt.Fprintf(w, "Decompressed: %s received as %s, ratio %.2fx\n", formatBytes(float64(stats.DecodedBytes)),
+			formatBytes(float64(stats.EncodedBytes)), ratio)
+	}
+	if len(stats.TLS) > 0 {
+		fmt.Fprintf(w, "TLS: %s\n", formatCounts(stats.TLS))
+	}
+	if stats.Failed > 0 {
+		fmt.Fprintf(w, "Errors by type: %s\n", formatCounts(stats.ErrorTypes))
+	}
+	if stats.Retries > 0 {
+		fmt.Fprintf(w, "Retries: %d (%s)\n", stats.Retries, formatCounts(stats.RetryReasons))
+	}
+	if stats.BreakerTrips > 0 {
+		fmt.Fprintf(w, "Circuit breaker tripped %d time(s)\n", stats.BreakerTrips)
+	}
+	if stats.RateBackoffs > 0 {
+		fmt.Fprintf(w, "Adaptive rate: backed off %d time(s), sustainable rate %.1f req/s\n", stats.RateBackoffs, stats.SustainableRate)
+	}
+	if stats.Aborted != "" {
+		fmt.Fprintf(w, "Run aborted: %s\n", stats.Aborted)
+	}
+	if stats.RetriesDenied > 0 {
+		fmt.Fprintf(w, "Retry budget exhausted: %d failures not retried\n", stats.RetriesDenied)
+	}
+}
+
+// formatCPU describes the share of CPU the generator used
+func formatCPU(g metrics.GeneratorStats) string {
+	if g.CPU < 0 {
+		return fmt.Sprintf("CPU n/a (%d CPUs)", g.CPUs)
+	}
+	return fmt.Sprintf("CPU %.0f%% of %d CPUs", g.CPU*100, g.CPUs)
+}
+
+// formatKnown formats a count that is -1 when unknown
+func formatKnown(n int) string {
+	if n < 0 {
+		return "n/a"
+	}
+	return strconv.Itoa(n)
+}
+
+// sortedByCount returns the keys of counts, most frequent first
+func sortedByCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// formatCounts renders counts on one line, most frequent first
+func formatCounts(counts map[string]int) string {
+	var parts []string
+	for _, k := range sortedByCount(counts) {
+		parts = append(parts, fmt.Sprintf("%s=%d", k, counts[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sortedStatusCodes returns the status codes seen in ascending order
+func sortedStatusCodes(stats *metrics.RunStats) []int {
+	codes := make([]int, 0, len(stats.StatusCodes))
+	for code := range stats.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	return codes
+}
+
+// formatStatusCodes renders the status distribution on one line, e.g.
+// "200=950, 429=30, 503=12, no response=8"
+func formatStatusCodes(stats *metrics.RunStats) string {
+	var parts []string
+	for _, code := range sortedStatusCodes(stats) {
+		parts = append(parts, fmt.Sprintf("%d=%d", code, stats.StatusCodes[code]))
+	}
+	if stats.NoResponse > 0 {
+		parts = append(parts, fmt.Sprintf("no response=%d", stats.NoResponse))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// PrintStatusTable prints the status distribution as a table with shares
+// of the total
+func PrintStatusTable(w io.Writer, stats *metrics.RunStats) {
+	total := stats.NoResponse
+	for _, n := range stats.StatusCodes {
+		total += n
+	}
+	if total == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Status code distribution (all runs):")
+	fmt.Fprintf(w, "  %-12s %10s %8s\n", "Status", "Count", "Share")
+	row := func(label string, n int) {
+		fmt.Fprintf(w, "  %-12s %10d %7.2f%%\n", label, n, 100*float64(n)/float64(total))
+	}
+	for _, code := range sortedStatusCodes(stats) {
+		row(fmt.Sprint(code), stats.StatusCodes[code])
+	}
+	if stats.NoResponse > 0 {
+		row("no response", stats.NoResponse)
+	}
+}
+
+// PrintErrorTable prints failures by category with the most common message
+// seen for each category
+func PrintErrorTable(w io.Writer, stats *metrics.RunStats) {
+	if stats.Failed == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Errors by type (all runs):")
+	fmt.Fprintf(w, "  %-20s %10s %8s\n", "Type", "Count", "Share")
+	for _, typ := range sortedByCount(stats.ErrorTypes) {
+		n := stats.ErrorTypes[typ]
+		fmt.Fprintf(w, "  %-20s %10d %7.2f%%\n", typ, n, 100*float64(n)/float64(stats.Failed))
+	}
+	fmt.Fprintln(w, "Most frequent error messages:")
+	for i, msg := range sortedByCount(stats.Errors) {
+		if i == 5 {
+			break
+		}
+		fmt.Fprintf(w, "  %6d  %s\n", stats.Errors[msg], msg)
+	}
+}
+
+// sortedEndpoints returns the endpoint names, busiest first, or in step
+// order for a scenario
+func sortedEndpoints(cfg *config.Config, s *metrics.RunStats) []string {
+	if len(cfg.Scenario) > 0 {
+		var names []string
+		for _, step := range cfg.Scenario {
+			if _, ok := s.Endpoints[step.Name]; ok {
+				names = append(names, step.Name)
+			}
+		}
+		return names
+	}
+	counts := map[string]int{}
+	for name, e := range s.Endpoints {
+		counts[name] = e.Requests
+	}
+	return sortedByCount(counts)
+}
+
+// PrintEndpointTable prints per-endpoint or per-step results when more
+// than one endpoint was targeted
+func PrintEndpointTable(w io.Writer, cfg *config.Config, stats *metrics.RunStats) {
+	if len(stats.Endpoints) < 2 {
+		return
+	}
+	fmt.Fprintln(w, "Endpoints (all runs):")
+	fmt.Fprintf(w, "  %-32s %10s %8s %9s %8s %8s %8s %8s %8s\n", "Endpoint", "Count", "Share", "req/s", "Failed", "Errors",
+		"p50(ms)", "p95(ms)", "p99(ms)")
+	total := 0
+	for _, e := range stats.Endpoints {
+		total += e.Requests
+	}
+	for _, name := range sortedEndpoints(cfg, stats) {
+		e := stats.Endpoints[name]
+		ms := func(q float64) int64 { return e.Latency.Quantile(q).Milliseconds() }
+		fmt.Fprintf(w, "  %-32s %10d %7.2f%% %9.2f %8d %8s %8d %8d %8d\n", name, e.Requests,
+			100*float64(e.Requests)/float64(total), e.Throughput(stats.Duration), e.Failed, formatPercent(e.ErrorRate()),
+			ms(0.50), ms(0.95), ms(0.99))
+	}
+}
+
+// PrintThresholds prints PASS/FAIL for every threshold result
+func PrintThresholds(w io.Writer, results []metrics.ThresholdResult) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Thresholds:")
+	for _, r := range results {
+		status := "PASS"
+		if !r.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "  %s  %-24s actual %s\n", status, r.Threshold, r.Actual)
+	}
+}
+
+// FormatTags renders tags as key=value pairs sorted by key, joined by sep
+func FormatTags(tags map[string]string, sep string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + tags[k]
+	}
+	return strings.Join(pairs, sep)
+}
+
+// fmtMillis formats a duration as fractional milliseconds
+// formatBytes renders a byte count in decimal units, e.g. "12.35 MB"
+func formatBytes(n float64) string {
+	for _, unit := range []string{"B", "kB", "MB", "GB"} {
+		if n < 1000 || unit == "GB" {
+			return strconv.FormatFloat(n, 'f', 2, 64) + " " + unit
+		}
+		n /= 1000
+	}
+	return ""
+}
+
+func fmtMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
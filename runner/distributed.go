@@ -0,0 +1,399 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+	"LoadTester/report"
+)
+
+// Distributed mode: "loadtester agent" runs on each load generator and
+// waits for work. A coordinator started with -agents posts every agent its
+// share of the load for each run, then merges the returned stats into one
+// summary and report. Agents and coordinator share a token, sent as a
+// bearer token with every request but the health check.
+
+// agentJob is the body of a POST /run request to an agent
+type agentJob struct {
+	Run    int             `json:"run"`
+	Config json.RawMessage `json:"config"` // Config settings, not yet resolved
+}
+
+// NewAgent returns the HTTP handler of an agent, accepting work only from
+// coordinators sending token. Each job's per-request CSV is written to
+// reportDir and its progress to out.
+func NewAgent(token, reportDir string, out io.Writer) http.Handler {
+	var busy atomic.Bool
+	var active atomic.Pointer[Runner] // job in progress, if any
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "missing or wrong agent token", http.StatusUnauthorized)
+				return
+			}
+			h(w, r)
+		})
+	}
+	// Pausing an idle agent does nothing: the coordinator holds back the
+	// next job itself
+	handle("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		if rn := active.Load(); rn != nil && rn.Pause() {
+			fmt.Fprintln(out, "Paused by the coordinator")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handle("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		if rn := active.Load(); rn != nil && rn.Resume() {
+			fmt.Fprintln(out, "Resumed by the coordinator")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handle("POST /run", func(w http.ResponseWriter, r *http.Request) {
+		if !busy.CompareAndSwap(false, true) {
+			http.Error(w, "agent is busy with another run", http.StatusConflict)
+			return
+		}
+		defer busy.Store(false)
+		var job agentJob
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			http.Error(w, "invalid job: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		stats, err := runAgentJob(r.Context(), job, reportDir, out, &active)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+	})
+	return mux
+}
+
+// runAgentJob resolves the job's settings locally, on top of the defaults,
+// and runs them, writing the per-request report to reportDir. The run stops
+// early if the coordinator goes away. The job's runner is stored in active
+// while it runs.
+func runAgentJob(ctx context.Context, job agentJob, reportDir string, out io.Writer, active *atomic.Pointer[Runner]) (*metrics.RunStats, error) {
+	cfg := config.Default()
+	if err := config.Decode(job.Config, false, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	cfg.ReportDir = reportDir
+	r, err := New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	r.Out = out
+	if err := r.plan.RaiseOpenFiles(); err != nil {
+		return nil, err
+	}
+
+	os.MkdirAll(reportDir, 0755)
+	timestamp := time.Now().Format("20060102_150405")
+	fileName := fmt.Sprintf("%s/results_%s_run%d%s", reportDir, timestamp, job.Run, report.RecordExtension(cfg.Format))
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	records, err := report.NewRecordWriter(file, cfg.Format, cfg.Tags)
+	if err != nil {
+		return nil, err
+	}
+	var captureName string
+	if cfg.Capture {
+		captureName = fmt.Sprintf("%s/capture_%s_run%d.jsonl", reportDir, timestamp, job.Run)
+		captures, err := os.Create(captureName)
+		if err != nil {
+			return nil, err
+		}
+		defer captures.Close()
+		records = recordWriters{records, report.NewCaptureWriter(captures, cfg.AuthHeaderName())}
+	}
+	var failuresName string
+	if cfg.Failures {
+		failuresName = fmt.Sprintf("%s/failures_%s_run%d.jsonl", reportDir, timestamp, job.Run)
+		failures, err := os.Create(failuresName)
+		if err != nil {
+			return nil, err
+		}
+		defer failures.Close()
+		records = recordWriters{records, report.NewFailureWriter(failures, cfg.AuthHeaderName())}
+	}
+	active.Store(r)
+	defer active.Store(nil)
+	stats := r.runLocal(ctx, job.Run, metrics.NewLive(), records)
+	if err := records.Close(); err != nil {
+		slog.Error("failed to write the per-request report", "err", err)
+	}
+	fmt.Fprintf(out, "Report saved to: %s\n", fileName)
+	if captureName != "" {
+		fmt.Fprintf(out, "Captured requests saved to: %s\n", captureName)
+	}
+	if failuresName != "" {
+		fmt.Fprintf(out, "Failed requests saved to: %s\n", failuresName)
+	}
+	if cfg.UploadTo != "" {
+		// Agents upload under their own name so their reports, named
+		// alike, do not overwrite each other
+		file.Close()
+		hostname, _ := os.Hostname()
+		cfg.UploadTo = strings.TrimRight(cfg.UploadTo, "/") + "/" + hostname
+		for _, location := range uploadReports(&cfg, fileName, captureName, failuresName) {
+			fmt.Fprintf(out, "Report uploaded to: %s\n", location)
+		}
+	}
+	return stats, nil
+}
+
+// agentClient sends the health checks and signals, which agents answer
+// at once; an agent that accepts the connection but never replies fails
+// them rather than holding up the test
+var agentClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+		ResponseHeaderTimeout: 10 * time.Second,
+	},
+}
+
+// runAgents runs one test run on all agents at once and combines their
+// results
+func (r *Runner) runAgents(ctx context.Context, run int) (*metrics.RunStats, error) {
+	cfg := &r.cfg
+	// Fail before any agent starts rather than running a partial load
+	for _, addr := range cfg.Agents {
+		resp, err := agentClient.Get(agentURL(addr) + "/health")
+		if err != nil {
+			return nil, fmt.Errorf("agent %s: %w", addr, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("agent %s: health check returned %s", addr, resp.Status)
+		}
+	}
+	fmt.Fprintf(r.out(), "Starting test run #%d on %d agents (%s)\n", run, len(cfg.Agents), workload(&r.plan.Config))
+	parts := make([]*metrics.RunStats, len(cfg.Agents))
+	errs := make([]error, len(cfg.Agents))
+	var wg sync.WaitGroup
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if limit := agentRunLimit(cfg, r.plan.Deadline()); limit > 0 {
+		go r.limitAgentRun(jobCtx, cancel, limit)
+	}
+	for i, addr := range cfg.Agents {
+		share := agentShare(*cfg, i, len(cfg.Agents))
+		if deadline := r.plan.Deadline(); !deadline.IsZero() {
+			// Agents get what is left of the test
+			share.MaxDuration = config.Duration(time.Until(deadline))
+		}
+		spec, err := json.Marshal(share)
+		if err != nil {
+			return nil, err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			parts[i], errs[i] = postAgentJob(jobCtx, addr, cfg.AgentToken, agentJob{Run: run, Config: spec})
+			if errs[i] != nil {
+				if cause := context.Cause(jobCtx); ctx.Err() == nil && cause != nil {
+					errs[i] = cause
+				}
+				errs[i] = fmt.Errorf("agent %s: %w", addr, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	stats := metrics.Combine(run, parts)
+	report.PrintRunSummary(r.out(), &r.plan.Config, stats)
+	return stats, nil
+}
+
+// agentReportTime is how long an agent may take after a run to write its
+// reports and answer
+var agentReportTime = time.Minute
+
+// agentRunLimit returns how long an agent may take to answer the job of a
+// run: the run's length, or what is left of the test before deadline, plus
+// the shutdown grace and agentReportTime. A run of a number of requests
+// without a deadline has no limit.
+func agentRunLimit(cfg *config.Config, deadline time.Time) time.Duration {
+	var length time.Duration
+	switch {
+	case !deadline.IsZero():
+		length = max(0, time.Until(deadline))
+	case cfg.Duration > 0 || len(cfg.Stages) > 0:
+		length = time.Duration(cfg.Duration + cfg.Warmup)
+		for _, st := range cfg.Stages {
+			length += time.Duration(st.Duration)
+		}
+	default:
+		return 0
+	}
+	return length + time.Duration(cfg.ShutdownGrace) + agentReportTime
+}
+
+// limitAgentRun cancels the jobs of a run that has not ended after limit,
+// counting only the time the test was not paused
+func (r *Runner) limitAgentRun(ctx context.Context, cancel context.CancelCauseFunc, limit time.Duration) {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for left := limit; ; {
+		select {
+		case <-tick.C:
+			if !r.Paused() {
+				left -= time.Second
+			}
+			if left <= 0 {
+				cancel(fmt.Errorf("no results within %s", limit))
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// postAgentJob sends a job to an agent and waits for its stats
+func postAgentJob(ctx context.Context, addr, token string, job agentJob) (*metrics.RunStats, error) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, agentURL(addr)+"/run", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var stats metrics.RunStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("reading results: %w", err)
+	}
+	return &stats, nil
+}
+
+// signalAgents posts a pause or resume to every agent. Failures are
+// reported to Out but do not stop the test.
+func (r *Runner) signalAgents(action string) {
+	for _, addr := range r.cfg.Agents {
+		req, err := http.NewRequest(http.MethodPost, agentURL(addr)+"/"+action, nil)
+		if err != nil {
+			fmt.Fprintf(r.out(), "Failed to %s agent %s: %v\n", action, addr, err)
+			continue
+		}
+		req.Header.Set("Authorization", "Bearer "+r.cfg.AgentToken)
+		resp, err := agentClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent {
+				err = fmt.Errorf("%s", resp.Status)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(r.out(), "Failed to %s agent %s: %v\n", action, addr, err)
+		}
+	}
+}
+
+// agentURL returns the base URL of an agent given as host:port or URL
+func agentURL(addr string) string {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return strings.TrimSuffix(addr, "/")
+}
+
+// agentShare returns the settings for agent i of n: request counts,
+// concurrency, connection caps, rates and stage targets are divided
+// between the agents, and outputs only the coordinator produces are
+// switched off
+func agentShare(cfg config.Config, i, n int) config.Config {
+	c := cfg.Clone()
+	if c.MaxConcurrency > 0 {
+		// The cap is on the whole test
+		c.Concurrency = min(c.Concurrency, c.MaxConcurrency)
+		c.MaxConcurrency = 0
+	}
+	share := func(v int) int {
+		q := v / n
+		if i < v%n {
+			q++
+		}
+		return q
+	}
+	c.Requests = share(c.Requests)
+	c.WarmupRequests = share(c.WarmupRequests)
+	c.Concurrency = max(1, share(c.Concurrency))
+	if c.MaxInFlight > 0 {
+		c.MaxInFlight = max(1, share(c.MaxInFlight))
+	}
+	if c.MaxConnsPerHost > 0 {
+		c.MaxConnsPerHost = max(1, share(c.MaxConnsPerHost))
+	}
+	if c.MaxConns > 0 {
+		c.MaxConns = max(1, share(c.MaxConns))
+	}
+	if c.StopErrors > 0 {
+		c.StopErrors = max(1, share(c.StopErrors))
+	}
+	if c.StepWorkers > 0 {
+		c.StepWorkers = max(1, share(c.StepWorkers))
+	}
+	c.Rate /= float64(n)
+	c.SpikeRate /= float64(n)
+	for j := range c.Stages {
+		c.Stages[j].Target /= float64(n)
+	}
+	c.Agents = nil
+	c.AgentToken = ""
+	c.HealthCheck = ""
+	c.RepeatCount = 1
+	c.Thresholds = nil
+	// The coordinator searches, sending each agent one rate per run
+	c.Search = false
+	c.MetricsAddr = ""
+	c.PprofAddr = ""
+	c.TUI = false
+	c.Progress = false
+	c.HTMLReport = false
+	c.LogRequests = false
+	// The coordinator reports the outcome
+	c.NotifyURL = ""
+	c.HistoryFile = ""
+	return c
+}
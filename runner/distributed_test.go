@@ -0,0 +1,209 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+func TestAgentRequiresToken(t *testing.T) {
+	agent := NewAgent("secret", t.TempDir(), io.Discard)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{name: "health is open", method: "GET", path: "/health", want: http.StatusOK},
+		{name: "run without token", method: "POST", path: "/run", want: http.StatusUnauthorized},
+		{name: "run with wrong token", method: "POST", path: "/run", token: "guess", want: http.StatusUnauthorized},
+		{name: "pause without token", method: "POST", path: "/pause", want: http.StatusUnauthorized},
+		{name: "resume without token", method: "POST", path: "/resume", want: http.StatusUnauthorized},
+		{name: "pause", method: "POST", path: "/pause", token: "secret", want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"run": 1, "config": {}}`))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			agent.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	// An agent started without a token accepts no work at all
+	req := httptest.NewRequest("POST", "/run", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	NewAgent("", t.TempDir(), io.Discard).ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status with an empty token = %d, want 401", rec.Code)
+	}
+}
+
+// TestAgentJobDefaults checks that settings a job leaves out take their
+// defaults on the agent rather than their zero values
+func TestAgentJobDefaults(t *testing.T) {
+	var methods []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+	}))
+	defer target.Close()
+
+	job, _ := json.Marshal(agentJob{Run: 1, Config: json.RawMessage(`{"url": "` + target.URL + `", "requests": 2}`)})
+	req := httptest.NewRequest("POST", "/run", bytes.NewReader(job))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	NewAgent("secret", t.TempDir(), io.Discard).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var stats metrics.RunStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Success != 2 {
+		t.Errorf("success = %d, want 2", stats.Success)
+	}
+	if len(methods) != 2 || methods[0] != http.MethodGet {
+		t.Errorf("target saw %v, want two GETs", methods)
+	}
+}
+
+func TestCoordinatorSendsToken(t *testing.T) {
+	t.Chdir(t.TempDir())
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	var mu sync.Mutex
+	seen := map[string]string{} // Authorization header by agent request
+	var agents []*httptest.Server
+	for range 2 {
+		agent := NewAgent("secret", t.TempDir(), io.Discard)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			seen[r.Host+r.URL.Path] = r.Header.Get("Authorization")
+			mu.Unlock()
+			agent.ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+		agents = append(agents, srv)
+	}
+
+	cfg := config.Default()
+	cfg.URL = target.URL
+	cfg.Requests = 4
+	cfg.Agents = []string{agents[0].URL, agents[1].URL}
+	cfg.AgentToken = "secret"
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Out = io.Discard
+	out, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Total.Success != 4 {
+		t.Errorf("success = %d, want 4", out.Total.Success)
+	}
+	// Each agent gets its share of the job with the token
+	for _, a := range agents {
+		host := strings.TrimPrefix(a.URL, "http://")
+		if got, ok := seen[host+"/run"]; !ok || got != "Bearer secret" {
+			t.Errorf("agent %s got a job with Authorization %q (sent %v)", host, got, ok)
+		}
+	}
+}
+
+func TestUnresponsiveAgent(t *testing.T) {
+	t.Chdir(t.TempDir())
+	// Health checks and signals fail fast; the job waits for the run
+	client, reportTime := agentClient, agentReportTime
+	agentClient = &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: 100 * time.Millisecond}}
+	agentReportTime = 0
+	defer func() { agentClient, agentReportTime = client, reportTime }()
+
+	tests := []struct {
+		name  string
+		hangs string // path the agent never answers
+		jobs  int    // sent to the agent
+	}{
+		// No job goes to an agent that failed its health check
+		{name: "health", hangs: "/health"},
+		{name: "run", hangs: "/run", jobs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hung := make(chan struct{})
+			// Whether the coordinator gave up on the hung request
+			abandoned := make(chan bool, 1)
+			runs := 0
+			agent := NewAgent("secret", t.TempDir(), io.Discard)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/run" {
+					runs++
+				}
+				if r.URL.Path == tt.hangs {
+					// With the body read, the server notices the
+					// coordinator closing the connection
+					io.Copy(io.Discard, r.Body)
+					select {
+					case <-r.Context().Done():
+						abandoned <- true
+					case <-hung:
+						abandoned <- false
+					}
+					return
+				}
+				agent.ServeHTTP(w, r)
+			}))
+			defer srv.Close()
+			defer close(hung)
+
+			cfg := config.Default()
+			cfg.URL = "http://localhost"
+			cfg.Duration = config.Duration(time.Second)
+			cfg.ShutdownGrace = 0
+			cfg.Agents = []string{srv.URL}
+			cfg.AgentToken = "secret"
+			r, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Out = io.Discard
+			start := time.Now()
+			if _, err := r.Run(context.Background()); err == nil {
+				t.Error("the run succeeded without the agent")
+			}
+			if d := time.Since(start); d > 5*time.Second {
+				t.Errorf("the coordinator waited %s for the agent", d)
+			}
+			select {
+			case ok := <-abandoned:
+				if !ok {
+					t.Errorf("the coordinator kept its %s request open", tt.hangs)
+				}
+			case <-time.After(5 * time.Second):
+				t.Errorf("the coordinator kept its %s request open", tt.hangs)
+			}
+			if runs != tt.jobs {
+				t.Errorf("agent got %d jobs, want %d", runs, tt.jobs)
+			}
+		})
+	}
+}
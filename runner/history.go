@@ -0,0 +1,67 @@
+package runner
+
+import (
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/report"
+)
+
+// recordHistory adds the outcome of the test to cfg.HistoryFile. The
+// test is over, so a failure is only logged.
+func recordHistory(cfg *config.Config, rep *Report) {
+	total := rep.Total
+	e := report.HistoryEntry{
+		Time:        time.Now().UTC(),
+		Test:        cfg.TestName,
+		Commit:      gitCommit(cfg),
+		Target:      targetHost(cfg),
+		Runs:        len(rep.Runs),
+		Requests:    total.Sent,
+		Failed:      total.Failed,
+		ErrorRate:   total.ErrorRate(),
+		Throughput:  total.Throughput(),
+		P50Ms:       total.Percentile(0.50),
+		P90Ms:       total.Percentile(0.90),
+		P95Ms:       total.Percentile(0.95),
+		P99Ms:       total.Percentile(0.99),
+		MaxMs:       total.Latency.Max().Milliseconds(),
+		DurationS:   rep.Duration.Seconds(),
+		Passed:      rep.Passed,
+		Interrupted: rep.Interrupted,
+		Aborted:     rep.Aborted,
+		Tags:        cfg.Tags,
+	}
+	if e.Test == "" {
+		// Profiles of one file test the same target very differently
+		e.Test = e.Target
+		if cfg.Profile != "" {
+			e.Test += " " + cfg.Profile
+		}
+	}
+	if err := report.AppendHistory(cfg.HistoryFile, e); err != nil {
+		slog.Error("failed to write the history", "err", err)
+	}
+}
+
+// gitCommit returns the commit under test: GIT_COMMIT, the commit a CI
+// job runs for, or the HEAD of the git checkout in the working directory
+func gitCommit(cfg *config.Config) string {
+	if cfg.GitCommit != "" {
+		return cfg.GitCommit
+	}
+	for _, env := range []string{"GITHUB_SHA", "CI_COMMIT_SHA"} {
+		if sha := os.Getenv(env); sha != "" {
+			return sha
+		}
+	}
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,225 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+	"LoadTester/report"
+)
+
+// failWindow is how far back the error rate is measured for a failing
+// alert, and failMinRequests how many requests it needs to be meaningful
+const (
+	failWindow      = 30 * time.Second
+	failMinRequests = 20
+)
+
+// notification is the JSON body posted to NOTIFY_URL. Slack incoming
+// webhooks get only the text.
+type notification struct {
+	Event       string            `json:"event"` // "failing" or "finished"
+	Text        string            `json:"text"`
+	Target      string            `json:"target"`
+	Run         int               `json:"run,omitempty"`
+	Passed      *bool             `json:"passed,omitempty"`
+	Interrupted bool              `json:"interrupted,omitempty"`
+	Aborted     string            `json:"aborted,omitempty"`
+	Requests    int               `json:"requests"`
+	Failed      int               `json:"failed"`
+	ErrorRate   float64           `json:"error_rate"`
+	Throughput  float64           `json:"throughput,omitempty"` // requests per second
+	P50Ms       int64             `json:"p50_ms,omitempty"`
+	P95Ms       int64             `json:"p95_ms,omitempty"`
+	P99Ms       int64             `json:"p99_ms,omitempty"`
+	Thresholds  []notifyThreshold `json:"thresholds,omitempty"`
+	Reports     []string          `json:"reports,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+type notifyThreshold struct {
+	Threshold string `json:"threshold"`
+	Actual    string `json:"actual"`
+	Passed    bool   `json:"passed"`
+}
+
+// checkNotify validates the webhook settings
+func checkNotify(cfg *config.Config) error {
+	if cfg.NotifyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(cfg.NotifyURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("notify_url must be an http or https URL, got %q", cfg.NotifyURL)
+	}
+	if cfg.NotifyErrorRate < 0 || cfg.NotifyErrorRate > 1 {
+		return fmt.Errorf("notify_error_rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// postNotification sends n to the webhook
+func postNotification(ctx context.Context, webhook string, n notification) error {
+	var payload any = n
+	if u, err := url.Parse(webhook); err == nil && u.Host == "hooks.slack.com" {
+		payload = map[string]string{"text": n.Text}
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.SetEscapeHTML(false) // thresholds are written with < and >
+	if err := enc.Encode(payload); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// notifyFinished announces the outcome of the test. The test is over, so
+// a failure to post is only logged.
+func notifyFinished(cfg *config.Config, rep *Report) {
+	total := rep.Total
+	n := notification{
+		Event:       "finished",
+		Target:      targetHost(cfg),
+		Passed:      &rep.Passed,
+		Interrupted: rep.Interrupted,
+		Aborted:     rep.Aborted,
+		Requests:    total.Sent,
+		Failed:      total.Failed,
+		Throughput:  total.Throughput(),
+		P50Ms:       total.Percentile(0.50),
+		P95Ms:       total.Percentile(0.95),
+		P99Ms:       total.Percentile(0.99),
+		Reports:     rep.Uploaded,
+		Tags:        cfg.Tags,
+	}
+	if total.Sent > 0 {
+		n.ErrorRate = float64(total.Failed) / float64(total.Sent)
+	}
+	outcome := "passed"
+	switch {
+	case rep.Aborted != "":
+		outcome = "was aborted (" + rep.Aborted + ")"
+	case !rep.Passed:
+		outcome = "failed its thresholds"
+	case rep.Interrupted:
+		outcome = "was interrupted"
+	}
+	var text strings.Builder
+	fmt.Fprintf(&text, "Load test of %s %s: %d requests in %.1fs, %.2f%% failed, %.1f req/s, p50 %d ms, p95 %d ms, p99 %d ms",
+		n.Target, outcome, n.Requests, rep.Duration.Seconds(), n.ErrorRate*100, n.Throughput, n.P50Ms, n.P95Ms, n.P99Ms)
+	if len(cfg.Tags) > 0 {
+		fmt.Fprintf(&text, "\nTags: %s", report.FormatTags(cfg.Tags, ", "))
+	}
+	for _, t := range rep.Thresholds {
+		n.Thresholds = append(n.Thresholds, notifyThreshold{t.Threshold, t.Actual, t.Passed})
+		if !t.Passed {
+			fmt.Fprintf(&text, "\nFailed threshold %s (actual %s)", t.Threshold, t.Actual)
+		}
+	}
+	for _, location := range rep.Uploaded {
+		fmt.Fprintf(&text, "\nReport: %s", location)
+	}
+	n.Text = text.String()
+	if err := postNotification(context.Background(), cfg.NotifyURL, n); err != nil {
+		slog.Warn("failed to send the notification", "err", err)
+	}
+}
+
+// failWatch is a sink that posts a notification, once per run, when the
+// share of failed requests over the last failWindow reaches a limit
+type failWatch struct {
+	webhook string
+	target  string
+	tags    map[string]string
+	limit   float64
+
+	mu      sync.Mutex
+	seconds map[int64][2]int // unix second -> requests, failures
+	alerted bool
+	posting sync.WaitGroup
+}
+
+func newFailWatch(cfg *config.Config) *failWatch {
+	return &failWatch{webhook: cfg.NotifyURL, target: targetHost(cfg), tags: cfg.Tags, limit: cfg.NotifyErrorRate, seconds: map[int64][2]int{}}
+}
+
+func (w *failWatch) Observe(run int, r metrics.Result) {
+	if r.Warmup {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.alerted {
+		return
+	}
+	now := time.Now().Unix()
+	c := w.seconds[now]
+	c[0]++
+	if r.Error != "" {
+		c[1]++
+	}
+	w.seconds[now] = c
+	requests, failed := 0, 0
+	for sec, c := range w.seconds {
+		if sec <= now-int64(failWindow/time.Second) {
+			delete(w.seconds, sec)
+			continue
+		}
+		requests += c[0]
+		failed += c[1]
+	}
+	rate := float64(failed) / float64(requests)
+	if requests < failMinRequests || rate < w.limit {
+		return
+	}
+	w.alerted = true
+	n := notification{
+		Event:     "failing",
+		Text:      fmt.Sprintf("Load test of %s is failing: %.1f%% of %d requests failed in the last %s (run %d)", w.target, rate*100, requests, failWindow, run),
+		Target:    w.target,
+		Run:       run,
+		Requests:  requests,
+		Failed:    failed,
+		ErrorRate: rate,
+		Tags:      w.tags,
+	}
+	// Posted in the background so the test is not held up
+	w.posting.Add(1)
+	go func() {
+		defer w.posting.Done()
+		if err := postNotification(context.Background(), w.webhook, n); err != nil {
+			slog.Warn("failed to send the notification", "err", err)
+		}
+	}()
+}
+
+func (w *failWatch) Close() error {
+	w.posting.Wait()
+	return nil
+}
@@ -0,0 +1,463 @@
+// Package runner runs load tests. It is what the loadtester command is
+// built on, and lets Go programs and integration tests run a test and
+// inspect its results directly:
+//
+//	cfg := config.Default()
+//	cfg.URL = "http://localhost:8080/health"
+//	cfg.Requests, cfg.Concurrency = 500, 20
+//	cfg.Thresholds = []string{"p95 < 100ms", "error_rate < 1%"}
+//	rep, err := runner.Run(ctx, cfg)
+//	if err == nil && !rep.Passed {
+//		// a threshold failed
+//	}
+package runner
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/loadgen"
+	"LoadTester/metrics"
+	"LoadTester/report"
+)
+
+// Runner runs a prepared test. Out and Live may be set before Run is
+// called; Pause and Resume may be called at any time.
+type Runner struct {
+	// Out receives progress messages and the summary of each run; nil
+	// discards them
+	Out io.Writer
+	// Live, when set, is fed every result as it completes, for live
+	// displays and the Prometheus endpoint
+	Live *metrics.Live
+	// Modifiers and Validators are hooks applied to every HTTP request
+	// attempt and response, e.g. to sign requests or validate responses
+	// in ways the settings cannot express, and Sinks receive every result.
+	// They run in this process, so they cannot be combined with agents.
+	Modifiers  []loadgen.RequestModifier
+	Validators []loadgen.ResponseValidator
+	Sinks      []MetricsSink
+
+	cfg        config.Config // as given; agents resolve it themselves
+	plan       *loadgen.Plan
+	thresholds []metrics.Threshold
+}
+
+// Report is the outcome of all runs of a test
+type Report struct {
+	Config     config.Config // settings as resolved for the test
+	Runs       []*metrics.RunStats
+	Total      *metrics.RunStats
+	Duration   time.Duration // sum of the run durations
+	CSVFile    string        // per-request report, CSV or JSONL; empty in distributed mode
+	HTMLFile   string        // empty unless an HTML report was written
+	Uploaded   []string      // where the reports were uploaded, if anywhere
+	Thresholds []metrics.ThresholdResult
+	Passed     bool // every threshold held
+	// MaxRate is the highest rate the thresholds held at in a Search, zero
+	// if they failed at every rate tried, and FailRate the lowest rate
+	// they failed at, zero if they held up to SearchMax. The thresholds
+	// are those of the run at MaxRate.
+	MaxRate  float64
+	FailRate float64
+	// Interrupted is set when the test was cancelled before all runs
+	// finished; the results cover what was sent until then
+	Interrupted bool
+	// Aborted is why the circuit breaker, a stop condition or MaxDuration
+	// stopped the test, if one did
+	Aborted string
+	// CaptureFile holds the captured requests and responses, empty unless
+	// Capture is set; in distributed mode the agents write them
+	CaptureFile string
+	// FailuresFile holds the failed requests in detail, empty unless
+	// Failures is set; in distributed mode the agents write them
+	FailuresFile string
+}
+
+// New validates cfg and prepares a test from it. An error means the
+// configuration is invalid.
+func New(cfg config.Config) (*Runner, error) {
+	plan, err := loadgen.Compile(cfg)
+	if err != nil {
+		return nil, err
+	}
+	thresholds, err := metrics.ParseThresholds(cfg.Thresholds)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := report.NewRecordWriter(io.Discard, cfg.Format, nil); err != nil {
+		return nil, err
+	}
+	if err := checkTags(&cfg); err != nil {
+		return nil, err
+	}
+	if err := checkSinks(&cfg); err != nil {
+		return nil, err
+	}
+	if cfg.UploadTo != "" {
+		if _, err := openBucket(&cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkNotify(&cfg); err != nil {
+		return nil, err
+	}
+	return &Runner{cfg: cfg.Clone(), plan: plan, thresholds: thresholds}, nil
+}
+
+// Run prepares and runs the test described by cfg with no output other
+// than its report files
+func Run(ctx context.Context, cfg config.Config) (*Report, error) {
+	r, err := New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return r.Run(ctx)
+}
+
+// Config returns the settings of the test as resolved
+func (r *Runner) Config() config.Config {
+	return r.plan.Config
+}
+
+// Run performs every run of the test, writing the per-request and HTML reports.
+// Cancelling ctx ends the current run early and skips the rest; the
+// report then covers the requests sent so far. Without a healthy
+// HealthCheck URL, or with an open file limit too low for the test,
+// nothing is sent and an error is returned.
+func (r *Runner) Run(ctx context.Context) (*Report, error) {
+	cfg := &r.plan.Config
+	if err := r.applyHooks(); err != nil {
+		return nil, err
+	}
+	out := r.out()
+	live := r.Live
+	if live == nil {
+		live = metrics.NewLive()
+	}
+	live.SetTags(cfg.Tags)
+	if cfg.HealthCheck != "" {
+		// Load sent to a target still deploying only measures errors
+		r.plan.Log = out
+		fmt.Fprintf(out, "Checking %s before starting\n", cfg.HealthCheck)
+		if err := r.plan.CheckHealth(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.plan.RaiseOpenFiles(); err != nil {
+		return nil, err
+	}
+	os.MkdirAll(cfg.ReportDir, 0755)
+	timestamp := time.Now().Format("20060102_150405")
+	rep := &Report{Config: *cfg}
+	// MaxDuration counts from here, including reports and repeat delays
+	deadline := r.plan.Deadline()
+
+	var records report.RecordWriter = discardRecords{}
+	closeRecords := func() {}
+	if len(cfg.Agents) == 0 {
+		rep.CSVFile = fmt.Sprintf("%s/results_%s%s", cfg.ReportDir, timestamp, report.RecordExtension(cfg.Format))
+		if cfg.Compress {
+			rep.CSVFile += ".gz"
+		}
+		file, err := os.Create(rep.CSVFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		var w io.Writer = file
+		closeRecords = func() { file.Close() }
+		if cfg.Compress {
+			gzipWriter := gzip.NewWriter(file)
+			defer gzipWriter.Close()
+			w = gzipWriter
+			closeRecords = func() {
+				gzipWriter.Close()
+				file.Close()
+			}
+		}
+		if records, err = report.NewRecordWriter(w, cfg.Format, cfg.Tags); err != nil {
+			return nil, err
+		}
+		if cfg.Capture {
+			rep.CaptureFile = fmt.Sprintf("%s/capture_%s.jsonl", cfg.ReportDir, timestamp)
+			captures, err := os.Create(rep.CaptureFile)
+			if err != nil {
+				return nil, err
+			}
+			defer captures.Close()
+			records = recordWriters{records, report.NewCaptureWriter(captures, cfg.AuthHeaderName())}
+		}
+		if cfg.Failures {
+			rep.FailuresFile = fmt.Sprintf("%s/failures_%s.jsonl", cfg.ReportDir, timestamp)
+			failures, err := os.Create(rep.FailuresFile)
+			if err != nil {
+				return nil, err
+			}
+			defer failures.Close()
+			records = recordWriters{records, report.NewFailureWriter(failures, cfg.AuthHeaderName())}
+		}
+	}
+
+	// A search runs until it has found the rate, regardless of RepeatCount
+	search := newRateSearch(cfg)
+	more := func(run int) bool { return search != nil || run <= cfg.RepeatCount }
+	for run := 1; more(run) && ctx.Err() == nil; run++ {
+		if search != nil {
+			r.setRate(search.rate)
+		}
+		r.plan.WaitResumed(ctx)
+		if ctx.Err() != nil {
+			break
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			rep.Aborted = fmt.Sprintf("max_duration of %s reached", time.Duration(cfg.MaxDuration))
+			break
+		}
+		var stats *metrics.RunStats
+		if len(cfg.Agents) > 0 {
+			var err error
+			stats, err = r.runAgents(ctx, run)
+			if err != nil && ctx.Err() != nil {
+				// Agents drop an interrupted run, so only earlier runs
+				// are reported
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("distributed run failed: %w", err)
+			}
+		} else {
+			stats = r.runLocal(ctx, run, live, records)
+		}
+		rep.Runs = append(rep.Runs, stats)
+		rep.Duration += stats.Duration
+		// In a search, a run stopped by the circuit breaker or a stop
+		// condition failed at its rate; only MaxDuration ends the test
+		overdue := !deadline.IsZero() && !time.Now().Before(deadline)
+		if stats.Aborted != "" && (search == nil || overdue) {
+			rep.Aborted = stats.Aborted
+			break
+		}
+		if search != nil && ctx.Err() == nil {
+			results, held := metrics.EvaluateThresholds(r.thresholds, stats)
+			held = held && stats.Aborted == ""
+			printSearchStep(out, search.rate, results, held)
+			if !search.record(stats, held) {
+				break
+			}
+		}
+		if more(run + 1) {
+			fmt.Fprintf(out, "Waiting %d seconds before next run...\n", cfg.RepeatDelay)
+			delay := time.Duration(cfg.RepeatDelay) * time.Second
+			if !deadline.IsZero() {
+				delay = min(delay, time.Until(deadline))
+			}
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+			}
+		}
+	}
+	if err := records.Close(); err != nil {
+		slog.Error("failed to write the per-request report", "err", err)
+	}
+	rep.Interrupted = ctx.Err() != nil
+	rep.Total = metrics.Merge(rep.Runs)
+	rep.Thresholds, rep.Passed = metrics.EvaluateThresholds(r.thresholds, rep.Total)
+	if search != nil {
+		rep.MaxRate, rep.FailRate = search.held, search.failed
+		if search.best != nil {
+			rep.Thresholds, rep.Passed = metrics.EvaluateThresholds(r.thresholds, search.best)
+		}
+	}
+
+	if cfg.HTMLReport {
+		htmlName := fmt.Sprintf("%s/results_%s.html", cfg.ReportDir, timestamp)
+		if err := report.WriteHTML(htmlName, *cfg, rep.Runs); err != nil {
+			slog.Error("failed to write the HTML report", "err", err)
+		} else {
+			rep.HTMLFile = htmlName
+		}
+	}
+	if cfg.UploadTo != "" {
+		closeRecords()
+		rep.Uploaded = uploadReports(cfg, rep.CSVFile, rep.HTMLFile, rep.CaptureFile, rep.FailuresFile)
+	}
+	if cfg.HistoryFile != "" {
+		recordHistory(cfg, rep)
+	}
+	if cfg.NotifyURL != "" {
+		notifyFinished(cfg, rep)
+	}
+	return rep, nil
+}
+
+// Probe sends a single request to every endpoint of the test, or runs its
+// scenario once, from this process, to check the test before running it
+func (r *Runner) Probe(ctx context.Context) []metrics.Result {
+	// Probes are sent from this process even in distributed mode
+	r.plan.Modifiers, r.plan.Validators = r.Modifiers, r.Validators
+	return r.plan.Probe(ctx)
+}
+
+// Pause stops sending new requests until Resume is called, without
+// closing connections or resetting the results so far. Requests in flight
+// complete and are counted. It reports whether the test was running.
+func (r *Runner) Pause() bool {
+	if !r.plan.Pause() {
+		return false
+	}
+	if r.Live != nil {
+		r.Live.SetPaused(true)
+	}
+	r.signalAgents("pause")
+	return true
+}
+
+// Resume continues a paused test. It reports whether the test was paused.
+func (r *Runner) Resume() bool {
+	if !r.plan.Resume() {
+		return false
+	}
+	if r.Live != nil {
+		r.Live.SetPaused(false)
+	}
+	r.signalAgents("resume")
+	return true
+}
+
+// Paused reports whether the test is paused
+func (r *Runner) Paused() bool {
+	return r.plan.Paused()
+}
+
+// runLocal sends one run's requests from this process, writing a record
+// per request as it completes and passing it to the configured sinks. The
+// records are flushed when the run ends.
+func (r *Runner) runLocal(ctx context.Context, run int, live *metrics.Live, records report.RecordWriter) *metrics.RunStats {
+	out := r.out()
+	r.plan.Log = out
+	fmt.Fprintf(out, "Starting test run #%d (%s)\n", run, workload(&r.plan.Config))
+	sinks := openSinks(&r.plan.Config)
+	logRequests := r.plan.LogRequests && slog.Default().Enabled(ctx, slog.LevelDebug)
+	stats := r.plan.Run(ctx, run, live, func(res metrics.Result) {
+		records.Write(run, res)
+		sinks.Observe(run, res)
+		for _, s := range r.Sinks {
+			s.Observe(run, res)
+		}
+		if logRequests {
+			logResult(ctx, run, res)
+		}
+	})
+	if err := sinks.Close(); err != nil {
+		slog.Warn("failed to push the last results", "err", err)
+	}
+	if err := records.Flush(); err != nil {
+		slog.Error("failed to write the per-request report", "err", err)
+	}
+	report.PrintRunSummary(out, &r.plan.Config, stats)
+	return stats
+}
+
+// MetricsSink receives every result of a test as it completes, e.g. to
+// forward it to a monitoring system LoadTester has no sink for. Observe is
+// called from one goroutine at a time; any metrics.Sink is a MetricsSink.
+type MetricsSink interface {
+	Observe(run int, r metrics.Result)
+}
+
+// applyHooks hands the request and response hooks to the plan
+func (r *Runner) applyHooks() error {
+	if len(r.cfg.Agents) > 0 && (len(r.Modifiers) > 0 || len(r.Validators) > 0 || len(r.Sinks) > 0) {
+		return fmt.Errorf("hooks and sinks run in this process and cannot be combined with agents")
+	}
+	r.plan.Modifiers, r.plan.Validators = r.Modifiers, r.Validators
+	return nil
+}
+
+// logResult logs a request at debug level
+func logResult(ctx context.Context, run int, res metrics.Result) {
+	attrs := []slog.Attr{
+		slog.Int("run", run),
+		slog.Int("request_id", res.RequestID),
+		slog.String("endpoint", res.Endpoint),
+		slog.Int("status", res.Status),
+		slog.Float64("duration_ms", float64(res.Duration.Microseconds())/1000),
+		slog.Int("retries", res.Retries),
+	}
+	if res.Warmup {
+		attrs = append(attrs, slog.Bool("warmup", true))
+	}
+	if res.Error != "" {
+		attrs = append(attrs, slog.String("error_type", res.ErrorType), slog.String("error", res.Error))
+	}
+	slog.LogAttrs(ctx, slog.LevelDebug, "request", attrs...)
+}
+
+// recordWriters writes every record to each of its writers
+type recordWriters []report.RecordWriter
+
+func (ws recordWriters) Write(run int, r metrics.Result) error {
+	var first error
+	for _, w := range ws {
+		if err := w.Write(run, r); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (ws recordWriters) Flush() error {
+	var first error
+	for _, w := range ws {
+		if err := w.Flush(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (ws recordWriters) Close() error {
+	var first error
+	for _, w := range ws {
+		if err := w.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// discardRecords is the RecordWriter of a distributed test, whose
+// agents write the per-request reports
+type discardRecords struct{}
+
+func (discardRecords) Write(int, metrics.Result) error { return nil }
+func (discardRecords) Flush() error                    { return nil }
+func (discardRecords) Close() error                    { return nil }
+
+// workload describes the run's workload model for its start line
+func workload(cfg *config.Config) string {
+	switch {
+	case cfg.Model == config.ModelClosed:
+		return fmt.Sprintf("closed model, %d virtual users", cfg.Concurrency)
+	case len(cfg.Stages) > 0:
+		return "open model, staged arrival rate"
+	case cfg.Rate > 0:
+		return fmt.Sprintf("open model, %.2f req/s", cfg.Rate)
+	}
+	return "open model, recorded timing"
+}
+
+func (r *Runner) out() io.Writer {
+	if r.Out == nil {
+		return io.Discard
+	}
+	return r.Out
+}
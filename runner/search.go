@@ -0,0 +1,79 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+// rateSearch steps the rate of successive runs up until the thresholds
+// fail, then bisects between the highest rate they held at and the lowest
+// they failed at
+type rateSearch struct {
+	step      float64
+	max       float64
+	precision float64
+	rate      float64 // of the run in progress
+	held      float64 // highest rate the thresholds held at, zero for none
+	failed    float64 // lowest rate they failed at, zero for none
+	best      *metrics.RunStats
+}
+
+// newRateSearch returns the search of a test, or nil when each run uses
+// the configured rate
+func newRateSearch(cfg *config.Config) *rateSearch {
+	if !cfg.Search {
+		return nil
+	}
+	return &rateSearch{
+		step:      cfg.SearchStep,
+		max:       cfg.SearchMax,
+		precision: cfg.SearchPrecision,
+		rate:      cfg.Rate,
+	}
+}
+
+// record notes whether the thresholds held for the run at the current
+// rate and picks the next rate. It reports false once the search is over.
+func (s *rateSearch) record(stats *metrics.RunStats, held bool) bool {
+	if held {
+		s.held, s.best = s.rate, stats
+	} else {
+		s.failed = s.rate
+	}
+	if s.failed == 0 {
+		if s.rate >= s.max {
+			return false
+		}
+		s.rate = min(s.max, s.rate+s.step)
+		return true
+	}
+	if s.failed-s.held <= s.precision {
+		return false
+	}
+	s.rate = (s.held + s.failed) / 2
+	return true
+}
+
+// setRate makes the next run send at rate, locally and on the agents
+func (r *Runner) setRate(rate float64) {
+	r.plan.Rate = rate
+	r.cfg.Rate = rate
+}
+
+// printSearchStep reports the outcome of a run of the search
+func printSearchStep(w io.Writer, rate float64, results []metrics.ThresholdResult, held bool) {
+	if held {
+		fmt.Fprintf(w, "Search: thresholds held at %.2f req/s\n", rate)
+		return
+	}
+	fmt.Fprintf(w, "Search: thresholds failed at %.2f req/s:", rate)
+	for _, res := range results {
+		if !res.Passed {
+			fmt.Fprintf(w, " %s (actual %s)", res.Threshold, res.Actual)
+		}
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,107 @@
+package runner
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+	"LoadTester/report"
+)
+
+// checkSinks validates the settings of the monitoring systems results are
+// pushed to
+func checkSinks(cfg *config.Config) error {
+	if cfg.InfluxURL != "" {
+		u, err := url.Parse(cfg.InfluxURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("influx_url must be an http or https URL, got %q", cfg.InfluxURL)
+		}
+	}
+	if cfg.ElasticURL != "" {
+		u, err := url.Parse(cfg.ElasticURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("elastic_url must be an http or https URL, got %q", cfg.ElasticURL)
+		}
+		if cfg.ElasticIndex == "" {
+			return fmt.Errorf("elastic_index must not be empty")
+		}
+	}
+	if cfg.GraphiteAddr != "" {
+		if _, _, err := net.SplitHostPort(cfg.GraphiteAddr); err != nil {
+			return fmt.Errorf("graphite_addr must be host:port, got %q", cfg.GraphiteAddr)
+		}
+	}
+	if cfg.StatsDAddr != "" {
+		if _, _, err := net.SplitHostPort(cfg.StatsDAddr); err != nil {
+			return fmt.Errorf("statsd_addr must be host:port, got %q", cfg.StatsDAddr)
+		}
+	}
+	return nil
+}
+
+// openSinks starts the sinks configured for one run. Every point is
+// tagged with the test's tags, the target host and the load generator's
+// hostname, so the agents of a distributed test can be told apart.
+func openSinks(cfg *config.Config) metrics.Sinks {
+	var sinks metrics.Sinks
+	hostname, _ := os.Hostname()
+	tags := maps.Clone(cfg.Tags)
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	tags["target"], tags["host"] = targetHost(cfg), hostname
+	if cfg.InfluxURL != "" {
+		sinks = append(sinks, metrics.NewInfluxSink(cfg.InfluxURL, cfg.InfluxToken, tags))
+	}
+	if cfg.GraphiteAddr != "" {
+		sinks = append(sinks, metrics.NewGraphiteSink(cfg.GraphiteAddr, cfg.GraphitePrefix, tags))
+	}
+	if cfg.StatsDAddr != "" {
+		sinks = append(sinks, metrics.NewStatsDSink(cfg.StatsDAddr, cfg.StatsDPrefix, cfg.StatsDTags, tags))
+	}
+	if cfg.ElasticURL != "" {
+		sinks = append(sinks, report.NewElasticSink(cfg.ElasticURL, cfg.ElasticIndex, cfg.ElasticAPIKey, hostname, tags["target"], cfg.Tags))
+	}
+	if cfg.NotifyURL != "" && cfg.NotifyErrorRate > 0 {
+		sinks = append(sinks, newFailWatch(cfg))
+	}
+	return sinks
+}
+
+// reservedTags are the tags the sinks set themselves
+var reservedTags = []string{"run", "target", "host", "status_class"}
+
+// checkTags validates the test's tags. Their keys become tag and label
+// names in the monitoring systems, so they are limited to what all of
+// them accept.
+func checkTags(cfg *config.Config) error {
+	for k, v := range cfg.Tags {
+		if !tagKey.MatchString(k) {
+			return fmt.Errorf("tag %q: keys must be letters, digits and underscores, starting with a letter", k)
+		}
+		if slices.Contains(reservedTags, k) {
+			return fmt.Errorf("tag %q is reserved; the sinks set it themselves", k)
+		}
+		if v == "" {
+			return fmt.Errorf("tag %q has no value", k)
+		}
+	}
+	return nil
+}
+
+var tagKey = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// targetHost returns the host of the target URL, or the URL itself when
+// it has none
+func targetHost(cfg *config.Config) string {
+	if u, err := url.Parse(cfg.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return cfg.URL
+}
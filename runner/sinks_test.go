@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+func TestGraphiteSinkTags(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		lines <- line
+	}()
+
+	cfg := config.Default()
+	cfg.URL = "http://api.example.test:8080/orders"
+	cfg.GraphiteAddr = ln.Addr().String()
+	cfg.GraphitePrefix = "loadtest"
+	cfg.Tags = map[string]string{"env": "staging"}
+	sinks := openSinks(&cfg)
+	sinks.Observe(1, metrics.Result{Status: 200, Duration: 10 * time.Millisecond})
+	sinks.Close()
+
+	var line string
+	select {
+	case line = <-lines:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no point reached the Graphite server")
+	}
+	hostname, _ := os.Hostname()
+	for _, tag := range []string{";env=staging", ";target=api.example.test:8080", ";host=" + hostname} {
+		if !strings.Contains(line, tag) {
+			t.Errorf("point %q has no %s tag", line, tag)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package runner
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"LoadTester/config"
+)
+
+// bucket is where reports are uploaded: an S3 bucket, or one of a service
+// with an S3-compatible API such as MinIO or Google Cloud Storage
+type bucket struct {
+	scheme    string   // s3 or gs, as given
+	endpoint  *url.URL // scheme and host requests are sent to
+	name      string
+	prefix    string // key prefix, empty or ending in /
+	region    string
+	pathStyle bool // bucket in the path rather than the host name
+
+	accessKey, secretKey, sessionToken string
+}
+
+// openBucket parses the UPLOAD_TO destination, s3://bucket/prefix or
+// gs://bucket/prefix. Credentials come from the environment, as for the
+// AWS command line tools; for Cloud Storage they are HMAC keys.
+func openBucket(cfg *config.Config) (*bucket, error) {
+	u, err := url.Parse(cfg.UploadTo)
+	if err != nil || u.Host == "" || (u.Scheme != "s3" && u.Scheme != "gs") {
+		return nil, fmt.Errorf("upload_to must be s3://bucket/prefix or gs://bucket/prefix, got %q", cfg.UploadTo)
+	}
+	b := &bucket{
+		scheme:       u.Scheme,
+		name:         u.Host,
+		prefix:       strings.TrimPrefix(u.Path, "/"),
+		region:       cfg.UploadRegion,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if b.prefix != "" && !strings.HasSuffix(b.prefix, "/") {
+		b.prefix += "/"
+	}
+	if b.accessKey == "" || b.secretKey == "" {
+		return nil, fmt.Errorf("uploading reports needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if b.region == "" {
+		b.region = "us-east-1"
+		if u.Scheme == "gs" {
+			b.region = "auto"
+		}
+	}
+	switch {
+	case cfg.UploadEndpoint != "":
+		// MinIO and other self-hosted stores are addressed by path
+		b.endpoint, err = url.Parse(cfg.UploadEndpoint)
+		if err != nil || (b.endpoint.Scheme != "http" && b.endpoint.Scheme != "https") || b.endpoint.Host == "" {
+			return nil, fmt.Errorf("upload_endpoint must be an http or https URL, got %q", cfg.UploadEndpoint)
+		}
+		b.pathStyle = true
+	case u.Scheme == "gs":
+		b.endpoint = &url.URL{Scheme: "https", Host: "storage.googleapis.com"}
+		b.pathStyle = true
+	default:
+		b.endpoint = &url.URL{Scheme: "https", Host: "s3." + b.region + ".amazonaws.com"}
+		// Bucket names with dots do not match the wildcard certificate
+		b.pathStyle = strings.Contains(b.name, ".")
+	}
+	return b, nil
+}
+
+// uploadReports uploads the report files to cfg's bucket and returns where
+// they went. The test has already finished, so failures are only logged;
+// the files stay in the report directory either way.
+func uploadReports(cfg *config.Config, files ...string) []string {
+	b, err := openBucket(cfg)
+	if err != nil {
+		slog.Error("failed to upload the reports", "err", err)
+		return nil
+	}
+	// Cancelling the test does not stop the upload of what it produced
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	uploaded, err := b.upload(ctx, files...)
+	if err != nil {
+		slog.Error("failed to upload the reports", "err", err)
+	}
+	return uploaded
+}
+
+// upload stores the files under the bucket's prefix, keeping their base
+// names, and returns the location of each. It stops at the first failure.
+func (b *bucket) upload(ctx context.Context, files ...string) ([]string, error) {
+	var done []string
+	for _, path := range files {
+		if path == "" {
+			continue
+		}
+		key := b.prefix + filepath.Base(path)
+		if err := b.put(ctx, key, path); err != nil {
+			return done, fmt.Errorf("uploading %s: %w", path, err)
+		}
+		done = append(done, fmt.Sprintf("%s://%s/%s", b.scheme, b.name, key))
+	}
+	return done, nil
+}
+
+// put uploads one file with a single PUT, signed with AWS Signature
+// Version 4. The payload hash is part of the signature, so the file is
+// read twice rather than held in memory.
+func (b *bucket) put(ctx context.Context, key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	u := *b.endpoint
+	if b.pathStyle {
+		u.Path = "/" + b.name + "/" + key
+	} else {
+		u.Host = b.name + "." + u.Host
+		u.Path = "/" + key
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType(path))
+	b.sign(req, hex.EncodeToString(h.Sum(nil)), time.Now().UTC())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// sign adds the Signature Version 4 authorization to req
+func (b *bucket) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	values := []string{req.URL.Host, payloadHash, amzDate}
+	if b.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.sessionToken)
+		signed = append(signed, "x-amz-security-token")
+		values = append(values, b.sessionToken)
+	}
+	var canonHeaders strings.Builder
+	for i, name := range signed {
+		canonHeaders.WriteString(name + ":" + values[i] + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+	canonical := strings.Join([]string{
+		req.Method,
+		awsEscapePath(req.URL.Path),
+		"", // no query
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + b.region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+b.secretKey), day)
+	for _, part := range []string{b.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.accessKey, scope, signedHeaders, signature))
+	// The request must go out with the path that was signed
+	req.URL.RawPath = awsEscapePath(req.URL.Path)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// awsEscapePath percent-encodes every byte of path but the unreserved
+// characters and slashes, as Signature Version 4 requires
+func awsEscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// contentType returns the media type a report file is uploaded with
+func contentType(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return "application/gzip"
+	case strings.HasSuffix(path, ".csv"):
+		return "text/csv"
+	case strings.HasSuffix(path, ".jsonl"):
+		return "application/x-ndjson"
+	case strings.HasSuffix(path, ".html"):
+		return "text/html; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,583 @@
+// Package server implements serve mode: an HTTP API to start, watch and
+// stop tests, and a web UI built on it. Tests run one at a time; finished
+// runs are kept in memory. Every API request must carry the server's
+// token as a bearer token.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+	"LoadTester/runner"
+)
+
+//go:embed ui.html
+var uiPage []byte
+
+// maxAPIRuns is how many runs the API remembers, oldest dropped first
+const maxAPIRuns = 100
+
+// Run states reported by the API
+const (
+	RunRunning   = "running"
+	RunCompleted = "completed"
+	RunCancelled = "cancelled"
+	RunFailed    = "failed"
+)
+
+// apiRun is a test started through the API
+type apiRun struct {
+	id      string
+	cfg     config.Config // as resolved
+	runner  *runner.Runner
+	live    *metrics.Live
+	cancel  context.CancelFunc
+	created time.Time
+
+	mu       sync.Mutex
+	status   string
+	finished time.Time
+	err      string
+	snap     *metrics.Snapshot
+	out      *runner.Report
+	subs     map[chan metrics.Snapshot]bool // SSE streams, closed when the run ends
+}
+
+// apiServer holds the runs started through the API
+type apiServer struct {
+	mu     sync.Mutex
+	runs   map[string]*apiRun
+	order  []string // run IDs, oldest first
+	active *apiRun
+}
+
+// New returns the handler serving the control API and web UI. API
+// requests must be authorized with token as a bearer token; the UI page
+// itself asks for it.
+func New(token string) http.Handler {
+	s := &apiServer{runs: map[string]*apiRun{}}
+	return s.handler(token)
+}
+
+func (s *apiServer) handler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(uiPage)
+	})
+	api := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, requireToken(token, h))
+	}
+	api("POST /runs", s.startRun)
+	api("GET /runs", s.listRuns)
+	api("GET /runs/{id}", s.getRun)
+	api("DELETE /runs/{id}", s.stopRun)
+	api("POST /runs/{id}/pause", s.pauseRun)
+	api("POST /runs/{id}/resume", s.resumeRun)
+	api("GET /runs/{id}/events", s.streamRun)
+	api("GET /runs/{id}/report", s.getReport)
+	return mux
+}
+
+// requireToken passes on only requests with token as their bearer token.
+// A browser cannot add the header to a request another site makes it
+// send, so this also keeps other sites from starting tests.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, "missing or wrong API token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startRun starts a test from a JSON or YAML test definition, the same
+// format as a -config file, applying the profile named in the query. The
+// definition may not touch the server's files or send anything elsewhere
+// than the target (see config.Config.HostSettings).
+func (s *apiServer) startRun(w http.ResponseWriter, r *http.Request) {
+	var yaml bool
+	switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+	case "application/json":
+	case "application/yaml":
+		yaml = true
+	default:
+		writeAPIError(w, http.StatusUnsupportedMediaType, "the test definition must be sent as application/json or application/yaml")
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, 10<<20))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cfg := config.Default()
+	if err := config.DecodeProfile(data, yaml, r.URL.Query().Get("profile"), &cfg); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid configuration: "+err.Error())
+		return
+	}
+	if set := cfg.HostSettings(); len(set) > 0 {
+		writeAPIError(w, http.StatusForbidden, "not allowed through the API, as they read or write files on the server or send data elsewhere than the target: "+strings.Join(set, ", "))
+		return
+	}
+	if cfg.DryRun {
+		// A definition meant to be checked must not start the load
+		writeAPIError(w, http.StatusBadRequest, "dry_run is only supported on the command line")
+		return
+	}
+	// The API replaces the terminal displays and metrics endpoint
+	cfg.TUI, cfg.Progress, cfg.MetricsAddr, cfg.PprofAddr = false, false, "", ""
+	rn, err := runner.New(cfg)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid configuration: "+err.Error())
+		return
+	}
+	rn.Live = metrics.NewLive()
+
+	s.mu.Lock()
+	if s.active != nil {
+		s.mu.Unlock()
+		writeAPIError(w, http.StatusConflict, "run "+s.active.id+" is still in progress")
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &apiRun{
+		id:      fmt.Sprintf("%016x", rand.Uint64()),
+		cfg:     rn.Config(),
+		runner:  rn,
+		live:    rn.Live,
+		cancel:  cancel,
+		created: time.Now(),
+		status:  RunRunning,
+		subs:    map[chan metrics.Snapshot]bool{},
+	}
+	s.active = run
+	s.runs[run.id] = run
+	s.order = append(s.order, run.id)
+	if len(s.order) > maxAPIRuns {
+		delete(s.runs, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.mu.Unlock()
+
+	go s.execute(ctx, run)
+	w.Header().Set("Location", "/runs/"+run.id)
+	writeJSON(w, http.StatusCreated, run.view())
+}
+
+// execute runs the test and publishes a snapshot every second
+func (s *apiServer) execute(ctx context.Context, run *apiRun) {
+	done := make(chan struct{})
+	ticked := make(chan struct{})
+	go func() {
+		defer close(ticked)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				run.publish(run.live.Tick())
+			}
+		}
+	}()
+	out, err := run.runner.Run(ctx)
+	close(done)
+	<-ticked
+
+	run.mu.Lock()
+	run.finished = time.Now()
+	run.out = out
+	switch {
+	case err != nil:
+		run.status = RunFailed
+		run.err = err.Error()
+	case ctx.Err() != nil:
+		run.status = RunCancelled
+	default:
+		run.status = RunCompleted
+	}
+	for ch := range run.subs {
+		close(ch)
+	}
+	run.subs = nil
+	run.mu.Unlock()
+	run.cancel()
+
+	s.mu.Lock()
+	s.active = nil
+	s.mu.Unlock()
+}
+
+// publish stores the latest snapshot and passes it to every stream. A
+// stream that has fallen behind misses the update.
+func (run *apiRun) publish(snap metrics.Snapshot) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.snap = &snap
+	for ch := range run.subs {
+		select {
+		case ch <- snap:
+		default:
+		}
+	}
+}
+
+func (s *apiServer) lookup(w http.ResponseWriter, r *http.Request) *apiRun {
+	s.mu.Lock()
+	run := s.runs[r.PathValue("id")]
+	s.mu.Unlock()
+	if run == nil {
+		writeAPIError(w, http.StatusNotFound, "no such run")
+	}
+	return run
+}
+
+func (s *apiServer) listRuns(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	runs := make([]*apiRun, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		runs = append(runs, s.runs[s.order[i]])
+	}
+	s.mu.Unlock()
+	views := make([]runView, 0, len(runs))
+	for _, run := range runs {
+		views = append(views, run.view())
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (s *apiServer) getRun(w http.ResponseWriter, r *http.Request) {
+	if run := s.lookup(w, r); run != nil {
+		writeJSON(w, http.StatusOK, run.view())
+	}
+}
+
+// getReport serves the HTML report of a finished run
+func (s *apiServer) getReport(w http.ResponseWriter, r *http.Request) {
+	run := s.lookup(w, r)
+	if run == nil {
+		return
+	}
+	run.mu.Lock()
+	var name string
+	if run.out != nil {
+		name = run.out.HTMLFile
+	}
+	run.mu.Unlock()
+	if name == "" {
+		writeAPIError(w, http.StatusNotFound, "run has no HTML report")
+		return
+	}
+	http.ServeFile(w, r, name)
+}
+
+// stopRun cancels a running test. Requests in flight still complete, so
+// the run reports its results up to that point.
+func (s *apiServer) stopRun(w http.ResponseWriter, r *http.Request) {
+	run := s.lookup(w, r)
+	if run == nil {
+		return
+	}
+	run.mu.Lock()
+	running := run.status == RunRunning
+	run.mu.Unlock()
+	if !running {
+		writeAPIError(w, http.StatusConflict, "run is not in progress")
+		return
+	}
+	run.cancel()
+	writeJSON(w, http.StatusAccepted, run.view())
+}
+
+// pauseRun stops a running test from sending new requests until it is
+// resumed
+func (s *apiServer) pauseRun(w http.ResponseWriter, r *http.Request) {
+	s.setPaused(w, r, true)
+}
+
+// resumeRun continues a paused test
+func (s *apiServer) resumeRun(w http.ResponseWriter, r *http.Request) {
+	s.setPaused(w, r, false)
+}
+
+func (s *apiServer) setPaused(w http.ResponseWriter, r *http.Request, pause bool) {
+	run := s.lookup(w, r)
+	if run == nil {
+		return
+	}
+	run.mu.Lock()
+	running := run.status == RunRunning
+	run.mu.Unlock()
+	if !running {
+		writeAPIError(w, http.StatusConflict, "run is not in progress")
+		return
+	}
+	if pause {
+		run.runner.Pause()
+	} else {
+		run.runner.Resume()
+	}
+	writeJSON(w, http.StatusOK, run.view())
+}
+
+// streamRun sends server-sent events: a "stats" event with live figures
+// every second while the test runs, then a "done" event with the final
+// state of the run
+func (s *apiServer) streamRun(w http.ResponseWriter, r *http.Request) {
+	run := s.lookup(w, r)
+	if run == nil {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	var ch chan metrics.Snapshot
+	run.mu.Lock()
+	if run.subs != nil {
+		ch = make(chan metrics.Snapshot, 8)
+		run.subs[ch] = true
+	}
+	run.mu.Unlock()
+	defer func() {
+		run.mu.Lock()
+		delete(run.subs, ch)
+		run.mu.Unlock()
+	}()
+
+	for ch != nil {
+		select {
+		case snap, ok := <-ch:
+			if !ok {
+				ch = nil
+				break
+			}
+			writeEvent(w, "stats", newLiveView(snap))
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+	writeEvent(w, "done", run.view())
+	flusher.Flush()
+}
+
+func writeEvent(w io.Writer, event string, v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// runView is the API representation of a run
+type runView struct {
+	ID       string       `json:"id"`
+	Status   string       `json:"status"`
+	Target   string       `json:"target"`
+	Created  time.Time    `json:"created"`
+	Finished *time.Time   `json:"finished,omitempty"`
+	Error    string       `json:"error,omitempty"`
+	Paused   bool         `json:"paused,omitempty"`
+	Live     *liveView    `json:"live,omitempty"`    // latest second while running
+	Summary  *summaryView `json:"summary,omitempty"` // once finished
+}
+
+// liveView is one second of live figures
+type liveView struct {
+	Run       int     `json:"run"`
+	Paused    bool    `json:"paused"`
+	Elapsed   float64 `json:"elapsed_seconds"`
+	InFlight  int     `json:"in_flight"`
+	Requests  int     `json:"requests"`
+	Errors    int     `json:"errors"`
+	RPS       float64 `json:"rps"`
+	ErrorRate float64 `json:"error_rate"`
+	P50       int64   `json:"p50_ms"`
+	P95       int64   `json:"p95_ms"`
+	P99       int64   `json:"p99_ms"`
+}
+
+type secondView struct {
+	Second   int   `json:"second"`
+	Requests int   `json:"requests"`
+	Errors   int   `json:"errors"`
+	P50      int64 `json:"p50_ms"`
+	P95      int64 `json:"p95_ms"`
+	P99      int64 `json:"p99_ms"`
+	Max      int64 `json:"max_ms"`
+}
+
+// summaryView is the outcome of all runs of a finished test
+type summaryView struct {
+	Requests     int               `json:"requests"`
+	Success      int               `json:"success"`
+	Failed       int               `json:"failed"`
+	ErrorRate    float64           `json:"error_rate"`
+	RPS          float64           `json:"rps"`
+	Duration     float64           `json:"duration_seconds"`
+	P50          int64             `json:"p50_ms"`
+	P90          int64             `json:"p90_ms"`
+	P95          int64             `json:"p95_ms"`
+	P99          int64             `json:"p99_ms"`
+	Max          int64             `json:"max_ms"`
+	StatusCodes  map[int]int       `json:"status_codes"`
+	ErrorTypes   map[string]int    `json:"error_types"`
+	Thresholds   []thresholdView   `json:"thresholds,omitempty"`
+	Passed       bool              `json:"passed"`            // all thresholds held
+	Aborted      string            `json:"aborted,omitempty"` // why the circuit breaker or a stop condition stopped the test
+	CSVFile      string            `json:"csv_file,omitempty"`
+	HTMLFile     string            `json:"html_file,omitempty"`
+	CaptureFile  string            `json:"capture_file,omitempty"`
+	FailuresFile string            `json:"failures_file,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	// Endpoints, or scenario steps, when there are several, busiest first
+	Endpoints []endpointView `json:"endpoints,omitempty"`
+	// Per-second figures over the whole test, runs laid end to end
+	Timeline []secondView `json:"timeline,omitempty"`
+}
+
+type endpointView struct {
+	Name      string  `json:"name"`
+	Requests  int     `json:"requests"`
+	Failed    int     `json:"failed"`
+	ErrorRate float64 `json:"error_rate"`
+	RPS       float64 `json:"rps"`
+	P50       int64   `json:"p50_ms"`
+	P95       int64   `json:"p95_ms"`
+	P99       int64   `json:"p99_ms"`
+}
+
+type thresholdView struct {
+	Threshold string `json:"threshold"`
+	Actual    string `json:"actual"`
+	Passed    bool   `json:"passed"`
+}
+
+func newLiveView(s metrics.Snapshot) *liveView {
+	return &liveView{
+		Run:       s.Run,
+		Paused:    s.Paused,
+		Elapsed:   s.Elapsed.Seconds(),
+		InFlight:  s.InFlight,
+		Requests:  s.Requests,
+		Errors:    s.Errors,
+		RPS:       s.RPS,
+		ErrorRate: s.ErrorRate,
+		P50:       s.P50,
+		P95:       s.P95,
+		P99:       s.P99,
+	}
+}
+
+func (run *apiRun) view() runView {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	v := runView{
+		ID:      run.id,
+		Status:  run.status,
+		Target:  run.cfg.TargetLabel(),
+		Created: run.created,
+		Error:   run.err,
+	}
+	if !run.finished.IsZero() {
+		v.Finished = &run.finished
+	}
+	if run.status == RunRunning {
+		v.Paused = run.runner.Paused()
+		if run.snap != nil {
+			v.Live = newLiveView(*run.snap)
+		}
+	}
+	if run.out != nil {
+		v.Summary = newSummaryView(run.out)
+	}
+	return v
+}
+
+func newSummaryView(out *runner.Report) *summaryView {
+	t := out.Total
+	v := &summaryView{
+		Requests:     t.Sent,
+		Success:      t.Success,
+		Failed:       t.Failed,
+		Duration:     out.Duration.Seconds(),
+		P50:          t.Percentile(0.50),
+		P90:          t.Percentile(0.90),
+		P95:          t.Percentile(0.95),
+		P99:          t.Percentile(0.99),
+		Max:          t.Latency.Max().Milliseconds(),
+		StatusCodes:  t.StatusCodes,
+		ErrorTypes:   t.ErrorTypes,
+		Passed:       out.Passed,
+		Aborted:      out.Aborted,
+		CSVFile:      out.CSVFile,
+		HTMLFile:     out.HTMLFile,
+		CaptureFile:  out.CaptureFile,
+		FailuresFile: out.FailuresFile,
+		Tags:         out.Config.Tags,
+	}
+	if t.Sent > 0 {
+		v.ErrorRate = float64(t.Failed) / float64(t.Sent)
+	}
+	if out.Duration > 0 {
+		v.RPS = float64(t.Sent) / out.Duration.Seconds()
+	}
+	if len(t.Endpoints) > 1 {
+		for name, e := range t.Endpoints {
+			v.Endpoints = append(v.Endpoints, endpointView{
+				Name:      name,
+				Requests:  e.Requests,
+				Failed:    e.Failed,
+				ErrorRate: e.ErrorRate(),
+				RPS:       e.Throughput(out.Duration),
+				P50:       e.Latency.Quantile(0.50).Milliseconds(),
+				P95:       e.Latency.Quantile(0.95).Milliseconds(),
+				P99:       e.Latency.Quantile(0.99).Milliseconds(),
+			})
+		}
+		sort.Slice(v.Endpoints, func(i, j int) bool {
+			if v.Endpoints[i].Requests != v.Endpoints[j].Requests {
+				return v.Endpoints[i].Requests > v.Endpoints[j].Requests
+			}
+			return v.Endpoints[i].Name < v.Endpoints[j].Name
+		})
+	}
+	for _, b := range t.Timeline {
+		v.Timeline = append(v.Timeline, secondView{b.Second, b.Requests, b.Errors, b.P50, b.P95, b.P99, b.Max})
+	}
+	for _, th := range out.Thresholds {
+		v.Thresholds = append(v.Thresholds, thresholdView{th.Threshold, th.Actual, th.Passed})
+	}
+	return v
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testToken = "secret"
+
+func TestAPI(t *testing.T) {
+	// Runs write their reports under the working directory
+	t.Chdir(t.TempDir())
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	run := `{"url": "` + target.URL + `", "requests": 1, "concurrency": 1}`
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		token       string
+		contentType string
+		body        string
+		want        int
+		wantErr     string
+	}{
+		{name: "ui without token", method: "GET", path: "/", want: http.StatusOK},
+		{name: "no token", method: "GET", path: "/runs", want: http.StatusUnauthorized},
+		{name: "wrong token", method: "GET", path: "/runs", token: "guess", want: http.StatusUnauthorized},
+		{name: "start without token", method: "POST", path: "/runs", contentType: "application/json", body: run, want: http.StatusUnauthorized},
+		{name: "list", method: "GET", path: "/runs", token: testToken, want: http.StatusOK},
+		{name: "text/plain", method: "POST", path: "/runs", token: testToken, contentType: "text/plain", body: run, want: http.StatusUnsupportedMediaType},
+		{name: "form", method: "POST", path: "/runs", token: testToken, contentType: "application/x-www-form-urlencoded", body: run, want: http.StatusUnsupportedMediaType},
+		{name: "body file", method: "POST", path: "/runs", token: testToken, contentType: "application/json",
+			body: `{"url": "` + target.URL + `", "body_file": "/etc/passwd"}`, want: http.StatusForbidden, wantErr: "body_file"},
+		{name: "report dir", method: "POST", path: "/runs", token: testToken, contentType: "application/yaml",
+			body: "url: " + target.URL + "\nreport_dir: /tmp/elsewhere\n", want: http.StatusForbidden, wantErr: "report_dir"},
+		{name: "endpoint body file", method: "POST", path: "/runs", token: testToken, contentType: "application/json",
+			body: `{"endpoints": [{"url": "` + target.URL + `", "body_file": "/etc/passwd"}]}`, want: http.StatusForbidden, wantErr: "endpoints.body_file"},
+		{name: "sink", method: "POST", path: "/runs", token: testToken, contentType: "application/json",
+			body: `{"url": "` + target.URL + `", "notify_url": "http://example.com/hook"}`, want: http.StatusForbidden, wantErr: "notify_url"},
+		{name: "start", method: "POST", path: "/runs", token: testToken, contentType: "application/json; charset=utf-8", body: run, want: http.StatusCreated},
+	}
+	h := New(testToken)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.wantErr != "" {
+				var body struct{ Error string }
+				json.NewDecoder(rec.Body).Decode(&body)
+				if !strings.Contains(body.Error, tt.wantErr) {
+					t.Errorf("error = %q, want it to name %s", body.Error, tt.wantErr)
+				}
+			}
+		})
+	}
+	waitIdle(t, h)
+}
+
+// waitIdle waits for the runs started through h to finish, so that they
+// are not left writing to a removed directory
+func waitIdle(t *testing.T, h http.Handler) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		req := httptest.NewRequest("GET", "/runs", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if !strings.Contains(rec.Body.String(), `"`+RunRunning+`"`) {
+			return
+		}
+	}
+	t.Fatal("run still in progress")
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// pauseSignals toggle pausing a running test; there is no SIGUSR1 here
+var pauseSignals []os.Signal
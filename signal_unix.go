@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// pauseSignals toggle pausing a running test
+var pauseSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/runner"
+)
+
+// runTargets runs the profiles named by cfg.Targets at the same time, each
+// as a test of its own with its reports in a directory named after it, and
+// returns the process exit code
+func runTargets(args []string, cfg config.Config) int {
+	runners := make([]*runner.Runner, len(cfg.Targets))
+	var grace time.Duration
+	var mu sync.Mutex // keeps the targets' output lines whole
+	for i, name := range cfg.Targets {
+		tc, err := config.Load(append(slices.Clone(args), "-profile", name))
+		if err != nil {
+			slog.Error("invalid configuration", "target", name, "err", err)
+			return 2
+		}
+		tc.Targets = nil
+		// The dashboard and the metrics and pprof endpoints serve one test
+		tc.TUI, tc.Progress, tc.MetricsAddr, tc.PprofAddr = false, false, "", ""
+		tc.ReportDir = filepath.Join(tc.ReportDir, name)
+		r, err := runner.New(tc)
+		if err != nil {
+			slog.Error("invalid configuration", "target", name, "err", err)
+			return 2
+		}
+		r.Out = &prefixWriter{prefix: "[" + name + "] ", w: os.Stdout, mu: &mu}
+		runners[i] = r
+		resolved := r.Config()
+		grace = max(grace, time.Duration(resolved.ShutdownGrace))
+	}
+	if cfg.DryRun {
+		code := 0
+		for i, r := range runners {
+			fmt.Printf("Target %s:\n", cfg.Targets[i])
+			code = max(code, dryRun(r))
+		}
+		return code
+	}
+
+	ctx, stop := interruptContext(grace)
+	reports := make([]*runner.Report, len(runners))
+	errs := make([]error, len(runners))
+	var wg sync.WaitGroup
+	for i, r := range runners {
+		stopPause := handlePauseSignals(r)
+		defer stopPause()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reports[i], errs[i] = r.Run(ctx)
+		}()
+	}
+	wg.Wait()
+	stop()
+
+	code := 0
+	for i, out := range reports {
+		fmt.Printf("\n=== Target %s ===\n", cfg.Targets[i])
+		if errs[i] != nil {
+			slog.Error("test failed", "target", cfg.Targets[i], "err", errs[i])
+			code = 1
+			continue
+		}
+		// A failed target outweighs an interrupted one
+		switch c := printResults(out); {
+		case c == 1:
+			code = 1
+		case c != 0 && code == 0:
+			code = c
+		}
+	}
+	return code
+}
+
+// prefixWriter writes each complete line to w with prefix in front.
+// Writers sharing mu never interleave their lines.
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := fmt.Fprintf(p.w, "%s%s", p.prefix, p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
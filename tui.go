@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"LoadTester/config"
+	"LoadTester/metrics"
+)
+
+const (
+	ansiEnterAltScreen = "\033[?1049h\033[?25l"
+	ansiExitAltScreen  = "\033[?25h\033[?1049l"
+	ansiClearScreen    = "\033[H\033[2J"
+	ansiBold           = "\033[1m"
+	ansiRed            = "\033[31m"
+	ansiGreen          = "\033[32m"
+	ansiDim            = "\033[2m"
+	ansiReset          = "\033[0m"
+
+	dashboardEvents = 8 // lines of captured output shown on the dashboard
+)
+
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+// dashboard draws live stats on the terminal's alternate screen every
+// second. Anything the rest of the program prints to stdout meanwhile is
+// captured, shown in an events panel and replayed when the dashboard stops.
+type dashboard struct {
+	cfg    *config.Config
+	live   *metrics.Live
+	out    *os.File // the real stdout
+	pipe   *os.File
+	mu     sync.Mutex
+	events []string
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// startDashboard takes over the terminal and returns a function that
+// restores it
+func startDashboard(cfg *config.Config, live *metrics.Live) (stop func(), err error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	d := &dashboard{cfg: cfg, live: live, out: os.Stdout, pipe: w, done: make(chan struct{})}
+	os.Stdout = w
+
+	d.wg.Add(2)
+	go d.capture(r)
+	go d.loop()
+	fmt.Fprint(d.out, ansiEnterAltScreen)
+	return d.stop, nil
+}
+
+// capture collects lines printed to the redirected stdout
+func (d *dashboard) capture(r io.Reader) {
+	defer d.wg.Done()
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		d.mu.Lock()
+		d.events = append(d.events, sc.Text())
+		d.mu.Unlock()
+	}
+}
+
+func (d *dashboard) loop() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			d.draw(d.live.Tick())
+		}
+	}
+}
+
+func (d *dashboard) stop() {
+	close(d.done)
+	os.Stdout = d.out
+	d.pipe.Close()
+	d.wg.Wait()
+	fmt.Fprint(d.out, ansiExitAltScreen)
+	// Replay everything that was printed while the dashboard was up
+	for _, e := range d.events {
+		fmt.Fprintln(d.out, e)
+	}
+}
+
+func (d *dashboard) draw(s metrics.Snapshot) {
+	var b strings.Builder
+	b.WriteString(ansiClearScreen)
+	fmt.Fprintf(&b, "%sLoadTester%s  %s", ansiBold, ansiReset, d.cfg.TargetLabel())
+	if s.Paused {
+		fmt.Fprintf(&b, "  %s%sPAUSED%s", ansiBold, ansiRed, ansiReset)
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "%sRun %d/%d   elapsed %s   in-flight %d%s\n\n", ansiDim, s.Run, d.cfg.RepeatCount, s.Elapsed.Round(time.Second), s.InFlight, ansiReset)
+
+	errColor := ansiGreen
+	if s.ErrorRate > 0 {
+		errColor = ansiRed
+	}
+	fmt.Fprintf(&b, "  Throughput   %s%8.1f req/s%s\n", ansiBold, s.RPS, ansiReset)
+	fmt.Fprintf(&b, "  Completed    %8d\n", s.Requests)
+	fmt.Fprintf(&b, "  Succeeded    %s%8d%s\n", ansiGreen, s.Requests-s.Errors, ansiReset)
+	fmt.Fprintf(&b, "  Failed       %s%8d%s   (%s%.1f%%%s in the last second)\n", errColor, s.Errors, ansiReset, errColor, s.ErrorRate*100, ansiReset)
+	fmt.Fprintf(&b, "\n  Latency, last %ds   p50 %d ms   p95 %d ms   p99 %d ms\n", metrics.RollingWindow, s.P50, s.P95, s.P99)
+	fmt.Fprintf(&b, "  p95 per second      %s\n", sparkline(s.History))
+
+	d.mu.Lock()
+	events := d.events
+	if len(events) > dashboardEvents {
+		events = events[len(events)-dashboardEvents:]
+	}
+	b.WriteString("\n" + ansiDim + "Events" + ansiReset + "\n")
+	for _, e := range events {
+		b.WriteString("  " + e + "\n")
+	}
+	d.mu.Unlock()
+
+	fmt.Fprint(d.out, b.String())
+}
+
+// sparkline renders values as a row of block characters scaled to the max
+func sparkline(values []int64) string {
+	var hi int64
+	for _, v := range values {
+		hi = max(hi, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if hi > 0 {
+			i = int(v * int64(len(sparkChars)-1) / hi)
+		}
+		b.WriteRune(sparkChars[i])
+	}
+	if hi > 0 {
+		fmt.Fprintf(&b, " max %d ms", hi)
+	}
+	return b.String()
+}